@@ -3,6 +3,7 @@ module github.com/cjeanner/kustomap
 go 1.24.12
 
 require (
+	github.com/coder/websocket v1.8.14
 	github.com/go-chi/chi/v5 v5.2.4
 	github.com/google/go-github/v82 v82.0.0
 	github.com/google/uuid v1.6.0
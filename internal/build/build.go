@@ -100,10 +100,14 @@ func (b *Builder) downloadArchive(dir string, parts *NodeIDParts, baseURL string
 	var archiveURL string
 	var req *http.Request
 
+	// The API URL overrides only apply to github.com and gitlab.com
+	repo := &repository.RepositoryInfo{Type: parts.Type, BaseURL: baseURL}
 	switch parts.Type {
 	case repository.GitHub:
 		apiBase := "https://api.github.com"
-		if baseURL != "" {
+		if override := repository.APIURLOverride(repo); override != "" {
+			apiBase = override
+		} else if baseURL != "" {
 			if baseURL == "https://github.com" {
 				apiBase = "https://api.github.com"
 			} else {
@@ -116,9 +120,12 @@ func (b *Builder) downloadArchive(dir string, parts *NodeIDParts, baseURL string
 			req.Header.Set("Authorization", "Bearer "+b.githubToken)
 		}
 		req.Header.Set("Accept", "application/vnd.github.v3+json")
+		req.Header.Set("X-GitHub-Api-Version", repository.GitHubAPIVersion())
 	case repository.GitLab:
 		apiBase := "https://gitlab.com"
-		if baseURL != "" {
+		if override := repository.APIURLOverride(repo); override != "" {
+			apiBase = override
+		} else if baseURL != "" {
 			apiBase = strings.TrimSuffix(baseURL, "/")
 		}
 		projectID := parts.Owner + "%2F" + parts.Repo
@@ -3,10 +3,14 @@ package build
 import (
 	"archive/tar"
 	"compress/gzip"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
+
+	"github.com/cjeanner/kustomap/internal/repository"
 )
 
 func TestBuild_InvalidNodeID_ReturnsParseError(t *testing.T) {
@@ -139,3 +143,37 @@ func TestExtractTarGz_NoTopLevelDir_ReturnsError(t *testing.T) {
 		t.Errorf("extractTarGz() error = %v, want containing 'no top-level directory'", err)
 	}
 }
+
+func TestDownloadArchive_APIURLEnvOverride(t *testing.T) {
+	var paths []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		w.Write([]byte("archive"))
+	}))
+	defer srv.Close()
+
+	cases := []struct {
+		name, env, value string
+		parts            *NodeIDParts
+		baseURL          string
+		wantPath         string
+	}{
+		{"github.com", repository.GitHubAPIURLEnv, srv.URL + "/github/", &NodeIDParts{Type: repository.GitHub, Owner: "o", Repo: "r", Ref: "main"}, "https://github.com", "/github/repos/o/r/tarball/main"},
+		{"gitlab.com", repository.GitLabAPIURLEnv, srv.URL + "/api/v4", &NodeIDParts{Type: repository.GitLab, Owner: "g", Repo: "p", Ref: "main"}, "https://gitlab.com", "/api/v4/projects/g/p/repository/archive.tar.gz"},
+		// Other hosts keep their own API (and the token meant for it)
+		{"GitHub Enterprise", repository.GitHubAPIURLEnv, "http://override.invalid", &NodeIDParts{Type: repository.GitHub, Owner: "o", Repo: "r", Ref: "main"}, srv.URL, "/api/v3/repos/o/r/tarball/main"},
+		{"self-managed GitLab", repository.GitLabAPIURLEnv, "http://override.invalid", &NodeIDParts{Type: repository.GitLab, Owner: "g", Repo: "p", Ref: "main"}, srv.URL, "/api/v4/projects/g/p/repository/archive.tar.gz"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			t.Setenv(c.env, c.value)
+			paths = nil
+			if _, err := NewBuilder("", "").downloadArchive(t.TempDir(), c.parts, c.baseURL); err != nil {
+				t.Fatalf("downloadArchive: %v", err)
+			}
+			if len(paths) != 1 || paths[0] != c.wantPath {
+				t.Errorf("requested %v, want [%s]", paths, c.wantPath)
+			}
+		})
+	}
+}
@@ -8,9 +8,11 @@ import (
 )
 
 // NodeIDParts holds parsed components of a graph node ID.
-// Format: Type:Owner/Repo/Path@Ref (e.g. github:foo/bar/deploy/overlay@main)
+// Format: Type[@Host]:Owner/Repo/Path@Ref (e.g. github:foo/bar/deploy/overlay@main),
+// see repository.CanonicalNodeID.
 type NodeIDParts struct {
 	Type   repository.RepositoryType
+	Host   string // set for hosts other than github.com and gitlab.com, port included
 	Owner  string
 	Repo   string
 	Path   string
@@ -20,11 +22,16 @@ type NodeIDParts struct {
 // ParseNodeID parses a node ID into repo type, owner, repo, path and ref.
 // Returns an error if the format is invalid.
 func ParseNodeID(nodeID string) (*NodeIDParts, error) {
-	colon := strings.Index(nodeID, ":")
+	// The type prefix ends at the last ":" before owner/repo: a host may carry a port
+	head := nodeID
+	if slash := strings.Index(nodeID, "/"); slash >= 0 {
+		head = nodeID[:slash]
+	}
+	colon := strings.LastIndex(head, ":")
 	if colon <= 0 || colon == len(nodeID)-1 {
 		return nil, fmt.Errorf("invalid node ID: missing or invalid type prefix (expected type:owner/repo/path@ref)")
 	}
-	typStr := nodeID[:colon]
+	typStr, host, _ := strings.Cut(nodeID[:colon], "@")
 	rest := nodeID[colon+1:]
 
 	var repoType repository.RepositoryType
@@ -60,6 +67,7 @@ func ParseNodeID(nodeID string) (*NodeIDParts, error) {
 
 	return &NodeIDParts{
 		Type:  repoType,
+		Host:  host,
 		Owner: owner,
 		Repo:  repo,
 		Path:  strings.Trim(path, "/"),
@@ -72,6 +72,30 @@ func TestParseNodeID(t *testing.T) {
 				Ref:   "main",
 			},
 		},
+		{
+			name:   "self-hosted host",
+			nodeID: "gitlab@gitlab.corp.example:group/proj/base@main",
+			want: &NodeIDParts{
+				Type:  repository.GitLab,
+				Host:  "gitlab.corp.example",
+				Owner: "group",
+				Repo:  "proj",
+				Path:  "base",
+				Ref:   "main",
+			},
+		},
+		{
+			name:   "self-hosted host with port",
+			nodeID: "gitlab@gitlab.corp:8443:group/proj/base@main",
+			want: &NodeIDParts{
+				Type:  repository.GitLab,
+				Host:  "gitlab.corp:8443",
+				Owner: "group",
+				Repo:  "proj",
+				Path:  "base",
+				Ref:   "main",
+			},
+		},
 		{
 			name:    "empty ref",
 			nodeID:  "github:foo/bar/path@",
@@ -88,9 +112,31 @@ func TestParseNodeID(t *testing.T) {
 			if tt.wantErr {
 				return
 			}
-			if got.Type != tt.want.Type || got.Owner != tt.want.Owner || got.Repo != tt.want.Repo || got.Path != tt.want.Path || got.Ref != tt.want.Ref {
+			if got.Type != tt.want.Type || got.Host != tt.want.Host || got.Owner != tt.want.Owner || got.Repo != tt.want.Repo || got.Path != tt.want.Path || got.Ref != tt.want.Ref {
 				t.Errorf("ParseNodeID() = %+v, want %+v", got, tt.want)
 			}
 		})
 	}
 }
+
+func TestParseNodeID_CanonicalRoundTrip(t *testing.T) {
+	for _, repoInfo := range []*repository.RepositoryInfo{
+		{Type: repository.GitHub, Owner: "foo", Repo: "bar"},
+		{Type: repository.GitLab, BaseURL: "https://gitlab.corp.example", Owner: "group", Repo: "proj"},
+		{Type: repository.GitLab, BaseURL: "https://gitlab.corp:8443", Owner: "group", Repo: "proj"},
+	} {
+		id := repository.CanonicalNodeID(repoInfo, "main", "deploy/overlay")
+		got, err := ParseNodeID(id)
+		if err != nil {
+			t.Errorf("ParseNodeID(%q): %v", id, err)
+			continue
+		}
+		wantHost := ""
+		if repoInfo.BaseURL != "" {
+			wantHost = repoInfo.Host()
+		}
+		if got.Type != repoInfo.Type || got.Host != wantHost || got.Owner != repoInfo.Owner || got.Repo != repoInfo.Repo || got.Path != "deploy/overlay" || got.Ref != "main" {
+			t.Errorf("ParseNodeID(%q) = %+v", id, got)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package fetcher
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/cjeanner/kustomap/internal/repository"
+)
+
+// ArchiveFetcher reads files from a .tar.gz, .tar or .zip snapshot of a repository
+// (repository.Archive), loaded into memory once. Paths are relative to the archive root.
+type ArchiveFetcher struct {
+	info  *repository.RepositoryInfo
+	files map[string][]byte
+}
+
+// NewArchiveFetcher reads the archive file info.LocalRoot.
+func NewArchiveFetcher(info *repository.RepositoryInfo) (*ArchiveFetcher, error) {
+	if info.LocalRoot == "" {
+		return nil, fmt.Errorf("archive repository has no file path")
+	}
+	data, err := os.ReadFile(info.LocalRoot)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read archive: %w", err)
+	}
+	return NewArchiveFetcherFromBytes(info, data)
+}
+
+// NewArchiveFetcherFromBytes reads an archive held in memory. The format (zip,
+// gzip-compressed tar or plain tar) is detected from the content, not the file name.
+func NewArchiveFetcherFromBytes(info *repository.RepositoryInfo, data []byte) (*ArchiveFetcher, error) {
+	var files map[string][]byte
+	var err error
+	switch {
+	case bytes.HasPrefix(data, []byte("PK\x03\x04")):
+		files, err = readZip(data)
+	case bytes.HasPrefix(data, []byte{0x1f, 0x8b}):
+		var zr *gzip.Reader
+		if zr, err = gzip.NewReader(bytes.NewReader(data)); err == nil {
+			files, err = readTar(zr)
+		}
+	default:
+		files, err = readTar(bytes.NewReader(data))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read archive %s: %w", info.LocalRoot, err)
+	}
+
+	log.Printf("Loaded %d files from archive %s", len(files), info.LocalRoot)
+	return &ArchiveFetcher{info: info, files: files}, nil
+}
+
+// readTar returns the regular files of a tar stream by archive path
+func readTar(r io.Reader) (map[string][]byte, error) {
+	files := make(map[string][]byte)
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return files, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !hdr.FileInfo().Mode().IsRegular() {
+			continue
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", hdr.Name, err)
+		}
+		files[archivePath(hdr.Name)] = data
+	}
+}
+
+// readZip returns the regular files of a zip archive by archive path
+func readZip(data []byte) (map[string][]byte, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	files := make(map[string][]byte)
+	for _, zf := range zr.File {
+		if !zf.Mode().IsRegular() {
+			continue
+		}
+		rc, err := zf.Open()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", zf.Name, err)
+		}
+		content, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", zf.Name, err)
+		}
+		files[archivePath(zf.Name)] = content
+	}
+	return files, nil
+}
+
+// archivePath normalizes a path to its form inside the archive: slash-separated,
+// without leading "./" or "/", and never above the root.
+func archivePath(p string) string {
+	return strings.TrimPrefix(path.Clean("/"+p), "/")
+}
+
+// FetchFile retrieves a single file content
+func (f *ArchiveFetcher) FetchFile(filePath string) ([]byte, error) {
+	content, ok := f.files[archivePath(filePath)]
+	if !ok {
+		return nil, fmt.Errorf("failed to fetch file %s: %w", filePath, fs.ErrNotExist)
+	}
+	return content, nil
+}
+
+// ListFiles lists all files in the archive, outside .git directories
+func (f *ArchiveFetcher) ListFiles() ([]string, error) {
+	var allFiles []string
+	for name := range f.files {
+		if name == ".git" || strings.HasPrefix(name, ".git/") || strings.Contains(name, "/.git/") {
+			continue
+		}
+		allFiles = append(allFiles, name)
+	}
+	sort.Strings(allFiles)
+	return allFiles, nil
+}
+
+// FindKustomizationInPath finds kustomization.yaml in a specific path
+func (f *ArchiveFetcher) FindKustomizationInPath(dirPath string) (string, error) {
+	dirPath = strings.Trim(dirPath, "/")
+
+	if content, err := f.FetchFile(dirPath); err == nil {
+		return string(content), nil
+	}
+
+	for _, filename := range repository.KustomizationFilenames() {
+		if content, err := f.FetchFile(path.Join(dirPath, filename)); err == nil {
+			log.Printf("✅ Found kustomization file: %s", path.Join(dirPath, filename))
+			return string(content), nil
+		}
+	}
+
+	return "", fmt.Errorf("%w in path: %s", ErrKustomizationNotFound, dirPath)
+}
@@ -0,0 +1,122 @@
+package fetcher
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io/fs"
+	"testing"
+
+	"github.com/cjeanner/kustomap/internal/repository"
+)
+
+var archiveFiles = map[string]string{
+	"overlay/kustomization.yaml": "resources: [../base]\n",
+	"./base/kustomization.yml":   "resources: [deploy.yaml]\n",
+	"base/deploy.yaml":           "kind: Deployment\n",
+	".git/HEAD":                  "ref: refs/heads/main\n",
+}
+
+func tarGzArchive(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	if err := tw.WriteHeader(&tar.Header{Name: "overlay/", Typeflag: tar.TypeDir, Mode: 0o755}); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0o644, Size: int64(len(content))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func zipArchive(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestArchiveFetcher(t *testing.T) {
+	archives := map[string][]byte{
+		"tar.gz": tarGzArchive(t, archiveFiles),
+		"zip":    zipArchive(t, archiveFiles),
+	}
+	for format, data := range archives {
+		t.Run(format, func(t *testing.T) {
+			f, err := NewArchiveFetcherFromBytes(repository.NewArchiveRepository("/srv/manifests."+format), data)
+			if err != nil {
+				t.Fatalf("NewArchiveFetcherFromBytes: %v", err)
+			}
+
+			if got, err := f.FindKustomizationInPath("overlay"); err != nil || got != archiveFiles["overlay/kustomization.yaml"] {
+				t.Errorf("FindKustomizationInPath(overlay) = (%q, %v)", got, err)
+			}
+			if got, err := f.FindKustomizationInPath("/base/"); err != nil || got != archiveFiles["./base/kustomization.yml"] {
+				t.Errorf("FindKustomizationInPath(base) = (%q, %v)", got, err)
+			}
+			if got, err := f.FindKustomizationInPath("base/deploy.yaml"); err != nil || got != archiveFiles["base/deploy.yaml"] {
+				t.Errorf("FindKustomizationInPath(base/deploy.yaml) = (%q, %v)", got, err)
+			}
+			if _, err := f.FindKustomizationInPath("missing"); !errors.Is(err, ErrKustomizationNotFound) {
+				t.Errorf("FindKustomizationInPath(missing) err = %v, want ErrKustomizationNotFound", err)
+			}
+			if _, err := f.FetchFile("../base/deploy.yaml"); err != nil {
+				t.Errorf("FetchFile(../base/deploy.yaml) should stay inside the archive root: %v", err)
+			}
+			if _, err := f.FetchFile("overlay"); !errors.Is(err, fs.ErrNotExist) {
+				t.Errorf("FetchFile(overlay) err = %v, want fs.ErrNotExist for a directory", err)
+			}
+
+			listed, err := f.ListFiles()
+			if err != nil {
+				t.Fatalf("ListFiles: %v", err)
+			}
+			want := []string{"base/deploy.yaml", "base/kustomization.yml", "overlay/kustomization.yaml"}
+			if len(listed) != len(want) {
+				t.Fatalf("ListFiles() = %v, want %v", listed, want)
+			}
+			for i := range want {
+				if listed[i] != want[i] {
+					t.Errorf("ListFiles()[%d] = %q, want %q", i, listed[i], want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestArchiveFetcher_Invalid(t *testing.T) {
+	info := repository.NewArchiveRepository("/srv/broken.tar.gz")
+	if _, err := NewArchiveFetcherFromBytes(info, []byte{0x1f, 0x8b, 0, 0}); err == nil {
+		t.Error("NewArchiveFetcherFromBytes(truncated gzip) should error")
+	}
+	if _, err := NewFetcher(repository.NewArchiveRepository(t.TempDir()+"/missing.zip"), ""); err == nil {
+		t.Error("NewFetcher(missing archive) should error")
+	}
+}
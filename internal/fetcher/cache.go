@@ -0,0 +1,50 @@
+package fetcher
+
+import (
+	"strings"
+
+	"github.com/cjeanner/kustomap/internal/repository"
+)
+
+// CachingFetcher is a Fetcher reusing the file contents and kustomization files it
+// found from a repository.ContentCache, keyed by the repository and ref of info and
+// the token f fetches with. Failures aren't cached.
+type CachingFetcher struct {
+	Fetcher
+	info  *repository.RepositoryInfo
+	token string
+	cache *repository.ContentCache
+}
+
+// NewCachingFetcher wraps f, fetching from info with token, with cache.
+func NewCachingFetcher(f Fetcher, info *repository.RepositoryInfo, token string, cache *repository.ContentCache) *CachingFetcher {
+	return &CachingFetcher{Fetcher: f, info: info, token: token, cache: cache}
+}
+
+// FetchFile retrieves a single file content, from the cache when present
+func (f *CachingFetcher) FetchFile(path string) ([]byte, error) {
+	key := repository.ContentCacheKey(f.info, f.info.Ref, strings.Trim(path, "/"), f.token)
+	if content, ok := f.cache.Get(key); ok {
+		return content, nil
+	}
+	content, err := f.Fetcher.FetchFile(path)
+	if err == nil {
+		f.cache.Add(key, content)
+	}
+	return content, err
+}
+
+// FindKustomizationInPath finds the kustomization file of a specific path, from the
+// cache when present. It is cached under the path with a trailing "/", apart from
+// the file contents of FetchFile.
+func (f *CachingFetcher) FindKustomizationInPath(path string) (string, error) {
+	key := repository.ContentCacheKey(f.info, f.info.Ref, strings.Trim(path, "/")+"/", f.token)
+	if content, ok := f.cache.Get(key); ok {
+		return string(content), nil
+	}
+	content, err := f.Fetcher.FindKustomizationInPath(path)
+	if err == nil {
+		f.cache.Add(key, []byte(content))
+	}
+	return content, err
+}
@@ -0,0 +1,85 @@
+package fetcher
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/cjeanner/kustomap/internal/repository"
+)
+
+// countingFetcher serves files from a path -> content map and counts the calls.
+type countingFetcher struct {
+	files map[string]string
+	calls int
+}
+
+func (f *countingFetcher) FetchFile(path string) ([]byte, error) {
+	f.calls++
+	if content, ok := f.files[path]; ok {
+		return []byte(content), nil
+	}
+	return nil, errors.New("file not found: " + path)
+}
+
+func (f *countingFetcher) ListFiles() ([]string, error) {
+	return nil, nil
+}
+
+func (f *countingFetcher) FindKustomizationInPath(path string) (string, error) {
+	f.calls++
+	if content, ok := f.files[path+"/kustomization.yaml"]; ok {
+		return content, nil
+	}
+	return "", ErrKustomizationNotFound
+}
+
+func TestCachingFetcher(t *testing.T) {
+	info := &repository.RepositoryInfo{Type: repository.GitHub, Owner: "o", Repo: "r", Ref: "main"}
+	underlying := &countingFetcher{files: map[string]string{
+		"base/kustomization.yaml": "resources: []\n",
+		"base/deploy.yaml":        "kind: Deployment\n",
+	}}
+	cache := repository.NewContentCache(1<<10, time.Minute)
+	f := NewCachingFetcher(underlying, info, "secret", cache)
+
+	for range 2 {
+		if got, err := f.FindKustomizationInPath("base"); err != nil || got != "resources: []\n" {
+			t.Fatalf("FindKustomizationInPath = %q, %v", got, err)
+		}
+		if got, err := f.FetchFile("base/deploy.yaml"); err != nil || string(got) != "kind: Deployment\n" {
+			t.Fatalf("FetchFile = %q, %v", got, err)
+		}
+	}
+	if underlying.calls != 2 {
+		t.Errorf("underlying calls = %d, want 2 (second fetches from the cache)", underlying.calls)
+	}
+
+	// Another ref of the same repository has its own entries
+	other := NewCachingFetcher(underlying, &repository.RepositoryInfo{Type: repository.GitHub, Owner: "o", Repo: "r", Ref: "v1"}, "secret", cache)
+	if _, err := other.FetchFile("base/deploy.yaml"); err != nil {
+		t.Fatalf("FetchFile(v1): %v", err)
+	}
+	if underlying.calls != 3 {
+		t.Errorf("underlying calls = %d, want 3 (different ref)", underlying.calls)
+	}
+
+	// Contents fetched with a token aren't served to anonymous callers
+	anonymous := NewCachingFetcher(underlying, info, "", cache)
+	if _, err := anonymous.FetchFile("base/deploy.yaml"); err != nil {
+		t.Fatalf("FetchFile(anonymous): %v", err)
+	}
+	if underlying.calls != 4 {
+		t.Errorf("underlying calls = %d, want 4 (anonymous fetch misses the authenticated entry)", underlying.calls)
+	}
+
+	// Failures are fetched again
+	for range 2 {
+		if _, err := f.FindKustomizationInPath("missing"); !errors.Is(err, ErrKustomizationNotFound) {
+			t.Fatalf("FindKustomizationInPath(missing) error = %v, want ErrKustomizationNotFound", err)
+		}
+	}
+	if underlying.calls != 6 {
+		t.Errorf("underlying calls = %d, want 6 (failures not cached)", underlying.calls)
+	}
+}
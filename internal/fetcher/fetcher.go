@@ -1,11 +1,17 @@
 package fetcher
 
 import (
+	"context"
+	"errors"
 	"fmt"
 
 	"github.com/cjeanner/kustomap/internal/repository"
 )
 
+// ErrKustomizationNotFound is returned (wrapped) by FindKustomizationInPath when the
+// path holds no kustomization file (e.g. the path 404s on the remote).
+var ErrKustomizationNotFound = errors.New("no kustomization file found")
+
 // Fetcher interface for retrieving files from remote repositories
 type Fetcher interface {
 	// FetchFile retrieves a single file content
@@ -20,11 +26,32 @@ type Fetcher interface {
 
 // NewFetcher creates the appropriate fetcher based on repository type
 func NewFetcher(info *repository.RepositoryInfo, token string) (Fetcher, error) {
+	return NewFetcherContext(context.Background(), info, token)
+}
+
+// NewFetcherContext is NewFetcher with a context passed to every API call the
+// fetcher makes (e.g. one from repository.WithAPICallLog). GitHub and GitLab
+// contents are reused from repository.SharedContentCache.
+func NewFetcherContext(ctx context.Context, info *repository.RepositoryInfo, token string) (Fetcher, error) {
 	switch info.Type {
 	case repository.GitHub:
-		return NewGitHubFetcher(info, token)
+		f, err := NewGitHubFetcher(info, token)
+		if err != nil {
+			return nil, err
+		}
+		f.ctx = ctx
+		return NewCachingFetcher(f, info, token, repository.SharedContentCache()), nil
 	case repository.GitLab:
-		return NewGitLabFetcher(info, token)
+		f, err := NewGitLabFetcher(info, token)
+		if err != nil {
+			return nil, err
+		}
+		f.ctx = ctx
+		return NewCachingFetcher(f, info, token, repository.SharedContentCache()), nil
+	case repository.Local:
+		return NewLocalFetcher(info)
+	case repository.Archive:
+		return NewArchiveFetcher(info)
 	default:
 		return nil, fmt.Errorf("unsupported repository type: %s", info.Type)
 	}
@@ -39,3 +39,18 @@ func TestNewFetcher_Unsupported(t *testing.T) {
 		t.Fatal("NewFetcher(Unknown) should error")
 	}
 }
+
+func TestNewFetcher_Local(t *testing.T) {
+	f, err := NewFetcher(repository.NewLocalRepository(t.TempDir()), "")
+	if err != nil {
+		t.Fatalf("NewFetcher(Local): %v", err)
+	}
+	if _, ok := f.(*LocalFetcher); !ok {
+		t.Fatalf("NewFetcher(Local) = %T, want *LocalFetcher", f)
+	}
+
+	_, err = NewFetcher(&repository.RepositoryInfo{Type: repository.Local}, "")
+	if err == nil {
+		t.Fatal("NewFetcher(Local) without root should error")
+	}
+}
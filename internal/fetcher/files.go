@@ -0,0 +1,83 @@
+package fetcher
+
+import (
+	"log"
+	"strings"
+
+	"github.com/cjeanner/kustomap/internal/repository"
+)
+
+// FileFetcher downloads a single file at a ref. Used for testing so FetchFile can be
+// tested without calling real GitHub/GitLab APIs (mirrors repository.RefLister).
+type FileFetcher interface {
+	FetchFile(repoInfo *repository.RepositoryInfo, ref, path, token string) ([]byte, error)
+}
+
+// testFileFetcher is set by tests to mock file downloads. When non-nil,
+// FetchFile uses it instead of the fetcher of the repository.
+var testFileFetcher FileFetcher
+
+// SetTestFileFetcher sets the FileFetcher used by FetchFile. Only for tests;
+// call with nil to restore real API behavior. The content cache is cleared so
+// files from a previous fetcher are not reused.
+func SetTestFileFetcher(f FileFetcher) {
+	testFileFetcher = f
+	repository.ClearContentCache()
+}
+
+// FetchFile downloads path at ref (repoInfo.Ref when ref is empty) with the fetcher
+// of the repository (see NewFetcher), so GitHub and GitLab contents are reused from
+// repository.SharedContentCache. When path is a directory, the kustomization file
+// inside it is returned: kustomization.yaml, kustomization.yml, then Kustomization.
+func FetchFile(repoInfo *repository.RepositoryInfo, ref, path, token string) ([]byte, error) {
+	info := *repoInfo
+	if ref != "" {
+		info.Ref = ref
+	}
+	f, err := newFileFetcher(&info, token)
+	if err != nil {
+		return nil, err
+	}
+	path = strings.Trim(path, "/")
+
+	content, err := f.FetchFile(path)
+	if err == nil {
+		return content, nil
+	}
+
+	// Not a file: look for a kustomization file in the directory
+	for _, name := range repository.KustomizationFilenames() {
+		filePath := name
+		if path != "" {
+			filePath = path + "/" + name
+		}
+		if content, ferr := f.FetchFile(filePath); ferr == nil {
+			log.Printf("Found kustomization file: %s", filePath)
+			return content, nil
+		}
+	}
+	return nil, err
+}
+
+// newFileFetcher returns the Fetcher FetchFile downloads from info with: the test
+// FileFetcher behind the shared content cache when set, else NewFetcher's.
+func newFileFetcher(info *repository.RepositoryInfo, token string) (Fetcher, error) {
+	if testFileFetcher == nil {
+		return NewFetcher(info, token)
+	}
+	f := &fileFetcherAdapter{files: testFileFetcher, info: info, token: token}
+	return NewCachingFetcher(f, info, token, repository.SharedContentCache()), nil
+}
+
+// fileFetcherAdapter is the Fetcher of a FileFetcher at info's ref. Only FetchFile is
+// implemented: it is all FetchFile uses.
+type fileFetcherAdapter struct {
+	Fetcher
+	files FileFetcher
+	info  *repository.RepositoryInfo
+	token string
+}
+
+func (f *fileFetcherAdapter) FetchFile(path string) ([]byte, error) {
+	return f.files.FetchFile(f.info, f.info.Ref, path, f.token)
+}
@@ -0,0 +1,149 @@
+package fetcher
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/cjeanner/kustomap/internal/repository"
+)
+
+// mockFileFetcher serves files from a path -> content map and records requested paths.
+type mockFileFetcher struct {
+	files     map[string]string
+	requested []string
+	refs      []string
+}
+
+func (m *mockFileFetcher) FetchFile(_ *repository.RepositoryInfo, ref, path, _ string) ([]byte, error) {
+	m.requested = append(m.requested, path)
+	m.refs = append(m.refs, ref)
+	if content, ok := m.files[path]; ok {
+		return []byte(content), nil
+	}
+	return nil, fmt.Errorf("file not found: %s", path)
+}
+
+func TestFetchFile_WithMock(t *testing.T) {
+	repoInfo := &repository.RepositoryInfo{Type: repository.GitHub, Owner: "owner", Repo: "repo", Ref: "main"}
+
+	cases := []struct {
+		name          string
+		files         map[string]string
+		ref           string
+		path          string
+		want          string
+		wantRequested []string
+		wantRef       string
+		wantErr       bool
+	}{
+		{
+			name:          "file",
+			files:         map[string]string{"base/deploy.yaml": "kind: Deployment\n"},
+			path:          "base/deploy.yaml",
+			want:          "kind: Deployment\n",
+			wantRequested: []string{"base/deploy.yaml"},
+			wantRef:       "main",
+		},
+		{
+			name:          "directory with kustomization.yaml",
+			files:         map[string]string{"base/kustomization.yaml": "resources: []\n", "base/kustomization.yml": "other"},
+			ref:           "v1.0",
+			path:          "/base/",
+			want:          "resources: []\n",
+			wantRequested: []string{"base", "base/kustomization.yaml"},
+			wantRef:       "v1.0",
+		},
+		{
+			name:          "directory with Kustomization",
+			files:         map[string]string{"Kustomization": "resources: []\n"},
+			path:          "",
+			want:          "resources: []\n",
+			wantRequested: []string{"", "kustomization.yaml", "kustomization.yml", "Kustomization"},
+			wantRef:       "main",
+		},
+		{
+			name:          "missing",
+			files:         map[string]string{},
+			path:          "missing",
+			wantRequested: []string{"missing", "missing/kustomization.yaml", "missing/kustomization.yml", "missing/Kustomization"},
+			wantRef:       "main",
+			wantErr:       true,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			mock := &mockFileFetcher{files: c.files}
+			SetTestFileFetcher(mock)
+			defer SetTestFileFetcher(nil)
+
+			got, err := FetchFile(repoInfo, c.ref, c.path, "")
+			if (err != nil) != c.wantErr {
+				t.Fatalf("FetchFile error = %v, wantErr %v", err, c.wantErr)
+			}
+			if string(got) != c.want {
+				t.Errorf("FetchFile = %q, want %q", got, c.want)
+			}
+			if !reflect.DeepEqual(mock.requested, c.wantRequested) {
+				t.Errorf("requested = %q, want %q", mock.requested, c.wantRequested)
+			}
+			if mock.refs[0] != c.wantRef {
+				t.Errorf("ref = %q, want %q", mock.refs[0], c.wantRef)
+			}
+		})
+	}
+}
+
+func TestFetchFile_GitLab(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/v4/projects/group/project/repository/files/base/kustomization.yml" &&
+			r.URL.Query().Get("ref") == "main" {
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprintf(w, `{"file_path":"base/kustomization.yml","encoding":"base64","content":%q}`,
+				base64.StdEncoding.EncodeToString([]byte("resources: []\n")))
+			return
+		}
+		http.Error(w, `{"message":"404 File Not Found"}`, http.StatusNotFound)
+	}))
+	defer srv.Close()
+	repository.ClearContentCache()
+
+	repoInfo := &repository.RepositoryInfo{Type: repository.GitLab, Owner: "group", Repo: "project", Ref: "main", BaseURL: srv.URL}
+	got, err := FetchFile(repoInfo, "", "base", "")
+	if err != nil {
+		t.Fatalf("FetchFile: %v", err)
+	}
+	if string(got) != "resources: []\n" {
+		t.Errorf("FetchFile = %q, want the kustomization.yml content", got)
+	}
+
+	if _, err := FetchFile(repoInfo, "", "missing", ""); err == nil {
+		t.Error("FetchFile(missing) expected error, got nil")
+	}
+}
+
+func TestFetchFile_UsesContentCache(t *testing.T) {
+	mock := &mockFileFetcher{files: map[string]string{"base/kustomization.yaml": "resources: []\n"}}
+	SetTestFileFetcher(mock)
+	defer SetTestFileFetcher(nil)
+
+	repoInfo := &repository.RepositoryInfo{Type: repository.GitHub, Owner: "owner", Repo: "repo", Ref: "main"}
+	for range 2 {
+		if got, err := FetchFile(repoInfo, "", "base/kustomization.yaml", ""); err != nil || string(got) != "resources: []\n" {
+			t.Fatalf("FetchFile = %q, %v", got, err)
+		}
+	}
+	if len(mock.requested) != 1 {
+		t.Errorf("requested = %q, want a single download", mock.requested)
+	}
+
+	if _, err := FetchFile(repoInfo, "v1", "base/kustomization.yaml", ""); err != nil {
+		t.Fatalf("FetchFile(v1): %v", err)
+	}
+	if len(mock.requested) != 2 {
+		t.Errorf("requested = %q, want another ref downloaded again", mock.requested)
+	}
+}
@@ -2,8 +2,10 @@ package fetcher
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"net/http"
 	"strings"
 
 	"github.com/cjeanner/kustomap/internal/repository"
@@ -19,15 +21,8 @@ type GitHubFetcher struct {
 func NewGitHubFetcher(info *repository.RepositoryInfo, token string) (*GitHubFetcher, error) {
 	ctx := context.Background()
 
-	var client *github.Client
-	if token != "" {
-		client = github.NewClient(nil).WithAuthToken(token)
-	} else {
-		client = github.NewClient(nil)
-	}
-
 	return &GitHubFetcher{
-		client: client,
+		client: repository.NewGitHubClient(info, token),
 		info:   info,
 		ctx:    ctx,
 	}, nil
@@ -90,7 +85,9 @@ func (f *GitHubFetcher) ListFiles() ([]string, error) {
 	return files, nil
 }
 
-// FindKustomizationInPath finds kustomization.yaml in a specific path
+// FindKustomizationInPath finds the kustomization file of a specific path: path itself
+// when it is a file, else the first of repository.KustomizationFilenames() found in
+// it. Only a 404 moves on to the next name; other API errors are returned as is.
 func (f *GitHubFetcher) FindKustomizationInPath(path string) (string, error) {
 	// Normalize path
 	path = strings.Trim(path, "/")
@@ -101,14 +98,8 @@ func (f *GitHubFetcher) FindKustomizationInPath(path string) (string, error) {
 		return string(content), nil
 	}
 
-	// Try common kustomization file names
-	kustomizationFiles := []string{
-		"kustomization.yaml",
-		"kustomization.yml",
-		"Kustomization",
-	}
-
-	for _, filename := range kustomizationFiles {
+	// Try the kustomization file names, in kustomize's order
+	for _, filename := range repository.KustomizationFilenames() {
 		var fullPath string
 		if path == "" {
 			fullPath = filename
@@ -123,7 +114,16 @@ func (f *GitHubFetcher) FindKustomizationInPath(path string) (string, error) {
 			log.Printf("✅ Found kustomization file: %s", fullPath)
 			return string(content), nil
 		}
+		if !isNotFound(err) {
+			return "", err
+		}
 	}
 
-	return "", fmt.Errorf("no kustomization file found in path: %s", strings.Clone(path))
+	return "", fmt.Errorf("%w in path: %s", ErrKustomizationNotFound, strings.Clone(path))
+}
+
+// isNotFound reports whether err is a 404 from the GitHub API.
+func isNotFound(err error) bool {
+	var ghErr *github.ErrorResponse
+	return errors.As(err, &ghErr) && ghErr.Response != nil && ghErr.Response.StatusCode == http.StatusNotFound
 }
@@ -0,0 +1,109 @@
+package fetcher
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/cjeanner/kustomap/internal/repository"
+)
+
+// contentsTransport answers GitHub Contents API calls from a path -> content map
+// (404 otherwise) and records the requested paths.
+type contentsTransport struct {
+	files     map[string]string
+	status    map[string]int // status of paths not in files, instead of 404
+	requested []string
+}
+
+func (c *contentsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	path := strings.TrimPrefix(req.URL.Path, "/repos/o/r/contents/")
+	c.requested = append(c.requested, path)
+	status, body := http.StatusNotFound, `{"message":"Not Found"}`
+	if code, ok := c.status[path]; ok {
+		status, body = code, `{"message":"Bad credentials"}`
+	}
+	if content, ok := c.files[path]; ok {
+		status = http.StatusOK
+		body = fmt.Sprintf(`{"type":"file","encoding":"base64","path":%q,"content":%q}`,
+			path, base64.StdEncoding.EncodeToString([]byte(content)))
+	}
+	return &http.Response{
+		StatusCode: status,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       io.NopCloser(strings.NewReader(body)),
+		Request:    req,
+	}, nil
+}
+
+func TestGitHubFetcher_FindKustomizationInPath_YML(t *testing.T) {
+	transport := &contentsTransport{files: map[string]string{"base/kustomization.yml": "resources: []\n"}}
+	repository.SetTestTransport(transport)
+	defer repository.SetTestTransport(nil)
+
+	f, err := NewGitHubFetcher(&repository.RepositoryInfo{
+		Type: repository.GitHub, Owner: "o", Repo: "r", Ref: "main", BaseURL: "https://github.com",
+	}, "")
+	if err != nil {
+		t.Fatalf("NewGitHubFetcher: %v", err)
+	}
+
+	got, err := f.FindKustomizationInPath("base")
+	if err != nil {
+		t.Fatalf("FindKustomizationInPath: %v", err)
+	}
+	if got != "resources: []\n" {
+		t.Errorf("FindKustomizationInPath = %q, want the kustomization.yml content", got)
+	}
+	want := []string{"base", "base/kustomization.yaml", "base/kustomization.yml"}
+	if strings.Join(transport.requested, ",") != strings.Join(want, ",") {
+		t.Errorf("requested = %q, want %q", transport.requested, want)
+	}
+}
+
+// TestGitHubFetcher_FindKustomizationInPath_Fallback ensures each kustomization file name
+// is tried in turn on 404s, and that other API errors aren't reported as a missing file.
+func TestGitHubFetcher_FindKustomizationInPath_Fallback(t *testing.T) {
+	transport := &contentsTransport{}
+	repository.SetTestTransport(transport)
+	defer repository.SetTestTransport(nil)
+
+	f, err := NewGitHubFetcher(&repository.RepositoryInfo{
+		Type: repository.GitHub, Owner: "o", Repo: "r", Ref: "main", BaseURL: "https://github.com",
+	}, "")
+	if err != nil {
+		t.Fatalf("NewGitHubFetcher: %v", err)
+	}
+
+	transport.files = map[string]string{"base/Kustomization": "resources: []\n"}
+	got, err := f.FindKustomizationInPath("base")
+	if err != nil {
+		t.Fatalf("FindKustomizationInPath: %v", err)
+	}
+	if got != "resources: []\n" {
+		t.Errorf("FindKustomizationInPath = %q, want the Kustomization content", got)
+	}
+	want := []string{"base", "base/kustomization.yaml", "base/kustomization.yml", "base/Kustomization"}
+	if strings.Join(transport.requested, ",") != strings.Join(want, ",") {
+		t.Errorf("requested = %q, want %q", transport.requested, want)
+	}
+
+	transport.files, transport.requested = nil, nil
+	if _, err := f.FindKustomizationInPath("base"); !errors.Is(err, ErrKustomizationNotFound) {
+		t.Errorf("no kustomization file: err = %v, want ErrKustomizationNotFound", err)
+	}
+
+	transport.requested = nil
+	transport.status = map[string]int{"base/kustomization.yaml": http.StatusUnauthorized}
+	_, err = f.FindKustomizationInPath("base")
+	if err == nil || errors.Is(err, ErrKustomizationNotFound) {
+		t.Errorf("401: err = %v, want the API error", err)
+	}
+	if want := []string{"base", "base/kustomization.yaml"}; strings.Join(transport.requested, ",") != strings.Join(want, ",") {
+		t.Errorf("401: requested = %q, want %q", transport.requested, want)
+	}
+}
@@ -1,6 +1,7 @@
 package fetcher
 
 import (
+	"context"
 	"encoding/base64"
 	"fmt"
 	"log"
@@ -14,21 +15,14 @@ type GitLabFetcher struct {
 	client    *gitlab.Client
 	info      *repository.RepositoryInfo
 	projectID string
+	ctx       context.Context
 }
 
 func NewGitLabFetcher(info *repository.RepositoryInfo, token string) (*GitLabFetcher, error) {
 	// Create GitLab client
-	var client *gitlab.Client
-	var err error
-
-	if token != "" {
-		client, err = gitlab.NewClient(token, gitlab.WithBaseURL(info.BaseURL+"/api/v4"))
-	} else {
-		client, err = gitlab.NewClient("", gitlab.WithBaseURL(info.BaseURL+"/api/v4"))
-	}
-
+	client, err := repository.NewGitLabClient(info, token)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create GitLab client: %w", err)
+		return nil, err
 	}
 
 	// GitLab uses "owner/repo" as project ID
@@ -38,6 +32,7 @@ func NewGitLabFetcher(info *repository.RepositoryInfo, token string) (*GitLabFet
 		client:    client,
 		info:      info,
 		projectID: projectID,
+		ctx:       context.Background(),
 	}, nil
 }
 
@@ -52,6 +47,7 @@ func (f *GitLabFetcher) FetchFile(path string) ([]byte, error) {
 		&gitlab.GetFileOptions{
 			Ref: gitlab.Ptr(f.info.Ref),
 		},
+		gitlab.WithContext(f.ctx),
 	)
 
 	if err != nil {
@@ -84,7 +80,7 @@ func (f *GitLabFetcher) ListFiles() ([]string, error) {
 	var allFiles []string
 
 	for {
-		tree, resp, err := f.client.Repositories.ListTree(f.projectID, opts)
+		tree, resp, err := f.client.Repositories.ListTree(f.projectID, opts, gitlab.WithContext(f.ctx))
 		if err != nil {
 			return nil, fmt.Errorf("failed to list repository tree: %w", err)
 		}
@@ -106,20 +102,21 @@ func (f *GitLabFetcher) ListFiles() ([]string, error) {
 	return allFiles, nil
 }
 
-// kustomizationFilenamesLower are known kustomization file names (lowercase for matching).
-var kustomizationFilenamesLower = map[string]bool{
-	"kustomization.yaml": true,
-	"kustomization.yml":  true,
-	"kustomization":      true,
-}
-
-func isKustomizationFileName(name string) bool {
-	return kustomizationFilenamesLower[strings.ToLower(name)]
+// kustomizationFileRank returns the position of name (case-insensitive) in
+// repository.KustomizationFilenames(), or -1 when it isn't a kustomization file.
+func kustomizationFileRank(name string) int {
+	for i, candidate := range repository.KustomizationFilenames() {
+		if strings.EqualFold(name, candidate) {
+			return i
+		}
+	}
+	return -1
 }
 
 // FindKustomizationInPath finds kustomization.yaml in a specific path.
 // It tries the path as a file first, then lists the directory (when path is a directory)
-// and picks a kustomization file by name (case-insensitive), matching GitHub fetcher behavior.
+// and picks a kustomization file by name (case-insensitive), in the order of
+// repository.KustomizationFilenames(), matching GitHub fetcher behavior.
 func (f *GitLabFetcher) FindKustomizationInPath(path string) (string, error) {
 	path = strings.Trim(path, "/")
 
@@ -136,8 +133,9 @@ func (f *GitLabFetcher) FindKustomizationInPath(path string) (string, error) {
 		Recursive:   gitlab.Ptr(false),
 		ListOptions: gitlab.ListOptions{PerPage: 100, Page: 1},
 	}
-	tree, _, err := f.client.Repositories.ListTree(f.projectID, opts)
+	tree, _, err := f.client.Repositories.ListTree(f.projectID, opts, gitlab.WithContext(f.ctx))
 	if err == nil {
+		candidates := make([]string, len(repository.KustomizationFilenames())) // file path by rank
 		for _, node := range tree {
 			if node.Type != "blob" {
 				continue
@@ -147,7 +145,8 @@ func (f *GitLabFetcher) FindKustomizationInPath(path string) (string, error) {
 				parts := strings.Split(node.Path, "/")
 				name = parts[len(parts)-1]
 			}
-			if !isKustomizationFileName(name) {
+			rank := kustomizationFileRank(name)
+			if rank < 0 || candidates[rank] != "" {
 				continue
 			}
 			filePath := node.Path
@@ -158,6 +157,12 @@ func (f *GitLabFetcher) FindKustomizationInPath(path string) (string, error) {
 					filePath = name
 				}
 			}
+			candidates[rank] = filePath
+		}
+		for _, filePath := range candidates {
+			if filePath == "" {
+				continue
+			}
 			content, err := f.FetchFile(filePath)
 			if err == nil {
 				log.Printf("✅ Found kustomization file: %s", filePath)
@@ -166,5 +171,5 @@ func (f *GitLabFetcher) FindKustomizationInPath(path string) (string, error) {
 		}
 	}
 
-	return "", fmt.Errorf("no kustomization file found in path: %s", strings.Clone(path))
+	return "", fmt.Errorf("%w in path: %s", ErrKustomizationNotFound, strings.Clone(path))
 }
@@ -0,0 +1,54 @@
+package fetcher
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/cjeanner/kustomap/internal/repository"
+)
+
+// TestGitLabFetcher_FindKustomizationInPath_Order ensures the directory listing is
+// matched in repository.KustomizationFilenames() order, not listing order.
+func TestGitLabFetcher_FindKustomizationInPath_Order(t *testing.T) {
+	files := map[string]string{
+		"base/Kustomization":     "bare",
+		"base/kustomization.yml": "yml",
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/repository/tree"):
+			fmt.Fprint(w, `[{"name":"Kustomization","path":"base/Kustomization","type":"blob"},`+
+				`{"name":"kustomization.yml","path":"base/kustomization.yml","type":"blob"}]`)
+		case strings.Contains(r.URL.Path, "/repository/files/"):
+			name := strings.TrimPrefix(r.URL.Path, "/api/v4/projects/o/r/repository/files/")
+			content, ok := files[name]
+			if !ok {
+				http.Error(w, `{"message":"404 File Not Found"}`, http.StatusNotFound)
+				return
+			}
+			fmt.Fprintf(w, `{"file_path":%q,"encoding":"base64","content":%q}`, name, base64.StdEncoding.EncodeToString([]byte(content)))
+		default:
+			http.Error(w, `{"message":"404 Not Found"}`, http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	f, err := NewGitLabFetcher(&repository.RepositoryInfo{
+		Type: repository.GitLab, Owner: "o", Repo: "r", Ref: "main", BaseURL: srv.URL,
+	}, "")
+	if err != nil {
+		t.Fatalf("NewGitLabFetcher: %v", err)
+	}
+	got, err := f.FindKustomizationInPath("base")
+	if err != nil {
+		t.Fatalf("FindKustomizationInPath: %v", err)
+	}
+	if got != "yml" {
+		t.Errorf("FindKustomizationInPath = %q, want kustomization.yml content", got)
+	}
+}
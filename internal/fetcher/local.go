@@ -0,0 +1,95 @@
+package fetcher
+
+import (
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/cjeanner/kustomap/internal/repository"
+)
+
+// LocalFetcher reads files from a checkout on disk (repository.Local).
+// Paths are relative to the repository root and may use "../" to reach siblings.
+type LocalFetcher struct {
+	info *repository.RepositoryInfo
+}
+
+func NewLocalFetcher(info *repository.RepositoryInfo) (*LocalFetcher, error) {
+	if info.LocalRoot == "" {
+		return nil, fmt.Errorf("local repository has no root path")
+	}
+	return &LocalFetcher{info: info}, nil
+}
+
+// fullPath returns the on-disk path of a repository-relative path
+func (f *LocalFetcher) fullPath(path string) string {
+	return filepath.Join(f.info.LocalRoot, filepath.FromSlash(path))
+}
+
+// FetchFile retrieves a single file content
+func (f *LocalFetcher) FetchFile(path string) ([]byte, error) {
+	fullPath := f.fullPath(path)
+	log.Printf("Reading local file: %s", fullPath)
+
+	info, err := os.Stat(fullPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch file %s: %w", path, err)
+	}
+	if info.IsDir() {
+		return nil, fmt.Errorf("file not found: %s", path)
+	}
+	return os.ReadFile(fullPath)
+}
+
+// ListFiles lists all files recursively under the repository root
+func (f *LocalFetcher) ListFiles() ([]string, error) {
+	log.Printf("Listing local files: %s", f.info.LocalRoot)
+
+	var allFiles []string
+	err := filepath.WalkDir(f.info.LocalRoot, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if d.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(f.info.LocalRoot, p)
+		if err != nil {
+			return err
+		}
+		allFiles = append(allFiles, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list local files: %w", err)
+	}
+
+	log.Printf("Found %d files in %s", len(allFiles), f.info.LocalRoot)
+	return allFiles, nil
+}
+
+// FindKustomizationInPath finds kustomization.yaml in a specific path
+func (f *LocalFetcher) FindKustomizationInPath(path string) (string, error) {
+	path = strings.Trim(path, "/")
+
+	content, err := f.FetchFile(path)
+	if err == nil {
+		return string(content), nil
+	}
+
+	for _, filename := range repository.KustomizationFilenames() {
+		content, err := f.FetchFile(filepath.ToSlash(filepath.Join(path, filename)))
+		if err == nil {
+			log.Printf("✅ Found kustomization file: %s", filepath.Join(path, filename))
+			return string(content), nil
+		}
+	}
+
+	return "", fmt.Errorf("%w in path: %s", ErrKustomizationNotFound, path)
+}
@@ -0,0 +1,71 @@
+package fetcher
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cjeanner/kustomap/internal/repository"
+)
+
+func TestLocalFetcher(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		"overlay/kustomization.yaml": "resources: [../base]\n",
+		"base/kustomization.yml":     "resources: [deploy.yaml]\n",
+		"base/deploy.yaml":           "kind: Deployment\n",
+		".git/HEAD":                  "ref: refs/heads/main\n",
+	}
+	for name, content := range files {
+		p := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	f, err := NewLocalFetcher(repository.NewLocalRepository(root))
+	if err != nil {
+		t.Fatalf("NewLocalFetcher: %v", err)
+	}
+
+	if got, err := f.FindKustomizationInPath("overlay"); err != nil || got != files["overlay/kustomization.yaml"] {
+		t.Errorf("FindKustomizationInPath(overlay) = (%q, %v)", got, err)
+	}
+	if got, err := f.FindKustomizationInPath("/base/"); err != nil || got != files["base/kustomization.yml"] {
+		t.Errorf("FindKustomizationInPath(base) = (%q, %v)", got, err)
+	}
+	if got, err := f.FindKustomizationInPath("base/deploy.yaml"); err != nil || got != files["base/deploy.yaml"] {
+		t.Errorf("FindKustomizationInPath(base/deploy.yaml) = (%q, %v)", got, err)
+	}
+	if _, err := f.FindKustomizationInPath("missing"); !errors.Is(err, ErrKustomizationNotFound) {
+		t.Errorf("FindKustomizationInPath(missing) err = %v, want ErrKustomizationNotFound", err)
+	}
+
+	listed, err := f.ListFiles()
+	if err != nil {
+		t.Fatalf("ListFiles: %v", err)
+	}
+	if len(listed) != 3 {
+		t.Errorf("ListFiles() = %v, want the 3 files outside .git", listed)
+	}
+}
+
+func TestLocalFetcher_ProbeOrder(t *testing.T) {
+	root := t.TempDir()
+	for name, content := range map[string]string{"kustomization.yml": "yml", "Kustomization": "bare"} {
+		if err := os.WriteFile(filepath.Join(root, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	f, err := NewLocalFetcher(repository.NewLocalRepository(root))
+	if err != nil {
+		t.Fatalf("NewLocalFetcher: %v", err)
+	}
+	// kustomization.yml comes before Kustomization
+	if got, err := f.FindKustomizationInPath(""); err != nil || got != "yml" {
+		t.Errorf("FindKustomizationInPath() = (%q, %v), want yml", got, err)
+	}
+}
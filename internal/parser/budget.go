@@ -0,0 +1,78 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/cjeanner/kustomap/internal/fetcher"
+)
+
+// ErrAPICallBudgetExceeded is wrapped by the APICallBudgetError of a parse that ran
+// out of API calls.
+var ErrAPICallBudgetExceeded = errors.New("API call budget exceeded")
+
+// APICallBudgetError is returned by Parse when it needed more than Parser.MaxAPICalls
+// API calls. Resolved is the number of nodes resolved before it stopped.
+type APICallBudgetError struct {
+	Limit    int
+	Resolved int
+}
+
+func (e *APICallBudgetError) Error() string {
+	return fmt.Sprintf("%v: stopped after %d calls with %d nodes resolved", ErrAPICallBudgetExceeded, e.Limit, e.Resolved)
+}
+
+func (e *APICallBudgetError) Unwrap() error {
+	return ErrAPICallBudgetExceeded
+}
+
+// apiCallBudget counts the API calls of a parse (fetches and ref resolutions) against
+// a limit. A nil budget has no limit. Safe for concurrent use.
+type apiCallBudget struct {
+	limit int
+	used  atomic.Int64
+}
+
+// spend records a call, failing once the limit is reached
+func (b *apiCallBudget) spend() error {
+	if b == nil {
+		return nil
+	}
+	if b.used.Add(1) > int64(b.limit) {
+		return fmt.Errorf("%w (limit of %d calls)", ErrAPICallBudgetExceeded, b.limit)
+	}
+	return nil
+}
+
+// exhausted reports whether a call was refused
+func (b *apiCallBudget) exhausted() bool {
+	return b != nil && b.used.Load() > int64(b.limit)
+}
+
+// budgetFetcher is a Fetcher spending a call of its budget before each fetch.
+type budgetFetcher struct {
+	fetcher.Fetcher
+	budget *apiCallBudget
+}
+
+func (f *budgetFetcher) FetchFile(path string) ([]byte, error) {
+	if err := f.budget.spend(); err != nil {
+		return nil, err
+	}
+	return f.Fetcher.FetchFile(path)
+}
+
+func (f *budgetFetcher) ListFiles() ([]string, error) {
+	if err := f.budget.spend(); err != nil {
+		return nil, err
+	}
+	return f.Fetcher.ListFiles()
+}
+
+func (f *budgetFetcher) FindKustomizationInPath(path string) (string, error) {
+	if err := f.budget.spend(); err != nil {
+		return "", err
+	}
+	return f.Fetcher.FindKustomizationInPath(path)
+}
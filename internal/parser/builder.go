@@ -0,0 +1,213 @@
+package parser
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/cjeanner/kustomap/internal/fetcher"
+	"github.com/cjeanner/kustomap/internal/repository"
+	"github.com/cjeanner/kustomap/internal/types"
+)
+
+// EdgeReferencedBy is the edge type linking a corpus node to the root graph node it references.
+const EdgeReferencedBy = "referenced-by"
+
+// defaultFetcherFactory creates the fetchers used by Build. Tests replace it with mocks.
+var defaultFetcherFactory = fetcher.NewFetcherContext
+
+// BuildResult is the outcome of Build: the graph and the API calls made to build it.
+type BuildResult struct {
+	Graph *types.Graph
+
+	// APICallLog lists every GitHub/GitLab API call (branch listings, file fetches...)
+	// made by the resolver and fetchers, for cost accounting and debugging.
+	APICallLog []repository.APICall
+}
+
+// BuildOptions configures BuildGraph. The zero value builds the whole graph with the
+// parser defaults and no tokens.
+type BuildOptions struct {
+	// Tokens picks the token of each repository of the graph
+	Tokens repository.TokenProvider
+
+	// MaxDepth is the number of levels of references followed below the root (see
+	// Parser.MaxDepth); 0 or less means no limit.
+	MaxDepth int
+
+	// StrictMode fails the build when any reference can't be resolved (see
+	// Parser.StrictMode).
+	StrictMode bool
+
+	// Workers is the number of references resolved concurrently; 0 or less means
+	// DefaultWorkers.
+	Workers int
+
+	// LocalOnly builds the graph of a checkout or archive without network access:
+	// remote references are leaves (see Parser.LocalOnly).
+	LocalOnly bool
+
+	// MaxAPICalls aborts the build with an *APICallBudgetError once that many API
+	// calls were made while parsing (see Parser.MaxAPICalls); 0 or less means no limit.
+	MaxAPICalls int
+}
+
+// BuildGraph detects the repository behind ref, resolves its branch and path, and
+// builds its dependency graph as configured by opts: the single entry point for
+// callers such as a CLI.
+func BuildGraph(ctx context.Context, ref string, opts BuildOptions) (*types.Graph, error) {
+	return buildGraph(ctx, ref, "", opts, nil)
+}
+
+// Build is BuildGraph with the default options, also returning the log of the API
+// calls made. The token is used for the root repository type.
+func Build(ctx context.Context, rootURL, token string) (*BuildResult, error) {
+	return build(ctx, rootURL, token, BuildOptions{}, nil)
+}
+
+// BuildWithTokens is Build taking the token of each repository of the graph from
+// tokens, for graphs spanning several hosts.
+func BuildWithTokens(ctx context.Context, rootURL string, tokens repository.TokenProvider) (*BuildResult, error) {
+	return build(ctx, rootURL, "", BuildOptions{Tokens: tokens}, nil)
+}
+
+func build(ctx context.Context, rootURL, token string, opts BuildOptions, events chan<- ProgressEvent) (*BuildResult, error) {
+	ctx, callLog := repository.WithAPICallLog(ctx)
+	graph, err := buildGraph(ctx, rootURL, token, opts, events)
+	if err != nil {
+		return nil, err
+	}
+	return &BuildResult{Graph: graph, APICallLog: callLog.Calls()}, nil
+}
+
+// buildGraph builds the graph of rootURL. Without opts.Tokens, token is used for the
+// repositories of the root's type. Parse progress is sent on events, if set.
+func buildGraph(ctx context.Context, rootURL, token string, opts BuildOptions, events chan<- ProgressEvent) (*types.Graph, error) {
+	repoInfo, err := repository.DetectRepository(rootURL, "")
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrMalformedReference, err)
+	}
+	if opts.LocalOnly && repoInfo.Type != repository.Local && repoInfo.Type != repository.Archive {
+		return nil, fmt.Errorf("local-only build of %s: not a local checkout or archive", rootURL)
+	}
+	tokens := opts.Tokens
+	if tokens == nil {
+		tokens = repository.TokensByType(map[repository.RepositoryType]string{repoInfo.Type: token})
+	}
+	token = tokens(repoInfo)
+
+	if repoInfo.AmbiguousPath != "" {
+		branch, path, err := repository.ResolveBranchAndPathTokens(ctx, repoInfo, repoInfo.AmbiguousPath, tokens)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve branch: %w", err)
+		}
+		repoInfo.Ref = branch
+		repoInfo.Path = path
+	}
+	if repoInfo.Ref == "" {
+		if _, err := repository.ResolveDefaultBranchContext(ctx, repoInfo, token); err != nil {
+			return nil, fmt.Errorf("failed to resolve default branch: %w", err)
+		}
+	}
+
+	factory := func(repo *repository.RepositoryInfo, token string) (fetcher.Fetcher, error) {
+		return defaultFetcherFactory(ctx, repo, token)
+	}
+	f, err := factory(repoInfo, token)
+	if err != nil {
+		return nil, err
+	}
+
+	p := NewParser(f, repoInfo)
+	p.ctx = ctx
+	p.FetcherFactory = factory
+	p.Tokens = tokens
+	p.Events = events
+	p.StrictMode = opts.StrictMode
+	p.LocalOnly = opts.LocalOnly
+	p.MaxAPICalls = opts.MaxAPICalls
+	if opts.MaxDepth > 0 {
+		p.MaxDepth = opts.MaxDepth
+	}
+	if opts.Workers > 0 {
+		p.Workers = opts.Workers
+	}
+	return p.Parse(repoInfo.Path)
+}
+
+// BuildWithReferrers builds the downward graph of rootRef, then scans the corpus
+// (other kustomization URLs, e.g. a whole org) for references to any of its nodes.
+// Each referencing corpus node is added with a "referenced-by" edge pointing to the
+// root node it references. Corpus entries that fail to build are logged and skipped.
+func BuildWithReferrers(rootRef string, corpus []string, token string) (*types.Graph, error) {
+	graph, err := buildGraph(context.Background(), rootRef, token, BuildOptions{}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	rootNodes := make(map[string]bool)
+	for _, elem := range graph.Elements {
+		if elem.Group == "nodes" {
+			rootNodes[elem.Data.ID] = true
+		}
+	}
+
+	existing := make(map[string]bool)
+	for _, elem := range graph.Elements {
+		existing[elem.Data.ID] = true
+	}
+
+	for _, entry := range corpus {
+		corpusGraph, err := buildGraph(context.Background(), entry, token, BuildOptions{}, nil)
+		if err != nil {
+			log.Printf("⚠️  Skipping corpus entry %s: %v", entry, err)
+			continue
+		}
+
+		corpusNodes := make(map[string]types.Element)
+		for _, elem := range corpusGraph.Elements {
+			if elem.Group == "nodes" {
+				corpusNodes[elem.Data.ID] = elem
+			}
+		}
+
+		for _, elem := range corpusGraph.Elements {
+			if elem.Group != "edges" || !rootNodes[elem.Data.Target] || rootNodes[elem.Data.Source] {
+				continue
+			}
+			source := elem.Data.Source
+			if !existing[source] {
+				node, ok := corpusNodes[source]
+				if !ok {
+					log.Printf("⚠️  Skipping edge of corpus entry %s from unknown node %s", entry, source)
+					continue
+				}
+				graph.Elements = append(graph.Elements, node)
+				if baseURL, ok := corpusGraph.BaseURLs[source]; ok {
+					graph.BaseURLs[source] = baseURL
+				}
+				existing[source] = true
+			}
+
+			edgeID := types.EdgeID(source, EdgeReferencedBy, elem.Data.Target)
+			if existing[edgeID] {
+				continue
+			}
+			graph.Elements = append(graph.Elements, types.Element{
+				Group: "edges",
+				Data: types.ElementData{
+					ID:       edgeID,
+					Label:    "referenced by",
+					Source:   source,
+					Target:   elem.Data.Target,
+					EdgeType: EdgeReferencedBy,
+				},
+			})
+			existing[edgeID] = true
+			log.Printf("Added edge: %s -> %s (type: %s)", source, elem.Data.Target, EdgeReferencedBy)
+		}
+	}
+
+	graph.Sort()
+	return graph, nil
+}
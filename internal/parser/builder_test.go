@@ -0,0 +1,559 @@
+package parser
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/cjeanner/kustomap/internal/fetcher"
+	"github.com/cjeanner/kustomap/internal/repository"
+)
+
+// TestBuildWithReferrers ensures a corpus entry referencing the root's base adds the
+// referencing node with an incoming "referenced-by" edge on the root node.
+func TestBuildWithReferrers(t *testing.T) {
+	repository.SetTestRefLister(&defaultBranchRefLister{branch: "main"})
+	defer repository.SetTestRefLister(nil)
+
+	fetchers := map[string]*mockFetcher{
+		"org/base": {PathToContent: map[string]string{"deploy": "resources: []\n"}},
+		"org/app": {PathToContent: map[string]string{
+			"overlay": "resources:\n  - https://github.com/org/base//deploy?ref=main\n",
+		}},
+		"org/unrelated": {PathToContent: map[string]string{"overlay": "resources: []\n"}},
+	}
+	orig := defaultFetcherFactory
+	defer func() { defaultFetcherFactory = orig }()
+	defaultFetcherFactory = func(_ context.Context, repo *repository.RepositoryInfo, _ string) (fetcher.Fetcher, error) {
+		f, ok := fetchers[repo.Owner+"/"+repo.Repo]
+		if !ok {
+			return nil, errors.New("repository not found")
+		}
+		return f, nil
+	}
+
+	graph, err := BuildWithReferrers("https://github.com/org/base/tree/main/deploy", []string{
+		"https://github.com/org/app/tree/main/overlay",
+		"https://github.com/org/unrelated/tree/main/overlay",
+		"https://github.com/org/missing/tree/main/overlay", // fails to build: skipped
+	}, "")
+	if err != nil {
+		t.Fatalf("BuildWithReferrers: %v", err)
+	}
+
+	const rootID = "github:org/base/deploy@main"
+	const referrerID = "github:org/app/overlay@main"
+	nodes := map[string]bool{}
+	var referencedBy []string
+	for _, e := range graph.Elements {
+		switch e.Group {
+		case "nodes":
+			nodes[e.Data.ID] = true
+		case "edges":
+			if e.Data.EdgeType == EdgeReferencedBy {
+				referencedBy = append(referencedBy, e.Data.Source+"->"+e.Data.Target)
+			}
+		}
+	}
+	if !nodes[rootID] || !nodes[referrerID] {
+		t.Fatalf("expected nodes %q and %q, got %v", rootID, referrerID, nodes)
+	}
+	if nodes["github:org/unrelated/overlay@main"] {
+		t.Error("unrelated corpus entry should not be added")
+	}
+	if len(referencedBy) != 1 || referencedBy[0] != referrerID+"->"+rootID {
+		t.Errorf("referenced-by edges = %v, want [%s->%s]", referencedBy, referrerID, rootID)
+	}
+}
+
+// TestBuildGraph_Options builds a graph from a tree URL whose branch has a slash, with
+// mocked ref listing and fetchers, under each BuildOptions setting.
+func TestBuildGraph_Options(t *testing.T) {
+	repository.SetTestRefLister(&defaultBranchRefLister{branch: "release/1.0"})
+	defer repository.SetTestRefLister(nil)
+
+	fetchers := map[string]*mockFetcher{
+		"org/app": {PathToContent: map[string]string{
+			"overlay": "resources:\n  - ../base\n  - https://github.com/org/lib//deploy?ref=v1\n",
+			"base":    "resources:\n  - deploy.yaml\n",
+		}},
+		"org/lib": {PathToContent: map[string]string{"deploy": "resources:\n  - ../missing\n"}},
+	}
+	orig := defaultFetcherFactory
+	defer func() { defaultFetcherFactory = orig }()
+	var tokensUsed []string
+	defaultFetcherFactory = func(_ context.Context, repo *repository.RepositoryInfo, token string) (fetcher.Fetcher, error) {
+		tokensUsed = append(tokensUsed, token)
+		f, ok := fetchers[repo.Owner+"/"+repo.Repo]
+		if !ok {
+			return nil, errors.New("repository not found")
+		}
+		return f, nil
+	}
+	tokens := repository.TokensByHost(map[string]string{"github.com": "gh-token"})
+	const rootURL = "https://github.com/org/app/tree/release/1.0/overlay"
+
+	nodeIDs := func(opts BuildOptions) (map[string]bool, error) {
+		graph, err := BuildGraph(context.Background(), rootURL, opts)
+		if err != nil {
+			return nil, err
+		}
+		ids := map[string]bool{}
+		for _, e := range graph.Elements {
+			if e.Group == "nodes" {
+				ids[e.Data.ID] = true
+			}
+		}
+		return ids, nil
+	}
+
+	tokensUsed = nil
+	ids, err := nodeIDs(BuildOptions{Tokens: tokens, Workers: 1})
+	if err != nil {
+		t.Fatalf("BuildGraph: %v", err)
+	}
+	for _, id := range []string{
+		"github:org/app/overlay@release/1.0",
+		"github:org/app/base@release/1.0",
+		"github:org/app/base/deploy.yaml@release/1.0",
+		"github:org/lib/deploy@v1",
+		"github:org/lib/missing@v1",
+	} {
+		if !ids[id] {
+			t.Errorf("missing node %s (nodes %v)", id, ids)
+		}
+	}
+	for _, token := range tokensUsed {
+		if token != "gh-token" {
+			t.Errorf("fetcher created with token %q, want gh-token", token)
+		}
+	}
+
+	ids, err = nodeIDs(BuildOptions{MaxDepth: 1})
+	if err != nil {
+		t.Fatalf("BuildGraph(MaxDepth: 1): %v", err)
+	}
+	if ids["github:org/app/base/deploy.yaml@release/1.0"] || !ids["github:org/app/base@release/1.0"] {
+		t.Errorf("MaxDepth 1: nodes %v, want the root's references only", ids)
+	}
+
+	var unresolved *UnresolvedReferenceError
+	if _, err := nodeIDs(BuildOptions{StrictMode: true}); !errors.As(err, &unresolved) {
+		t.Errorf("StrictMode: err = %v, want an UnresolvedReferenceError", err)
+	}
+}
+
+// TestBuildGraph_MaxAPICalls stops a build running out of API calls, reporting the
+// nodes resolved so far.
+func TestBuildGraph_MaxAPICalls(t *testing.T) {
+	repository.SetTestRefLister(&defaultBranchRefLister{branch: "main"})
+	defer repository.SetTestRefLister(nil)
+
+	f := &mockFetcher{PathToContent: map[string]string{
+		"overlay": "resources:\n  - ../level1\n",
+		"level1":  "resources:\n  - ../level2\n",
+		"level2":  "resources:\n  - ../level3\n",
+		"level3":  "resources: []\n",
+	}}
+	orig := defaultFetcherFactory
+	defer func() { defaultFetcherFactory = orig }()
+	defaultFetcherFactory = func(context.Context, *repository.RepositoryInfo, string) (fetcher.Fetcher, error) {
+		return f, nil
+	}
+	const rootURL = "https://github.com/org/app/tree/main/overlay"
+
+	_, err := BuildGraph(context.Background(), rootURL, BuildOptions{MaxAPICalls: 2, Workers: 1})
+	var budgetErr *APICallBudgetError
+	if !errors.As(err, &budgetErr) || !errors.Is(err, ErrAPICallBudgetExceeded) {
+		t.Fatalf("BuildGraph(MaxAPICalls: 2) err = %v, want an APICallBudgetError", err)
+	}
+	if budgetErr.Limit != 2 || budgetErr.Resolved != 2 {
+		t.Errorf("APICallBudgetError = %+v, want limit 2 with overlay and level1 resolved", budgetErr)
+	}
+
+	if _, err := BuildGraph(context.Background(), rootURL, BuildOptions{MaxAPICalls: 4}); err != nil {
+		t.Errorf("BuildGraph(MaxAPICalls: 4): %v, want the whole graph within budget", err)
+	}
+}
+
+// TestParse_BudgetSharedAcrossCalls ensures repeated Parse calls spend from one budget
+// through a single budget wrapper.
+func TestParse_BudgetSharedAcrossCalls(t *testing.T) {
+	repo := &repository.RepositoryInfo{Type: repository.GitHub, Owner: "org", Repo: "app", Ref: "main"}
+	p := NewParser(&mockFetcher{PathToContent: map[string]string{"overlay": "resources: []\n"}}, repo)
+	p.MaxAPICalls = 1
+
+	if _, err := p.Parse("overlay"); err != nil {
+		t.Fatalf("first Parse: %v", err)
+	}
+	if _, err := p.Parse("overlay"); !errors.Is(err, ErrAPICallBudgetExceeded) {
+		t.Errorf("second Parse err = %v, want the budget of the first call exhausted", err)
+	}
+	if bf, ok := p.fetcher.(*budgetFetcher); !ok {
+		t.Errorf("fetcher = %T, want *budgetFetcher", p.fetcher)
+	} else if _, nested := bf.Fetcher.(*budgetFetcher); nested {
+		t.Error("fetcher wrapped in a budgetFetcher twice")
+	}
+}
+
+// TestParse_BudgetCountsHostProbes ensures probing the API of an unknown host to
+// detect its type is spent from the budget.
+func TestParse_BudgetCountsHostProbes(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/v4/version" {
+			fmt.Fprint(w, `{"version":"16.0.0"}`)
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	defer srv.Close()
+
+	repo := &repository.RepositoryInfo{Type: repository.GitHub, Owner: "org", Repo: "app", Ref: "main"}
+	f := &mockFetcher{PathToContent: map[string]string{
+		"overlay": "resources:\n  - " + srv.URL + "/group/proj//base?ref=main\n",
+		"base":    "resources: []\n",
+	}}
+	parse := func(maxAPICalls int) error {
+		p := NewParser(f, repo)
+		p.FetcherFactory = func(*repository.RepositoryInfo, string) (fetcher.Fetcher, error) { return f, nil }
+		p.MaxAPICalls = maxAPICalls
+		_, err := p.Parse("overlay")
+		return err
+	}
+
+	// overlay, the GitLab probe of the host and base
+	if err := parse(2); !errors.Is(err, ErrAPICallBudgetExceeded) {
+		t.Errorf("Parse(MaxAPICalls: 2) err = %v, want the probe counted", err)
+	}
+	if err := parse(3); err != nil {
+		t.Errorf("Parse(MaxAPICalls: 3): %v, want the whole graph within budget", err)
+	}
+}
+
+func TestParse_ProbesUnknownHostWithItsToken(t *testing.T) {
+	var probeTokens []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/v4/version" {
+			probeTokens = append(probeTokens, r.Header.Get("PRIVATE-TOKEN"))
+			fmt.Fprint(w, `{"version":"16.0.0"}`)
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	defer srv.Close()
+	srvHost := strings.TrimPrefix(srv.URL, "http://")
+
+	repo := &repository.RepositoryInfo{Type: repository.GitHub, Owner: "org", Repo: "app", Ref: "main"}
+	f := &mockFetcher{PathToContent: map[string]string{
+		"overlay": "resources:\n  - " + srv.URL + "/group/proj//base?ref=main\n",
+		"base":    "resources: []\n",
+	}}
+	cases := []struct {
+		name      string
+		configure func(p *Parser)
+		want      string
+	}{
+		{"per-type tokens", func(p *Parser) { p.SetToken(repository.GitHub, "parent-token") }, ""},
+		{"token provider", func(p *Parser) {
+			p.Tokens = func(r *repository.RepositoryInfo) string {
+				if r.Host() == srvHost {
+					return "host-token"
+				}
+				return "parent-token"
+			}
+		}, "host-token"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			probeTokens = nil
+			p := NewParser(f, repo)
+			p.FetcherFactory = func(*repository.RepositoryInfo, string) (fetcher.Fetcher, error) { return f, nil }
+			c.configure(p)
+			if _, err := p.Parse("overlay"); err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			if len(probeTokens) != 1 || probeTokens[0] != c.want {
+				t.Errorf("probed with tokens %q, want [%q] (never the parent repository's)", probeTokens, c.want)
+			}
+		})
+	}
+}
+
+// TestBuildGraph_Local builds the graph of a checkout in a temp dir, without any git host.
+func TestBuildGraph_Local(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		"overlay/kustomization.yaml":               "resources:\n  - ../base\ncomponents:\n  - ../components/monitoring\n",
+		"base/kustomization.yaml":                  "resources:\n  - deploy.yaml\n",
+		"base/deploy.yaml":                         "kind: Deployment\n",
+		"components/monitoring/kustomization.yaml": "kind: Component\n",
+	}
+	for name, content := range files {
+		p := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, rootURL := range []string{"file://" + filepath.Join(root, "overlay"), filepath.Join(root, "overlay")} {
+		t.Run(rootURL, func(t *testing.T) {
+			graph, err := BuildGraph(context.Background(), rootURL, BuildOptions{})
+			if err != nil {
+				t.Fatalf("BuildGraph: %v", err)
+			}
+
+			nodeTypes := map[string]string{}
+			for _, e := range graph.Elements {
+				if e.Group == "nodes" {
+					nodeTypes[e.Data.ID] = e.Data.Type
+				}
+			}
+			slashRoot := filepath.ToSlash(root)
+			want := map[string]string{
+				"local:" + slashRoot + "/overlay@working-tree":               "overlay",
+				"local:" + slashRoot + "/base@working-tree":                  "resource",
+				"local:" + slashRoot + "/base/deploy.yaml@working-tree":      "resource",
+				"local:" + slashRoot + "/components/monitoring@working-tree": "component",
+			}
+			for id, typ := range want {
+				if nodeTypes[id] != typ {
+					t.Errorf("node %s type = %q, want %q (nodes: %v)", id, nodeTypes[id], typ, nodeTypes)
+				}
+			}
+		})
+	}
+}
+
+// noNetwork fails the test on any ref listing or HTTP request.
+type noNetwork struct{ t *testing.T }
+
+func (n noNetwork) ListBranchesAndTags(repoInfo *repository.RepositoryInfo, _ string) ([]string, error) {
+	n.t.Errorf("unexpected ref listing of %s", repoInfo)
+	return nil, errors.New("no network")
+}
+
+func (n noNetwork) RoundTrip(req *http.Request) (*http.Response, error) {
+	n.t.Errorf("unexpected request to %s", req.URL)
+	return nil, errors.New("no network")
+}
+
+// TestBuildGraph_LocalOnly builds a checkout without network access: remote references
+// are leaves marked Remote, and neither refs nor files are fetched for them.
+func TestBuildGraph_LocalOnly(t *testing.T) {
+	repository.SetTestRefLister(noNetwork{t})
+	defer repository.SetTestRefLister(nil)
+	repository.SetTestTransport(noNetwork{t})
+	defer repository.SetTestTransport(nil)
+
+	root := t.TempDir()
+	files := map[string]string{
+		"overlay/kustomization.yaml": "resources:\n  - ../base\n  - https://github.com/org/lib/tree/release/1.0/deploy\n" +
+			"components:\n  - git@gitlab.example.com:org/components.git//monitoring\n",
+		"base/kustomization.yaml": "resources:\n  - https://git.example.com/org/unknown-host//deploy?ref=v1\n",
+	}
+	for name, content := range files {
+		p := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	graph, err := BuildGraph(context.Background(), filepath.Join(root, "overlay"), BuildOptions{LocalOnly: true})
+	if err != nil {
+		t.Fatalf("BuildGraph: %v", err)
+	}
+	nodes := map[string]bool{} // node ID -> Remote
+	for _, e := range graph.Elements {
+		if e.Group == "nodes" {
+			nodes[e.Data.ID] = e.Data.Remote
+		}
+	}
+	slashRoot := filepath.ToSlash(root)
+	want := map[string]bool{
+		"local:" + slashRoot + "/overlay@working-tree":                   false,
+		"local:" + slashRoot + "/base@working-tree":                      false,
+		"remote:https://github.com/org/lib/tree/release/1.0/deploy":      true,
+		"remote:git@gitlab.example.com:org/components.git//monitoring":   true,
+		"remote:https://git.example.com/org/unknown-host//deploy?ref=v1": true,
+	}
+	if !reflect.DeepEqual(nodes, want) {
+		t.Errorf("nodes (ID: remote) = %v, want %v", nodes, want)
+	}
+
+	if _, err := BuildGraph(context.Background(), "https://github.com/org/app//overlay?ref=main", BuildOptions{LocalOnly: true}); err == nil {
+		t.Error("local-only build of a remote root: want an error")
+	}
+}
+
+// TestBuildGraph_Archive builds the graph of an overlay inside a .tar.gz export:
+// relative references resolve to paths within the archive.
+func TestBuildGraph_Archive(t *testing.T) {
+	files := map[string]string{
+		"overlay/kustomization.yaml":               "resources:\n  - ../base\ncomponents:\n  - ../components/monitoring\n",
+		"base/kustomization.yaml":                  "resources:\n  - deploy.yaml\n",
+		"base/deploy.yaml":                         "kind: Deployment\n",
+		"components/monitoring/kustomization.yaml": "kind: Component\n",
+	}
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for name, content := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(content))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	archive := filepath.Join(t.TempDir(), "manifests.tar.gz")
+	if err := os.WriteFile(archive, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	graph, err := BuildGraph(context.Background(), filepath.Join(archive, "overlay"), BuildOptions{})
+	if err != nil {
+		t.Fatalf("BuildGraph: %v", err)
+	}
+
+	nodeTypes := map[string]string{}
+	for _, e := range graph.Elements {
+		if e.Group == "nodes" {
+			nodeTypes[e.Data.ID] = e.Data.Type
+		}
+	}
+	prefix := "archive:" + filepath.ToSlash(archive)
+	want := map[string]string{
+		prefix + "/overlay@snapshot":               "overlay",
+		prefix + "/base@snapshot":                  "resource",
+		prefix + "/base/deploy.yaml@snapshot":      "resource",
+		prefix + "/components/monitoring@snapshot": "component",
+	}
+	if len(nodeTypes) != len(want) {
+		t.Errorf("got %d nodes, want %d: %v", len(nodeTypes), len(want), nodeTypes)
+	}
+	for id, typ := range want {
+		if nodeTypes[id] != typ {
+			t.Errorf("node %s type = %q, want %q (nodes: %v)", id, nodeTypes[id], typ, nodeTypes)
+		}
+	}
+}
+
+// TestProcessReference_LocalFromRemote ensures a remote repository can't make the
+// parser read the local filesystem.
+func TestProcessReference_LocalFromRemote(t *testing.T) {
+	entryRepo := &repository.RepositoryInfo{Type: repository.GitHub, Owner: "org", Repo: "app", Ref: "main"}
+	f := &mockFetcher{PathToContent: map[string]string{"overlay": "resources:\n  - file:///etc/secrets\n"}}
+	p := NewParser(f, entryRepo)
+	p.FetcherFactory = func(_ *repository.RepositoryInfo, _ string) (fetcher.Fetcher, error) {
+		t.Fatal("no fetcher should be created for a local reference from a remote repository")
+		return nil, nil
+	}
+
+	graph, err := p.Parse("overlay")
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	found := false
+	for _, e := range graph.Elements {
+		if e.Group == "nodes" && e.Data.ID == "error:file:///etc/secrets" {
+			found = e.Data.Type == "error"
+		}
+	}
+	if !found {
+		t.Error("expected an error node for the local reference")
+	}
+}
+
+// githubAPITransport is a fake GitHub API serving branches "main", no tags, and
+// the files in contents (404 otherwise).
+type githubAPITransport struct {
+	contents map[string]string // contents path (after /repos/) -> file content
+}
+
+func (g *githubAPITransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	status, body := http.StatusNotFound, `{"message":"Not Found"}`
+	path := strings.TrimPrefix(req.URL.Path, "/repos/")
+	switch {
+	case strings.HasSuffix(path, "/branches"):
+		status, body = http.StatusOK, `[{"name":"main"}]`
+	case strings.HasSuffix(path, "/tags"):
+		status, body = http.StatusOK, `[]`
+	default:
+		if content, ok := g.contents[path]; ok {
+			status = http.StatusOK
+			body = fmt.Sprintf(`{"type":"file","encoding":"base64","content":%q}`, base64.StdEncoding.EncodeToString([]byte(content)))
+		}
+	}
+	return &http.Response{
+		StatusCode: status,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       io.NopCloser(strings.NewReader(body)),
+		Request:    req,
+	}, nil
+}
+
+// TestBuild_APICallLog ensures the build result records the API calls made, including
+// the branch listing used to resolve the root reference.
+func TestBuild_APICallLog(t *testing.T) {
+	repository.SetTestRefLister(nil) // use the (fake) API, with a clean ref cache
+	repository.SetTestTransport(&githubAPITransport{contents: map[string]string{
+		"org/app/contents/overlay/kustomization.yaml": "resources: []\n",
+	}})
+	defer repository.SetTestTransport(nil)
+	defer repository.ClearRefCache()
+
+	result, err := Build(context.Background(), "https://github.com/org/app/tree/main/overlay", "")
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	if result.Graph == nil || len(result.Graph.Elements) != 1 {
+		t.Fatalf("Graph = %+v, want the overlay node", result.Graph)
+	}
+
+	var branchListing *repository.APICall
+	var contentCalls int
+	for i, call := range result.APICallLog {
+		switch {
+		case call.Path == "/repos/org/app/branches":
+			branchListing = &result.APICallLog[i]
+		case strings.HasPrefix(call.Path, "/repos/org/app/contents/"):
+			contentCalls++
+		}
+	}
+	if branchListing == nil {
+		t.Fatalf("APICallLog = %+v, want the branch listing call", result.APICallLog)
+	}
+	if branchListing.Host != "api.github.com" || branchListing.Method != http.MethodGet || branchListing.Status != http.StatusOK {
+		t.Errorf("branch listing = %+v, want GET api.github.com 200", *branchListing)
+	}
+	if branchListing.Duration < 0 {
+		t.Errorf("branch listing duration = %v, want >= 0", branchListing.Duration)
+	}
+	if contentCalls != 2 {
+		t.Errorf("content calls = %d, want 2 (overlay as a file, then overlay/kustomization.yaml)", contentCalls)
+	}
+}
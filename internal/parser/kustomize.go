@@ -1,10 +1,17 @@
 package parser
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"net/url"
 	"path"
+	"slices"
 	"strings"
+	"sync"
 
 	"github.com/cjeanner/kustomap/internal/fetcher"
 	"github.com/cjeanner/kustomap/internal/repository"
@@ -18,14 +25,175 @@ func copyLogArgs(s string) string { return strings.Clone(s) }
 
 // Kustomization represents a kustomization.yaml file structure
 type Kustomization struct {
+	Kind       string        `yaml:"kind"` // "Kustomization" (default) or "Component"
 	Resources  []string      `yaml:"resources"`
 	Components []string      `yaml:"components"`
 	Patches    []interface{} `yaml:"patches"`
 
+	// JSON 6902 patches of a target, inline (patch:) or from a file (path:)
+	PatchesJSON6902 []interface{} `yaml:"patchesJson6902"`
+
+	// Transformers applied to every resource; shown in node tooltips
+	Namespace  string `yaml:"namespace"`
+	NamePrefix string `yaml:"namePrefix"`
+	NameSuffix string `yaml:"nameSuffix"`
+
+	// Image overrides (images: transformer); metadata only, no graph edges
+	Images []ImageOverride `yaml:"images"`
+
+	// Generators may reference external files via files/envs
+	ConfigMapGenerator []GeneratorArgs `yaml:"configMapGenerator"`
+	SecretGenerator    []GeneratorArgs `yaml:"secretGenerator"`
+
+	// Replacements are inlined or read from a file (path:); files become graph nodes
+	Replacements []ReplacementEntry `yaml:"replacements"`
+
+	// Schemas: a custom OpenAPI schema file and CRD definition files
+	OpenAPI OpenAPISpec `yaml:"openapi"`
+	CRDs    []string    `yaml:"crds"`
+
+	// Helm charts inflated by the helm generator
+	HelmCharts []HelmChart `yaml:"helmCharts"`
+
+	// Legacy vars: cross-references to fields of other objects; metadata only, no graph edges
+	Vars []Var `yaml:"vars"`
+
+	// Output options (annotations and labels added, resource order); metadata only
+	BuildMetadata []string     `yaml:"buildMetadata"`
+	SortOptions   *SortOptions `yaml:"sortOptions"`
+
 	// Deprecated but still supported for backward compatibility
 	Bases []string `yaml:"bases"`
 }
 
+// IsComponent reports whether the file declares kind: Component, which may only be
+// referenced from components: and can't be built on its own.
+func (k *Kustomization) IsComponent() bool {
+	return k.Kind == "Component"
+}
+
+// ParseKustomizations parses every kustomization of a multi-document YAML stream
+// (documents separated by "---", e.g. a rendered bundle), in order. Documents of other
+// kinds are skipped, as are Flux's Kustomization resources (another apiVersion) and
+// empty documents; a document without kind is a kustomization.
+func ParseKustomizations(data []byte) ([]*Kustomization, error) {
+	var kusts []*Kustomization
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	for i := 0; ; i++ {
+		var doc yaml.Node
+		if err := dec.Decode(&doc); errors.Is(err, io.EOF) {
+			return kusts, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to parse YAML document %d: %w", i+1, err)
+		}
+		if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+			continue
+		}
+
+		var header struct {
+			APIVersion string `yaml:"apiVersion"`
+			Kind       string `yaml:"kind"`
+		}
+		if err := doc.Decode(&header); err != nil {
+			return nil, fmt.Errorf("failed to parse YAML document %d: %w", i+1, err)
+		}
+		switch header.Kind {
+		case "", "Kustomization", "Component":
+		default:
+			continue
+		}
+		if header.APIVersion != "" && !strings.HasPrefix(header.APIVersion, "kustomize.config.k8s.io/") {
+			continue
+		}
+
+		var kust Kustomization
+		if err := doc.Decode(&kust); err != nil {
+			return nil, fmt.Errorf("failed to parse kustomization YAML (document %d): %w", i+1, err)
+		}
+		kusts = append(kusts, &kust)
+	}
+}
+
+// GeneratorArgs represents a configMapGenerator or secretGenerator entry.
+// Files entries may use the "key=path" form; Envs entries are plain paths.
+type GeneratorArgs struct {
+	Name     string   `yaml:"name" json:"name"`
+	Files    []string `yaml:"files" json:"files,omitempty"`
+	Envs     []string `yaml:"envs" json:"envs,omitempty"`
+	Literals []string `yaml:"literals" json:"literals,omitempty"`
+}
+
+// ReplacementEntry represents a replacements entry: either the path of a file holding
+// replacements, or an inline replacement (source and targets).
+type ReplacementEntry struct {
+	Path    string        `yaml:"path" json:"path,omitempty"`
+	Source  interface{}   `yaml:"source" json:"source,omitempty"`
+	Targets []interface{} `yaml:"targets" json:"targets,omitempty"`
+}
+
+// HelmChart represents a helmCharts entry: a chart from a Helm repository, rendered with
+// an optional values file (relative to the kustomization).
+type HelmChart struct {
+	Name        string `yaml:"name" json:"name"`
+	Repo        string `yaml:"repo" json:"repo,omitempty"`
+	Version     string `yaml:"version" json:"version,omitempty"`
+	ReleaseName string `yaml:"releaseName" json:"releaseName,omitempty"`
+	Namespace   string `yaml:"namespace" json:"namespace,omitempty"`
+	ValuesFile  string `yaml:"valuesFile" json:"valuesFile,omitempty"`
+}
+
+// OpenAPISpec represents the openapi field: a schema file (Path) or a builtin
+// Kubernetes schema version.
+type OpenAPISpec struct {
+	Path    string `yaml:"path" json:"path,omitempty"`
+	Version string `yaml:"version" json:"version,omitempty"`
+}
+
+// SortOptions represents the sortOptions field: the order of the build output, "legacy"
+// (by kind, tunable with LegacySortOptions) or "fifo" (as listed).
+type SortOptions struct {
+	Order             string             `yaml:"order" json:"order,omitempty"`
+	LegacySortOptions *LegacySortOptions `yaml:"legacySortOptions" json:"legacySortOptions,omitempty"`
+}
+
+// LegacySortOptions lists the kinds output first and last by the legacy order.
+type LegacySortOptions struct {
+	OrderFirst []string `yaml:"orderFirst" json:"orderFirst,omitempty"`
+	OrderLast  []string `yaml:"orderLast" json:"orderLast,omitempty"`
+}
+
+// ImageOverride represents an images: entry: the image Name is replaced by NewName
+// and/or tagged with NewTag or pinned to Digest.
+type ImageOverride struct {
+	Name    string `yaml:"name" json:"name"`
+	NewName string `yaml:"newName" json:"newName,omitempty"`
+	NewTag  string `yaml:"newTag" json:"newTag,omitempty"`
+	Digest  string `yaml:"digest" json:"digest,omitempty"`
+}
+
+// Var represents a (deprecated) vars: entry: $(Name) is replaced by the field at
+// FieldRef.FieldPath (metadata.name by default) of the object ObjRef.
+type Var struct {
+	Name     string      `yaml:"name" json:"name"`
+	ObjRef   VarObjRef   `yaml:"objref" json:"objref"`
+	FieldRef VarFieldRef `yaml:"fieldref" json:"fieldref"`
+}
+
+// VarObjRef identifies the object a var reads from.
+type VarObjRef struct {
+	APIVersion string `yaml:"apiVersion" json:"apiVersion,omitempty"`
+	Group      string `yaml:"group" json:"group,omitempty"`
+	Version    string `yaml:"version" json:"version,omitempty"`
+	Kind       string `yaml:"kind" json:"kind"`
+	Name       string `yaml:"name" json:"name"`
+	Namespace  string `yaml:"namespace" json:"namespace,omitempty"`
+}
+
+// VarFieldRef selects the field a var reads.
+type VarFieldRef struct {
+	FieldPath string `yaml:"fieldPath" json:"fieldPath,omitempty"`
+}
+
 // FetcherFactory creates a fetcher for a given repo and token.
 // When set on Parser (e.g. in tests), it is used instead of fetcher.NewFetcher
 // when resolving references that require a fetcher for a different repo.
@@ -37,25 +205,92 @@ type Parser struct {
 	repoInfo       *repository.RepositoryInfo
 	tokens         map[repository.RepositoryType]string // GitHub and GitLab tokens
 	graph          *types.Graph
-	visitedURLs    map[string]bool // Prevent infinite loops
-	FetcherFactory FetcherFactory // optional; used in tests to inject mock fetchers
+	visitedURLs    map[string]bool                       // Prevent infinite loops
+	nodeRepos      map[string]*repository.RepositoryInfo // node ID -> repository it was found in
+	ctx            context.Context                       // passed to API calls made while parsing
+	FetcherFactory FetcherFactory                        // optional; used in tests to inject mock fetchers
+
+	// Tokens, when set, picks the token of each repository (per host in mixed-host
+	// graphs) instead of the per-type tokens given to SetToken.
+	Tokens repository.TokenProvider
+
+	// DisambiguateLabels appends a short repo hint ("base (repoA)") to labels shared
+	// by nodes from different repositories. Unique labels are left untouched.
+	DisambiguateLabels bool
+
+	// MaxDepth stops following references of kustomizations MaxDepth levels below the
+	// entry point (0: entry point only); their nodes are marked Truncated. Defaults to
+	// UnlimitedDepth; any negative value means no limit.
+	MaxDepth int
+
+	// Workers is the number of references of a kustomization resolved concurrently.
+	// Defaults to DefaultWorkers; values below 1 resolve them one at a time.
+	Workers int
+
+	// StrictMode makes Parse fail when any reference can't be resolved, returning every
+	// failure joined (errors.Join) as *UnresolvedReferenceError values.
+	StrictMode bool
+
+	// Exclude lists path.Match glob patterns of references not to follow, matched
+	// against "owner/repo/path" and each of its leading segments: "org/charts" excludes
+	// a whole repository, "org/app/deploy/heavy" one directory and what's below it.
+	// Excluded references are nodes marked Excluded, without children.
+	Exclude []string
+
+	// LocalOnly follows relative and local references only, from the filesystem, for
+	// offline builds of a checkout: remote references are nodes marked Remote, without
+	// children, and no API call is made for them.
+	LocalOnly bool
+
+	// MaxAPICalls stops the parse once it made that many API calls (kustomization and
+	// file fetches, branch and project resolutions, type probes of unknown hosts),
+	// Parse then failing with an *APICallBudgetError. The budget is shared by every
+	// Parse call of the parser. 0 or less means no limit.
+	MaxAPICalls int
+
+	// SchemaValidation checks each kustomization against the Kustomize schema (see
+	// ValidateSchemaBytes), adding the violations to its node's Warnings.
+	SchemaValidation bool
+
+	// Events, when set, receives the progress of Parse (see ProgressEvent): each node
+	// added, each reference resolved and each new depth reached. Sends block, so the
+	// receiver must keep up or cancel the parser's context.
+	Events chan<- ProgressEvent
+
+	depth      int            // levels below the entry point of the kustomization being processed
+	deepest    int            // deepest level reached so far, for EventDepthReached
+	unresolved []error        // references that couldn't be resolved, collected in StrictMode
+	budget     *apiCallBudget // API calls left when MaxAPICalls is set
 }
 
+// UnlimitedDepth is the MaxDepth sentinel for following references without limit.
+const UnlimitedDepth = -1
+
+// DefaultWorkers is the default number of references resolved concurrently.
+const DefaultWorkers = 8
+
 // sameRepoAsEntry reports whether current is the same repo (owner+repo) as entry.
 // Used to decide whether a relative ref should use the entry fetcher or a new fetcher.
 func sameRepoAsEntry(entry, current *repository.RepositoryInfo) bool {
 	if entry == nil || current == nil {
 		return false
 	}
-	return entry.Owner == current.Owner && entry.Repo == current.Repo
+	return entry.Owner == current.Owner && entry.Repo == current.Repo && entry.LocalRoot == current.LocalRoot
 }
 
 // getFetcherForRepo returns a fetcher for the given repo, using FetcherFactory if set (e.g. in tests).
 func (p *Parser) getFetcherForRepo(repo *repository.RepositoryInfo, token string) (fetcher.Fetcher, error) {
+	var f fetcher.Fetcher
+	var err error
 	if p.FetcherFactory != nil {
-		return p.FetcherFactory(repo, token)
+		f, err = p.FetcherFactory(repo, token)
+	} else {
+		f, err = fetcher.NewFetcherContext(p.ctx, repo, token)
 	}
-	return fetcher.NewFetcher(repo, token)
+	if err != nil || p.budget == nil {
+		return f, err
+	}
+	return &budgetFetcher{Fetcher: f, budget: p.budget}, nil
 }
 
 // NewParser creates a new Kustomize parser
@@ -66,6 +301,10 @@ func NewParser(f fetcher.Fetcher, repoInfo *repository.RepositoryInfo) *Parser {
 		tokens:      make(map[repository.RepositoryType]string),
 		graph:       &types.Graph{Elements: []types.Element{}, BaseURLs: make(map[string]string)},
 		visitedURLs: make(map[string]bool),
+		nodeRepos:   make(map[string]*repository.RepositoryInfo),
+		ctx:         context.Background(),
+		MaxDepth:    UnlimitedDepth,
+		Workers:     DefaultWorkers,
 	}
 }
 
@@ -74,9 +313,41 @@ func (p *Parser) SetToken(repoType repository.RepositoryType, token string) {
 	p.tokens[repoType] = token
 }
 
+// SetContext sets the context passed to the API calls made while parsing, so a
+// caller can cancel the parse (e.g. when a client disconnects). Defaults to
+// context.Background().
+func (p *Parser) SetContext(ctx context.Context) {
+	p.ctx = ctx
+}
+
+// tokenFor returns the token to use for repo
+func (p *Parser) tokenFor(repo *repository.RepositoryInfo) string {
+	if p.Tokens != nil {
+		return p.Tokens(repo)
+	}
+	return p.tokens[repo.Type]
+}
+
+// probeToken returns the token ParseReference probes the API of ref's host with when
+// it has to detect the repository type of an unknown host: the one tokens gives that
+// host, never the current repository's (a kustomization may point at any host). The
+// per-type tokens of SetToken don't apply to a host of unknown type.
+func probeToken(ref string, tokens repository.TokenProvider) string {
+	host := referenceHost(ref)
+	if host == "" || tokens == nil {
+		return ""
+	}
+	return tokens(&repository.RepositoryInfo{BaseURL: "https://" + host})
+}
+
 // Parse starts parsing from the initial path
 func (p *Parser) Parse(startPath string) (*types.Graph, error) {
 	log.Printf("Starting parse from path: %s", startPath)
+	// Wrap the fetcher once, on the first call
+	if p.MaxAPICalls > 0 && p.budget == nil {
+		p.budget = &apiCallBudget{limit: p.MaxAPICalls}
+		p.fetcher = &budgetFetcher{Fetcher: p.fetcher, budget: p.budget}
+	}
 
 	// Fetch the initial kustomization.yaml
 	content, err := p.fetcher.FindKustomizationInPath(startPath)
@@ -91,6 +362,21 @@ func (p *Parser) Parse(startPath string) (*types.Graph, error) {
 		return nil, err
 	}
 
+	if p.DisambiguateLabels {
+		p.disambiguateLabels()
+	}
+
+	if p.budget.exhausted() {
+		return nil, &APICallBudgetError{Limit: p.MaxAPICalls, Resolved: p.resolvedNodes()}
+	}
+	if len(p.unresolved) > 0 {
+		return nil, errors.Join(p.unresolved...)
+	}
+
+	p.graph.Dedup()
+	p.graph.ComputeLevels()
+
+	p.graph.Sort()
 	log.Printf("✅ Graph built with %d elements", len(p.graph.Elements))
 	return p.graph, nil
 }
@@ -114,51 +400,584 @@ func (p *Parser) processKustomization(nodeID, content, currentPath string, curre
 		return fmt.Errorf("failed to parse kustomization YAML: %w", err)
 	}
 
+	// A Component is labelled as one however it was referenced; kustomize only
+	// accepts it under components:, so other uses are flagged
+	var kindWarning string
+	if kust.IsComponent() && nodeType != "component" {
+		if nodeType == "overlay" {
+			kindWarning = "kind: Component used as the root: a Component can't be built on its own"
+		} else {
+			kindWarning = fmt.Sprintf("kind: Component referenced as a %s; it must be listed under components:", nodeType)
+		}
+		log.Printf("⚠️  Warning: %s: %s", nodeID, kindWarning)
+		nodeType = "component"
+	}
+
 	// Create node for this kustomization (type reflects how it was referenced)
-	p.addNode(nodeID, nodeType, currentPath, &kust, currentRepo.BaseURL)
+	p.addNode(nodeID, nodeType, currentPath, &kust, currentRepo)
+	p.updateNode(nodeID, func(data *types.ElementData) { data.RawContent = content })
+	if kindWarning != "" {
+		p.setNodeContent(nodeID, "warning", kindWarning)
+	}
+	if infos := patchInfos(&kust, currentPath); len(infos) > 0 {
+		p.updateNode(nodeID, func(data *types.ElementData) { data.Patches = infos })
+	}
+	if p.SchemaValidation {
+		var warnings []string
+		for _, schemaErr := range ValidateSchemaBytes([]byte(content)) {
+			warnings = append(warnings, schemaErr.Error())
+		}
+		if len(warnings) > 0 {
+			log.Printf("⚠️  Warning: %s doesn't match the kustomization schema: %s", nodeID, strings.Join(warnings, "; "))
+			p.updateNode(nodeID, func(data *types.ElementData) { data.Warnings = append(data.Warnings, warnings...) })
+		}
+	}
 
-	// Merge bases into resources (backward compatibility)
-	allResources := append(kust.Resources, kust.Bases...)
+	// Out of API calls: the parse is aborted, don't follow more references
+	if p.budget.exhausted() {
+		log.Printf("API call budget of %d calls exhausted, not following references of %s", p.MaxAPICalls, nodeID)
+		return nil
+	}
 
-	// Process all resources (files + kustomizations)
-	for _, resource := range allResources {
-		if err := p.processResource(nodeID, resource, currentPath, currentRepo); err != nil {
-			log.Printf("Warning: failed to process resource %s: %v", resource, err)
+	// Depth limit reached: keep the node but don't follow its references
+	if p.MaxDepth >= 0 && p.depth >= p.MaxDepth {
+		if len(kust.Resources)+len(kust.Bases)+len(kust.Components)+len(kust.ConfigMapGenerator)+len(kust.SecretGenerator)+len(kust.Replacements)+len(kust.CRDs)+len(kust.HelmCharts) > 0 || kust.OpenAPI.Path != "" {
+			log.Printf("Max depth %d reached, not following references of %s", p.MaxDepth, nodeID)
+			p.updateNode(nodeID, func(data *types.ElementData) { data.Truncated = true })
 		}
+		return nil
 	}
 
-	// Process components (reusable components)
+	// Resolve all resources (files + kustomizations), the legacy bases and components
+	// (reusable components) concurrently, then add them to the graph in order
+	var refs []reference
+	for _, resource := range kust.Resources {
+		refs = append(refs, reference{ref: resource, origin: OriginResource})
+	}
+	for _, base := range kust.Bases {
+		refs = append(refs, reference{ref: base, origin: OriginBase})
+	}
 	for _, component := range kust.Components {
-		if err := p.processReference(nodeID, component, "component", currentPath, currentRepo); err != nil {
-			log.Printf("Warning: failed to process component %s: %v", component, err)
+		refs = append(refs, reference{ref: component, origin: OriginComponent})
+	}
+	var lines map[string]int
+	if p.StrictMode {
+		lines = referenceLines(content)
+	}
+	resolvedRefs := p.resolveReferences(refs, currentPath, currentRepo)
+	if warnings := duplicateReferences(refs, resolvedRefs); len(warnings) > 0 {
+		for _, warning := range warnings {
+			log.Printf("⚠️  Warning: %s: %s", nodeID, warning)
+		}
+		p.updateNode(nodeID, func(data *types.ElementData) { data.Warnings = append(data.Warnings, warnings...) })
+	}
+	for i, resolved := range resolvedRefs {
+		p.emit(ProgressEvent{Type: EventReferenceResolved, NodeID: resolved.childID, Parent: nodeID, Ref: refs[i].ref, Depth: p.depth})
+		err := p.addReference(nodeID, resolved)
+		if err != nil {
+			log.Printf("Warning: failed to process %s %s: %v", refs[i].origin, refs[i].ref, err)
+		} else if resolved.err != nil {
+			err = resolved.err
+		}
+		if err != nil && p.StrictMode {
+			p.unresolved = append(p.unresolved, &UnresolvedReferenceError{
+				Kustomization: nodeID,
+				Line:          lines[refs[i].ref],
+				Ref:           refs[i].ref,
+				Err:           err,
+			})
+		}
+	}
+
+	// Process generators (files/envs become file nodes)
+	for i, gen := range kust.ConfigMapGenerator {
+		p.processGenerator(nodeID, "configMapGenerator", i, gen, currentPath, currentRepo)
+	}
+	for i, gen := range kust.SecretGenerator {
+		p.processGenerator(nodeID, "secretGenerator", i, gen, currentPath, currentRepo)
+	}
+
+	// File-based replacements become file nodes; inline replacements have no file to link
+	for _, repl := range kust.Replacements {
+		if repl.Path != "" {
+			p.addFileReference(nodeID, repl.Path, string(OriginReplacement), currentPath, currentRepo)
+		}
+	}
+
+	// Schema dependencies
+	if kust.OpenAPI.Path != "" {
+		p.addFileReference(nodeID, kust.OpenAPI.Path, string(OriginSchema), currentPath, currentRepo)
+	}
+	for _, crd := range kust.CRDs {
+		p.addFileReference(nodeID, crd, string(OriginCRD), currentPath, currentRepo)
+	}
+
+	for _, chart := range kust.HelmCharts {
+		p.processHelmChart(nodeID, chart, currentPath, currentRepo)
+	}
+
+	// Patches only add patch nodes and edges to nodes already below: one index serves them all
+	if len(kust.Patches) > 0 || len(kust.PatchesJSON6902) > 0 {
+		ix := p.graph.Index()
+		for i, patch := range kust.Patches {
+			p.processPatch(ix, nodeID, i, patch, currentPath, currentRepo)
+		}
+		for i, patch := range kust.PatchesJSON6902 {
+			p.processPatch(ix, nodeID, len(kust.Patches)+i, patch, currentPath, currentRepo)
 		}
 	}
 
 	return nil
 }
 
-// processReference handles bases and components (both can be remote or local)
-func (p *Parser) processReference(parentID, ref, refType, currentPath string, currentRepo *repository.RepositoryInfo) error {
-	log.Printf("Processing %s: %s", refType, ref)
+// processGenerator adds a generator node for the index-th configMapGenerator/secretGenerator
+// entry and a file node (edge type "generator") for each of its files/envs paths.
+// Literal-only generators get a node without file edges. An unnamed entry is keyed by
+// its index.
+func (p *Parser) processGenerator(parentID, kind string, index int, gen GeneratorArgs, currentPath string, currentRepo *repository.RepositoryInfo) {
+	genID := fmt.Sprintf("%s:%s/%s", kind, parentID, gen.Name)
+	if gen.Name == "" {
+		genID = fmt.Sprintf("%s:%s/%d", kind, parentID, index)
+	}
+	content := map[string]interface{}{
+		"kind":     kind,
+		"name":     gen.Name,
+		"files":    gen.Files,
+		"envs":     gen.Envs,
+		"literals": gen.Literals,
+	}
+	p.addGeneratorNode(genID, gen.Name, currentPath, content, currentRepo)
+	p.addEdge(parentID, genID, string(OriginGenerator))
 
-	// Check if it's a YAML file
-	if isYAMLFile(ref) {
-		resourcePath := path.Join(currentPath, ref)
-		childID := p.buildNodeID(currentRepo, resourcePath)
-		p.addNode(childID, "resource", resourcePath, nil, currentRepo.BaseURL)
-		p.addEdge(parentID, childID, refType)
+	var files []string
+	for _, f := range gen.Files {
+		// files entries may be "key=path"; only the path matters for the graph
+		if idx := strings.Index(f, "="); idx >= 0 {
+			f = f[idx+1:]
+		}
+		files = append(files, f)
+	}
+	files = append(files, gen.Envs...)
+
+	for _, f := range files {
+		if f == "" {
+			continue
+		}
+		p.addFileReference(genID, f, string(OriginGenerator), currentPath, currentRepo)
+	}
+}
+
+// processHelmChart adds a helm node for a helmCharts entry, shared by every kustomization
+// using the same repo, name and version, and a file node for its valuesFile, linked
+// from the chart node (edge type "values"). Charts aren't fetched.
+func (p *Parser) processHelmChart(parentID string, chart HelmChart, currentPath string, currentRepo *repository.RepositoryInfo) {
+	chartID := chart.Name
+	if chart.Repo != "" {
+		chartID = strings.TrimSuffix(chart.Repo, "/") + "/" + chartID
+	}
+	label := chart.Name
+	if chart.Version != "" {
+		chartID += "@" + chart.Version
+		label += "@" + chart.Version
+	}
+	chartID = "helm:" + chartID
+
+	p.addNode(chartID, "helm", chart.Name, nil, nil)
+	p.updateNode(chartID, func(data *types.ElementData) {
+		data.Label = label
+		data.Content = map[string]interface{}{
+			"repo":    chart.Repo,
+			"name":    chart.Name,
+			"version": chart.Version,
+		}
+	})
+	p.addEdge(parentID, chartID, string(OriginHelm))
+
+	if chart.ValuesFile != "" {
+		p.addFileReference(chartID, chart.ValuesFile, string(OriginValues), currentPath, currentRepo)
+	}
+}
+
+// processPatch adds a patch node for a patches entry, the file at its path or, for an
+// inline patch, a node of its own, with its target in the content (see
+// types.Graph.OrphanedPatches). The edge (type "patch") is labelled with the target.
+// ix indexes the graph before the kustomization's patches were added.
+func (p *Parser) processPatch(ix *types.GraphIndex, parentID string, index int, patch interface{}, currentPath string, currentRepo *repository.RepositoryInfo) {
+	entry, ok := patch.(map[string]interface{})
+	if !ok {
+		return
+	}
+	patchPath, _ := entry["path"].(string)
+	target, _ := entry["target"].(map[string]interface{})
+
+	if patchPath != "" {
+		patchPath = resolvePath(currentPath, patchPath)
+	}
+	// A patch whose target is found below the kustomization links to the resources it
+	// modifies; otherwise it stays a standalone patch node
+	if matches := p.patchTargets(ix, parentID, target); len(matches) > 0 {
+		for _, id := range matches {
+			p.addLabelledEdge(parentID, id, string(OriginPatch), patchLabel(target))
+		}
+		return
+	}
+
+	var patchID string
+	if patchPath != "" {
+		patchID = p.buildNodeID(currentRepo, patchPath)
+		p.addNode(patchID, "patch", patchPath, nil, currentRepo)
+	} else {
+		patchID = fmt.Sprintf("patch:%s/%d", parentID, index)
+		p.addNode(patchID, "patch", currentPath, nil, currentRepo)
+		p.updateNode(patchID, func(data *types.ElementData) { data.Label = "inline patch" })
+	}
+	if target != nil {
+		p.setNodeContent(patchID, "target", target)
+	}
+	p.addLabelledEdge(parentID, patchID, string(OriginPatch), patchLabel(target))
+}
+
+// patchTargets returns the IDs of the nodes below parentID matching target, the way
+// Graph.OrphanedPatches matches them. Resource files without a known kind are fetched
+// to read the kind and name of their first document.
+func (p *Parser) patchTargets(ix *types.GraphIndex, parentID string, target map[string]interface{}) []string {
+	kind, _ := target["kind"].(string)
+	if kind == "" {
 		return nil
 	}
+	name, _ := target["name"].(string)
 
-	// Parse the reference
-	token := p.tokens[currentRepo.Type]
-	kustomizeRef, err := ParseReference(ref, token)
+	var matches []string
+	for _, id := range ix.Descendants(parentID) {
+		node := ix.Node(id)
+		if node == nil || node.Data.Type == "patch" {
+			continue
+		}
+		if _, known := node.Data.Content["kind"]; !known && node.Data.Type == "resource" && isYAMLFile(node.Data.Path) {
+			p.describeResource(&node.Data)
+		}
+		if k, _ := node.Data.Content["kind"].(string); k != kind {
+			continue
+		}
+		if n, _ := node.Data.Content["name"].(string); name != "" && n != name {
+			continue
+		}
+		matches = append(matches, id)
+	}
+	return matches
+}
+
+// describeResource fetches the resource file of data and records the kind and
+// metadata.name of its first document in its content. Failures are only logged, the
+// kind being recorded as "" so that the file isn't fetched again by the next patch.
+func (p *Parser) describeResource(data *types.ElementData) {
+	if data.Content == nil {
+		data.Content = map[string]interface{}{}
+	}
+	data.Content["kind"] = ""
+
+	repo := p.nodeRepos[data.ID]
+	if repo == nil {
+		return
+	}
+	f := p.fetcher
+	if !sameRepoAsEntry(p.repoInfo, repo) {
+		var err error
+		if f, err = p.getFetcherForRepo(repo, p.tokenFor(repo)); err != nil {
+			log.Printf("Warning: failed to create fetcher for %s: %v", data.ID, err)
+			return
+		}
+	}
+	content, err := f.FetchFile(data.Path)
 	if err != nil {
-		childID := fmt.Sprintf("error:%s", ref)
-		p.addErrorNode(childID, ref, fmt.Sprintf("Failed to parse reference: %v", err), currentRepo.BaseURL)
-		p.addEdge(parentID, childID, refType) // Edge AFTER node creation
+		log.Printf("Warning: failed to fetch resource %s: %v", data.ID, err)
+		return
+	}
+	var doc struct {
+		Kind     string `yaml:"kind"`
+		Metadata struct {
+			Name string `yaml:"name"`
+		} `yaml:"metadata"`
+	}
+	if err := yaml.NewDecoder(bytes.NewReader(content)).Decode(&doc); err != nil || doc.Kind == "" {
+		return
+	}
+	data.Content["kind"] = doc.Kind
+	if doc.Metadata.Name != "" {
+		data.Content["name"] = doc.Metadata.Name
+	}
+}
+
+// patchInfos describes the patches and JSON 6902 patches of kust for the node
+// details, with file paths resolved against currentPath.
+func patchInfos(kust *Kustomization, currentPath string) []types.PatchInfo {
+	var infos []types.PatchInfo
+	for _, list := range []struct {
+		field   string
+		patches []interface{}
+	}{{"patches", kust.Patches}, {"patchesJson6902", kust.PatchesJSON6902}} {
+		for _, patch := range list.patches {
+			entry, ok := patch.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			info := types.PatchInfo{Field: list.field, Target: patchTarget(entry["target"])}
+			if patchPath, _ := entry["path"].(string); patchPath != "" {
+				info.Path = resolvePath(currentPath, patchPath)
+			} else {
+				info.Inline = true
+			}
+			infos = append(infos, info)
+		}
+	}
+	return infos
+}
+
+// patchTarget reads the target selector of a patch entry, nil when there is none
+func patchTarget(value interface{}) *types.PatchTarget {
+	target, ok := value.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	field := func(key string) string {
+		s, _ := target[key].(string)
+		return s
+	}
+	return &types.PatchTarget{
+		Group:              field("group"),
+		Version:            field("version"),
+		Kind:               field("kind"),
+		Name:               field("name"),
+		Namespace:          field("namespace"),
+		LabelSelector:      field("labelSelector"),
+		AnnotationSelector: field("annotationSelector"),
+	}
+}
+
+// patchLabel describes a patch edge by its target: "patch target: Kind/name", or
+// "patch" without target kind.
+func patchLabel(target map[string]interface{}) string {
+	kind, _ := target["kind"].(string)
+	if kind == "" {
+		return string(OriginPatch)
+	}
+	if name, _ := target["name"].(string); name != "" {
+		kind += "/" + name
+	}
+	return "patch target: " + kind
+}
+
+// addFileReference adds a file node for the file at ref, relative to currentPath, and
+// an edge of edgeType from parentID to it. The file isn't fetched.
+func (p *Parser) addFileReference(parentID, ref, edgeType, currentPath string, currentRepo *repository.RepositoryInfo) {
+	filePath := resolvePath(currentPath, ref)
+	fileID := p.buildNodeID(currentRepo, filePath)
+	p.addNode(fileID, "file", filePath, nil, currentRepo)
+	p.addEdge(parentID, fileID, edgeType)
+}
+
+// addGeneratorNode adds a generator node to the graph
+func (p *Parser) addGeneratorNode(id, name, nodePath string, content map[string]interface{}, repo *repository.RepositoryInfo) {
+	for _, elem := range p.graph.Elements {
+		if elem.Group == "nodes" && elem.Data.ID == id {
+			return
+		}
+	}
+
+	label := name
+	if label == "" {
+		label = getShortLabel(nodePath)
+	}
+	p.graph.Elements = append(p.graph.Elements, types.Element{
+		Group: "nodes",
+		Data: types.ElementData{
+			ID:      id,
+			Label:   label,
+			Type:    "generator",
+			Path:    nodePath,
+			Content: content,
+		},
+	})
+
+	p.setNodeRepo(id, repo)
+	log.Printf("Added generator node: %s", id)
+	p.emit(ProgressEvent{Type: EventNodeAdded, NodeID: id, NodeType: "generator", Depth: p.depth})
+}
+
+// reference is a resources/bases or components entry of a kustomization
+type reference struct {
+	ref    string
+	origin ReferenceOrigin // OriginResource, OriginBase or OriginComponent
+}
+
+// resolvedReference is a reference resolved to its target, ready to be added to the graph.
+// nodeType is empty when content holds a kustomization to process; otherwise the target
+// is a leaf node of that type ("resource", "oci", "error" or "missing").
+type resolvedReference struct {
+	origin    ReferenceOrigin     // of the KustomizeReference: edge type and type of the child node
+	kref      *KustomizeReference // the parsed reference; nil for files of the current repository and references failing to parse
+	childID   string
+	childPath string
+	childRepo *repository.RepositoryInfo
+	nodeType  string
+	message   string // error message of "error" and "missing" nodes
+	err       error  // cause of the failure of "error" and "missing" nodes
+	excluded  bool   // matched an Exclude pattern: added as a node without following it
+	remote    bool   // remote reference in LocalOnly mode: added as a node without following it
+	content   string
+}
+
+// UnresolvedReferenceError is a reference that couldn't be resolved, reported by Parse
+// in StrictMode.
+type UnresolvedReferenceError struct {
+	Kustomization string // node ID of the kustomization listing the reference
+	Line          int    // line of the reference in that kustomization file; 0 if unknown
+	Ref           string
+	Err           error
+}
+
+func (e *UnresolvedReferenceError) Error() string {
+	return fmt.Sprintf("%s:%d: unresolved reference %s: %v", e.Kustomization, e.Line, e.Ref, e.Err)
+}
+
+func (e *UnresolvedReferenceError) Unwrap() error {
+	return e.Err
+}
+
+// referenceLines maps the resources/bases/components entries of a kustomization file
+// to the line they are on.
+func referenceLines(content string) map[string]int {
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(content), &doc); err != nil || len(doc.Content) == 0 {
 		return nil
 	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil
+	}
+	lines := make(map[string]int)
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		switch root.Content[i].Value {
+		case "resources", "bases", "components":
+			for _, item := range root.Content[i+1].Content {
+				if _, seen := lines[item.Value]; !seen {
+					lines[item.Value] = item.Line
+				}
+			}
+		}
+	}
+	return lines
+}
+
+// duplicateReferences returns a warning for each target listed more than once across
+// the resources, bases and components of a kustomization (which kustomize rejects),
+// comparing them with KustomizeReference.Equal, so "../base" and "../base/" are
+// duplicates. Warnings are in order of each target's first reference.
+func duplicateReferences(refs []reference, resolved []resolvedReference) []string {
+	var groups [][]int // indexes in refs of the references to each target
+	for i := range resolved {
+		g := slices.IndexFunc(groups, func(group []int) bool { return sameTarget(resolved[group[0]], resolved[i]) })
+		if g < 0 {
+			groups = append(groups, []int{i})
+			continue
+		}
+		groups[g] = append(groups[g], i)
+	}
+
+	var warnings []string
+	for _, group := range groups {
+		if len(group) < 2 {
+			continue
+		}
+		listed := make([]string, len(group))
+		for j, i := range group {
+			listed[j] = fmt.Sprintf("%q", refs[i].ref)
+		}
+		warnings = append(warnings, fmt.Sprintf("duplicate reference to %s: listed %d times (%s)", resolved[group[0]].childID, len(listed), strings.Join(listed, ", ")))
+	}
+	return warnings
+}
+
+// sameTarget reports whether two resolved references point at the same target: equal
+// references when both were parsed with the same type, the same node ID otherwise (a
+// file of the current repository, or a relative and a remote reference to one place).
+func sameTarget(a, b resolvedReference) bool {
+	if a.kref != nil && b.kref != nil && a.kref.Type == b.kref.Type {
+		return a.kref.Equal(b.kref)
+	}
+	return a.childID == b.childID
+}
+
+// resolveReferences resolves refs with up to p.Workers concurrent workers. Results are
+// returned in the order of refs so the graph is built the same way whatever the timing.
+func (p *Parser) resolveReferences(refs []reference, currentPath string, currentRepo *repository.RepositoryInfo) []resolvedReference {
+	results := make([]resolvedReference, len(refs))
+	workers := min(max(p.Workers, 1), len(refs))
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i] = p.resolveReference(refs[i].ref, refs[i].origin, currentPath, currentRepo)
+			}
+		}()
+	}
+	for i := range refs {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	return results
+}
+
+// resolveReference finds what a reference (remote or local) points to and fetches its
+// kustomization. It makes the network calls but doesn't touch the graph, so
+// references can be resolved concurrently.
+func (p *Parser) resolveReference(ref string, origin ReferenceOrigin, currentPath string, currentRepo *repository.RepositoryInfo) resolvedReference {
+	log.Printf("Processing %s: %s", origin, ref)
+
+	// Check if it's a YAML file (of the current repository; remote files are below)
+	if isYAMLFile(ref) && !strings.Contains(ref, "://") {
+		resourcePath := path.Join(currentPath, ref)
+		return resolvedReference{origin: origin, childID: p.buildNodeID(currentRepo, resourcePath), childPath: resourcePath, childRepo: currentRepo, nodeType: "resource"}
+	}
+
+	failed := func(childID, childPath, message string, repo *repository.RepositoryInfo) resolvedReference {
+		return resolvedReference{origin: origin, childID: childID, childPath: childPath, childRepo: repo, nodeType: "error", message: message, err: errors.New(message)}
+	}
+
+	// Not even parsed: detecting the type of an unknown host probes its API
+	if p.LocalOnly && isRemoteReference(ref) {
+		log.Printf("Not following remote %s (local only): %s", origin, ref)
+		return resolvedReference{origin: origin, childID: "remote:" + ref, childPath: ref, remote: true}
+	}
+
+	// Parse the reference
+	kustomizeRef, err := ParseReference(ref, probeToken(ref, p.Tokens))
+	// Detecting the type of an unknown host probed its API
+	probes := 0
+	if errors.Is(err, repository.ErrUnknownRepositoryType) {
+		probes = repository.MaxTypeProbes
+	} else if err == nil && kustomizeRef.RepoInfo != nil {
+		probes = kustomizeRef.RepoInfo.TypeProbes
+	}
+	for ; probes > 0; probes-- {
+		if spendErr := p.budget.spend(); spendErr != nil && err == nil {
+			return failed(fmt.Sprintf("error:%s", ref), ref, spendErr.Error(), currentRepo)
+		}
+	}
+	if err != nil {
+		return failed(fmt.Sprintf("error:%s", ref), ref, fmt.Sprintf("Failed to parse reference: %v", err), currentRepo)
+	}
+	kustomizeRef.Origin = origin
+
+	// OCI artifacts can't be fetched as git repositories; show them as leaf nodes
+	if kustomizeRef.Type == ReferenceOCI {
+		return resolvedReference{origin: kustomizeRef.Origin, kref: kustomizeRef, childID: "oci:" + kustomizeRef.OCI.String(), childPath: kustomizeRef.OCI.String(), nodeType: "oci"}
+	}
 
 	var childFetcher fetcher.Fetcher
 	var childRepo *repository.RepositoryInfo
@@ -166,7 +985,17 @@ func (p *Parser) processReference(parentID, ref, refType, currentPath string, cu
 
 	switch kustomizeRef.Type {
 	case ReferenceRelative:
-		childPath = resolvePath(currentPath, kustomizeRef.RelativePath)
+		// A local root is the entry directory, whose siblings may be reached with "../";
+		// in a remote repository a path above the root can't be fetched
+		var err error
+		if currentRepo.Type == repository.Local {
+			childPath = resolvePath(currentPath, kustomizeRef.RelativePath)
+		} else {
+			childPath, err = ResolveRelative(currentPath, kustomizeRef.RelativePath)
+		}
+		if err != nil {
+			return failed(fmt.Sprintf("error:%s", ref), ref, err.Error(), currentRepo)
+		}
 		childRepo = currentRepo
 		// Use the fetcher for the repo we're currently in. If we're still in the
 		// entry-point repo, use p.fetcher; otherwise create a fetcher for currentRepo
@@ -174,35 +1003,94 @@ func (p *Parser) processReference(parentID, ref, refType, currentPath string, cu
 		if sameRepoAsEntry(p.repoInfo, currentRepo) {
 			childFetcher = p.fetcher
 		} else {
-			tok := p.tokens[currentRepo.Type]
+			tok := p.tokenFor(currentRepo)
 			var err error
 			childFetcher, err = p.getFetcherForRepo(currentRepo, tok)
+			if err != nil {
+				return failed(p.buildNodeID(currentRepo, childPath), childPath, fmt.Sprintf("Failed to create fetcher: %v", err), currentRepo)
+			}
+		}
+
+	case ReferenceLocal:
+		// Never read the local filesystem on behalf of a remote repository
+		if currentRepo.Type != repository.Local {
+			return failed(fmt.Sprintf("error:%s", ref), ref, "Local references are only followed from local repositories", currentRepo)
+		}
+		childRepo = kustomizeRef.RepoInfo
+		childPath = kustomizeRef.Path
+
+		var err error
+		childFetcher, err = p.getFetcherForRepo(childRepo, "")
 		if err != nil {
-			childID := p.buildNodeID(currentRepo, childPath)
-			p.addErrorNode(childID, childPath, fmt.Sprintf("Failed to create fetcher: %v", err), currentRepo.BaseURL)
-			p.addEdge(parentID, childID, refType)
-			return nil
+			return failed(p.buildNodeID(childRepo, childPath), childPath, fmt.Sprintf("Failed to create fetcher: %v", err), childRepo)
 		}
-	}
 
 	case ReferenceRemote:
 		childRepo = kustomizeRef.RepoInfo
 		childPath = kustomizeRef.Path
+		// The fork parent fallback opted into for the entry repo applies to its references
+		childRepo.FollowForkParent = currentRepo.FollowForkParent
+
+		token := p.tokenFor(childRepo)
+		// GitLab URL without "//": find which segments are subgroups/project and which the path
+		if childRepo.AmbiguousProjectPath != "" {
+			if err := p.budget.spend(); err != nil {
+				return failed(fmt.Sprintf("error:%s", ref), ref, err.Error(), currentRepo)
+			}
+			if path, err := repository.ResolveGitLabProjectContext(p.ctx, childRepo, token); err != nil {
+				log.Printf("Warning: failed to resolve GitLab project in %s, assuming %s/%s: %v", childRepo.AmbiguousProjectPath, childRepo.Owner, childRepo.Repo, err)
+			} else {
+				childPath = path
+			}
+		}
+		// Raw file URL: find which segments are the ref and which the path
+		if childRepo.AmbiguousPath != "" {
+			if err := p.budget.spend(); err != nil {
+				return failed(fmt.Sprintf("error:%s", ref), ref, err.Error(), currentRepo)
+			}
+			guessedRef := childRepo.Ref
+			childRepo.Ref = ""
+			if branch, path, err := repository.ResolveBranchAndPathTokens(p.ctx, childRepo, childRepo.AmbiguousPath, p.tokenFor); err != nil {
+				log.Printf("Warning: failed to resolve branch in %s, assuming %s: %v", childRepo.AmbiguousPath, guessedRef, err)
+				childRepo.Ref = guessedRef
+			} else {
+				childRepo.Ref, childPath = branch, path
+			}
+			childRepo.AmbiguousPath = ""
+		}
+		// No ?ref=: use the repository's real default branch
+		if childRepo.Ref == "" {
+			if err := p.budget.spend(); err != nil {
+				return failed(fmt.Sprintf("error:%s", ref), ref, err.Error(), currentRepo)
+			}
+			if _, err := repository.ResolveDefaultBranchContext(p.ctx, childRepo, token); err != nil {
+				log.Printf("Warning: failed to resolve default branch for %s/%s, assuming main: %v", childRepo.Owner, childRepo.Repo, err)
+				childRepo.Ref = "main"
+			}
+		}
+
+		kustomizeRef.Path = childPath
 
-		token := p.tokens[childRepo.Type]
 		var err error
 		childFetcher, err = p.getFetcherForRepo(childRepo, token)
 		if err != nil {
-			childID := p.buildNodeID(childRepo, childPath)
-			p.addErrorNode(childID, childPath, fmt.Sprintf("Failed to create fetcher: %v", err), childRepo.BaseURL)
-			p.addEdge(parentID, childID, refType) // Edge AFTER node creation
-			return nil
+			return failed(p.buildNodeID(childRepo, childPath), childPath, fmt.Sprintf("Failed to create fetcher for %s: %v", kustomizeRef.Pretty(), err), childRepo)
 		}
 	}
 
 	// Build unique node ID
 	childID := p.buildNodeID(childRepo, childPath)
 
+	if p.isExcluded(childRepo, childPath) {
+		log.Printf("Excluded %s: %s", kustomizeRef.Origin, childID)
+		return resolvedReference{origin: kustomizeRef.Origin, kref: kustomizeRef, childID: childID, childPath: childPath, childRepo: childRepo, excluded: true}
+	}
+
+	// A remote file (raw URL) is a leaf: there is no kustomization to fetch
+	if kustomizeRef.Type == ReferenceRemote && isYAMLFile(childPath) {
+		return resolvedReference{origin: kustomizeRef.Origin, kref: kustomizeRef, childID: childID, childPath: childPath, childRepo: childRepo, nodeType: "resource"}
+	}
+
 	// Try to fetch the child kustomization
 	content, err := childFetcher.FindKustomizationInPath(childPath)
 	if err != nil {
@@ -210,21 +1098,70 @@ func (p *Parser) processReference(parentID, ref, refType, currentPath string, cu
 		// shared buffers when multiple requests log concurrently.
 		pathCopy := copyLogArgs(childPath)
 		errStr := copyLogArgs(err.Error())
-		log.Printf("⚠️  Warning: failed to fetch kustomization at %s: %s", pathCopy, errStr)
-		p.addErrorNode(childID, pathCopy, "File not found or inaccessible: "+errStr, childRepo.BaseURL)
-		p.addEdge(parentID, childID, refType)
-		return nil
+		log.Printf("⚠️  Warning: failed to fetch kustomization of %s at %s: %s", kustomizeRef.Pretty(), pathCopy, errStr)
+		if errors.Is(err, fetcher.ErrKustomizationNotFound) {
+			return resolvedReference{origin: kustomizeRef.Origin, kref: kustomizeRef, childID: childID, childPath: pathCopy, childRepo: childRepo, nodeType: "missing", message: errStr, err: err}
+		}
+		r := failed(childID, pathCopy, fmt.Sprintf("File not found or inaccessible (%s): %s", kustomizeRef.Pretty(), errStr), childRepo)
+		r.err = err
+		return r
 	}
 
-	// Add edge BEFORE processing (so the node will exist after processKustomization)
-	p.addEdge(parentID, childID, refType)
+	return resolvedReference{origin: kustomizeRef.Origin, kref: kustomizeRef, childID: childID, childPath: childPath, childRepo: childRepo, content: content}
+}
 
-	// Recursively process the child (creates the node with type = refType: "resource" or "component")
-	return p.processKustomization(childID, content, childPath, childRepo, refType)
+// addReference adds a resolved reference below parentID, recursively processing the
+// kustomization it points to.
+func (p *Parser) addReference(parentID string, r resolvedReference) error {
+	edgeType := string(r.origin)
+	// A legacy base is a resource: only its edge tells it was listed under bases:
+	nodeType := edgeType
+	if r.origin == OriginBase {
+		nodeType = string(OriginResource)
+	}
+	switch {
+	case r.excluded:
+		p.addNode(r.childID, nodeType, r.childPath, nil, r.childRepo)
+		p.updateNode(r.childID, func(data *types.ElementData) { data.Excluded = true })
+	case r.remote:
+		p.addNode(r.childID, nodeType, r.childPath, nil, nil)
+		p.updateNode(r.childID, func(data *types.ElementData) { data.Remote = true })
+	case r.nodeType == "":
+		// Add edge BEFORE processing (so the node will exist after processKustomization)
+		p.addEdge(parentID, r.childID, edgeType)
+
+		// Recursively process the child (creates the node with type = origin: "resource" or "component")
+		p.depth++
+		defer func() { p.depth-- }()
+		if p.depth > p.deepest {
+			p.deepest = p.depth
+			p.emit(ProgressEvent{Type: EventDepthReached, NodeID: r.childID, Depth: p.depth})
+		}
+		return p.processKustomization(r.childID, r.content, r.childPath, r.childRepo, nodeType)
+	case r.nodeType == "error":
+		p.addErrorNode(r.childID, r.childPath, r.message, r.childRepo)
+	case r.nodeType == "missing":
+		p.addMissingNode(r.childID, r.childPath, r.message, r.childRepo)
+	default:
+		p.addNode(r.childID, r.nodeType, r.childPath, nil, r.childRepo)
+	}
+	p.addEdge(parentID, r.childID, edgeType) // Edge AFTER node creation
+	return nil
 }
 
 // addErrorNode adds an error node to the graph
-func (p *Parser) addErrorNode(id, path, errorMessage, baseURL string) {
+func (p *Parser) addErrorNode(id, path, errorMessage string, repo *repository.RepositoryInfo) {
+	p.addFailedNode(id, "error", path, errorMessage, repo)
+}
+
+// addMissingNode adds a "missing" node for a reference whose kustomization doesn't
+// exist (fetcher.ErrKustomizationNotFound), so the rest of the graph is still built.
+func (p *Parser) addMissingNode(id, path, errorMessage string, repo *repository.RepositoryInfo) {
+	p.addFailedNode(id, "missing", path, errorMessage, repo)
+}
+
+// addFailedNode adds a node of the given failure type ("error" or "missing")
+func (p *Parser) addFailedNode(id, nodeType, path, errorMessage string, repo *repository.RepositoryInfo) {
 	// Check if node already exists
 	for _, elem := range p.graph.Elements {
 		if elem.Group == "nodes" && elem.Data.ID == id {
@@ -242,47 +1179,59 @@ func (p *Parser) addErrorNode(id, path, errorMessage, baseURL string) {
 		Data: types.ElementData{
 			ID:      id,
 			Label:   label,
-			Type:    "error",
+			Type:    nodeType,
 			Path:    path,
 			Content: content,
+			Error:   errorMessage,
 		},
 	})
 
-	if baseURL != "" {
-		p.graph.BaseURLs[id] = baseURL
-	}
-	log.Printf("Added error node: %s (error: %s)", copyLogArgs(id), copyLogArgs(errorMessage))
-}
-
-// processResource handles individual YAML resources or kustomization directories
-func (p *Parser) processResource(parentID, resource, currentPath string, currentRepo *repository.RepositoryInfo) error {
-	log.Printf("Processing resource: %s", resource)
-
-	// Check if it's a directory (needs kustomization) or a file
-	if isYAMLFile(resource) {
-		// Direct YAML file - create a resource node
-		resourcePath := path.Join(currentPath, resource)
-		resourceID := p.buildNodeID(currentRepo, resourcePath)
-		p.addNode(resourceID, "resource", resourcePath, nil, currentRepo.BaseURL)
-		p.addEdge(parentID, resourceID, "resource")
-		return nil
-	}
-
-	// It's a directory (or remote repo), treat as a kustomization reference
-	return p.processReference(parentID, resource, "resource", currentPath, currentRepo)
+	p.setNodeRepo(id, repo)
+	log.Printf("Added %s node: %s (error: %s)", nodeType, copyLogArgs(id), copyLogArgs(errorMessage))
+	p.emit(ProgressEvent{Type: EventNodeAdded, NodeID: id, NodeType: nodeType, Depth: p.depth})
 }
 
-// buildNodeID creates a unique identifier for a node
+// buildNodeID creates a unique identifier for a node (see repository.CanonicalNodeID)
 func (p *Parser) buildNodeID(repoInfo *repository.RepositoryInfo, nodePath string) string {
 	if repoInfo == nil {
 		return nodePath
 	}
-	return fmt.Sprintf("%s:%s/%s/%s@%s",
-		repoInfo.Type, repoInfo.Owner, repoInfo.Repo, nodePath, repoInfo.Ref)
+	return repository.CanonicalNodeID(repoInfo, repoInfo.Ref, nodePath)
+}
+
+// setNodeRepo records the repository a node comes from (and its base URL for build),
+// and sets the node's Host/Owner/Repo/Ref so consumers don't parse them from the ID,
+// and its Color by repository. A repository resolved via its fork parent is recorded
+// in the node's "resolvedFromFork" content.
+func (p *Parser) setNodeRepo(id string, repo *repository.RepositoryInfo) {
+	if repo == nil {
+		return
+	}
+	p.nodeRepos[id] = repo
+	if repo.BaseURL != "" {
+		p.graph.BaseURLs[id] = repo.BaseURL
+	}
+	for i := range p.graph.Elements {
+		elem := &p.graph.Elements[i]
+		if elem.Group == "nodes" && elem.Data.ID == id {
+			elem.Data.Host = repo.Host()
+			elem.Data.Owner = repo.Owner
+			elem.Data.Repo = repo.Repo
+			elem.Data.Ref = repo.Ref
+			elem.Data.Color = types.RepoColor(repo.Owner, repo.Repo)
+			if repo.ResolvedFromFork != "" {
+				if elem.Data.Content == nil {
+					elem.Data.Content = map[string]interface{}{}
+				}
+				elem.Data.Content["resolvedFromFork"] = repo.ResolvedFromFork
+			}
+			return
+		}
+	}
 }
 
 // addNode adds a node to the graph
-func (p *Parser) addNode(id, nodeType, nodePath string, kust *Kustomization, baseURL string) {
+func (p *Parser) addNode(id, nodeType, nodePath string, kust *Kustomization, repo *repository.RepositoryInfo) {
 	var content map[string]interface{}
 	if kust != nil {
 		content = map[string]interface{}{
@@ -291,6 +1240,45 @@ func (p *Parser) addNode(id, nodeType, nodePath string, kust *Kustomization, bas
 			"components": kust.Components,
 			"patches":    kust.Patches,
 		}
+		if len(kust.ConfigMapGenerator) > 0 {
+			content["configMapGenerator"] = kust.ConfigMapGenerator
+		}
+		if len(kust.SecretGenerator) > 0 {
+			content["secretGenerator"] = kust.SecretGenerator
+		}
+		if len(kust.Images) > 0 {
+			content["images"] = kust.Images
+		}
+		if len(kust.Replacements) > 0 {
+			content["replacements"] = kust.Replacements
+		}
+		if len(kust.Vars) > 0 {
+			content["vars"] = kust.Vars
+		}
+		if kust.OpenAPI != (OpenAPISpec{}) {
+			content["openapi"] = kust.OpenAPI
+		}
+		if len(kust.CRDs) > 0 {
+			content["crds"] = kust.CRDs
+		}
+		if len(kust.HelmCharts) > 0 {
+			content["helmCharts"] = kust.HelmCharts
+		}
+		if len(kust.BuildMetadata) > 0 {
+			content["buildMetadata"] = kust.BuildMetadata
+		}
+		if kust.SortOptions != nil {
+			content["sortOptions"] = kust.SortOptions
+		}
+		for key, value := range map[string]string{
+			"namespace":  kust.Namespace,
+			"namePrefix": kust.NamePrefix,
+			"nameSuffix": kust.NameSuffix,
+		} {
+			if value != "" {
+				content[key] = value
+			}
+		}
 	}
 	label := getShortLabel(nodePath)
 	newData := types.ElementData{
@@ -301,35 +1289,153 @@ func (p *Parser) addNode(id, nodeType, nodePath string, kust *Kustomization, bas
 		Content: content,
 	}
 
-	// If a node with this ID already exists, replace it only if it was an error node
+	// If a node with this ID already exists, replace it only if it was an error/missing node
 	// (so that a later successful resolution wins over an earlier failed fetch).
 	for i := range p.graph.Elements {
 		elem := &p.graph.Elements[i]
 		if elem.Group == "nodes" && elem.Data.ID == id {
-			if elem.Data.Type == "error" {
+			if elem.Data.Type == "error" || elem.Data.Type == "missing" {
 				elem.Data = newData
-				log.Printf("Replaced error node with success node: %s (type: %s)", id, nodeType)
-			}
-			if baseURL != "" {
-				p.graph.BaseURLs[id] = baseURL
+				log.Printf("Replaced failed node with success node: %s (type: %s)", id, nodeType)
 			}
+			p.setNodeRepo(id, repo)
 			return
 		}
 	}
 
-	if baseURL != "" {
-		p.graph.BaseURLs[id] = baseURL
-	}
 	p.graph.Elements = append(p.graph.Elements, types.Element{
 		Group: "nodes",
 		Data:  newData,
 	})
+	p.setNodeRepo(id, repo)
 	log.Printf("Added node: %s (type: %s)", id, nodeType)
+	p.emit(ProgressEvent{Type: EventNodeAdded, NodeID: id, NodeType: nodeType, Depth: p.depth})
+}
+
+// isRemoteReference reports whether ref is a reference to a git repository
+// (https://, http://, ssh:// or git@), as opposed to a path or an OCI artifact.
+func isRemoteReference(ref string) bool {
+	for _, prefix := range []string{"https://", "http://", "ssh://", "git@"} {
+		if strings.HasPrefix(ref, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// referenceHost returns the host of a remote reference (see isRemoteReference), ""
+// for other references. The port of an ssh:// URL is left out, as for its API host.
+func referenceHost(ref string) string {
+	if rest, ok := strings.CutPrefix(ref, "git@"); ok {
+		host, _, _ := strings.Cut(rest, ":")
+		return host
+	}
+	u, err := url.Parse(ref)
+	if err != nil || !isRemoteReference(ref) {
+		return ""
+	}
+	if u.Scheme == "ssh" {
+		return u.Hostname()
+	}
+	return u.Host
+}
+
+// isExcluded reports whether the kustomization at nodePath in repo matches an Exclude pattern
+func (p *Parser) isExcluded(repo *repository.RepositoryInfo, nodePath string) bool {
+	if len(p.Exclude) == 0 {
+		return false
+	}
+	segments := strings.Split(path.Join(repo.Owner, repo.Repo, nodePath), "/")
+	for _, pattern := range p.Exclude {
+		for n := 1; n <= len(segments); n++ {
+			if ok, _ := path.Match(pattern, strings.Join(segments[:n], "/")); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// updateNode applies update to the data of an existing node
+func (p *Parser) updateNode(id string, update func(*types.ElementData)) {
+	for i := range p.graph.Elements {
+		elem := &p.graph.Elements[i]
+		if elem.Group == "nodes" && elem.Data.ID == id {
+			update(&elem.Data)
+			return
+		}
+	}
+}
+
+// setNodeContent sets a content key on an existing node
+func (p *Parser) setNodeContent(id, key string, value interface{}) {
+	for i := range p.graph.Elements {
+		elem := &p.graph.Elements[i]
+		if elem.Group == "nodes" && elem.Data.ID == id {
+			if elem.Data.Content == nil {
+				elem.Data.Content = map[string]interface{}{}
+			}
+			elem.Data.Content[key] = value
+			return
+		}
+	}
+}
+
+// resolvedNodes counts the nodes of the graph that aren't errors or missing kustomizations
+func (p *Parser) resolvedNodes() int {
+	n := 0
+	for _, elem := range p.graph.Elements {
+		if elem.Group == "nodes" && elem.Data.Type != "error" && elem.Data.Type != "missing" {
+			n++
+		}
+	}
+	return n
+}
+
+// disambiguateLabels appends a repo hint to node labels shared by nodes from different
+// repositories. The hint is the repo name, or owner/repo when repo names also collide.
+func (p *Parser) disambiguateLabels() {
+	byLabel := make(map[string][]int)
+	for i, elem := range p.graph.Elements {
+		if elem.Group == "nodes" && p.nodeRepos[elem.Data.ID] != nil {
+			byLabel[elem.Data.Label] = append(byLabel[elem.Data.Label], i)
+		}
+	}
+
+	for label, indexes := range byLabel {
+		repos := make(map[string]bool)
+		repoNames := make(map[string]map[string]bool) // repo name -> owners
+		for _, i := range indexes {
+			repo := p.nodeRepos[p.graph.Elements[i].Data.ID]
+			repos[repo.Owner+"/"+repo.Repo] = true
+			if repoNames[repo.Repo] == nil {
+				repoNames[repo.Repo] = make(map[string]bool)
+			}
+			repoNames[repo.Repo][repo.Owner] = true
+		}
+		if len(repos) < 2 {
+			continue
+		}
+		for _, i := range indexes {
+			repo := p.nodeRepos[p.graph.Elements[i].Data.ID]
+			hint := repo.Repo
+			if len(repoNames[repo.Repo]) > 1 {
+				hint = repo.Owner + "/" + repo.Repo
+			}
+			p.graph.Elements[i].Data.Label = fmt.Sprintf("%s (%s)", label, hint)
+		}
+	}
 }
 
 // addEdge adds an edge to the graph
 func (p *Parser) addEdge(sourceID, targetID, edgeType string) {
-	edgeID := fmt.Sprintf("%s->%s", sourceID, targetID)
+	p.addLabelledEdge(sourceID, targetID, edgeType, edgeType)
+}
+
+// addLabelledEdge adds an edge whose Label describes the relationship; addEdge labels
+// edges with their type ("resource", "component"...).
+func (p *Parser) addLabelledEdge(sourceID, targetID, edgeType, label string) {
+	edgeID := types.EdgeID(sourceID, edgeType, targetID)
 
 	// Check if edge already exists
 	for _, elem := range p.graph.Elements {
@@ -342,6 +1448,7 @@ func (p *Parser) addEdge(sourceID, targetID, edgeType string) {
 		Group: "edges",
 		Data: types.ElementData{
 			ID:       edgeID,
+			Label:    label,
 			Source:   sourceID,
 			Target:   targetID,
 			EdgeType: edgeType,
@@ -370,6 +1477,22 @@ func resolvePath(basePath, relativePath string) string {
 	return path.Join(basePath, relativePath)
 }
 
+// ErrEscapesRepoRoot is returned by ResolveRelative when a relative reference climbs
+// above the repository root.
+var ErrEscapesRepoRoot = errors.New("relative reference escapes the repository root")
+
+// ResolveRelative resolves a relative reference (rel, e.g. "../../shared/base" or
+// "./nodeset") against base, the repository path of the kustomization referencing it.
+// ".." segments are normalized; an error wrapping ErrEscapesRepoRoot is returned when
+// the result would be above the repository root.
+func ResolveRelative(base, rel string) (string, error) {
+	resolved := resolvePath(base, rel)
+	if resolved == ".." || strings.HasPrefix(resolved, "../") {
+		return "", fmt.Errorf("%w: %s from %s", ErrEscapesRepoRoot, rel, base)
+	}
+	return resolved, nil
+}
+
 // maxLabelLenMulti is the max length when the label is multiple path segments (e.g. "base/app").
 const maxLabelLenMulti = 35
 
@@ -1,12 +1,22 @@
 package parser
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/cjeanner/kustomap/internal/fetcher"
 	"github.com/cjeanner/kustomap/internal/repository"
 	"github.com/cjeanner/kustomap/internal/types"
+	"gopkg.in/yaml.v3"
 )
 
 func TestIsYAMLFile(t *testing.T) {
@@ -58,6 +68,60 @@ func TestResolvePath(t *testing.T) {
 	}
 }
 
+func TestResolveRelative(t *testing.T) {
+	cases := []struct {
+		name    string
+		base    string
+		rel     string
+		want    string
+		escapes bool
+	}{
+		{"sibling", "overlays/prod", "../base", "overlays/base", false},
+		{"climbs to a shared base", "envs/prod/eu", "../../shared/base", "envs/shared/base", false},
+		{"dot-slash prefix", "components/dataplane", "./nodeset", "components/dataplane/nodeset", false},
+		{"implicit relative", "overlay", "patches", "overlay/patches", false},
+		{"back to the root", "overlay", "..", ".", false},
+		{"escapes by one level", "overlay", "../../base", "", true},
+		{"escapes from the root", "", "../base", "", true},
+		{"escapes after normalizing", "a/b", "./../../../x", "", true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := ResolveRelative(c.base, c.rel)
+			if c.escapes {
+				if !errors.Is(err, ErrEscapesRepoRoot) {
+					t.Errorf("ResolveRelative(%q, %q) error = %v, want ErrEscapesRepoRoot", c.base, c.rel, err)
+				}
+				return
+			}
+			if err != nil || got != c.want {
+				t.Errorf("ResolveRelative(%q, %q) = %q, %v; want %q", c.base, c.rel, got, err, c.want)
+			}
+		})
+	}
+}
+
+// TestProcessReference_RelativeEscapingRoot ensures a relative reference climbing above
+// a remote repository's root becomes an error node instead of a broken path.
+func TestProcessReference_RelativeEscapingRoot(t *testing.T) {
+	repo := &repository.RepositoryInfo{Type: repository.GitHub, Owner: "org", Repo: "app", Ref: "main"}
+	f := &mockFetcher{PathToContent: map[string]string{"overlay": "resources:\n  - ../../outside\n"}}
+
+	graph, err := NewParser(f, repo).Parse("overlay")
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	for _, elem := range graph.Elements {
+		if elem.Group == "nodes" && elem.Data.ID == "error:../../outside" {
+			if elem.Data.Type != "error" {
+				t.Errorf("node Type = %s, want error", elem.Data.Type)
+			}
+			return
+		}
+	}
+	t.Errorf("no error node for the escaping reference: %+v", graph.Elements)
+}
+
 func TestGetShortLabel(t *testing.T) {
 	cases := []struct {
 		name string
@@ -116,13 +180,18 @@ func TestSameRepoAsEntry(t *testing.T) {
 
 // mockFetcher implements fetcher.Fetcher for tests. PathToContent maps path -> kustomization content;
 // PathToError maps path -> error for FindKustomizationInPath. If path is in PathToError, that error is returned.
+// Files maps path -> file content for FetchFile.
 type mockFetcher struct {
 	PathToContent map[string]string
 	PathToError   map[string]error
+	Files         map[string]string
 	ListFilesErr  error
 }
 
 func (m *mockFetcher) FetchFile(path string) ([]byte, error) {
+	if content, ok := m.Files[path]; ok {
+		return []byte(content), nil
+	}
 	return nil, errors.New("not implemented")
 }
 
@@ -239,3 +308,1881 @@ resources: [dataplane-deployment.yaml]
 		t.Errorf("deployment node should not be an error (relative ref must use current-repo fetcher, not entry fetcher): content=%v", deploymentNode.Data.Content)
 	}
 }
+
+// TestProcessKustomization_Generators ensures configMapGenerator/secretGenerator files and envs
+// become file nodes (relative to the kustomization) linked with "generator" edges, and that a
+// literal-only generator still gets a node but no file edges.
+func TestProcessKustomization_Generators(t *testing.T) {
+	repo := &repository.RepositoryInfo{Type: repository.GitHub, Owner: "o", Repo: "r", Ref: "main"}
+	f := &mockFetcher{
+		PathToContent: map[string]string{
+			"overlay": `apiVersion: kustomize.config.k8s.io/v1beta1
+kind: Kustomization
+configMapGenerator:
+  - name: app-config
+    files:
+      - configs/app.properties
+      - extra=configs/extra.conf
+  - name: literal-only
+    literals:
+      - FOO=bar
+secretGenerator:
+  - name: app-secret
+    envs:
+      - secrets/app.env
+`,
+		},
+	}
+
+	p := NewParser(f, repo)
+	graph, err := p.Parse("overlay")
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	nodes := map[string]types.ElementData{}
+	edgesFrom := map[string][]types.ElementData{}
+	for _, e := range graph.Elements {
+		if e.Group == "nodes" {
+			nodes[e.Data.ID] = e.Data
+		} else {
+			edgesFrom[e.Data.Source] = append(edgesFrom[e.Data.Source], e.Data)
+		}
+	}
+
+	overlayID := p.buildNodeID(repo, "overlay")
+	for _, genID := range []string{
+		"configMapGenerator:" + overlayID + "/app-config",
+		"secretGenerator:" + overlayID + "/app-secret",
+	} {
+		if nodes[genID].Type != "generator" {
+			t.Errorf("expected generator node %q, got %+v", genID, nodes[genID])
+		}
+	}
+
+	for _, wantPath := range []string{"overlay/configs/app.properties", "overlay/configs/extra.conf", "overlay/secrets/app.env"} {
+		id := p.buildNodeID(repo, wantPath)
+		n, ok := nodes[id]
+		if !ok {
+			t.Errorf("expected file node %q", id)
+			continue
+		}
+		if n.Type != "file" || n.Path != wantPath {
+			t.Errorf("file node %q = type %q path %q, want file %q", id, n.Type, n.Path, wantPath)
+		}
+	}
+
+	ref, err := ParseReference("configs/app.properties", "")
+	if err != nil {
+		t.Fatalf("ParseReference: %v", err)
+	}
+	if ref.Type != ReferenceRelative {
+		t.Errorf("generator file reference Type = %q, want relative", ref.Type)
+	}
+
+	appEdges := edgesFrom["configMapGenerator:"+overlayID+"/app-config"]
+	if len(appEdges) != 2 {
+		t.Errorf("app-config edges = %d, want 2", len(appEdges))
+	}
+	for _, e := range appEdges {
+		if e.EdgeType != "generator" {
+			t.Errorf("edge %q type = %q, want generator", e.ID, e.EdgeType)
+		}
+	}
+
+	literalID := "configMapGenerator:" + overlayID + "/literal-only"
+	if _, ok := nodes[literalID]; !ok {
+		t.Errorf("expected node for literal-only generator %q", literalID)
+	}
+	if n := len(edgesFrom[literalID]); n != 0 {
+		t.Errorf("literal-only generator should have no file edges, got %d", n)
+	}
+}
+
+// TestProcessKustomization_UnnamedGenerators ensures unnamed generator entries (the
+// name may come from generatorOptions or a later patch) each get their own node.
+func TestProcessKustomization_UnnamedGenerators(t *testing.T) {
+	repo := &repository.RepositoryInfo{Type: repository.GitHub, Owner: "o", Repo: "r", Ref: "main"}
+	f := &mockFetcher{PathToContent: map[string]string{
+		"overlay": "configMapGenerator:\n  - files:\n      - a.properties\n  - files:\n      - b.properties\n",
+	}}
+	p := NewParser(f, repo)
+	graph, err := p.Parse("overlay")
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	overlayID := p.buildNodeID(repo, "overlay")
+	edgesFrom := map[string][]string{}
+	for _, e := range graph.Elements {
+		if e.Group == "edges" {
+			edgesFrom[e.Data.Source] = append(edgesFrom[e.Data.Source], e.Data.Target)
+		}
+	}
+	for i, file := range []string{"overlay/a.properties", "overlay/b.properties"} {
+		genID := fmt.Sprintf("configMapGenerator:%s/%d", overlayID, i)
+		if want := []string{p.buildNodeID(repo, file)}; !slices.Equal(edgesFrom[genID], want) {
+			t.Errorf("edges from %s = %q, want %q", genID, edgesFrom[genID], want)
+		}
+	}
+}
+
+func TestProcessKustomization_Replacements(t *testing.T) {
+	repo := &repository.RepositoryInfo{Type: repository.GitHub, Owner: "o", Repo: "r", Ref: "main"}
+	f := &mockFetcher{
+		PathToContent: map[string]string{
+			"overlay": `apiVersion: kustomize.config.k8s.io/v1beta1
+kind: Kustomization
+replacements:
+  - path: replacements/image-tag.yaml
+  - path: ../shared/replacements.yaml
+  - source:
+      kind: ConfigMap
+      name: app-config
+      fieldPath: data.host
+    targets:
+      - select:
+          kind: Deployment
+        fieldPaths:
+          - spec.template.spec.containers.0.env.0.value
+`,
+		},
+	}
+
+	p := NewParser(f, repo)
+	graph, err := p.Parse("overlay")
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	overlayID := p.buildNodeID(repo, "overlay")
+	nodes := map[string]types.ElementData{}
+	var targets []string
+	for _, e := range graph.Elements {
+		if e.Group == "nodes" {
+			nodes[e.Data.ID] = e.Data
+		} else if e.Data.Source == overlayID {
+			if e.Data.EdgeType != "replacement" {
+				t.Errorf("edge %s -> %s type = %q, want replacement", e.Data.Source, e.Data.Target, e.Data.EdgeType)
+			}
+			targets = append(targets, e.Data.Target)
+		}
+	}
+	want := []string{p.buildNodeID(repo, "overlay/replacements/image-tag.yaml"), p.buildNodeID(repo, "shared/replacements.yaml")}
+	if len(targets) != len(want) {
+		t.Fatalf("replacement edges to %v, want %v (inline replacements get no edge)", targets, want)
+	}
+	for _, id := range want {
+		if nodes[id].Type != "file" {
+			t.Errorf("node %s type = %q, want file", id, nodes[id].Type)
+		}
+	}
+	if repls, _ := nodes[overlayID].Content["replacements"].([]ReplacementEntry); len(repls) != 3 {
+		t.Errorf("root content replacements = %v, want the 3 entries", nodes[overlayID].Content["replacements"])
+	}
+}
+
+func TestProcessKustomization_Schemas(t *testing.T) {
+	content := `apiVersion: kustomize.config.k8s.io/v1beta1
+kind: Kustomization
+openapi:
+  path: schemas/custom.json
+crds:
+  - crds/widget.yaml
+  - ../shared/crds/gadget.yaml
+`
+	var kust Kustomization
+	if err := yaml.Unmarshal([]byte(content), &kust); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if kust.OpenAPI.Path != "schemas/custom.json" || len(kust.CRDs) != 2 {
+		t.Fatalf("Unmarshal = openapi %+v, crds %v", kust.OpenAPI, kust.CRDs)
+	}
+
+	repo := &repository.RepositoryInfo{Type: repository.GitHub, Owner: "o", Repo: "r", Ref: "main"}
+	p := NewParser(&mockFetcher{PathToContent: map[string]string{"overlay": content}}, repo)
+	graph, err := p.Parse("overlay")
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	overlayID := p.buildNodeID(repo, "overlay")
+	nodes := map[string]types.ElementData{}
+	edgeTypes := map[string]string{}
+	for _, e := range graph.Elements {
+		if e.Group == "nodes" {
+			nodes[e.Data.ID] = e.Data
+		} else if e.Data.Source == overlayID {
+			edgeTypes[e.Data.Target] = e.Data.EdgeType
+		}
+	}
+	want := map[string]string{
+		p.buildNodeID(repo, "overlay/schemas/custom.json"): "schema",
+		p.buildNodeID(repo, "overlay/crds/widget.yaml"):    "crd",
+		p.buildNodeID(repo, "shared/crds/gadget.yaml"):     "crd",
+	}
+	if len(edgeTypes) != len(want) {
+		t.Errorf("edges from overlay = %v, want %v", edgeTypes, want)
+	}
+	for id, edgeType := range want {
+		if edgeTypes[id] != edgeType {
+			t.Errorf("edge to %s type = %q, want %q", id, edgeTypes[id], edgeType)
+		}
+		if nodes[id].Type != "file" {
+			t.Errorf("node %s type = %q, want file", id, nodes[id].Type)
+		}
+	}
+
+	// A builtin schema version has no file to link
+	p = NewParser(&mockFetcher{PathToContent: map[string]string{"overlay": "openapi:\n  version: v1.21.2\n"}}, repo)
+	graph, err = p.Parse("overlay")
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if len(graph.Elements) != 1 {
+		t.Errorf("openapi version only: got %d elements, want just the overlay node", len(graph.Elements))
+	}
+}
+
+func TestProcessKustomization_HelmCharts(t *testing.T) {
+	repo := &repository.RepositoryInfo{Type: repository.GitHub, Owner: "o", Repo: "r", Ref: "main"}
+	f := &mockFetcher{
+		PathToContent: map[string]string{
+			"overlay": `resources:
+  - ../base
+helmCharts:
+  - name: redis
+    repo: https://charts.bitnami.com/bitnami/
+    version: 18.1.0
+    releaseName: cache
+    valuesFile: values/redis.yaml
+  - name: local-chart
+`,
+			"base": `helmCharts:
+  - name: redis
+    repo: https://charts.bitnami.com/bitnami
+    version: 18.1.0
+`,
+		},
+	}
+
+	p := NewParser(f, repo)
+	graph, err := p.Parse("overlay")
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	nodes := map[string]types.ElementData{}
+	edges := map[string]string{}
+	for _, e := range graph.Elements {
+		if e.Group == "nodes" {
+			nodes[e.Data.ID] = e.Data
+		} else {
+			edges[e.Data.Source+" -> "+e.Data.Target] = e.Data.EdgeType
+		}
+	}
+
+	redisID := "helm:https://charts.bitnami.com/bitnami/redis@18.1.0"
+	if n := nodes[redisID]; n.Type != "helm" || n.Label != "redis@18.1.0" || n.Content["version"] != "18.1.0" {
+		t.Errorf("redis node = %+v, want a helm node labelled redis@18.1.0", n)
+	}
+	if n := nodes["helm:local-chart"]; n.Type != "helm" || n.Label != "local-chart" {
+		t.Errorf("local-chart node = %+v, want a helm node labelled local-chart", n)
+	}
+
+	overlayID := p.buildNodeID(repo, "overlay")
+	baseID := p.buildNodeID(repo, "base")
+	valuesID := p.buildNodeID(repo, "overlay/values/redis.yaml")
+	want := map[string]string{
+		overlayID + " -> " + baseID:        "resource",
+		overlayID + " -> " + redisID:       "helm",
+		overlayID + " -> helm:local-chart": "helm",
+		redisID + " -> " + valuesID:        "values",
+		baseID + " -> " + redisID:          "helm",
+	}
+	if len(edges) != len(want) {
+		t.Errorf("edges = %v, want %v", edges, want)
+	}
+	for edge, edgeType := range want {
+		if edges[edge] != edgeType {
+			t.Errorf("edge %s type = %q, want %q", edge, edges[edge], edgeType)
+		}
+	}
+	if nodes[valuesID].Type != "file" {
+		t.Errorf("values node type = %q, want file", nodes[valuesID].Type)
+	}
+}
+
+func TestProcessKustomization_Patches(t *testing.T) {
+	repo := &repository.RepositoryInfo{Type: repository.GitHub, Owner: "o", Repo: "r", Ref: "main"}
+	f := &mockFetcher{PathToContent: map[string]string{
+		"overlay": `resources:
+  - ../base
+patches:
+  - path: patches/nodeset.yaml
+    target:
+      kind: OpenStackDataPlaneNodeSet
+  - path: patches/replicas.yaml
+    target:
+      kind: Deployment
+      name: web
+  - patch: |-
+      - op: replace
+        path: /spec/replicas
+        value: 3
+  - path: patches/no-target.yaml
+`,
+		"base": "resources: []\n",
+	}}
+
+	p := NewParser(f, repo)
+	graph, err := p.Parse("overlay")
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	nodes := map[string]types.ElementData{}
+	labels := map[string]string{} // edge target -> label
+	for _, e := range graph.Elements {
+		if e.Group == "nodes" {
+			nodes[e.Data.ID] = e.Data
+		} else {
+			labels[e.Data.Target] = e.Data.Label
+		}
+	}
+
+	overlayID := p.buildNodeID(repo, "overlay")
+	nodesetID := p.buildNodeID(repo, "overlay/patches/nodeset.yaml")
+	replicasID := p.buildNodeID(repo, "overlay/patches/replicas.yaml")
+	noTargetID := p.buildNodeID(repo, "overlay/patches/no-target.yaml")
+	inlineID := "patch:" + overlayID + "/2"
+	want := map[string]string{
+		p.buildNodeID(repo, "base"): "resource",
+		nodesetID:                   "patch target: OpenStackDataPlaneNodeSet",
+		replicasID:                  "patch target: Deployment/web",
+		inlineID:                    "patch",
+		noTargetID:                  "patch",
+	}
+	if !reflect.DeepEqual(labels, want) {
+		t.Errorf("edge labels = %v, want %v", labels, want)
+	}
+
+	if n := nodes[nodesetID]; n.Type != "patch" || n.Content["target"] == nil {
+		t.Errorf("nodeset patch node = %+v, want a patch node with its target", n)
+	}
+	if n := nodes[inlineID]; n.Type != "patch" || n.Label != "inline patch" {
+		t.Errorf("inline patch node = %+v, want a patch node labelled inline patch", n)
+	}
+	if orphaned := graph.OrphanedPatches(); len(orphaned) != 2 {
+		t.Errorf("OrphanedPatches() = %v, want the two targeted patches", orphaned)
+	}
+}
+
+func TestProcessKustomization_PatchTargetsResources(t *testing.T) {
+	repo := &repository.RepositoryInfo{Type: repository.GitHub, Owner: "o", Repo: "r", Ref: "main"}
+	f := &mockFetcher{
+		PathToContent: map[string]string{
+			"overlay": `resources:
+  - ../base
+patches:
+  - path: replicas.yaml
+    target:
+      kind: Deployment
+      name: web
+  - path: nodeset.yaml
+    target:
+      kind: OpenStackDataPlaneNodeSet
+`,
+			"base": "resources:\n  - deployment.yaml\n  - service.yaml\n",
+		},
+		Files: map[string]string{
+			"base/deployment.yaml": "apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: web\n",
+			"base/service.yaml":    "apiVersion: v1\nkind: Service\nmetadata:\n  name: web\n",
+		},
+	}
+
+	p := NewParser(f, repo)
+	graph, err := p.Parse("overlay")
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	overlayID := p.buildNodeID(repo, "overlay")
+	deploymentID := p.buildNodeID(repo, "base/deployment.yaml")
+	nodesetID := p.buildNodeID(repo, "overlay/nodeset.yaml")
+	patchEdges := map[string]string{} // target -> label
+	for _, e := range graph.Elements {
+		if e.Group == "edges" && e.Data.EdgeType == "patch" && e.Data.Source == overlayID {
+			patchEdges[e.Data.Target] = e.Data.Label
+		}
+	}
+	want := map[string]string{
+		deploymentID: "patch target: Deployment/web",
+		nodesetID:    "patch target: OpenStackDataPlaneNodeSet",
+	}
+	if !reflect.DeepEqual(patchEdges, want) {
+		t.Errorf("patch edges = %v, want %v", patchEdges, want)
+	}
+
+	ix := graph.Index()
+	if node := ix.Node(p.buildNodeID(repo, "overlay/replicas.yaml")); node != nil {
+		t.Errorf("matched patch kept a standalone node: %+v", node.Data)
+	}
+	if node := ix.Node(nodesetID); node == nil || node.Data.Type != "patch" {
+		t.Errorf("unmatched patch node = %v, want a standalone patch node", node)
+	}
+	if node := ix.Node(deploymentID); node == nil || node.Data.Content["kind"] != "Deployment" {
+		t.Errorf("deployment node = %v, want its kind recorded", node)
+	}
+}
+
+// fetchCountingFetcher is a mockFetcher counting FetchFile calls by path.
+type fetchCountingFetcher struct {
+	*mockFetcher
+	fetches map[string]int
+}
+
+func (f *fetchCountingFetcher) FetchFile(path string) ([]byte, error) {
+	f.fetches[path]++
+	return f.mockFetcher.FetchFile(path)
+}
+
+func TestProcessKustomization_PatchTargetsFetchesResourceOnce(t *testing.T) {
+	repo := &repository.RepositoryInfo{Type: repository.GitHub, Owner: "o", Repo: "r", Ref: "main"}
+	f := &fetchCountingFetcher{mockFetcher: &mockFetcher{
+		PathToContent: map[string]string{
+			"overlay": `resources:
+  - missing.yaml
+  - deployment.yaml
+patches:
+  - path: a.yaml
+    target:
+      kind: Deployment
+  - path: b.yaml
+    target:
+      kind: Deployment
+  - path: c.yaml
+    target:
+      kind: Service
+`,
+		},
+		Files: map[string]string{"overlay/deployment.yaml": "kind: Deployment\nmetadata:\n  name: web\n"},
+	}, fetches: map[string]int{}}
+
+	if _, err := NewParser(f, repo).Parse("overlay"); err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	for _, path := range []string{"overlay/missing.yaml", "overlay/deployment.yaml"} {
+		if n := f.fetches[path]; n != 1 {
+			t.Errorf("%s fetched %d times, want once", path, n)
+		}
+	}
+}
+
+func TestParse_ColorsNodesByRepository(t *testing.T) {
+	repo := &repository.RepositoryInfo{Type: repository.GitHub, Owner: "org", Repo: "app", Ref: "main"}
+	f := &mockFetcher{PathToContent: map[string]string{
+		"overlay": "resources:\n  - ../base\n  - https://github.com/org/lib//deploy?ref=v1\n",
+		"base":    "resources: []\n",
+	}}
+	p := NewParser(f, repo)
+	p.FetcherFactory = func(*repository.RepositoryInfo, string) (fetcher.Fetcher, error) {
+		return &mockFetcher{PathToContent: map[string]string{"deploy": "resources: []\n"}}, nil
+	}
+	graph, err := p.Parse("overlay")
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	colors := map[string]string{}
+	for _, e := range graph.Elements {
+		if e.Group == "nodes" {
+			colors[e.Data.ID] = e.Data.Color
+		}
+	}
+
+	overlay, base, lib := colors["github:org/app/overlay@main"], colors["github:org/app/base@main"], colors["github:org/lib/deploy@v1"]
+	if overlay == "" || overlay != base {
+		t.Errorf("colors of org/app nodes = %q and %q, want the same color", overlay, base)
+	}
+	if lib == "" || lib == overlay {
+		t.Errorf("color of org/lib node = %q, want a color other than org/app's %q", lib, overlay)
+	}
+	if want := types.RepoColor("org", "lib"); lib != want {
+		t.Errorf("color of org/lib node = %q, want RepoColor(org, lib) = %q", lib, want)
+	}
+}
+
+func TestProcessKustomization_PatchDetails(t *testing.T) {
+	repo := &repository.RepositoryInfo{Type: repository.GitHub, Owner: "o", Repo: "r", Ref: "main"}
+	f := &mockFetcher{PathToContent: map[string]string{
+		"overlay": `resources: []
+patches:
+  - path: patches/replicas.yaml
+    target:
+      kind: Deployment
+      name: web
+patchesJson6902:
+  - target:
+      group: apps
+      version: v1
+      kind: Deployment
+      name: web
+    path: patches/image.json
+  - target:
+      version: v1
+      kind: Service
+      name: web
+    patch: |-
+      - op: replace
+        path: /spec/type
+        value: LoadBalancer
+`,
+	}}
+
+	p := NewParser(f, repo)
+	graph, err := p.Parse("overlay")
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	overlay := graph.Index().Node(p.buildNodeID(repo, "overlay"))
+	if overlay == nil {
+		t.Fatal("missing overlay node")
+	}
+	want := []types.PatchInfo{
+		{Field: "patches", Target: &types.PatchTarget{Kind: "Deployment", Name: "web"}, Path: "overlay/patches/replicas.yaml"},
+		{Field: "patchesJson6902", Target: &types.PatchTarget{Group: "apps", Version: "v1", Kind: "Deployment", Name: "web"}, Path: "overlay/patches/image.json"},
+		{Field: "patchesJson6902", Target: &types.PatchTarget{Version: "v1", Kind: "Service", Name: "web"}, Inline: true},
+	}
+	if !reflect.DeepEqual(overlay.Data.Patches, want) {
+		t.Errorf("Patches = %+v, want %+v", overlay.Data.Patches, want)
+	}
+	if _, warnings, err := ParseKustomizationStrict([]byte(f.PathToContent["overlay"])); err != nil || len(warnings) > 0 {
+		t.Errorf("ParseKustomizationStrict = %v, %v, want no warning", warnings, err)
+	}
+}
+
+func TestParse_RecordsForkParentFallback(t *testing.T) {
+	repo := &repository.RepositoryInfo{Type: repository.GitHub, Owner: "upstream", Repo: "r", Ref: "feature/x", ResolvedFromFork: "me/r"}
+	f := &mockFetcher{PathToContent: map[string]string{"overlay": "resources: []\n"}}
+
+	p := NewParser(f, repo)
+	graph, err := p.Parse("overlay")
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	root := graph.Elements[0].Data
+	if root.Content["resolvedFromFork"] != "me/r" {
+		t.Errorf("root content resolvedFromFork = %v, want me/r", root.Content["resolvedFromFork"])
+	}
+}
+
+// forkRefLister lists refs per "owner/repo" and knows each fork's parent.
+type forkRefLister struct {
+	refs    map[string][]string
+	parents map[string]*repository.RepositoryInfo
+}
+
+func (m *forkRefLister) ListBranchesAndTags(repoInfo *repository.RepositoryInfo, _ string) ([]string, error) {
+	return m.refs[repoInfo.Owner+"/"+repoInfo.Repo], nil
+}
+
+func (m *forkRefLister) ParentRepository(repoInfo *repository.RepositoryInfo, _ string) (*repository.RepositoryInfo, error) {
+	return m.parents[repoInfo.Owner+"/"+repoInfo.Repo], nil
+}
+
+func TestParse_ChildReferenceFollowsForkParent(t *testing.T) {
+	repository.SetTestRefLister(&forkRefLister{
+		refs: map[string][]string{
+			"me/repo":       {"main"},
+			"upstream/repo": {"main", "feature/x"},
+		},
+		parents: map[string]*repository.RepositoryInfo{
+			"me/repo": {Type: repository.GitHub, Owner: "upstream", Repo: "repo"},
+		},
+	})
+	defer repository.SetTestRefLister(nil)
+
+	f := &mockFetcher{PathToContent: map[string]string{
+		"overlay": "resources:\n  - https://raw.githubusercontent.com/me/repo/feature/x/deploy/app.yaml\n",
+	}}
+	for _, follow := range []bool{false, true} {
+		t.Run(fmt.Sprintf("FollowForkParent=%v", follow), func(t *testing.T) {
+			repo := &repository.RepositoryInfo{Type: repository.GitHub, Owner: "org", Repo: "app", Ref: "main", FollowForkParent: follow}
+			p := NewParser(f, repo)
+			p.FetcherFactory = func(*repository.RepositoryInfo, string) (fetcher.Fetcher, error) { return f, nil }
+			graph, err := p.Parse("overlay")
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+
+			var child *types.ElementData
+			for i := range graph.Elements {
+				if e := &graph.Elements[i]; e.Group == "nodes" && e.Data.Type == "resource" {
+					child = &e.Data
+				}
+			}
+			if child == nil {
+				t.Fatalf("no node for the child reference in %+v", graph.Elements)
+			}
+			if !follow {
+				if child.Owner != "me" || child.Content["resolvedFromFork"] != nil {
+					t.Errorf("child = %s/%s@%s (from fork %v), want the fork, not its parent", child.Owner, child.Repo, child.Ref, child.Content["resolvedFromFork"])
+				}
+				return
+			}
+			if child.Owner != "upstream" || child.Ref != "feature/x" {
+				t.Errorf("child = %s/%s@%s, want upstream/repo@feature/x", child.Owner, child.Repo, child.Ref)
+			}
+			if child.Content["resolvedFromFork"] != "me/repo" {
+				t.Errorf("child content resolvedFromFork = %v, want me/repo", child.Content["resolvedFromFork"])
+			}
+			if root := graph.Elements[0].Data; root.Content["resolvedFromFork"] != nil {
+				t.Errorf("root content resolvedFromFork = %v, want none", root.Content["resolvedFromFork"])
+			}
+		})
+	}
+}
+
+// parseContextKey tags the context given to Parser.SetContext
+type parseContextKey struct{}
+
+// contextRefLister records whether listings got the context tagged with parseContextKey.
+type contextRefLister struct {
+	sawParseContext bool
+}
+
+func (m *contextRefLister) ListBranchesAndTags(_ *repository.RepositoryInfo, _ string) ([]string, error) {
+	return nil, errors.New("context-less listing should not be used")
+}
+
+func (m *contextRefLister) ListBranchesAndTagsContext(ctx context.Context, _ *repository.RepositoryInfo, _ string) ([]string, error) {
+	m.sawParseContext = ctx.Value(parseContextKey{}) != nil
+	return []string{"main"}, nil
+}
+
+func TestParser_SetContext(t *testing.T) {
+	lister := &contextRefLister{}
+	repository.SetTestRefLister(lister)
+	defer repository.SetTestRefLister(nil)
+
+	repo := &repository.RepositoryInfo{Type: repository.GitHub, Owner: "org", Repo: "app", Ref: "main"}
+	f := &mockFetcher{PathToContent: map[string]string{
+		"overlay": "resources:\n  - https://raw.githubusercontent.com/org/tagged/main/deploy.yaml\n",
+	}}
+	p := NewParser(f, repo)
+	p.FetcherFactory = func(*repository.RepositoryInfo, string) (fetcher.Fetcher, error) { return f, nil }
+	p.SetContext(context.WithValue(context.Background(), parseContextKey{}, true))
+	if _, err := p.Parse("overlay"); err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if !lister.sawParseContext {
+		t.Error("expected the branch listing of the reference to get the parser's context")
+	}
+}
+
+// defaultBranchRefLister is a repository.RefLister that reports a fixed default branch.
+type defaultBranchRefLister struct {
+	branch string
+}
+
+func (m *defaultBranchRefLister) ListBranchesAndTags(_ *repository.RepositoryInfo, _ string) ([]string, error) {
+	return []string{m.branch}, nil
+}
+
+func (m *defaultBranchRefLister) DefaultBranch(_ *repository.RepositoryInfo, _ string) (string, error) {
+	return m.branch, nil
+}
+
+// TestProcessReference_RelativeFromRemoteParent ensures a relative reference of a remote
+// overlay resolves within that overlay's repository and ref, not the entry repository.
+func TestProcessReference_RelativeFromRemoteParent(t *testing.T) {
+	entryRepo := &repository.RepositoryInfo{Type: repository.GitHub, Owner: "org", Repo: "app", Ref: "main"}
+	entryFetcher := &mockFetcher{PathToContent: map[string]string{
+		"overlay": "resources:\n  - https://github.com/org/lib//overlays/prod?ref=v2\n",
+		// same paths as in lib: must not be used for lib's relative references
+		"overlays/shared": "resources: []\n",
+	}}
+	libFetcher := &mockFetcher{PathToContent: map[string]string{
+		"overlays/prod":   "resources:\n  - ../shared\n",
+		"overlays/shared": "resources:\n  - deploy.yaml\n",
+	}}
+	p := NewParser(entryFetcher, entryRepo)
+	p.FetcherFactory = func(repo *repository.RepositoryInfo, _ string) (fetcher.Fetcher, error) {
+		if repo.Owner != "org" || repo.Repo != "lib" || repo.Ref != "v2" {
+			return nil, fmt.Errorf("unexpected fetcher for %s", repo)
+		}
+		return libFetcher, nil
+	}
+
+	graph, err := p.Parse("overlay")
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	nodes := map[string]types.ElementData{}
+	for _, e := range graph.Elements {
+		if e.Group == "nodes" {
+			nodes[e.Data.ID] = e.Data
+		}
+	}
+	shared, ok := nodes["github:org/lib/overlays/shared@v2"]
+	if !ok {
+		t.Fatalf("missing node github:org/lib/overlays/shared@v2 (nodes %v)", nodes)
+	}
+	if shared.Type == "error" || shared.Owner != "org" || shared.Repo != "lib" || shared.Ref != "v2" || shared.Path != "overlays/shared" {
+		t.Errorf("shared node = %+v, want a node of org/lib@v2 at overlays/shared", shared)
+	}
+	if _, ok := nodes["github:org/lib/overlays/shared/deploy.yaml@v2"]; !ok {
+		t.Errorf("missing resource of the shared node (nodes %v)", nodes)
+	}
+	if _, ok := nodes["github:org/app/overlays/shared@main"]; ok {
+		t.Error("relative reference of the remote overlay resolved in the entry repository")
+	}
+}
+
+// TestProcessReference_RemoteComponentRelativeResources recurses into a remote component:
+// its relative resources and components are resolved in the component's repository at
+// the component's ref.
+func TestProcessReference_RemoteComponentRelativeResources(t *testing.T) {
+	entryRepo := &repository.RepositoryInfo{Type: repository.GitHub, Owner: "org", Repo: "app", Ref: "main"}
+	entryFetcher := &mockFetcher{PathToContent: map[string]string{
+		"overlay": "components:\n  - https://github.com/org/components//monitoring?ref=v1\n",
+	}}
+	componentFetcher := &mockFetcher{PathToContent: map[string]string{
+		"monitoring":       "kind: Component\nresources:\n  - ./rules\n  - servicemonitor.yaml\n",
+		"monitoring/rules": "resources:\n  - alerts.yaml\n",
+	}}
+	p := NewParser(entryFetcher, entryRepo)
+	p.FetcherFactory = func(repo *repository.RepositoryInfo, _ string) (fetcher.Fetcher, error) {
+		if repo.Owner != "org" || repo.Repo != "components" || repo.Ref != "v1" {
+			return nil, fmt.Errorf("unexpected fetcher for %s", repo)
+		}
+		return componentFetcher, nil
+	}
+
+	graph, err := p.Parse("overlay")
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	nodes := map[string]types.ElementData{}
+	for _, e := range graph.Elements {
+		if e.Group == "nodes" {
+			nodes[e.Data.ID] = e.Data
+		}
+	}
+	if n := nodes["github:org/components/monitoring@v1"]; n.Type != "component" {
+		t.Errorf("component node = %+v, want a component", n)
+	}
+	for _, id := range []string{
+		"github:org/components/monitoring/rules@v1",
+		"github:org/components/monitoring/servicemonitor.yaml@v1",
+		"github:org/components/monitoring/rules/alerts.yaml@v1",
+	} {
+		n, ok := nodes[id]
+		if !ok {
+			t.Errorf("missing node %s (nodes %v)", id, nodes)
+			continue
+		}
+		if n.Type != "resource" || n.Owner != "org" || n.Repo != "components" || n.Ref != "v1" {
+			t.Errorf("node %s = %+v, want a resource of org/components@v1", id, n)
+		}
+	}
+	if children := graph.Index().Children("github:org/components/monitoring@v1"); len(children) != 2 {
+		t.Errorf("component children = %v, want its 2 resources", children)
+	}
+}
+
+// TestProcessReference_RawGitHubURL follows raw.githubusercontent.com references to
+// the GitHub repository, splitting a branch with slashes from the path.
+func TestProcessReference_RawGitHubURL(t *testing.T) {
+	repository.SetTestRefLister(&defaultBranchRefLister{branch: "release/1.0"})
+	defer repository.SetTestRefLister(nil)
+
+	entryRepo := &repository.RepositoryInfo{Type: repository.GitHub, Owner: "o", Repo: "r", Ref: "main"}
+	entryFetcher := &mockFetcher{PathToContent: map[string]string{
+		"overlay": "resources:\n" +
+			"  - https://raw.githubusercontent.com/other/base/release/1.0/deploy/kustomization.yaml\n" +
+			"  - https://raw.githubusercontent.com/other/base/release/1.0/extra/service.yaml\n",
+	}}
+	var fetched []string
+	p := NewParser(entryFetcher, entryRepo)
+	p.FetcherFactory = func(repo *repository.RepositoryInfo, _ string) (fetcher.Fetcher, error) {
+		fetched = append(fetched, repo.Owner+"/"+repo.Repo+"@"+repo.Ref)
+		return &mockFetcher{PathToContent: map[string]string{"deploy": "resources: []\n"}}, nil
+	}
+
+	graph, err := p.Parse("overlay")
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	nodes := map[string]string{}
+	for _, e := range graph.Elements {
+		if e.Group == "nodes" {
+			nodes[e.Data.ID] = e.Data.Type
+		}
+	}
+	if got := nodes["github:other/base/deploy@release/1.0"]; got != "resource" {
+		t.Errorf("kustomization node type = %q, want resource (nodes %v)", got, nodes)
+	}
+	if got := nodes["github:other/base/extra/service.yaml@release/1.0"]; got != "resource" {
+		t.Errorf("raw file node type = %q, want resource (nodes %v)", got, nodes)
+	}
+	for _, ref := range fetched {
+		if ref != "other/base@release/1.0" {
+			t.Errorf("fetched %s, want other/base@release/1.0", ref)
+		}
+	}
+}
+
+// TestProcessReference_RemoteWithoutRef_UsesDefaultBranch ensures a remote reference
+// without ?ref= is resolved against the repository's default branch, not "main".
+func TestProcessReference_RemoteWithoutRef_UsesDefaultBranch(t *testing.T) {
+	repository.SetTestRefLister(&defaultBranchRefLister{branch: "master"})
+	defer repository.SetTestRefLister(nil)
+
+	entryRepo := &repository.RepositoryInfo{Type: repository.GitHub, Owner: "o", Repo: "r", Ref: "main"}
+	entryFetcher := &mockFetcher{PathToContent: map[string]string{
+		"overlay": "resources:\n  - https://github.com/other/base//deploy\n",
+	}}
+	var fetchedRef string
+	p := NewParser(entryFetcher, entryRepo)
+	p.FetcherFactory = func(repo *repository.RepositoryInfo, _ string) (fetcher.Fetcher, error) {
+		fetchedRef = repo.Ref
+		return &mockFetcher{PathToContent: map[string]string{"deploy": "resources: []\n"}}, nil
+	}
+
+	graph, err := p.Parse("overlay")
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if fetchedRef != "master" {
+		t.Errorf("fetcher created for ref %q, want master", fetchedRef)
+	}
+	wantID := "github:other/base/deploy@master"
+	found := false
+	for _, e := range graph.Elements {
+		if e.Group == "nodes" && e.Data.ID == wantID {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("expected node %q in graph", wantID)
+	}
+}
+
+// TestParse_CanonicalNodeIDs ensures spellings of the same target (case, ".git",
+// trailing slash) share one node.
+func TestParse_CanonicalNodeIDs(t *testing.T) {
+	entryRepo := &repository.RepositoryInfo{Type: repository.GitHub, Owner: "o", Repo: "app", Ref: "main"}
+	entryFetcher := &mockFetcher{PathToContent: map[string]string{
+		"overlay": `resources:
+  - https://github.com/Org/Lib//base?ref=main
+  - https://github.com/org/lib.git//base/?ref=main
+  - ../overlay/../base
+  - ../base/
+`,
+		"base": "resources: []\n",
+	}}
+	p := NewParser(entryFetcher, entryRepo)
+	p.FetcherFactory = func(repo *repository.RepositoryInfo, _ string) (fetcher.Fetcher, error) {
+		return &mockFetcher{PathToContent: map[string]string{"base": "resources: []\n"}}, nil
+	}
+
+	graph, err := p.Parse("overlay")
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	var ids []string
+	for _, e := range graph.Elements {
+		if e.Group == "nodes" {
+			ids = append(ids, e.Data.ID)
+		}
+	}
+	want := []string{"github:o/app/base@main", "github:o/app/overlay@main", "github:org/lib/base@main"}
+	if strings.Join(ids, " ") != strings.Join(want, " ") {
+		t.Errorf("nodes = %v, want %v", ids, want)
+	}
+}
+
+func TestParse_DisambiguateLabels(t *testing.T) {
+	entryRepo := &repository.RepositoryInfo{Type: repository.GitHub, Owner: "o", Repo: "app", Ref: "main"}
+	entryFetcher := &mockFetcher{PathToContent: map[string]string{
+		"overlay": `resources:
+  - https://github.com/org/repoA//base?ref=main
+  - https://github.com/org/repoB//base?ref=main
+  - https://github.com/org/repoA//unique?ref=main
+`,
+	}}
+	newParser := func(disambiguate bool) *Parser {
+		p := NewParser(entryFetcher, entryRepo)
+		p.FetcherFactory = func(repo *repository.RepositoryInfo, _ string) (fetcher.Fetcher, error) {
+			return &mockFetcher{PathToContent: map[string]string{"base": "resources: []\n", "unique": "resources: []\n"}}, nil
+		}
+		p.DisambiguateLabels = disambiguate
+		return p
+	}
+
+	labels := func(g *types.Graph) map[string]string {
+		m := map[string]string{}
+		for _, e := range g.Elements {
+			if e.Group == "nodes" {
+				m[e.Data.ID] = e.Data.Label
+			}
+		}
+		return m
+	}
+
+	graph, err := newParser(true).Parse("overlay")
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	got := labels(graph)
+	want := map[string]string{
+		"github:o/app/overlay@main":    "overlay",
+		"github:org/repoa/base@main":   "base (repoA)",
+		"github:org/repob/base@main":   "base (repoB)",
+		"github:org/repoa/unique@main": "unique",
+	}
+	for id, label := range want {
+		if got[id] != label {
+			t.Errorf("label[%s] = %q, want %q", id, got[id], label)
+		}
+	}
+
+	graph, err = newParser(false).Parse("overlay")
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if l := labels(graph)["github:org/repoa/base@main"]; l != "base" {
+		t.Errorf("without option label = %q, want base", l)
+	}
+}
+
+// TestProcessReference_MissingRemoteComponent ensures a remote component whose path 404s
+// becomes a "missing" node linked by its edge, and its siblings are still processed.
+func TestProcessReference_MissingRemoteComponent(t *testing.T) {
+	entryRepo := &repository.RepositoryInfo{Type: repository.GitHub, Owner: "org", Repo: "app", Ref: "main"}
+	entryFetcher := &mockFetcher{PathToContent: map[string]string{
+		"overlay": `components:
+  - https://github.com/org/components//first?ref=main
+  - https://github.com/org/components//gone?ref=main
+  - https://github.com/org/components//third?ref=main
+`,
+	}}
+	componentsFetcher := &mockFetcher{
+		PathToContent: map[string]string{
+			"first": "kind: Component\n",
+			"third": "kind: Component\n",
+		},
+		PathToError: map[string]error{
+			"gone": fmt.Errorf("%w in path: gone", fetcher.ErrKustomizationNotFound),
+		},
+	}
+
+	p := NewParser(entryFetcher, entryRepo)
+	p.FetcherFactory = func(_ *repository.RepositoryInfo, _ string) (fetcher.Fetcher, error) {
+		return componentsFetcher, nil
+	}
+	graph, err := p.Parse("overlay")
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	nodeTypes := map[string]string{}
+	edges := map[string]string{}
+	var missingErr string
+	for _, e := range graph.Elements {
+		switch e.Group {
+		case "nodes":
+			nodeTypes[e.Data.ID] = e.Data.Type
+			if e.Data.Type == "missing" {
+				missingErr, _ = e.Data.Content["error"].(string)
+			}
+		case "edges":
+			edges[e.Data.Target] = e.Data.EdgeType
+		}
+	}
+
+	want := map[string]string{
+		"github:org/components/first@main": "component",
+		"github:org/components/gone@main":  "missing",
+		"github:org/components/third@main": "component",
+	}
+	for id, typ := range want {
+		if nodeTypes[id] != typ {
+			t.Errorf("node %s type = %q, want %q", id, nodeTypes[id], typ)
+		}
+		if edges[id] != "component" {
+			t.Errorf("edge to %s type = %q, want component", id, edges[id])
+		}
+	}
+	if !strings.Contains(missingErr, fetcher.ErrKustomizationNotFound.Error()) {
+		t.Errorf("missing node error = %q, want it to carry %q", missingErr, fetcher.ErrKustomizationNotFound)
+	}
+}
+
+// TestProcessKustomization_BasesEdgeType ensures legacy bases: are linked with "base"
+// edges, their nodes being resources like those listed under resources:.
+func TestProcessKustomization_BasesEdgeType(t *testing.T) {
+	repo := &repository.RepositoryInfo{Type: repository.GitHub, Owner: "org", Repo: "app", Ref: "main"}
+	f := &mockFetcher{PathToContent: map[string]string{
+		"overlay": "resources:\n  - ../shared\nbases:\n  - ../base\n",
+		"base":    "resources: []\n",
+		"shared":  "resources: []\n",
+	}}
+	graph, err := NewParser(f, repo).Parse("overlay")
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	nodeTypes := map[string]string{}
+	edges := map[string]string{}
+	for _, e := range graph.Elements {
+		switch e.Group {
+		case "nodes":
+			nodeTypes[e.Data.Path] = e.Data.Type
+		case "edges":
+			edges[e.Data.Target] = e.Data.EdgeType
+		}
+	}
+	for path, origin := range map[string]ReferenceOrigin{"base": OriginBase, "shared": OriginResource} {
+		id := "github:org/app/" + path + "@main"
+		if edges[id] != string(origin) {
+			t.Errorf("edge to %s type = %q, want %q", id, edges[id], origin)
+		}
+		if nodeTypes[path] != "resource" {
+			t.Errorf("node %s type = %q, want resource", path, nodeTypes[path])
+		}
+	}
+}
+
+// TestProcessReference_FetchError ensures a reference whose fetch fails (e.g. a bad ref)
+// becomes an "error" node with an edge and an Error message, and the build goes on.
+func TestProcessReference_FetchError(t *testing.T) {
+	entryRepo := &repository.RepositoryInfo{Type: repository.GitHub, Owner: "org", Repo: "app", Ref: "main"}
+	f := &mockFetcher{
+		PathToContent: map[string]string{
+			"overlay": "resources:\n  - ../broken\n  - ../base\n",
+			"base":    "resources:\n  - deploy.yaml\n",
+		},
+		PathToError: map[string]error{"broken": errors.New("404 Not Found")},
+	}
+
+	graph, err := NewParser(f, entryRepo).Parse("overlay")
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	nodes := map[string]types.ElementData{}
+	edges := map[string]bool{}
+	for _, e := range graph.Elements {
+		if e.Group == "nodes" {
+			nodes[e.Data.Path] = e.Data
+		} else {
+			edges[e.Data.Source+">"+e.Data.Target] = true
+		}
+	}
+	broken := nodes["broken"]
+	if broken.Type != "error" || !strings.Contains(broken.Error, "404 Not Found") {
+		t.Errorf("broken node = type %q error %q, want an error node carrying the fetch error", broken.Type, broken.Error)
+	}
+	if !edges["github:org/app/overlay@main>github:org/app/broken@main"] {
+		t.Errorf("no edge from overlay to the error node: %v", edges)
+	}
+	for _, path := range []string{"overlay", "base", "base/deploy.yaml"} {
+		if n, ok := nodes[path]; !ok || n.Error != "" {
+			t.Errorf("node %s = %+v, want it built without error", path, n)
+		}
+	}
+}
+
+func TestParse_StrictMode(t *testing.T) {
+	entryRepo := &repository.RepositoryInfo{Type: repository.GitHub, Owner: "org", Repo: "app", Ref: "main"}
+	f := &mockFetcher{
+		PathToContent: map[string]string{
+			"overlay": "resources:\n  - ../base\n  - ../broken\ncomponents:\n  - ../gone\n",
+			"base":    "resources:\n  - deploy.yaml\n",
+		},
+		PathToError: map[string]error{
+			"broken": errors.New("404 Not Found"),
+			"gone":   fmt.Errorf("%w in path: gone", fetcher.ErrKustomizationNotFound),
+		},
+	}
+
+	// Without StrictMode failures are error/missing nodes
+	if _, err := NewParser(f, entryRepo).Parse("overlay"); err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	p := NewParser(f, entryRepo)
+	p.StrictMode = true
+	graph, err := p.Parse("overlay")
+	if err == nil {
+		t.Fatalf("Parse in strict mode = %d elements, want an error", len(graph.Elements))
+	}
+	joined, ok := err.(interface{ Unwrap() []error })
+	if !ok {
+		t.Fatalf("error %T doesn't join the failures", err)
+	}
+
+	type failure struct {
+		ref  string
+		line int
+	}
+	var got []failure
+	for _, e := range joined.Unwrap() {
+		var unresolved *UnresolvedReferenceError
+		if !errors.As(e, &unresolved) {
+			t.Fatalf("failure %v is not an *UnresolvedReferenceError", e)
+		}
+		if unresolved.Kustomization != "github:org/app/overlay@main" {
+			t.Errorf("%s: Kustomization = %q, want the overlay", unresolved.Ref, unresolved.Kustomization)
+		}
+		got = append(got, failure{unresolved.Ref, unresolved.Line})
+	}
+	want := []failure{{"../broken", 3}, {"../gone", 5}}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("failures = %v, want %v", got, want)
+	}
+	if !errors.Is(err, fetcher.ErrKustomizationNotFound) {
+		t.Errorf("error %v doesn't wrap the fetch error of ../gone", err)
+	}
+	if !strings.Contains(err.Error(), "github:org/app/overlay@main:3: unresolved reference ../broken: 404 Not Found") {
+		t.Errorf("error = %q, want kustomization and line context", err)
+	}
+}
+
+// TestAddEdge_DistinctTypesSamePair ensures two differently-typed edges between the same
+// nodes are both kept, with distinct and stable content-addressed IDs.
+func TestAddEdge_DistinctTypesSamePair(t *testing.T) {
+	repo := &repository.RepositoryInfo{Type: repository.GitHub, Owner: "org", Repo: "app", Ref: "main"}
+	content := "resources:\n  - ../shared\ncomponents:\n  - ../shared\n"
+	build := func() []types.ElementData {
+		f := &mockFetcher{PathToContent: map[string]string{
+			"overlay": content,
+			"shared":  "resources: []\n",
+		}}
+		graph, err := NewParser(f, repo).Parse("overlay")
+		if err != nil {
+			t.Fatalf("Parse: %v", err)
+		}
+		var edges []types.ElementData
+		for _, e := range graph.Elements {
+			if e.Group == "edges" {
+				edges = append(edges, e.Data)
+			}
+		}
+		return edges
+	}
+
+	edges := build()
+	if len(edges) != 2 {
+		t.Fatalf("got %d edges, want 2: %+v", len(edges), edges)
+	}
+	if edges[0].ID == edges[1].ID {
+		t.Errorf("edges share ID %q", edges[0].ID)
+	}
+	for _, e := range edges {
+		if e.Label != e.EdgeType {
+			t.Errorf("edge %s label = %q, want %q", e.EdgeType, e.Label, e.EdgeType)
+		}
+		if e.ID != types.EdgeID(e.Source, e.EdgeType, e.Target) {
+			t.Errorf("edge %s ID = %q, want content-addressed ID", e.EdgeType, e.ID)
+		}
+	}
+
+	again := build()
+	for i := range edges {
+		if again[i].ID != edges[i].ID {
+			t.Errorf("edge ID not stable across builds: %q vs %q", edges[i].ID, again[i].ID)
+		}
+	}
+}
+
+func TestParse_SetsNodeRepoMetadata(t *testing.T) {
+	entryRepo := &repository.RepositoryInfo{Type: repository.GitHub, Owner: "o", Repo: "app", Ref: "main", BaseURL: "https://github.com"}
+	entryFetcher := &mockFetcher{PathToContent: map[string]string{
+		"overlay": "resources:\n  - https://gitlab.example.com/team/infra//base?ref=v1\n",
+	}}
+	p := NewParser(entryFetcher, entryRepo)
+	p.FetcherFactory = func(repo *repository.RepositoryInfo, _ string) (fetcher.Fetcher, error) {
+		return &mockFetcher{PathToContent: map[string]string{"base": "resources: []\n"}}, nil
+	}
+
+	graph, err := p.Parse("overlay")
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	want := map[string][4]string{
+		"overlay": {"github.com", "o", "app", "main"},
+		"base":    {"gitlab.example.com", "team", "infra", "v1"},
+	}
+	for _, elem := range graph.Elements {
+		if elem.Group != "nodes" {
+			continue
+		}
+		w, ok := want[elem.Data.Path]
+		if !ok {
+			t.Errorf("unexpected node %s", elem.Data.ID)
+			continue
+		}
+		got := [4]string{elem.Data.Host, elem.Data.Owner, elem.Data.Repo, elem.Data.Ref}
+		if got != w {
+			t.Errorf("node %s host/owner/repo/ref = %v, want %v", elem.Data.ID, got, w)
+		}
+		delete(want, elem.Data.Path)
+	}
+	if len(want) > 0 {
+		t.Errorf("missing nodes: %v", want)
+	}
+}
+
+// gitLabProjectRefLister is a repository.RefLister that knows one GitLab project path.
+type gitLabProjectRefLister struct {
+	project string
+}
+
+func (m *gitLabProjectRefLister) ListBranchesAndTags(_ *repository.RepositoryInfo, _ string) ([]string, error) {
+	return []string{"main"}, nil
+}
+
+func (m *gitLabProjectRefLister) ProjectExists(_ *repository.RepositoryInfo, projectPath, _ string) (bool, error) {
+	return projectPath == m.project, nil
+}
+
+// TestProcessReference_GitLabSubgroupsWithoutSeparator ensures a GitLab reference
+// without "//" is split into project and path by the repository layer.
+func TestProcessReference_GitLabSubgroupsWithoutSeparator(t *testing.T) {
+	repository.SetTestRefLister(&gitLabProjectRefLister{project: "group/sub1/sub2/project"})
+	defer repository.SetTestRefLister(nil)
+
+	entryRepo := &repository.RepositoryInfo{Type: repository.GitHub, Owner: "o", Repo: "app", Ref: "main"}
+	entryFetcher := &mockFetcher{PathToContent: map[string]string{
+		"overlay": "resources:\n  - https://gitlab.com/group/sub1/sub2/project/deploy/base?ref=main\n",
+	}}
+	var fetchedRepo *repository.RepositoryInfo
+	p := NewParser(entryFetcher, entryRepo)
+	p.FetcherFactory = func(repo *repository.RepositoryInfo, _ string) (fetcher.Fetcher, error) {
+		fetchedRepo = repo
+		return &mockFetcher{PathToContent: map[string]string{"deploy/base": "resources: []\n"}}, nil
+	}
+
+	graph, err := p.Parse("overlay")
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if fetchedRepo == nil || fetchedRepo.Owner != "group/sub1/sub2" || fetchedRepo.Repo != "project" {
+		t.Fatalf("fetcher repo = %+v, want group/sub1/sub2/project", fetchedRepo)
+	}
+	wantID := p.buildNodeID(fetchedRepo, "deploy/base")
+	for _, elem := range graph.Elements {
+		if elem.Group == "nodes" && elem.Data.ID == wantID {
+			if elem.Data.Type != "resource" {
+				t.Errorf("node %s Type = %s, want resource", wantID, elem.Data.Type)
+			}
+			return
+		}
+	}
+	t.Errorf("node %s not found in graph", wantID)
+}
+
+// TestProcessReference_OCINodeIDIgnoresOrigin ensures an OCI artifact listed as both a
+// resource and a component is a single node, typed by two edges.
+func TestProcessReference_OCINodeIDIgnoresOrigin(t *testing.T) {
+	repo := &repository.RepositoryInfo{Type: repository.GitHub, Owner: "org", Repo: "app", Ref: "main"}
+	f := &mockFetcher{PathToContent: map[string]string{
+		"overlay": "resources:\n  - oci://ghcr.io/org/manifests:v1\ncomponents:\n  - oci://ghcr.io/org/manifests:v1\n",
+	}}
+
+	graph, err := NewParser(f, repo).Parse("overlay")
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	var ociNodes int
+	edgeTypes := map[string]bool{}
+	for _, elem := range graph.Elements {
+		if elem.Group == "nodes" && elem.Data.Type == "oci" {
+			ociNodes++
+			if elem.Data.ID != "oci:ghcr.io/org/manifests:v1" {
+				t.Errorf("OCI node ID = %q, want oci:ghcr.io/org/manifests:v1", elem.Data.ID)
+			}
+		}
+		if elem.Group == "edges" {
+			edgeTypes[elem.Data.EdgeType] = true
+		}
+	}
+	if ociNodes != 1 || !edgeTypes["resource"] || !edgeTypes["component"] {
+		t.Errorf("got %d OCI nodes and edge types %v, want 1 node with resource and component edges", ociNodes, edgeTypes)
+	}
+}
+
+func TestKustomization_IsComponent(t *testing.T) {
+	cases := []struct {
+		name string
+		yaml string
+		want bool
+	}{
+		{"kustomization", "apiVersion: kustomize.config.k8s.io/v1beta1\nkind: Kustomization\nresources: [base]\n", false},
+		{"component", "apiVersion: kustomize.config.k8s.io/v1alpha1\nkind: Component\nresources: [nodeset.yaml]\n", true},
+		{"no kind", "resources: [base]\n", false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var kust Kustomization
+			if err := yaml.Unmarshal([]byte(c.yaml), &kust); err != nil {
+				t.Fatalf("Unmarshal: %v", err)
+			}
+			if got := kust.IsComponent(); got != c.want {
+				t.Errorf("IsComponent() = %v, want %v (Kind %q)", got, c.want, kust.Kind)
+			}
+		})
+	}
+}
+
+func TestParseKustomizations(t *testing.T) {
+	content := `apiVersion: kustomize.config.k8s.io/v1beta1
+kind: Kustomization
+resources:
+  - ../base
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+data:
+  resources: not-a-kustomization
+---
+# generated component
+apiVersion: kustomize.config.k8s.io/v1alpha1
+kind: Component
+components:
+  - ../monitoring
+`
+	kusts, err := ParseKustomizations([]byte(content))
+	if err != nil {
+		t.Fatalf("ParseKustomizations: %v", err)
+	}
+	if len(kusts) != 2 {
+		t.Fatalf("got %d kustomizations, want 2: %+v", len(kusts), kusts)
+	}
+	if kusts[0].IsComponent() || !slices.Equal(kusts[0].Resources, []string{"../base"}) {
+		t.Errorf("first kustomization = %+v, want the one with ../base", kusts[0])
+	}
+	if !kusts[1].IsComponent() || !slices.Equal(kusts[1].Components, []string{"../monitoring"}) {
+		t.Errorf("second kustomization = %+v, want the component", kusts[1])
+	}
+
+	cases := []struct {
+		name    string
+		yaml    string
+		want    int
+		wantErr bool
+	}{
+		{"single document without kind", "resources: [base]\n", 1, false},
+		{"empty documents", "---\n---\nresources: [base]\n---\n", 1, false},
+		{"flux Kustomization", "apiVersion: kustomize.toolkit.fluxcd.io/v1\nkind: Kustomization\nspec:\n  path: ./apps\n", 0, false},
+		{"empty", "", 0, false},
+		{"invalid document", "resources: [base]\n---\nresources: [base\n", 0, true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			kusts, err := ParseKustomizations([]byte(c.yaml))
+			if (err != nil) != c.wantErr {
+				t.Fatalf("ParseKustomizations() error = %v, wantErr %v", err, c.wantErr)
+			}
+			if len(kusts) != c.want {
+				t.Errorf("got %d kustomizations, want %d", len(kusts), c.want)
+			}
+		})
+	}
+}
+
+func TestProcessKustomization_ComponentKind(t *testing.T) {
+	repo := &repository.RepositoryInfo{Type: repository.GitHub, Owner: "org", Repo: "app", Ref: "main"}
+	component := "kind: Component\nresources: []\n"
+	f := &mockFetcher{PathToContent: map[string]string{
+		"overlay":   "kind: Kustomization\nresources:\n  - ../misused\ncomponents:\n  - ../proper\n",
+		"misused":   component,
+		"proper":    component,
+		"component": component,
+	}}
+
+	graph, err := NewParser(f, repo).Parse("overlay")
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	nodes := map[string]types.ElementData{}
+	for _, elem := range graph.Elements {
+		if elem.Group == "nodes" {
+			nodes[elem.Data.Path] = elem.Data
+		}
+	}
+	if n := nodes["overlay"]; n.Type != "overlay" || n.Content["warning"] != nil {
+		t.Errorf("overlay = type %q warning %v, want overlay without warning", n.Type, n.Content["warning"])
+	}
+	if n := nodes["proper"]; n.Type != "component" || n.Content["warning"] != nil {
+		t.Errorf("proper = type %q warning %v, want component without warning", n.Type, n.Content["warning"])
+	}
+	if n := nodes["misused"]; n.Type != "component" || n.Content["warning"] == nil {
+		t.Errorf("misused = type %q warning %v, want component with a warning", n.Type, n.Content["warning"])
+	}
+
+	// A Component as the root is labelled as such, with a warning
+	graph, err = NewParser(f, repo).Parse("component")
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	root := graph.Elements[0].Data
+	if root.Type != "component" {
+		t.Errorf("root Type = %q, want component", root.Type)
+	}
+	if w, _ := root.Content["warning"].(string); !strings.Contains(w, "root") {
+		t.Errorf("root warning = %q, want it to mention the root", w)
+	}
+}
+
+func TestKustomization_NameTransformers(t *testing.T) {
+	content := "namespace: openstack\nnamePrefix: prod-\nnameSuffix: -eu\nresources: [base]\n"
+	var kust Kustomization
+	if err := yaml.Unmarshal([]byte(content), &kust); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if kust.Namespace != "openstack" || kust.NamePrefix != "prod-" || kust.NameSuffix != "-eu" {
+		t.Errorf("namespace/namePrefix/nameSuffix = %q/%q/%q, want openstack/prod-/-eu", kust.Namespace, kust.NamePrefix, kust.NameSuffix)
+	}
+
+	repo := &repository.RepositoryInfo{Type: repository.GitHub, Owner: "org", Repo: "app", Ref: "main"}
+	f := &mockFetcher{PathToContent: map[string]string{"overlay": content, "overlay/base": "resources: []\n"}}
+	graph, err := NewParser(f, repo).Parse("overlay")
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	for _, elem := range graph.Elements {
+		if elem.Group != "nodes" {
+			continue
+		}
+		c := elem.Data.Content
+		switch elem.Data.Path {
+		case "overlay":
+			if c["namespace"] != "openstack" || c["namePrefix"] != "prod-" || c["nameSuffix"] != "-eu" {
+				t.Errorf("overlay content = %v, want namespace/namePrefix/nameSuffix", c)
+			}
+		case "overlay/base":
+			if _, ok := c["namePrefix"]; ok {
+				t.Errorf("base content = %v, want no namePrefix when unset", c)
+			}
+		}
+	}
+}
+
+func TestKustomization_Images(t *testing.T) {
+	content := `resources: []
+images:
+  - name: nginx
+    newTag: "1.25"
+  - name: quay.io/org/app
+    newName: registry.example.com/org/app
+    newTag: v2
+  - name: postgres
+    digest: sha256:24a0c4b4a4c0eb97a1aabb8e29f18e917d05abfe1b7a7c07857230879ce7d3d3
+`
+	var kust Kustomization
+	if err := yaml.Unmarshal([]byte(content), &kust); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	want := []ImageOverride{
+		{Name: "nginx", NewTag: "1.25"},
+		{Name: "quay.io/org/app", NewName: "registry.example.com/org/app", NewTag: "v2"},
+		{Name: "postgres", Digest: "sha256:24a0c4b4a4c0eb97a1aabb8e29f18e917d05abfe1b7a7c07857230879ce7d3d3"},
+	}
+	if len(kust.Images) != len(want) {
+		t.Fatalf("Images = %+v, want %d entries", kust.Images, len(want))
+	}
+	for i := range want {
+		if kust.Images[i] != want[i] {
+			t.Errorf("Images[%d] = %+v, want %+v", i, kust.Images[i], want[i])
+		}
+	}
+
+	repo := &repository.RepositoryInfo{Type: repository.GitHub, Owner: "org", Repo: "app", Ref: "main"}
+	graph, err := NewParser(&mockFetcher{PathToContent: map[string]string{"overlay": content}}, repo).Parse("overlay")
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	images, ok := graph.Elements[0].Data.Content["images"].([]ImageOverride)
+	if !ok || len(images) != 3 {
+		t.Errorf("node content images = %v, want the 3 overrides", graph.Elements[0].Data.Content["images"])
+	}
+	if graph.Elements[0].Data.RawContent != content {
+		t.Errorf("node RawContent = %q, want the file as fetched", graph.Elements[0].Data.RawContent)
+	}
+}
+
+func TestKustomization_Vars(t *testing.T) {
+	content := `resources: []
+vars:
+  - name: SERVICE_NAME
+    objref:
+      kind: Service
+      name: web
+      apiVersion: v1
+  - name: DB_HOST
+    objref:
+      kind: StatefulSet
+      name: db
+      apiVersion: apps/v1
+    fieldref:
+      fieldPath: spec.serviceName
+`
+	var kust Kustomization
+	if err := yaml.Unmarshal([]byte(content), &kust); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	want := []Var{
+		{Name: "SERVICE_NAME", ObjRef: VarObjRef{APIVersion: "v1", Kind: "Service", Name: "web"}},
+		{Name: "DB_HOST", ObjRef: VarObjRef{APIVersion: "apps/v1", Kind: "StatefulSet", Name: "db"}, FieldRef: VarFieldRef{FieldPath: "spec.serviceName"}},
+	}
+	if !reflect.DeepEqual(kust.Vars, want) {
+		t.Errorf("Vars = %+v, want %+v", kust.Vars, want)
+	}
+	if errs := ValidateSchema(&kust); len(errs) > 0 {
+		t.Errorf("ValidateSchema = %v, want no error", errs)
+	}
+	if _, warnings, err := ParseKustomizationStrict([]byte(content)); err != nil || len(warnings) > 0 {
+		t.Errorf("ParseKustomizationStrict = %v, %v, want no warning", warnings, err)
+	}
+
+	repo := &repository.RepositoryInfo{Type: repository.GitHub, Owner: "org", Repo: "app", Ref: "main"}
+	graph, err := NewParser(&mockFetcher{PathToContent: map[string]string{"overlay": content}}, repo).Parse("overlay")
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if vars, ok := graph.Elements[0].Data.Content["vars"].([]Var); !ok || !reflect.DeepEqual(vars, want) {
+		t.Errorf("node content vars = %v, want the 2 vars", graph.Elements[0].Data.Content["vars"])
+	}
+}
+
+func TestKustomization_BuildMetadataAndSortOptions(t *testing.T) {
+	content := `resources: []
+buildMetadata:
+  - managedByLabel
+  - originAnnotations
+sortOptions:
+  order: legacy
+  legacySortOptions:
+    orderFirst:
+      - Namespace
+      - CustomResourceDefinition
+    orderLast:
+      - ValidatingWebhookConfiguration
+`
+	var kust Kustomization
+	if err := yaml.Unmarshal([]byte(content), &kust); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if want := []string{"managedByLabel", "originAnnotations"}; !slices.Equal(kust.BuildMetadata, want) {
+		t.Errorf("BuildMetadata = %v, want %v", kust.BuildMetadata, want)
+	}
+	so := kust.SortOptions
+	if so == nil || so.Order != "legacy" || so.LegacySortOptions == nil {
+		t.Fatalf("SortOptions = %+v, want legacy order with legacySortOptions", so)
+	}
+	if want := []string{"Namespace", "CustomResourceDefinition"}; !slices.Equal(so.LegacySortOptions.OrderFirst, want) {
+		t.Errorf("OrderFirst = %v, want %v", so.LegacySortOptions.OrderFirst, want)
+	}
+	if want := []string{"ValidatingWebhookConfiguration"}; !slices.Equal(so.LegacySortOptions.OrderLast, want) {
+		t.Errorf("OrderLast = %v, want %v", so.LegacySortOptions.OrderLast, want)
+	}
+
+	repo := &repository.RepositoryInfo{Type: repository.GitHub, Owner: "org", Repo: "app", Ref: "main"}
+	graph, err := NewParser(&mockFetcher{PathToContent: map[string]string{
+		"overlay":      strings.Replace(content, "resources: []", "resources: [base]", 1),
+		"overlay/base": "resources: []\n",
+	}}, repo).Parse("overlay")
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	for _, elem := range graph.Elements {
+		if elem.Group != "nodes" {
+			continue
+		}
+		c := elem.Data.Content
+		switch elem.Data.Path {
+		case "overlay":
+			if _, ok := c["buildMetadata"].([]string); !ok {
+				t.Errorf("overlay content buildMetadata = %v, want the options", c["buildMetadata"])
+			}
+			if got, _ := c["sortOptions"].(*SortOptions); got == nil || got.Order != "legacy" {
+				t.Errorf("overlay content sortOptions = %v, want the legacy order", c["sortOptions"])
+			}
+		case "overlay/base":
+			if _, ok := c["buildMetadata"]; ok {
+				t.Errorf("base content = %v, want no buildMetadata when unset", c)
+			}
+			if _, ok := c["sortOptions"]; ok {
+				t.Errorf("base content = %v, want no sortOptions when unset", c)
+			}
+		}
+	}
+}
+
+func TestParse_MaxDepth(t *testing.T) {
+	repo := &repository.RepositoryInfo{Type: repository.GitHub, Owner: "org", Repo: "app", Ref: "main"}
+	contents := map[string]string{
+		"overlay":   "resources:\n  - ../level1\n  - deploy.yaml\n",
+		"level1":    "resources:\n  - ../level2\n",
+		"level2":    "resources:\n  - ../level3\n",
+		"level3":    "resources: []\n",
+	}
+
+	cases := []struct {
+		name      string
+		maxDepth  int
+		wantNodes []string
+		truncated string
+	}{
+		{"unlimited by default", UnlimitedDepth, []string{"overlay", "level1", "level2", "level3", "overlay/deploy.yaml"}, ""},
+		{"entry point only", 0, []string{"overlay"}, "overlay"},
+		{"one level", 1, []string{"overlay", "level1", "overlay/deploy.yaml"}, "level1"},
+		{"limit at the leaves", 3, []string{"overlay", "level1", "level2", "level3", "overlay/deploy.yaml"}, ""},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			p := NewParser(&mockFetcher{PathToContent: contents}, repo)
+			if c.maxDepth != UnlimitedDepth {
+				p.MaxDepth = c.maxDepth
+			}
+			graph, err := p.Parse("overlay")
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			var nodes []string
+			for _, elem := range graph.Elements {
+				if elem.Group != "nodes" {
+					continue
+				}
+				nodes = append(nodes, elem.Data.Path)
+				if want := elem.Data.Path == c.truncated; elem.Data.Truncated != want {
+					t.Errorf("node %s Truncated = %v, want %v", elem.Data.Path, elem.Data.Truncated, want)
+				}
+			}
+			sort.Strings(nodes)
+			want := append([]string(nil), c.wantNodes...)
+			sort.Strings(want)
+			if strings.Join(nodes, ",") != strings.Join(want, ",") {
+				t.Errorf("nodes = %v, want %v", nodes, want)
+			}
+		})
+	}
+}
+
+// delayFetcher is a mockFetcher whose fetches take delay, recording how many run at once.
+type delayFetcher struct {
+	mockFetcher
+	delay time.Duration
+
+	mu          sync.Mutex
+	inFlight    int
+	maxInFlight int
+}
+
+func (m *delayFetcher) FindKustomizationInPath(path string) (string, error) {
+	m.mu.Lock()
+	m.inFlight++
+	m.maxInFlight = max(m.maxInFlight, m.inFlight)
+	m.mu.Unlock()
+
+	time.Sleep(m.delay)
+
+	m.mu.Lock()
+	m.inFlight--
+	m.mu.Unlock()
+	return m.mockFetcher.FindKustomizationInPath(path)
+}
+
+func TestParse_ConcurrentReferences(t *testing.T) {
+	repo := &repository.RepositoryInfo{Type: repository.GitHub, Owner: "org", Repo: "app", Ref: "main"}
+	contents := map[string]string{
+		"overlay": "resources:\n  - ../base3\n  - ../base1\n  - ../base0\n  - ../base2\n  - ../base5\n  - ../base4\ncomponents:\n  - ../missing\n",
+	}
+	for i := range 6 {
+		contents[fmt.Sprintf("base%d", i)] = "resources:\n  - deploy.yaml\n"
+	}
+
+	cases := []struct {
+		name        string
+		workers     int
+		maxInFlight int
+	}{
+		{"one at a time", 1, 1},
+		{"bounded pool", 4, 4},
+		{"more workers than references", DefaultWorkers, 7},
+	}
+	var want []byte
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			f := &delayFetcher{mockFetcher: mockFetcher{PathToContent: contents}, delay: 20 * time.Millisecond}
+			p := NewParser(f, repo)
+			p.Workers = c.workers
+			graph, err := p.Parse("overlay")
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			// The entry point fetch runs alone; the 7 references of overlay share the pool
+			if f.maxInFlight != c.maxInFlight {
+				t.Errorf("max concurrent fetches = %d, want %d", f.maxInFlight, c.maxInFlight)
+			}
+
+			for i := 1; i < len(graph.Elements); i++ {
+				prev, elem := graph.Elements[i-1], graph.Elements[i]
+				if prev.Group == elem.Group && prev.Data.ID > elem.Data.ID || prev.Group == "edges" && elem.Group == "nodes" {
+					t.Errorf("Elements not sorted: %s %s before %s %s", prev.Group, prev.Data.ID, elem.Group, elem.Data.ID)
+				}
+			}
+			got, err := json.Marshal(graph)
+			if err != nil {
+				t.Fatalf("Marshal: %v", err)
+			}
+			if want == nil {
+				want = got
+			} else if string(got) != string(want) {
+				t.Errorf("graph with %d workers differs:\n%s\nwant:\n%s", c.workers, got, want)
+			}
+		})
+	}
+}
+
+func TestParse_Exclude(t *testing.T) {
+	entryRepo := &repository.RepositoryInfo{Type: repository.GitHub, Owner: "org", Repo: "app", Ref: "main"}
+	entryFetcher := &mockFetcher{PathToContent: map[string]string{
+		"overlay":    "resources:\n  - ../base\n  - ../heavy\ncomponents:\n  - https://github.com/vendor/charts//monitoring?ref=v1\n",
+		"base":       "resources:\n  - deploy.yaml\n",
+		"heavy":      "resources:\n  - ../heavy-deps\n",
+		"heavy-deps": "resources: []\n",
+	}}
+	chartsFetcher := &mockFetcher{PathToContent: map[string]string{
+		"monitoring": "kind: Component\nresources:\n  - prometheus.yaml\n",
+	}}
+
+	cases := []struct {
+		name     string
+		exclude  []string
+		excluded []string
+		wantIDs  []string
+	}{
+		{
+			name:     "whole repository",
+			exclude:  []string{"vendor/charts"},
+			excluded: []string{"github:vendor/charts/monitoring@v1"},
+			wantIDs:  []string{"github:org/app/base@main", "github:org/app/base/deploy.yaml@main", "github:org/app/heavy@main", "github:org/app/heavy-deps@main"},
+		},
+		{
+			name:     "subpath",
+			exclude:  []string{"org/*/heavy"},
+			excluded: []string{"github:org/app/heavy@main"},
+			wantIDs:  []string{"github:org/app/base@main", "github:org/app/base/deploy.yaml@main", "github:vendor/charts/monitoring@v1", "github:vendor/charts/monitoring/prometheus.yaml@v1"},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			p := NewParser(entryFetcher, entryRepo)
+			p.FetcherFactory = func(_ *repository.RepositoryInfo, _ string) (fetcher.Fetcher, error) {
+				return chartsFetcher, nil
+			}
+			p.Exclude = c.exclude
+			graph, err := p.Parse("overlay")
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+
+			nodes := map[string]types.ElementData{}
+			children := map[string]int{}
+			for _, e := range graph.Elements {
+				if e.Group == "nodes" {
+					nodes[e.Data.ID] = e.Data
+				} else {
+					children[e.Data.Source]++
+				}
+			}
+			for _, id := range c.excluded {
+				if n, ok := nodes[id]; !ok || !n.Excluded || children[id] != 0 {
+					t.Errorf("node %s = %+v with %d children, want it excluded without children", id, n, children[id])
+				}
+			}
+			for _, id := range c.wantIDs {
+				if n, ok := nodes[id]; !ok || n.Excluded {
+					t.Errorf("node %s = %+v, want it built", id, n)
+				}
+			}
+			if len(nodes) != 1+len(c.excluded)+len(c.wantIDs) {
+				t.Errorf("got %d nodes, want %d: %v", len(nodes), 1+len(c.excluded)+len(c.wantIDs), nodes)
+			}
+		})
+	}
+}
+
+// TestParse_TokensPerRepository ensures each repository of a mixed-host graph is
+// fetched with its own token when Parser.Tokens is set.
+func TestParse_TokensPerRepository(t *testing.T) {
+	entryRepo := &repository.RepositoryInfo{Type: repository.GitHub, Owner: "org", Repo: "app", Ref: "main"}
+	entryFetcher := &mockFetcher{PathToContent: map[string]string{
+		"overlay": "resources:\n  - https://github.com/org/base//deploy?ref=main\ncomponents:\n  - https://gitlab.mycorp.net/group/project//monitoring?ref=main\n",
+	}}
+
+	var mu sync.Mutex
+	used := map[string]string{}
+	p := NewParser(entryFetcher, entryRepo)
+	p.Tokens = repository.TokensByHost(map[string]string{"github.com": "gh-token", "gitlab.mycorp.net": "gl-token"})
+	p.FetcherFactory = func(repo *repository.RepositoryInfo, token string) (fetcher.Fetcher, error) {
+		mu.Lock()
+		used[repo.Owner+"/"+repo.Repo] = token
+		mu.Unlock()
+		return &mockFetcher{PathToContent: map[string]string{"deploy": "resources: []\n", "monitoring": "kind: Component\n"}}, nil
+	}
+	if _, err := p.Parse("overlay"); err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if used["org/base"] != "gh-token" || used["group/project"] != "gl-token" {
+		t.Errorf("tokens used = %v, want gh-token for org/base and gl-token for group/project", used)
+	}
+}
+
+func TestProcessKustomization_DuplicateReferences(t *testing.T) {
+	repo := &repository.RepositoryInfo{Type: repository.GitHub, Owner: "o", Repo: "r", Ref: "main"}
+	f := &mockFetcher{
+		PathToContent: map[string]string{
+			"overlay": "resources:\n  - ../base\n  - deployment.yaml\n  - ./deployment.yaml\n  - service.yaml\n" +
+				"  - https://github.com/o/lib//deploy?ref=v1\n  - https://github.com/O/lib.git//deploy/?ref=v1\nbases:\n  - ../base/\n",
+			"base":   "resources:\n  - deployment.yaml\n",
+			"deploy": "resources: []\n",
+		},
+	}
+
+	p := NewParser(f, repo)
+	p.FetcherFactory = func(*repository.RepositoryInfo, string) (fetcher.Fetcher, error) { return f, nil }
+	graph, err := p.Parse("overlay")
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	nodes := map[string]types.ElementData{}
+	for _, e := range graph.Elements {
+		if e.Group == "nodes" {
+			nodes[e.Data.ID] = e.Data
+		}
+	}
+	want := []string{
+		`duplicate reference to github:o/r/base@main: listed 2 times ("../base", "../base/")`,
+		`duplicate reference to github:o/r/overlay/deployment.yaml@main: listed 2 times ("deployment.yaml", "./deployment.yaml")`,
+		`duplicate reference to github:o/lib/deploy@v1: listed 2 times ("https://github.com/o/lib//deploy?ref=v1", "https://github.com/O/lib.git//deploy/?ref=v1")`,
+	}
+	if got := nodes[p.buildNodeID(repo, "overlay")].Warnings; !slices.Equal(got, want) {
+		t.Errorf("overlay warnings = %q, want %q", got, want)
+	}
+	if got := nodes[p.buildNodeID(repo, "base")].Warnings; got != nil {
+		t.Errorf("base warnings = %q, want none", got)
+	}
+	if _, ok := nodes[p.buildNodeID(repo, "overlay/service.yaml")]; !ok {
+		t.Error("references after a duplicate should still be followed")
+	}
+}
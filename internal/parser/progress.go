@@ -0,0 +1,69 @@
+package parser
+
+import (
+	"context"
+
+	"github.com/cjeanner/kustomap/internal/repository"
+	"github.com/cjeanner/kustomap/internal/types"
+)
+
+// ProgressEventType is the kind of a ProgressEvent.
+type ProgressEventType string
+
+const (
+	// EventReferenceResolved: a reference of a kustomization was resolved (or failed to)
+	EventReferenceResolved ProgressEventType = "reference-resolved"
+	// EventNodeAdded: a node was added to the graph
+	EventNodeAdded ProgressEventType = "node-added"
+	// EventDepthReached: the parser went one level deeper than before
+	EventDepthReached ProgressEventType = "depth-reached"
+	// EventComplete: the build succeeded; the last event, holding the graph
+	EventComplete ProgressEventType = "complete"
+	// EventError: the build failed; the last event, holding the error
+	EventError ProgressEventType = "error"
+)
+
+// ProgressEvent reports the progress of a graph build (see Parser.Events and BuildStream).
+type ProgressEvent struct {
+	Type ProgressEventType `json:"type"`
+
+	NodeID   string `json:"nodeId,omitempty"`   // node added, or node a reference resolved to
+	NodeType string `json:"nodeType,omitempty"` // type of the node added
+	Parent   string `json:"parent,omitempty"`   // kustomization listing the resolved reference
+	Ref      string `json:"ref,omitempty"`      // resolved reference, as written
+	Depth    int    `json:"depth,omitempty"`    // level reached below the root
+
+	Graph *types.Graph `json:"graph,omitempty"` // complete graph (EventComplete)
+	Error string       `json:"error,omitempty"` // build error (EventError)
+}
+
+// emit sends ev on p.Events, if set; it gives up when the parser's context is done.
+func (p *Parser) emit(ev ProgressEvent) {
+	if p.Events == nil {
+		return
+	}
+	select {
+	case p.Events <- ev:
+	case <-p.ctx.Done():
+	}
+}
+
+// BuildStream is BuildWithTokens reporting its progress: it returns a channel receiving
+// the build's events, ending with an EventComplete holding the graph or an EventError,
+// after which it is closed. The caller must drain the channel or cancel ctx.
+func BuildStream(ctx context.Context, rootURL string, tokens repository.TokenProvider) <-chan ProgressEvent {
+	events := make(chan ProgressEvent)
+	go func() {
+		defer close(events)
+		graph, err := buildGraph(ctx, rootURL, "", BuildOptions{Tokens: tokens}, events)
+		last := ProgressEvent{Type: EventComplete, Graph: graph}
+		if err != nil {
+			last = ProgressEvent{Type: EventError, Error: err.Error()}
+		}
+		select {
+		case events <- last:
+		case <-ctx.Done():
+		}
+	}()
+	return events
+}
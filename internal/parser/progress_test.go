@@ -0,0 +1,107 @@
+package parser
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/cjeanner/kustomap/internal/fetcher"
+	"github.com/cjeanner/kustomap/internal/repository"
+)
+
+func TestBuildStream(t *testing.T) {
+	repository.SetTestRefLister(&defaultBranchRefLister{branch: "main"})
+	defer repository.SetTestRefLister(nil)
+
+	fetchers := map[string]*mockFetcher{
+		"org/base": {PathToContent: map[string]string{"deploy": "resources:\n  - deployment.yaml\n"}},
+		"org/app": {PathToContent: map[string]string{
+			"overlay": "resources:\n  - https://github.com/org/base//deploy?ref=main\n",
+		}},
+	}
+	orig := defaultFetcherFactory
+	defer func() { defaultFetcherFactory = orig }()
+	defaultFetcherFactory = func(_ context.Context, repo *repository.RepositoryInfo, _ string) (fetcher.Fetcher, error) {
+		f, ok := fetchers[repo.Owner+"/"+repo.Repo]
+		if !ok {
+			return nil, errors.New("repository not found")
+		}
+		return f, nil
+	}
+
+	const overlayID = "github:org/app/overlay@main"
+	const baseID = "github:org/base/deploy@main"
+	const fileID = "github:org/base/deploy/deployment.yaml@main"
+
+	t.Run("success", func(t *testing.T) {
+		var events []ProgressEvent
+		for ev := range BuildStream(context.Background(), "https://github.com/org/app/tree/main/overlay", nil) {
+			events = append(events, ev)
+		}
+		if len(events) == 0 {
+			t.Fatal("no events")
+		}
+
+		last := events[len(events)-1]
+		if last.Type != EventComplete || last.Graph == nil {
+			t.Fatalf("last event = %+v, want %s with the graph", last, EventComplete)
+		}
+		var graphNodes []string
+		for _, e := range last.Graph.Elements {
+			if e.Group == "nodes" {
+				graphNodes = append(graphNodes, e.Data.ID)
+			}
+		}
+
+		var added, resolved []string
+		deepest := 0
+		for _, ev := range events[:len(events)-1] {
+			switch ev.Type {
+			case EventNodeAdded:
+				added = append(added, ev.NodeID)
+			case EventReferenceResolved:
+				resolved = append(resolved, ev.Parent+" -> "+ev.NodeID)
+			case EventDepthReached:
+				deepest = ev.Depth
+			default:
+				t.Errorf("unexpected event before the end: %+v", ev)
+			}
+		}
+		// Each node is announced once, in the order it was added
+		if want := []string{overlayID, baseID, fileID}; !slices.Equal(added, want) {
+			t.Errorf("node-added = %v, want %v", added, want)
+		}
+		for _, id := range added {
+			if !slices.Contains(graphNodes, id) {
+				t.Errorf("announced node %s is not in the final graph %v", id, graphNodes)
+			}
+		}
+		if want := []string{overlayID + " -> " + baseID, baseID + " -> " + fileID}; !slices.Equal(resolved, want) {
+			t.Errorf("reference-resolved = %v, want %v", resolved, want)
+		}
+		if deepest != 1 {
+			t.Errorf("deepest depth-reached = %d, want 1", deepest)
+		}
+	})
+
+	t.Run("failure", func(t *testing.T) {
+		var events []ProgressEvent
+		for ev := range BuildStream(context.Background(), "https://github.com/org/missing/tree/main/overlay", nil) {
+			events = append(events, ev)
+		}
+		if len(events) != 1 || events[0].Type != EventError || events[0].Error == "" {
+			t.Fatalf("events = %+v, want a single %s event", events, EventError)
+		}
+	})
+
+	t.Run("cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		events := BuildStream(ctx, "https://github.com/org/app/tree/main/overlay", nil)
+		<-events
+		cancel()
+		// The build gives up sending instead of blocking forever: the channel gets closed
+		for range events {
+		}
+	})
+}
@@ -1,9 +1,17 @@
 package parser
 
 import (
+	"errors"
 	"fmt"
 	"net/url"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/cjeanner/kustomap/internal/repository"
 )
@@ -19,6 +27,37 @@ type KustomizeReference struct {
 
 	// For relative references
 	RelativePath string
+
+	// For OCI artifact references
+	OCI *OCIReference
+
+	// Origin is the kustomization field the reference was listed in; set by the builder
+	Origin ReferenceOrigin
+}
+
+// ReferenceOrigin is the kustomization field a reference comes from. Its value is the
+// edge type linking the referencing kustomization to the reference.
+type ReferenceOrigin string
+
+const (
+	OriginResource    ReferenceOrigin = "resource"
+	OriginComponent   ReferenceOrigin = "component"
+	OriginBase        ReferenceOrigin = "base"
+	OriginPatch       ReferenceOrigin = "patch"
+	OriginGenerator   ReferenceOrigin = "generator"
+	OriginReplacement ReferenceOrigin = "replacement"
+	OriginSchema      ReferenceOrigin = "schema"
+	OriginCRD         ReferenceOrigin = "crd"
+	OriginHelm        ReferenceOrigin = "helm"
+	OriginValues      ReferenceOrigin = "values"
+)
+
+// OCIReference holds the parts of an oci:// reference (e.g. oci://ghcr.io/org/manifests:v1.0)
+type OCIReference struct {
+	Registry   string
+	Repository string
+	Tag        string
+	Digest     string
 }
 
 type ReferenceType string
@@ -26,12 +65,73 @@ type ReferenceType string
 const (
 	ReferenceRemote   ReferenceType = "remote"
 	ReferenceRelative ReferenceType = "relative"
+	ReferenceOCI      ReferenceType = "oci"
+	ReferenceLocal    ReferenceType = "local"
 )
 
+// Errors returned by ParseReference, usable with errors.Is; the message gives the details.
+var (
+	// ErrUnsupportedScheme is returned for URLs whose scheme isn't https, http, ssh,
+	// oci or file (e.g. s3://...).
+	ErrUnsupportedScheme = errors.New("unsupported reference scheme")
+
+	// ErrMalformedReference is returned when a reference has a supported form but
+	// can't be parsed (invalid URL, SSH port, OCI or local reference).
+	ErrMalformedReference = errors.New("malformed reference")
+)
+
+// schemePattern matches a URL scheme prefix such as "s3://".
+var schemePattern = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9+.-]*://`)
+
+// hostAliases maps alias hosts (e.g. ssh.github.com, or a CNAME) to their canonical host
+var (
+	hostAliasesMu sync.RWMutex
+	hostAliases   = map[string]string{}
+)
+
+// RegisterHostAlias makes ParseReference treat alias as canonical (e.g. "ssh.github.com"
+// → "github.com"), so references through either host are classified the same way and
+// produce identical node IDs. An empty canonical removes the alias.
+func RegisterHostAlias(alias, canonical string) {
+	alias = strings.ToLower(alias)
+	hostAliasesMu.Lock()
+	defer hostAliasesMu.Unlock()
+	if canonical == "" {
+		delete(hostAliases, alias)
+		return
+	}
+	hostAliases[alias] = strings.ToLower(canonical)
+}
+
+// canonicalizeHost rewrites the host of repoURL when it is a registered alias.
+// The alias may be registered with or without a port.
+func canonicalizeHost(repoURL string) string {
+	u, err := url.Parse(repoURL)
+	if err != nil || u.Host == "" {
+		return repoURL
+	}
+	hostAliasesMu.RLock()
+	canonical, ok := hostAliases[strings.ToLower(u.Host)]
+	if !ok {
+		canonical, ok = hostAliases[strings.ToLower(u.Hostname())]
+	}
+	hostAliasesMu.RUnlock()
+	if !ok {
+		return repoURL
+	}
+	u.Host = canonical
+	return u.String()
+}
+
 // ParseReference parses a reference from kustomization.yaml
 // Formats supported:
-// - https://github.com/org/repo//path?ref=branch
+// - https://github.com/org/repo//path?ref=branch (or ?version=branch)
+// - https://dev.azure.com/org/project/_git/repo//path?version=GBbranch (or GTtag)
+// - https://raw.githubusercontent.com/org/repo/branch/path/kustomization.yaml
 // - git@github.com:org/repo.git//path?ref=branch
+// - ssh://git@git.example.com:2222/org/repo.git//path?ref=branch
+// - oci://registry/repository:tag or oci://registry/repository@sha256:digest
+// - file:///abs/path or /abs/path (local checkout on disk)
 // - ../relative/path (explicit relative)
 // - ./relative/path (explicit relative)
 // - relative/path (implicit relative - no prefix)
@@ -46,6 +146,26 @@ func ParseReference(ref string, token string) (*KustomizeReference, error) {
 		return parseGitSSHReference(ref, token)
 	}
 
+	// ssh:// URL, possibly with a user and a port
+	if strings.HasPrefix(ref, "ssh://") {
+		return parseSSHURLReference(ref, token)
+	}
+
+	// OCI artifacts (Flux-style); not a git repository
+	if strings.HasPrefix(ref, "oci://") {
+		return parseOCIReference(ref)
+	}
+
+	// Local checkout on disk
+	if strings.HasPrefix(ref, "file://") || filepath.IsAbs(ref) {
+		return parseLocalReference(ref)
+	}
+
+	// Any other scheme would otherwise be taken for a relative path
+	if scheme := schemePattern.FindString(ref); scheme != "" {
+		return nil, fmt.Errorf("%w %q in %s", ErrUnsupportedScheme, strings.TrimSuffix(scheme, "://"), ref)
+	}
+
 	// Explicit relative paths
 	if strings.HasPrefix(ref, "./") || strings.HasPrefix(ref, "../") {
 		return &KustomizeReference{
@@ -65,12 +185,34 @@ func ParseReference(ref string, token string) (*KustomizeReference, error) {
 	}, nil
 }
 
+// splitAzureDevOps splits the path of an Azure DevOps URL, where the repository ends
+// after org/project/_git/repo, returning the repository and the path inside it. ok is
+// false for other URLs: a _git directory on another host is part of the path.
+func splitAzureDevOps(base string, pathParts []string, token string) (info *repository.RepositoryInfo, path string, ok bool) {
+	gitIndex := slices.Index(pathParts, "_git")
+	if gitIndex < 0 || gitIndex+1 >= len(pathParts) {
+		return nil, "", false
+	}
+	repoURL := fmt.Sprintf("%s/%s", base, strings.Join(pathParts[:gitIndex+2], "/"))
+	info, err := repository.DetectRepository(canonicalizeHost(repoURL), token)
+	if err != nil || info.Type != repository.AzureDevOps {
+		return nil, "", false
+	}
+	return info, strings.Join(pathParts[gitIndex+2:], "/"), true
+}
+
 // parseHTTPReference parses HTTP(S) Kustomize references
 // Format: https://github.com/org/repo//path?ref=branch
 func parseHTTPReference(ref string, token string) (*KustomizeReference, error) {
+	if u, err := url.Parse(ref); err == nil && strings.EqualFold(u.Host, rawGitHubHost) {
+		return parseRawGitHubReference(ref, u)
+	}
+
 	var repoURL string
+	var repoInfo *repository.RepositoryInfo // detected while splitting, if at all
 	var path string
-	var refOverride string
+	var query url.Values
+	var projectPath string // without "//": GitLab subgroups/project/path to split later
 
 	// Compter le nombre de "//" dans l'URL
 	slashCount := strings.Count(ref, "//")
@@ -84,15 +226,12 @@ func parseHTTPReference(ref string, token string) (*KustomizeReference, error) {
 
 		if secondIdx != -1 {
 			repoURL = ref[:idx+2+secondIdx]
-			pathWithRef := remaining[secondIdx+2:]
-
-			if strings.Contains(pathWithRef, "?ref=") {
-				subparts := strings.SplitN(pathWithRef, "?ref=", 2)
-				path = subparts[0]
-				refOverride = subparts[1]
-			} else {
-				path = pathWithRef
-			}
+			pathWithQuery := remaining[secondIdx+2:]
+
+			// Query holds ref and go-getter options (timeout, submodules, depth), in any order
+			var rawQuery string
+			path, rawQuery, _ = strings.Cut(pathWithQuery, "?")
+			query, _ = url.ParseQuery(rawQuery) // malformed pairs are ignored
 		} else {
 			repoURL = ref
 		}
@@ -101,22 +240,28 @@ func parseHTTPReference(ref string, token string) (*KustomizeReference, error) {
 		// Extraire le repo URL (schéma + host + jusqu'à 2 parties du path pour org/repo)
 		u, err := url.Parse(ref)
 		if err != nil {
-			return nil, fmt.Errorf("invalid URL: %w", err)
+			return nil, fmt.Errorf("%w: invalid URL: %w", ErrMalformedReference, err)
 		}
 
-		pathParts := strings.Split(strings.Trim(u.Path, "/"), "/")
-
-		// Extract ref query parameter (branch/tag for fetching)
-		if q := u.Query().Get("ref"); q != "" {
-			refOverride = q
+		// A registered GitLab may live under a subpath: owner/repo start after it
+		base := fmt.Sprintf("%s://%s", u.Scheme, u.Host)
+		repoPath := u.Path
+		if instanceURL, projectPath, ok := repository.SplitGitLabInstance(ref); ok {
+			base, repoPath = instanceURL, projectPath
 		}
 
-		if len(pathParts) >= 2 {
-			// Repo URL = scheme + host + /owner/repo
-			repoURL = fmt.Sprintf("%s://%s/%s/%s", u.Scheme, u.Host, pathParts[0], pathParts[1])
+		pathParts := strings.Split(strings.Trim(repoPath, "/"), "/")
+		query = u.Query()
+
+		if info, gitPath, ok := splitAzureDevOps(base, pathParts, token); ok {
+			repoInfo, path = info, gitPath
+		} else if len(pathParts) >= 2 {
+			// Repo URL = base + /owner/repo
+			repoURL = fmt.Sprintf("%s/%s/%s", base, pathParts[0], pathParts[1])
 			// Path = reste du chemin
 			if len(pathParts) > 2 {
 				path = strings.Join(pathParts[2:], "/")
+				projectPath = strings.Join(pathParts, "/")
 			}
 		} else {
 			repoURL = fmt.Sprintf("%s://%s%s", u.Scheme, u.Host, u.Path)
@@ -124,14 +269,34 @@ func parseHTTPReference(ref string, token string) (*KustomizeReference, error) {
 	}
 
 	// Le reste du code demeure identique
-	repoInfo, err := repository.DetectRepository(repoURL, token)
-	if err != nil {
-		return nil, fmt.Errorf("failed to detect repository type: %w", err)
+	if repoInfo == nil {
+		var err error
+		repoInfo, err = repository.DetectRepository(canonicalizeHost(repoURL), token)
+		if err != nil {
+			return nil, fmt.Errorf("failed to detect repository type: %w", err)
+		}
 	}
 
+	// Extract ref query parameter (branch/tag for fetching); "version" is an alias
+	// used by some tools, "ref" wins when both are present
+	refOverride := query.Get("ref")
+	if refOverride == "" {
+		refOverride = query.Get("version")
+	}
+	// Azure DevOps refs are prefixed with their kind (GBmain, GTv1.0), whichever key set them
+	if repoInfo.Type == repository.AzureDevOps {
+		refOverride = repository.AzureDevOpsRef(refOverride)
+	}
 	if refOverride != "" {
 		repoInfo.Ref = refOverride
 	}
+	applyGetterParams(repoInfo, query)
+
+	// GitLab projects may sit under any number of subgroups: without "//" (or a /-/
+	// marker) the project boundary is only known to the API
+	if repoInfo.Type == repository.GitLab && projectPath != "" && !strings.Contains("/"+projectPath+"/", "/-/") {
+		repoInfo.AmbiguousProjectPath = projectPath
+	}
 
 	return &KustomizeReference{
 		Type:     ReferenceRemote,
@@ -141,6 +306,72 @@ func parseHTTPReference(ref string, token string) (*KustomizeReference, error) {
 	}, nil
 }
 
+// rawGitHubHost serves the files of GitHub repositories: /org/repo/ref/path
+const rawGitHubHost = "raw.githubusercontent.com"
+
+// parseRawGitHubReference maps a raw file URL back to its GitHub repository
+// (github.com/org/repo) at the ref, with the file's path. A kustomization file stands
+// for its directory. Ref and Path assume a ref without "/"; AmbiguousPath keeps both,
+// for ResolveBranchAndPath to split when the repository has a branch like "release/1.0".
+// Format: https://raw.githubusercontent.com/org/repo/ref/path/kustomization.yaml
+func parseRawGitHubReference(ref string, u *url.URL) (*KustomizeReference, error) {
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(parts) < 4 {
+		return nil, fmt.Errorf("%w: raw URL without org/repo/ref/path: %s", ErrMalformedReference, ref)
+	}
+
+	// Fully qualified refs are also served (refs/heads/main/...)
+	refAndPath := parts[2:]
+	if len(refAndPath) > 3 && refAndPath[0] == "refs" && (refAndPath[1] == "heads" || refAndPath[1] == "tags") {
+		refAndPath = refAndPath[2:]
+	}
+	if dir, file := path.Split(strings.Join(refAndPath, "/")); slices.Contains(repository.KustomizationFilenames(), file) {
+		refAndPath = strings.Split(strings.TrimSuffix(dir, "/"), "/")
+	}
+
+	repoInfo := &repository.RepositoryInfo{
+		Type:    repository.GitHub,
+		Owner:   parts[0],
+		Repo:    parts[1],
+		Ref:     refAndPath[0],
+		BaseURL: "https://github.com",
+	}
+	if len(refAndPath) > 1 {
+		repoInfo.AmbiguousPath = strings.Join(refAndPath, "/")
+	}
+	return &KustomizeReference{
+		Type:     ReferenceRemote,
+		Original: ref,
+		RepoInfo: repoInfo,
+		Path:     strings.Join(refAndPath[1:], "/"),
+	}, nil
+}
+
+// applyGetterParams stores the go-getter options kustomize passes through in remote
+// URLs (submodules, timeout, depth) on repoInfo. Unknown or invalid values are ignored.
+func applyGetterParams(repoInfo *repository.RepositoryInfo, query url.Values) {
+	// Kustomize clones submodules unless told otherwise
+	repoInfo.Submodules = true
+	if v := query.Get("submodules"); v != "" {
+		if b, err := strconv.ParseBool(v); err == nil {
+			repoInfo.Submodules = b
+		}
+	}
+	if v := query.Get("timeout"); v != "" {
+		// Either a number of seconds ("60") or a duration ("1m30s")
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			repoInfo.Timeout = n
+		} else if d, err := time.ParseDuration(v); err == nil && d >= 0 {
+			repoInfo.Timeout = int(d.Seconds())
+		}
+	}
+	if v := query.Get("depth"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			repoInfo.Depth = n
+		}
+	}
+}
+
 // parseGitSSHReference parses Git SSH format
 // Format: git@github.com:org/repo.git//path?ref=branch
 func parseGitSSHReference(ref string, token string) (*KustomizeReference, error) {
@@ -152,9 +383,159 @@ func parseGitSSHReference(ref string, token string) (*KustomizeReference, error)
 	return parseHTTPReference(ref, token)
 }
 
+// parseSSHURLReference parses the ssh:// URL format; a non-default port is kept in
+// RepoInfo.SSHPort for cloning, the API host being the same without it.
+// Format: ssh://[user@]host[:port]/org/repo.git//path?ref=branch
+func parseSSHURLReference(ref string, token string) (*KustomizeReference, error) {
+	u, err := url.Parse(ref)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("%w: invalid SSH URL: %s", ErrMalformedReference, ref)
+	}
+	port := 0
+	if p := u.Port(); p != "" {
+		if port, err = strconv.Atoi(p); err != nil {
+			return nil, fmt.Errorf("%w: invalid SSH port in %s: %w", ErrMalformedReference, ref, err)
+		}
+	}
+
+	httpRef := "https://" + u.Hostname() + u.Path
+	if u.RawQuery != "" {
+		httpRef += "?" + u.RawQuery
+	}
+	parsed, err := parseHTTPReference(httpRef, token)
+	if err != nil {
+		return nil, err
+	}
+	parsed.Original = ref
+	parsed.RepoInfo.SSHPort = port
+	return parsed, nil
+}
+
+// parseLocalReference parses file:///abs/path or /abs/path; the directory is the
+// root of a Local repository.
+func parseLocalReference(ref string) (*KustomizeReference, error) {
+	repoInfo, err := repository.DetectRepository(ref, "")
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid local reference: %w", ErrMalformedReference, err)
+	}
+	return &KustomizeReference{
+		Type:     ReferenceLocal,
+		Original: ref,
+		RepoInfo: repoInfo,
+	}, nil
+}
+
+// parseOCIReference parses an OCI artifact reference
+// Format: oci://registry/repository[:tag][@sha256:digest]
+func parseOCIReference(ref string) (*KustomizeReference, error) {
+	rest := strings.TrimPrefix(ref, "oci://")
+	oci := &OCIReference{}
+
+	if idx := strings.Index(rest, "@"); idx != -1 {
+		oci.Digest = rest[idx+1:]
+		rest = rest[:idx]
+	}
+	// A tag is a ":" after the last "/" (a ":" before it would be a registry port)
+	if idx := strings.LastIndex(rest, ":"); idx > strings.LastIndex(rest, "/") {
+		oci.Tag = rest[idx+1:]
+		rest = rest[:idx]
+	}
+
+	slash := strings.Index(rest, "/")
+	if slash <= 0 || slash == len(rest)-1 {
+		return nil, fmt.Errorf("%w: invalid OCI reference: %s", ErrMalformedReference, ref)
+	}
+	oci.Registry = rest[:slash]
+	oci.Repository = rest[slash+1:]
+
+	return &KustomizeReference{
+		Type:     ReferenceOCI,
+		Original: ref,
+		OCI:      oci,
+	}, nil
+}
+
+// String renders the OCI reference without the scheme slashes (registry/repository:tag@digest)
+func (o *OCIReference) String() string {
+	s := o.Registry + "/" + o.Repository
+	if o.Tag != "" {
+		s += ":" + o.Tag
+	}
+	if o.Digest != "" {
+		s += "@" + o.Digest
+	}
+	return s
+}
+
+// String renders the reference, followed by its origin in parentheses when set
+// (e.g. "relative:./nodeset (component)").
 func (r *KustomizeReference) String() string {
-	if r.Type == ReferenceRelative {
-		return fmt.Sprintf("relative:%s", r.RelativePath)
+	var s string
+	switch r.Type {
+	case ReferenceRelative:
+		s = fmt.Sprintf("relative:%s", r.RelativePath)
+	case ReferenceOCI:
+		s = fmt.Sprintf("oci:%s", r.OCI.String())
+	case ReferenceLocal:
+		s = fmt.Sprintf("local:%s", r.RepoInfo.LocalRoot)
+	default:
+		s = fmt.Sprintf("remote:%s/%s/%s@%s", r.RepoInfo.Type, r.RepoInfo.Owner, r.RepoInfo.Repo, r.RepoInfo.Ref)
+	}
+	if r.Origin != "" {
+		s += fmt.Sprintf(" (%s)", r.Origin)
+	}
+	return s
+}
+
+// Pretty renders a one-line summary of the reference for error messages and logs,
+// e.g. "remote github.com owner/repo@main path=base", "relative ./base" or
+// "oci ghcr.io/org/app:v1". The ref and path are left out when empty.
+func (r *KustomizeReference) Pretty() string {
+	switch r.Type {
+	case ReferenceRelative:
+		return "relative " + r.RelativePath
+	case ReferenceOCI:
+		return "oci " + r.OCI.String()
+	}
+	var s string
+	if r.Type == ReferenceLocal {
+		s = "local " + r.RepoInfo.LocalRoot
+	} else {
+		host := r.RepoInfo.Host()
+		if host == "" {
+			host = string(r.RepoInfo.Type)
+		}
+		s = fmt.Sprintf("remote %s %s/%s", host, r.RepoInfo.Owner, r.RepoInfo.Repo)
+		if r.RepoInfo.Ref != "" {
+			s += "@" + r.RepoInfo.Ref
+		}
+	}
+	if r.Path != "" {
+		s += " path=" + r.Path
+	}
+	return s
+}
+
+// Equal reports whether r and other point at the same target: same type, and the same
+// repository, ref and path once canonicalized like node IDs, so references differing
+// only by a trailing slash, a "./" segment or a ".git" suffix are equal. Original and
+// Origin are not compared.
+func (r *KustomizeReference) Equal(other *KustomizeReference) bool {
+	if r == nil || other == nil {
+		return r == other
+	}
+	if r.Type != other.Type {
+		return false
+	}
+	switch r.Type {
+	case ReferenceRelative:
+		return path.Clean(r.RelativePath) == path.Clean(other.RelativePath)
+	case ReferenceOCI:
+		return r.OCI != nil && other.OCI != nil && *r.OCI == *other.OCI
+	}
+	if r.RepoInfo == nil || other.RepoInfo == nil {
+		return r.RepoInfo == other.RepoInfo
 	}
-	return fmt.Sprintf("remote:%s/%s/%s@%s", r.RepoInfo.Type, r.RepoInfo.Owner, r.RepoInfo.Repo, r.RepoInfo.Ref)
+	return repository.CanonicalNodeID(r.RepoInfo, r.RepoInfo.Ref, r.Path) ==
+		repository.CanonicalNodeID(other.RepoInfo, other.RepoInfo.Ref, other.Path)
 }
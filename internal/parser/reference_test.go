@@ -1,8 +1,10 @@
 package parser
 
 import (
+	"errors"
 	"testing"
 
+	"github.com/cjeanner/kustomap/internal/repository"
 	"gopkg.in/yaml.v3"
 )
 
@@ -90,8 +92,9 @@ func TestParseReference_HTTP_NoRef(t *testing.T) {
 	if err != nil {
 		t.Fatalf("ParseReference error: %v", err)
 	}
-	if got.RepoInfo.Ref != "main" {
-		t.Errorf("Ref (default) = %q, want main", got.RepoInfo.Ref)
+	// No ref: left empty so the repository layer resolves the real default branch
+	if got.RepoInfo.Ref != "" {
+		t.Errorf("Ref (default) = %q, want empty", got.RepoInfo.Ref)
 	}
 }
 
@@ -139,6 +142,104 @@ func TestParseReference_HTTP_GitLab(t *testing.T) {
 	}
 }
 
+func TestParseReference_HTTP_AzureDevOps(t *testing.T) {
+	cases := []struct {
+		name string
+		ref  string
+		path string
+		want string // resolved ref
+	}{
+		{"branch", "https://dev.azure.com/org/project/_git/repo//deploy/overlay?version=GBmain", "deploy/overlay", "main"},
+		{"tag", "https://dev.azure.com/org/project/_git/repo//deploy/overlay?version=GTv1.2.0", "deploy/overlay", "v1.2.0"},
+		{"branch with slashes", "https://dev.azure.com/org/project/_git/repo//base?version=GBrelease/2024", "base", "release/2024"},
+		{"ref", "https://dev.azure.com/org/project/_git/repo//base?ref=GBmain", "base", "main"},
+		{"ref wins over version", "https://dev.azure.com/org/project/_git/repo//base?version=GBmain&ref=GTv2", "base", "v2"},
+		{"ref without //", "https://dev.azure.com/org/project/_git/repo/deploy?ref=GTv1", "deploy", "v1"},
+		{"without //", "https://dev.azure.com/org/project/_git/repo/deploy/overlay?version=GTv1", "deploy/overlay", "v1"},
+		{"legacy host", "https://org.visualstudio.com/project/_git/repo//deploy?version=GBmain", "deploy", "main"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := ParseReference(c.ref, "")
+			if err != nil {
+				t.Fatalf("ParseReference error: %v", err)
+			}
+			if got.Type != ReferenceRemote || got.RepoInfo == nil {
+				t.Fatalf("got %+v, want a remote reference", got)
+			}
+			info := got.RepoInfo
+			if info.Type != repository.AzureDevOps || info.Owner != "org/project" || info.Repo != "repo" {
+				t.Errorf("RepoInfo = %s %s/%s, want azuredevops org/project/repo", info.Type, info.Owner, info.Repo)
+			}
+			if got.Path != c.path {
+				t.Errorf("Path = %q, want %q", got.Path, c.path)
+			}
+			if info.Ref != c.want {
+				t.Errorf("Ref = %q, want %q", info.Ref, c.want)
+			}
+		})
+	}
+}
+
+func TestParseReference_HTTP_GitDirectoryOutsideAzureDevOps(t *testing.T) {
+	got, err := ParseReference("https://github.com/org/repo/_git/app/overlay?ref=GBmain", "")
+	if err != nil {
+		t.Fatalf("ParseReference error: %v", err)
+	}
+	info := got.RepoInfo
+	if info.Type != repository.GitHub || info.Owner != "org" || info.Repo != "repo" {
+		t.Errorf("RepoInfo = %s %s/%s, want github org/repo", info.Type, info.Owner, info.Repo)
+	}
+	if got.Path != "_git/app/overlay" {
+		t.Errorf("Path = %q, want _git/app/overlay", got.Path)
+	}
+	if info.Ref != "GBmain" {
+		t.Errorf("Ref = %q, want GBmain (only Azure DevOps refs are translated)", info.Ref)
+	}
+}
+
+func TestParseReference_RawGitHub(t *testing.T) {
+	cases := []struct {
+		name      string
+		ref       string
+		owner     string
+		repo      string
+		wantRef   string
+		path      string
+		ambiguous string
+	}{
+		{"kustomization file", "https://raw.githubusercontent.com/org/repo/main/deploy/overlay/kustomization.yaml", "org", "repo", "main", "deploy/overlay", "main/deploy/overlay"},
+		{"kustomization at the root", "https://raw.githubusercontent.com/org/repo/v1.2.0/kustomization.yml", "org", "repo", "v1.2.0", "", ""},
+		{"plain resource file", "https://raw.githubusercontent.com/org/repo/main/deploy/service.yaml", "org", "repo", "main", "deploy/service.yaml", "main/deploy/service.yaml"},
+		{"fully qualified ref", "https://raw.githubusercontent.com/org/repo/refs/heads/main/base/Kustomization", "org", "repo", "main", "base", "main/base"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := ParseReference(c.ref, "")
+			if err != nil {
+				t.Fatalf("ParseReference error: %v", err)
+			}
+			if got.Type != ReferenceRemote || got.RepoInfo == nil || got.RepoInfo.Type != repository.GitHub {
+				t.Fatalf("got %+v, want a remote GitHub reference", got)
+			}
+			info := got.RepoInfo
+			if info.Owner != c.owner || info.Repo != c.repo || info.Ref != c.wantRef || got.Path != c.path {
+				t.Errorf("got %s/%s@%s path %q, want %s/%s@%s path %q", info.Owner, info.Repo, info.Ref, got.Path, c.owner, c.repo, c.wantRef, c.path)
+			}
+			if info.AmbiguousPath != c.ambiguous {
+				t.Errorf("AmbiguousPath = %q, want %q", info.AmbiguousPath, c.ambiguous)
+			}
+			if info.Host() != "github.com" {
+				t.Errorf("Host() = %q, want github.com", info.Host())
+			}
+		})
+	}
+
+	if _, err := ParseReference("https://raw.githubusercontent.com/org/repo/main", ""); !errors.Is(err, ErrMalformedReference) {
+		t.Errorf("raw URL without path: err = %v, want ErrMalformedReference", err)
+	}
+}
+
 func TestKustomizeReference_String(t *testing.T) {
 	rel := &KustomizeReference{Type: ReferenceRelative, RelativePath: "./base"}
 	if got := rel.String(); got != "relative:./base" {
@@ -146,6 +247,108 @@ func TestKustomizeReference_String(t *testing.T) {
 	}
 }
 
+func TestKustomizeReference_StringWithOrigin(t *testing.T) {
+	cases := []struct {
+		origin ReferenceOrigin
+		want   string
+	}{
+		{OriginResource, "relative:./base (resource)"},
+		{OriginComponent, "relative:./base (component)"},
+		{OriginBase, "relative:./base (base)"},
+		{OriginPatch, "relative:./base (patch)"},
+		{OriginGenerator, "relative:./base (generator)"},
+	}
+	for _, c := range cases {
+		t.Run(string(c.origin), func(t *testing.T) {
+			ref, err := ParseReference("./base", "")
+			if err != nil {
+				t.Fatalf("ParseReference: %v", err)
+			}
+			ref.Origin = c.origin
+			if got := ref.String(); got != c.want {
+				t.Errorf("String() = %q, want %q", got, c.want)
+			}
+		})
+	}
+
+	remote := &KustomizeReference{
+		Type:     ReferenceRemote,
+		RepoInfo: &repository.RepositoryInfo{Type: repository.GitHub, Owner: "o", Repo: "r", Ref: "main"},
+		Origin:   OriginComponent,
+	}
+	if got := remote.String(); got != "remote:github/o/r@main (component)" {
+		t.Errorf("String() = %q, want remote:github/o/r@main (component)", got)
+	}
+}
+
+func TestKustomizeReference_Pretty(t *testing.T) {
+	cases := []struct {
+		ref  string
+		want string
+	}{
+		{"../base", "relative ../base"},
+		{"https://github.com/owner/repo//base?ref=main", "remote github.com owner/repo@main path=base"},
+		{"https://github.com/owner/repo?ref=v1.2.0", "remote github.com owner/repo@v1.2.0"},
+		{"https://gitlab.com/group/project//deploy/overlay?ref=main", "remote gitlab.com group/project@main path=deploy/overlay"},
+	}
+	for _, c := range cases {
+		t.Run(c.ref, func(t *testing.T) {
+			ref, err := ParseReference(c.ref, "")
+			if err != nil {
+				t.Fatalf("ParseReference: %v", err)
+			}
+			if got := ref.Pretty(); got != c.want {
+				t.Errorf("Pretty() = %q, want %q", got, c.want)
+			}
+		})
+	}
+}
+
+func TestKustomizeReference_Equal(t *testing.T) {
+	cases := []struct {
+		a, b string
+		want bool
+	}{
+		{"https://github.com/org/repo//base?ref=main", "https://github.com/org/repo//base?ref=main", true},
+		{"https://github.com/org/repo//base?ref=main", "https://github.com/org/repo//base/?ref=main", true},
+		{"https://github.com/org/repo//base?ref=main", "https://github.com/org/repo.git//base?ref=main", true},
+		{"https://github.com/org/repo//base?ref=main", "https://github.com/Org/Repo//./base?ref=main", true},
+		{"https://github.com/org/repo//base?ref=main", "git@github.com:org/repo.git//base?ref=main", true},
+		{"../base", "../base/", true},
+		{"./base", "base", true},
+		{"oci://ghcr.io/org/app:v1", "oci://ghcr.io/org/app:v1", true},
+		{"https://github.com/org/repo//base?ref=main", "https://github.com/org/repo//base?ref=v1", false},
+		{"https://github.com/org/repo//base?ref=main", "https://github.com/org/repo//overlay?ref=main", false},
+		{"https://github.com/org/repo//base?ref=main", "https://github.com/org/other//base?ref=main", false},
+		{"https://github.com/org/repo//base?ref=main", "https://gitlab.com/org/repo//base?ref=main", false},
+		{"../base", "../overlay", false},
+		{"oci://ghcr.io/org/app:v1", "oci://ghcr.io/org/app:v2", false},
+		{"./base", "https://github.com/org/repo//base?ref=main", false},
+	}
+	for _, c := range cases {
+		a, err := ParseReference(c.a, "")
+		if err != nil {
+			t.Fatalf("ParseReference(%q): %v", c.a, err)
+		}
+		b, err := ParseReference(c.b, "")
+		if err != nil {
+			t.Fatalf("ParseReference(%q): %v", c.b, err)
+		}
+		b.Origin = OriginComponent
+		if got := a.Equal(b); got != c.want {
+			t.Errorf("%q.Equal(%q) = %v, want %v", c.a, c.b, got, c.want)
+		}
+		if got := b.Equal(a); got != c.want {
+			t.Errorf("%q.Equal(%q) = %v, want %v", c.b, c.a, got, c.want)
+		}
+	}
+
+	var none *KustomizeReference
+	if ref, _ := ParseReference("./base", ""); ref.Equal(none) || !none.Equal(nil) {
+		t.Error("Equal with nil references: want equal only to nil")
+	}
+}
+
 // Kustomization with bare path references (no "./" prefix, no URI).
 const kustomizationYAMLWithBarePaths = `---
 apiVersion: kustomize.config.k8s.io/v1beta1
@@ -308,3 +511,451 @@ func TestParseReference_KustomizationWithBranchWithSlashes(t *testing.T) {
 		t.Errorf("Path = %q, want %q", ref.Path, wantPath)
 	}
 }
+
+func TestParseReference_OCI(t *testing.T) {
+	cases := []struct {
+		name       string
+		ref        string
+		registry   string
+		repository string
+		tag        string
+		digest     string
+		str        string
+	}{
+		{
+			name:       "tag",
+			ref:        "oci://ghcr.io/org/manifests:v1.0",
+			registry:   "ghcr.io",
+			repository: "org/manifests",
+			tag:        "v1.0",
+			str:        "oci:ghcr.io/org/manifests:v1.0",
+		},
+		{
+			name:       "digest",
+			ref:        "oci://ghcr.io/org/manifests@sha256:0123456789abcdef",
+			registry:   "ghcr.io",
+			repository: "org/manifests",
+			digest:     "sha256:0123456789abcdef",
+			str:        "oci:ghcr.io/org/manifests@sha256:0123456789abcdef",
+		},
+		{
+			name:       "registry with port",
+			ref:        "oci://registry.local:5000/manifests:latest",
+			registry:   "registry.local:5000",
+			repository: "manifests",
+			tag:        "latest",
+			str:        "oci:registry.local:5000/manifests:latest",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := ParseReference(c.ref, "")
+			if err != nil {
+				t.Fatalf("ParseReference(%q) error: %v", c.ref, err)
+			}
+			if got.Type != ReferenceOCI {
+				t.Errorf("Type = %q, want oci", got.Type)
+			}
+			if got.RepoInfo != nil {
+				t.Errorf("RepoInfo = %v, want nil (OCI is not git)", got.RepoInfo)
+			}
+			if got.OCI == nil {
+				t.Fatal("OCI is nil")
+			}
+			if got.OCI.Registry != c.registry || got.OCI.Repository != c.repository {
+				t.Errorf("OCI = %s/%s, want %s/%s", got.OCI.Registry, got.OCI.Repository, c.registry, c.repository)
+			}
+			if got.OCI.Tag != c.tag || got.OCI.Digest != c.digest {
+				t.Errorf("Tag/Digest = %q/%q, want %q/%q", got.OCI.Tag, got.OCI.Digest, c.tag, c.digest)
+			}
+			if s := got.String(); s != c.str {
+				t.Errorf("String() = %q, want %q", s, c.str)
+			}
+		})
+	}
+}
+
+func TestParseReference_OCI_Invalid(t *testing.T) {
+	if _, err := ParseReference("oci://ghcr.io", ""); err == nil {
+		t.Fatal("expected error for OCI reference without repository")
+	}
+}
+
+func TestParseReference_GoGetterParams(t *testing.T) {
+	cases := []struct {
+		name       string
+		ref        string
+		wantRef    string
+		wantPath   string
+		submodules bool
+		timeout    int
+		depth      int
+	}{
+		{
+			name:       "ref first",
+			ref:        "https://github.com/org/repo//base?ref=main&timeout=60&submodules=false",
+			wantRef:    "main",
+			wantPath:   "base",
+			submodules: false,
+			timeout:    60,
+		},
+		{
+			name:       "ref last",
+			ref:        "https://github.com/org/repo//base?submodules=false&depth=1&ref=v1.2.3",
+			wantRef:    "v1.2.3",
+			wantPath:   "base",
+			submodules: false,
+			depth:      1,
+		},
+		{
+			name:       "ref in the middle, duration timeout",
+			ref:        "https://github.com/org/repo//deploy/overlay?timeout=2m&ref=release/v1&depth=5",
+			wantRef:    "release/v1",
+			wantPath:   "deploy/overlay",
+			submodules: true,
+			timeout:    120,
+			depth:      5,
+		},
+		{
+			name:       "unknown and invalid params ignored",
+			ref:        "https://github.com/org/repo//base?foo=bar&ref=main&timeout=soon&submodules=maybe",
+			wantRef:    "main",
+			wantPath:   "base",
+			submodules: true,
+		},
+		{
+			name:       "standard format",
+			ref:        "https://github.com/org/repo/base?timeout=30&ref=main",
+			wantRef:    "main",
+			wantPath:   "base",
+			submodules: true,
+			timeout:    30,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := ParseReference(c.ref, "")
+			if err != nil {
+				t.Fatalf("ParseReference(%q) error: %v", c.ref, err)
+			}
+			if got.RepoInfo.Ref != c.wantRef {
+				t.Errorf("Ref = %q, want %q", got.RepoInfo.Ref, c.wantRef)
+			}
+			if got.Path != c.wantPath {
+				t.Errorf("Path = %q, want %q", got.Path, c.wantPath)
+			}
+			if got.RepoInfo.Submodules != c.submodules {
+				t.Errorf("Submodules = %v, want %v", got.RepoInfo.Submodules, c.submodules)
+			}
+			if got.RepoInfo.Timeout != c.timeout {
+				t.Errorf("Timeout = %d, want %d", got.RepoInfo.Timeout, c.timeout)
+			}
+			if got.RepoInfo.Depth != c.depth {
+				t.Errorf("Depth = %d, want %d", got.RepoInfo.Depth, c.depth)
+			}
+		})
+	}
+}
+
+func TestParseReference_VersionAlias(t *testing.T) {
+	cases := []struct {
+		name     string
+		ref      string
+		wantRef  string
+		wantPath string
+	}{
+		{"version only", "https://github.com/org/repo//base?version=v1.2.3", "v1.2.3", "base"},
+		{"ref only", "https://github.com/org/repo//base?ref=v1.0.0", "v1.0.0", "base"},
+		{"both present, ref wins", "https://github.com/org/repo//base?version=v1.2.3&ref=main", "main", "base"},
+		{"version standard format", "https://github.com/org/repo/deploy/base?version=v2", "v2", "deploy/base"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := ParseReference(c.ref, "")
+			if err != nil {
+				t.Fatalf("ParseReference(%q) error: %v", c.ref, err)
+			}
+			if got.RepoInfo.Ref != c.wantRef {
+				t.Errorf("Ref = %q, want %q", got.RepoInfo.Ref, c.wantRef)
+			}
+			if got.Path != c.wantPath {
+				t.Errorf("Path = %q, want %q", got.Path, c.wantPath)
+			}
+		})
+	}
+}
+
+func TestParseReference_HostAlias(t *testing.T) {
+	RegisterHostAlias("ssh.github.com", "github.com")
+	RegisterHostAlias("git.corp.example:8443", "gitlab.com")
+	defer RegisterHostAlias("ssh.github.com", "")
+	defer RegisterHostAlias("git.corp.example:8443", "")
+
+	p := NewParser(nil, nil)
+	cases := []struct {
+		name      string
+		alias     string
+		canonical string
+	}{
+		{"ssh host", "git@ssh.github.com:org/repo.git//base?ref=main", "https://github.com/org/repo//base?ref=main"},
+		{"https alias", "https://ssh.github.com/org/repo//base?ref=main", "https://github.com/org/repo//base?ref=main"},
+		{"alias with port", "https://git.corp.example:8443/group/project//base?ref=v1", "https://gitlab.com/group/project//base?ref=v1"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			viaAlias, err := ParseReference(c.alias, "")
+			if err != nil {
+				t.Fatalf("ParseReference(%q): %v", c.alias, err)
+			}
+			viaCanonical, err := ParseReference(c.canonical, "")
+			if err != nil {
+				t.Fatalf("ParseReference(%q): %v", c.canonical, err)
+			}
+			aliasID := p.buildNodeID(viaAlias.RepoInfo, viaAlias.Path)
+			canonicalID := p.buildNodeID(viaCanonical.RepoInfo, viaCanonical.Path)
+			if aliasID != canonicalID {
+				t.Errorf("node ID via alias = %q, via canonical = %q", aliasID, canonicalID)
+			}
+			if viaAlias.RepoInfo.Type != viaCanonical.RepoInfo.Type || viaAlias.RepoInfo.BaseURL != viaCanonical.RepoInfo.BaseURL {
+				t.Errorf("alias repo = %s (%s), canonical = %s (%s)",
+					viaAlias.RepoInfo.Type, viaAlias.RepoInfo.BaseURL, viaCanonical.RepoInfo.Type, viaCanonical.RepoInfo.BaseURL)
+			}
+		})
+	}
+}
+
+func TestParseReference_Local(t *testing.T) {
+	for _, ref := range []string{"file:///srv/gitops/base", "/srv/gitops/base"} {
+		t.Run(ref, func(t *testing.T) {
+			r, err := ParseReference(ref, "")
+			if err != nil {
+				t.Fatalf("ParseReference(%q): %v", ref, err)
+			}
+			if r.Type != ReferenceLocal {
+				t.Errorf("Type = %q, want %q", r.Type, ReferenceLocal)
+			}
+			if r.RepoInfo.Type != repository.Local || r.RepoInfo.LocalRoot != "/srv/gitops/base" {
+				t.Errorf("RepoInfo = %s root=%q, want local root /srv/gitops/base", r.RepoInfo.Type, r.RepoInfo.LocalRoot)
+			}
+			if got := r.String(); got != "local:/srv/gitops/base" {
+				t.Errorf("String() = %q, want local:/srv/gitops/base", got)
+			}
+		})
+	}
+}
+
+func TestParseReference_GitLabSubpath(t *testing.T) {
+	defer repository.ClearGitLabInstances()
+	if err := repository.RegisterGitLabInstance("https://corp.example/gitlab"); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name string
+		ref  string
+		path string
+	}{
+		{"kustomize format", "https://corp.example/gitlab/group/project//deploy/base?ref=main", "deploy/base"},
+		{"standard format", "https://corp.example/gitlab/group/project/deploy/base?ref=main", "deploy/base"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			r, err := ParseReference(c.ref, "")
+			if err != nil {
+				t.Fatalf("ParseReference(%q): %v", c.ref, err)
+			}
+			info := r.RepoInfo
+			if info.Type != repository.GitLab || info.BaseURL != "https://corp.example/gitlab" {
+				t.Errorf("repo = %s at %q, want gitlab at https://corp.example/gitlab", info.Type, info.BaseURL)
+			}
+			if info.Owner != "group" || info.Repo != "project" || info.Ref != "main" || r.Path != c.path {
+				t.Errorf("got %s/%s@%s path %q, want group/project@main path %q", info.Owner, info.Repo, info.Ref, r.Path, c.path)
+			}
+		})
+	}
+}
+
+// TestParseReference_SelfManagedGitLabBaseURL ensures GitLab references on a
+// self-managed host carry its scheme+host, so the API is reached at BaseURL/api/v4.
+func TestParseReference_SelfManagedGitLabBaseURL(t *testing.T) {
+	defer repository.ClearGitLabInstances()
+	if err := repository.RegisterGitLabInstance("https://git.mycorp.net"); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name    string
+		ref     string
+		baseURL string
+	}{
+		{"kustomize format", "https://gitlab.mycorp.net/group/project//path?ref=main", "https://gitlab.mycorp.net"},
+		{"standard format", "https://gitlab.mycorp.net/group/project/path?ref=main", "https://gitlab.mycorp.net"},
+		{"mixed-case host", "https://GitLab.MyCorp.net/group/project//path?ref=main", "https://gitlab.mycorp.net"},
+		{"git SSH", "git@gitlab.mycorp.net:group/project.git//path?ref=main", "https://gitlab.mycorp.net"},
+		{"registered host", "https://git.mycorp.net/group/project//path?ref=main", "https://git.mycorp.net"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			r, err := ParseReference(c.ref, "")
+			if err != nil {
+				t.Fatalf("ParseReference(%q): %v", c.ref, err)
+			}
+			info := r.RepoInfo
+			if info.Type != repository.GitLab || info.BaseURL != c.baseURL {
+				t.Errorf("repo = %s at %q, want gitlab at %s", info.Type, info.BaseURL, c.baseURL)
+			}
+			if info.Owner != "group" || info.Repo != "project" || r.Path != "path" {
+				t.Errorf("got %s/%s path %q, want group/project path \"path\"", info.Owner, info.Repo, r.Path)
+			}
+		})
+	}
+}
+
+func TestParseReference_SSHURL(t *testing.T) {
+	defer repository.ClearGitLabInstances()
+	if err := repository.RegisterGitLabInstance("https://git.example.com"); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name string
+		ref  string
+		port int
+		path string
+	}{
+		{"with port", "ssh://git@git.example.com:2222/org/repo.git//deploy/base?ref=main", 2222, "deploy/base"},
+		{"without port", "ssh://git@git.example.com/org/repo.git//deploy/base?ref=main", 0, "deploy/base"},
+		{"without user", "ssh://git.example.com:2222/org/repo//deploy/base?ref=main", 2222, "deploy/base"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			r, err := ParseReference(c.ref, "")
+			if err != nil {
+				t.Fatalf("ParseReference(%q): %v", c.ref, err)
+			}
+			if r.Type != ReferenceRemote || r.Original != c.ref {
+				t.Errorf("Type/Original = %s/%q, want remote/%q", r.Type, r.Original, c.ref)
+			}
+			info := r.RepoInfo
+			if info.Owner != "org" || info.Repo != "repo" || info.Ref != "main" || r.Path != c.path {
+				t.Errorf("got %s/%s@%s path %q, want org/repo@main path %q", info.Owner, info.Repo, info.Ref, r.Path, c.path)
+			}
+			if info.SSHPort != c.port {
+				t.Errorf("SSHPort = %d, want %d", info.SSHPort, c.port)
+			}
+			if info.BaseURL != "https://git.example.com" {
+				t.Errorf("BaseURL = %q, want the host without the SSH port", info.BaseURL)
+			}
+		})
+	}
+}
+
+func TestParseReference_SSHURL_InvalidPort(t *testing.T) {
+	if _, err := ParseReference("ssh://git@github.com:ssh/org/repo//base", ""); err == nil {
+		t.Error("expected an error for a non-numeric port")
+	}
+}
+
+func TestParseReference_GitSuffix(t *testing.T) {
+	cases := []struct {
+		name  string
+		ref   string
+		owner string
+		path  string
+	}{
+		{"https with .git", "https://github.com/owner/repo.git//deploy/base?ref=main", "owner", "deploy/base"},
+		{"https standard format with .git", "https://github.com/owner/repo.git/deploy/base?ref=main", "owner", "deploy/base"},
+		{"https without suffix", "https://github.com/owner/repo//deploy/base?ref=main", "owner", "deploy/base"},
+		{"ssh with .git", "git@github.com:owner/repo.git//deploy/base?ref=main", "owner", "deploy/base"},
+		{"ssh without suffix", "git@github.com:owner/repo//deploy/base?ref=main", "owner", "deploy/base"},
+		{"ssh url with .git", "ssh://git@github.com/owner/repo.git//deploy/base?ref=main", "owner", "deploy/base"},
+		{"gitlab https with .git", "https://gitlab.com/group/sub/repo.git//deploy/base?ref=main", "group/sub", "deploy/base"},
+		{"repo root with .git", "https://github.com/owner/repo.git", "owner", ""},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			r, err := ParseReference(c.ref, "")
+			if err != nil {
+				t.Fatalf("ParseReference(%q): %v", c.ref, err)
+			}
+			if r.RepoInfo.Owner != c.owner || r.RepoInfo.Repo != "repo" || r.Path != c.path {
+				t.Errorf("got %s/%s path %q, want %s/repo path %q", r.RepoInfo.Owner, r.RepoInfo.Repo, r.Path, c.owner, c.path)
+			}
+		})
+	}
+}
+
+func TestParseReference_GitLabDeepSubgroups(t *testing.T) {
+	cases := []struct {
+		name  string
+		ref   string
+		owner string
+	}{
+		{"two subgroup levels", "https://gitlab.com/group/sub1/sub2/project//deploy/overlay?ref=main", "group/sub1/sub2"},
+		{"three subgroup levels", "https://gitlab.com/group/sub1/sub2/sub3/project//deploy/overlay?ref=main", "group/sub1/sub2/sub3"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			r, err := ParseReference(c.ref, "")
+			if err != nil {
+				t.Fatalf("ParseReference(%q): %v", c.ref, err)
+			}
+			info := r.RepoInfo
+			if info.Owner != c.owner || info.Repo != "project" || r.Path != "deploy/overlay" {
+				t.Errorf("got %s/%s path %q, want %s/project path deploy/overlay", info.Owner, info.Repo, r.Path, c.owner)
+			}
+			if info.AmbiguousProjectPath != "" {
+				t.Errorf("AmbiguousProjectPath = %q, want empty with a // separator", info.AmbiguousProjectPath)
+			}
+		})
+	}
+}
+
+func TestParseReference_GitLabWithoutSeparator_DefersProject(t *testing.T) {
+	r, err := ParseReference("https://gitlab.com/group/sub1/sub2/project/deploy/overlay?ref=main", "")
+	if err != nil {
+		t.Fatalf("ParseReference: %v", err)
+	}
+	if got := r.RepoInfo.AmbiguousProjectPath; got != "group/sub1/sub2/project/deploy/overlay" {
+		t.Errorf("AmbiguousProjectPath = %q, want the whole project path", got)
+	}
+
+	// GitHub repositories are always owner/repo
+	r, err = ParseReference("https://github.com/owner/repo/deploy/overlay?ref=main", "")
+	if err != nil {
+		t.Fatalf("ParseReference: %v", err)
+	}
+	if r.RepoInfo.AmbiguousProjectPath != "" {
+		t.Errorf("AmbiguousProjectPath = %q, want empty for GitHub", r.RepoInfo.AmbiguousProjectPath)
+	}
+}
+
+func TestParseReference_StructuredErrors(t *testing.T) {
+	cases := []struct {
+		name string
+		ref  string
+		want error
+	}{
+		{"s3 scheme", "s3://bucket/manifests", ErrUnsupportedScheme},
+		{"ftp scheme", "ftp://example.com/repo//base", ErrUnsupportedScheme},
+		{"invalid https URL", "https://github.com/org/repo/%zz", ErrMalformedReference},
+		{"invalid SSH port", "ssh://git@github.com:ssh/org/repo//base", ErrMalformedReference},
+		{"OCI without repository", "oci://ghcr.io", ErrMalformedReference},
+		{"file URL with a remote host", "file://server/srv/gitops", ErrMalformedReference},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := ParseReference(c.ref, "")
+			if !errors.Is(err, c.want) {
+				t.Fatalf("ParseReference(%q) error = %v, want errors.Is %v", c.ref, err, c.want)
+			}
+			other := ErrMalformedReference
+			if c.want == ErrMalformedReference {
+				other = ErrUnsupportedScheme
+			}
+			if errors.Is(err, other) {
+				t.Errorf("error %v should not match %v", err, other)
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package parser
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ErrReferenceNotFound is returned by RewriteReference when the kustomization doesn't
+// list the reference to rewrite.
+var ErrReferenceNotFound = errors.New("reference not found")
+
+// RewriteReference replaces every resources, bases and components entry equal to old
+// with new in a kustomization file. The file is parsed into a yaml.Node tree only to
+// locate the entries: their scalars are spliced in the original bytes, so comments,
+// key order, anchors and formatting are kept byte for byte, and only the lines of the
+// rewritten entries change. Each entry keeps its quoting style, unless new needs quotes.
+func RewriteReference(content []byte, old, new string) ([]byte, error) {
+	if strings.ContainsAny(new, "\r\n") {
+		return nil, fmt.Errorf("invalid reference %q: contains a line break", new)
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(content, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse kustomization YAML: %w", err)
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("%w in kustomization: %s", ErrReferenceNotFound, old)
+	}
+
+	var entries []*yaml.Node
+	root := doc.Content[0]
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		switch root.Content[i].Value {
+		case "resources", "bases", "components":
+		default:
+			continue
+		}
+		for _, item := range root.Content[i+1].Content {
+			if item.Kind == yaml.ScalarNode && item.Value == old {
+				entries = append(entries, item)
+			}
+		}
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("%w in kustomization: %s", ErrReferenceNotFound, old)
+	}
+
+	// Splice from the end so earlier offsets stay valid
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Line != entries[j].Line {
+			return entries[i].Line > entries[j].Line
+		}
+		return entries[i].Column > entries[j].Column
+	})
+	out := bytes.Clone(content)
+	for _, entry := range entries {
+		start, end, err := scalarSpan(out, entry)
+		if err != nil {
+			return nil, err
+		}
+		replacement, err := yaml.Marshal(&yaml.Node{Kind: yaml.ScalarNode, Value: new, Style: entry.Style})
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode reference %q: %w", new, err)
+		}
+		out = append(out[:start:start], append(bytes.TrimSuffix(replacement, []byte("\n")), out[end:]...)...)
+	}
+	return out, nil
+}
+
+// scalarSpan returns the byte range of the scalar node's text in content, quotes
+// included, from its (1-based, in characters) line and column.
+func scalarSpan(content []byte, node *yaml.Node) (int, int, error) {
+	offset := 0
+	for line := 1; line < node.Line; line++ {
+		i := bytes.IndexByte(content[offset:], '\n')
+		if i < 0 {
+			return 0, 0, fmt.Errorf("reference %q: line %d out of range", node.Value, node.Line)
+		}
+		offset += i + 1
+	}
+	for col := 1; col < node.Column && offset < len(content); col++ {
+		_, size := utf8.DecodeRune(content[offset:])
+		offset += size
+	}
+
+	// An anchored entry ("&base ../base") starts at its anchor
+	if node.Anchor != "" {
+		offset += len("&" + node.Anchor)
+		for offset < len(content) && (content[offset] == ' ' || content[offset] == '\t') {
+			offset++
+		}
+	}
+
+	rest := content[offset:]
+	switch node.Style {
+	case yaml.DoubleQuotedStyle:
+		for i := 1; i < len(rest); i++ {
+			switch rest[i] {
+			case '\\':
+				i++
+			case '"':
+				return offset, offset + i + 1, nil
+			}
+		}
+	case yaml.SingleQuotedStyle:
+		for i := 1; i < len(rest); i++ {
+			if rest[i] == '\'' {
+				if i+1 < len(rest) && rest[i+1] == '\'' {
+					i++
+					continue
+				}
+				return offset, offset + i + 1, nil
+			}
+		}
+	default:
+		if bytes.HasPrefix(rest, []byte(node.Value)) {
+			return offset, offset + len(node.Value), nil
+		}
+	}
+	return 0, 0, fmt.Errorf("reference %q: can't locate it at line %d, column %d", node.Value, node.Line, node.Column)
+}
@@ -0,0 +1,98 @@
+package parser
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestRewriteReference(t *testing.T) {
+	content := `# Production overlay
+apiVersion: kustomize.config.k8s.io/v1beta1
+kind: Kustomization
+
+resources:
+  - ../../base   # shared base
+  - &monitoring "https://github.com/org/components//monitoring?ref=v1.0.0"
+
+components:
+    # pinned until the new dashboards land
+    - https://github.com/org/components//dashboards?ref=v1.0.0
+    - 'https://github.com/org/components//alerts?ref=v1.0.0'
+
+patches:  [ { path: patch.yaml } ]
+`
+
+	cases := []struct {
+		name     string
+		old, new string
+		want     string // the rewritten line
+	}{
+		{
+			name: "plain component URL",
+			old:  "https://github.com/org/components//dashboards?ref=v1.0.0",
+			new:  "https://github.com/org/components//dashboards?ref=v1.1.0",
+			want: "    - https://github.com/org/components//dashboards?ref=v1.1.0",
+		},
+		{
+			name: "single-quoted component URL",
+			old:  "https://github.com/org/components//alerts?ref=v1.0.0",
+			new:  "https://github.com/org/components//alerts?ref=v1.1.0",
+			want: "    - 'https://github.com/org/components//alerts?ref=v1.1.0'",
+		},
+		{
+			name: "anchored, double-quoted resource",
+			old:  "https://github.com/org/components//monitoring?ref=v1.0.0",
+			new:  "https://github.com/org/components//monitoring?ref=v2.0.0",
+			want: `  - &monitoring "https://github.com/org/components//monitoring?ref=v2.0.0"`,
+		},
+		{
+			name: "resource with a trailing comment",
+			old:  "../../base",
+			new:  "../../base-v2",
+			want: "  - ../../base-v2   # shared base",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			out, err := RewriteReference([]byte(content), c.old, c.new)
+			if err != nil {
+				t.Fatalf("RewriteReference: %v", err)
+			}
+
+			before := strings.Split(content, "\n")
+			after := strings.Split(string(out), "\n")
+			if len(after) != len(before) {
+				t.Fatalf("rewritten file has %d lines, want %d:\n%s", len(after), len(before), out)
+			}
+			var changed []string
+			for i := range before {
+				if before[i] != after[i] {
+					changed = append(changed, after[i])
+				}
+			}
+			if len(changed) != 1 || changed[0] != c.want {
+				t.Errorf("changed lines = %q, want only %q", changed, c.want)
+			}
+
+			kust, _, err := ParseKustomizationStrict(out)
+			if err != nil {
+				t.Fatalf("rewritten file doesn't parse: %v", err)
+			}
+			refs := append(append(kust.Resources, kust.Bases...), kust.Components...)
+			if !slices.Contains(refs, c.new) || slices.Contains(refs, c.old) {
+				t.Errorf("references = %v, want %q instead of %q", refs, c.new, c.old)
+			}
+		})
+	}
+}
+
+func TestRewriteReference_NotFound(t *testing.T) {
+	content := "resources:\n  - ../base\npatches:\n  - path: ../other\n"
+	for _, old := range []string{"../other", "../missing"} {
+		if _, err := RewriteReference([]byte(content), old, "../new"); !errors.Is(err, ErrReferenceNotFound) {
+			t.Errorf("RewriteReference(%q) error = %v, want ErrReferenceNotFound", old, err)
+		}
+	}
+}
@@ -0,0 +1,272 @@
+package parser
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// SchemaError is a diagnostic of ValidateSchema: the path of the offending field
+// ("resources", "helmCharts[0].name") and what is wrong with it.
+type SchemaError struct {
+	Field   string
+	Message string
+	Line    int // line in the file; 0 when validating a Kustomization
+}
+
+func (e SchemaError) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("line %d: %s: %s", e.Line, e.Field, e.Message)
+	}
+	return e.Field + ": " + e.Message
+}
+
+// schema describes the expected shape of a kustomization value, after the Kustomize
+// JSON schema. Fields of objects not listed are accepted here; ParseKustomizationStrict
+// reports them as unknown, so the known fields of an object must all be listed.
+type schema struct {
+	kind      string             // "string", "integer", "boolean", "array" or "object"; "" for anything
+	items     *schema            // type of array items
+	fields    map[string]*schema // known fields of objects
+	values    *schema            // type of every field of objects without known fields (label maps)
+	required  []string           // object fields that must be set
+	enum      []string           // allowed values of strings
+	exclusive [][2]string        // object fields that can't be set together
+}
+
+var (
+	anyType     = &schema{}
+	stringType  = &schema{kind: "string"}
+	stringArray = &schema{kind: "array", items: stringType}
+	objectType  = &schema{kind: "object"}
+	stringMap   = &schema{kind: "object", values: stringType}
+
+	generatorSchema = &schema{kind: "object", required: []string{"name"}, fields: map[string]*schema{
+		"name":      stringType,
+		"namespace": stringType,
+		"behavior":  {kind: "string", enum: []string{"create", "replace", "merge"}},
+		"files":     stringArray,
+		"envs":      stringArray,
+		"env":       stringType,
+		"literals":  stringArray,
+		"type":      stringType,
+		"options":   objectType,
+	}}
+
+	kustomizationSchema = &schema{kind: "object", fields: map[string]*schema{
+		"apiVersion":            stringType,
+		"kind":                  {kind: "string", enum: []string{"Kustomization", "Component"}},
+		"metadata":              objectType,
+		"resources":             stringArray,
+		"bases":                 stringArray,
+		"components":            stringArray,
+		"crds":                  stringArray,
+		"buildMetadata":         {kind: "array", items: &schema{kind: "string", enum: []string{"managedByLabel", "originAnnotations", "transformerAnnotations"}}},
+		"configurations":        stringArray,
+		"generators":            stringArray,
+		"transformers":          stringArray,
+		"validators":            stringArray,
+		"patchesStrategicMerge": stringArray,
+		"namespace":             stringType,
+		"namePrefix":            stringType,
+		"nameSuffix":            stringType,
+		"commonLabels":          stringMap,
+		"commonAnnotations":     stringMap,
+		"labels":                {kind: "array", items: objectType},
+		"patches": {kind: "array", items: &schema{kind: "object", fields: map[string]*schema{
+			"path":    stringType,
+			"patch":   stringType,
+			"target":  objectType,
+			"options": objectType,
+		}}},
+		"patchesJson6902": {kind: "array", items: objectType},
+		"images": {kind: "array", items: &schema{kind: "object", required: []string{"name"}, fields: map[string]*schema{
+			"name":      stringType,
+			"newName":   stringType,
+			"newTag":    stringType,
+			"tagSuffix": stringType,
+			"digest":    stringType,
+		}}},
+		"replicas": {kind: "array", items: &schema{kind: "object", required: []string{"name"}, fields: map[string]*schema{
+			"name":  stringType,
+			"count": {kind: "integer"},
+		}}},
+		"configMapGenerator": {kind: "array", items: generatorSchema},
+		"secretGenerator":    {kind: "array", items: generatorSchema},
+		"generatorOptions":   objectType,
+		"replacements": {kind: "array", items: &schema{kind: "object", exclusive: [][2]string{{"path", "source"}, {"path", "targets"}}, fields: map[string]*schema{
+			"path":    stringType,
+			"source":  objectType,
+			"targets": {kind: "array", items: objectType},
+		}}},
+		"openapi": {kind: "object", exclusive: [][2]string{{"path", "version"}}, fields: map[string]*schema{
+			"path":    stringType,
+			"version": stringType,
+		}},
+		"helmGlobals":                 objectType,
+		"helmChartInflationGenerator": {kind: "array", items: objectType},
+		"helmCharts": {kind: "array", items: &schema{kind: "object", required: []string{"name"}, fields: map[string]*schema{
+			"name":                  stringType,
+			"repo":                  stringType,
+			"version":               stringType,
+			"releaseName":           stringType,
+			"namespace":             stringType,
+			"nameTemplate":          stringType,
+			"valuesFile":            stringType,
+			"additionalValuesFiles": stringArray,
+			"valuesInline":          objectType,
+			"valuesMerge":           {kind: "string", enum: []string{"override", "replace", "merge"}},
+			"includeCRDs":           {kind: "boolean"},
+			"skipHooks":             {kind: "boolean"},
+			"skipTests":             {kind: "boolean"},
+			"apiVersions":           stringArray,
+			"kubeVersion":           stringType,
+			"debug":                 {kind: "boolean"},
+		}}},
+		"sortOptions": {kind: "object", fields: map[string]*schema{
+			"order": {kind: "string", enum: []string{"legacy", "fifo"}},
+			"legacySortOptions": {kind: "object", fields: map[string]*schema{
+				"orderFirst": stringArray,
+				"orderLast":  stringArray,
+			}},
+		}},
+		"vars": {kind: "array", items: objectType},
+	}}
+)
+
+// ValidateSchema checks kust against the Kustomize schema: allowed values (kind,
+// sortOptions.order...), required fields (the name of images, generators and Helm
+// charts) and fields that exclude each other (a replacement's path and source). It
+// returns a diagnostic per violation, none when kust is valid.
+func ValidateSchema(kust *Kustomization) []SchemaError {
+	data, err := yaml.Marshal(kust)
+	if err != nil {
+		return []SchemaError{{Field: "(root)", Message: err.Error()}}
+	}
+	errs := ValidateSchemaBytes(data)
+	for i := range errs {
+		errs[i].Line = 0 // lines of the re-encoded struct, not of any file
+	}
+	return errs
+}
+
+// ValidateSchemaBytes is ValidateSchema for a kustomization file, before it is parsed
+// into a Kustomization: it also reports values of the wrong type (resources: "base"),
+// which fail the parsing, with their line.
+func ValidateSchemaBytes(data []byte) []SchemaError {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return []SchemaError{{Field: "(root)", Message: err.Error()}}
+	}
+	if len(doc.Content) == 0 {
+		return nil
+	}
+	return validateNode(doc.Content[0], kustomizationSchema, "")
+}
+
+// validateNode checks node against s; path is the field path of node ("" for the root)
+func validateNode(node *yaml.Node, s *schema, path string) []SchemaError {
+	for node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	// Unset values (a key without value) are accepted anywhere
+	if node.Kind == yaml.ScalarNode && node.Tag == "!!null" {
+		return nil
+	}
+	field := path
+	if field == "" {
+		field = "(root)"
+	}
+	fail := func(n *yaml.Node, format string, args ...interface{}) []SchemaError {
+		return []SchemaError{{Field: field, Message: fmt.Sprintf(format, args...), Line: n.Line}}
+	}
+
+	switch s.kind {
+	case "":
+		return nil
+	case "string", "integer", "boolean":
+		tag := map[string]string{"string": "!!str", "integer": "!!int", "boolean": "!!bool"}[s.kind]
+		if node.Kind != yaml.ScalarNode || node.Tag != tag {
+			return fail(node, "expected %s, got %s", s.kind, nodeKind(node))
+		}
+		if len(s.enum) > 0 && node.Value != "" && !slices.Contains(s.enum, node.Value) {
+			return fail(node, "%q is not one of %s", node.Value, strings.Join(s.enum, ", "))
+		}
+		return nil
+	case "array":
+		if node.Kind != yaml.SequenceNode {
+			return fail(node, "expected array, got %s", nodeKind(node))
+		}
+		var errs []SchemaError
+		for i, item := range node.Content {
+			errs = append(errs, validateNode(item, s.items, fmt.Sprintf("%s[%d]", path, i))...)
+		}
+		return errs
+	}
+
+	// object
+	if node.Kind != yaml.MappingNode {
+		return fail(node, "expected object, got %s", nodeKind(node))
+	}
+	var errs []SchemaError
+	set := make(map[string]bool)
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i].Value, node.Content[i+1]
+		set[key] = !isEmpty(value)
+		fieldSchema := s.values
+		if s.fields != nil {
+			fieldSchema = s.fields[key]
+		}
+		if fieldSchema == nil {
+			fieldSchema = anyType
+		}
+		childPath := key
+		if path != "" {
+			childPath = path + "." + key
+		}
+		errs = append(errs, validateNode(value, fieldSchema, childPath)...)
+	}
+	for _, name := range s.required {
+		if !set[name] {
+			errs = append(errs, fail(node, "missing required field %q", name)...)
+		}
+	}
+	for _, pair := range s.exclusive {
+		if set[pair[0]] && set[pair[1]] {
+			errs = append(errs, fail(node, "%q and %q can't both be set", pair[0], pair[1])...)
+		}
+	}
+	return errs
+}
+
+// isEmpty reports whether a value is null, "" or an empty array or object: unset for
+// required and exclusive fields.
+func isEmpty(node *yaml.Node) bool {
+	if node.Kind == yaml.ScalarNode {
+		return node.Tag == "!!null" || node.Value == "" && node.Tag == "!!str"
+	}
+	return node.Kind != yaml.AliasNode && len(node.Content) == 0
+}
+
+// nodeKind describes a YAML value for diagnostics: "string", "integer", "array"...
+func nodeKind(node *yaml.Node) string {
+	switch node.Kind {
+	case yaml.SequenceNode:
+		return "array"
+	case yaml.MappingNode:
+		return "object"
+	}
+	switch node.Tag {
+	case "!!str":
+		return "string"
+	case "!!int":
+		return "integer"
+	case "!!bool":
+		return "boolean"
+	case "!!float":
+		return "number"
+	}
+	return strings.TrimPrefix(node.Tag, "!!")
+}
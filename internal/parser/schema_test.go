@@ -0,0 +1,147 @@
+package parser
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/cjeanner/kustomap/internal/repository"
+	"gopkg.in/yaml.v3"
+)
+
+const validKustomization = `apiVersion: kustomize.config.k8s.io/v1beta1
+kind: Kustomization
+namespace: openstack
+commonLabels:
+  app: demo
+resources:
+  - ../base
+  - deployment.yaml
+components:
+  - ../components/monitoring
+images:
+  - name: nginx
+    newTag: "1.25"
+replicas:
+  - name: web
+    count: 3
+configMapGenerator:
+  - name: settings
+    behavior: merge
+    literals:
+      - LOG_LEVEL=debug
+helmCharts:
+  - name: redis
+    repo: https://charts.bitnami.com/bitnami
+    includeCRDs: true
+sortOptions:
+  order: fifo
+patches:
+`
+
+func TestValidateSchemaBytes(t *testing.T) {
+	cases := []struct {
+		name string
+		yaml string
+		want []SchemaError
+	}{
+		{name: "valid", yaml: validKustomization},
+		{name: "empty file", yaml: ""},
+		{
+			name: "resources as a string",
+			yaml: "resources: \"../base\"\n",
+			want: []SchemaError{{Field: "resources", Message: "expected array, got string", Line: 1}},
+		},
+		{
+			name: "wrong-typed nested fields",
+			yaml: "resources:\n  - ../base\n  - [nested]\nimages:\n  - name: nginx\n    newTag: 1.25\nreplicas:\n  - name: web\n    count: three\n",
+			want: []SchemaError{
+				{Field: "resources[1]", Message: "expected string, got array", Line: 3},
+				{Field: "images[0].newTag", Message: "expected string, got number", Line: 6},
+				{Field: "replicas[0].count", Message: "expected integer, got string", Line: 9},
+			},
+		},
+		{
+			name: "not an object",
+			yaml: "- ../base\n",
+			want: []SchemaError{{Field: "(root)", Message: "expected object, got array", Line: 1}},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := ValidateSchemaBytes([]byte(c.yaml)); !reflect.DeepEqual(got, c.want) {
+				t.Errorf("ValidateSchemaBytes() = %+v, want %+v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestValidateSchema(t *testing.T) {
+	var kust Kustomization
+	if err := yaml.Unmarshal([]byte(validKustomization), &kust); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if got := ValidateSchema(&kust); got != nil {
+		t.Errorf("ValidateSchema(valid) = %+v, want none", got)
+	}
+
+	invalid := &Kustomization{
+		Kind:         "Kustomisation",
+		Images:       []ImageOverride{{NewTag: "v2"}},
+		Replacements: []ReplacementEntry{{Path: "replacements.yaml", Source: map[string]interface{}{"kind": "ConfigMap"}}},
+		OpenAPI:      OpenAPISpec{Path: "schema.json", Version: "v1.20.4"},
+		SortOptions:  &SortOptions{Order: "alphabetical"},
+	}
+	want := []SchemaError{
+		{Field: "kind", Message: `"Kustomisation" is not one of Kustomization, Component`},
+		{Field: "replacements[0]", Message: `"path" and "source" can't both be set`},
+		{Field: "openapi", Message: `"path" and "version" can't both be set`},
+		{Field: "sortOptions.order", Message: `"alphabetical" is not one of legacy, fifo`},
+		{Field: "images[0]", Message: `missing required field "name"`},
+	}
+	got := ValidateSchema(invalid)
+	if len(got) != len(want) {
+		t.Fatalf("ValidateSchema(invalid) = %+v, want %+v", got, want)
+	}
+	for _, w := range want {
+		found := false
+		for _, g := range got {
+			found = found || g == w
+		}
+		if !found {
+			t.Errorf("ValidateSchema(invalid) = %+v, missing %+v", got, w)
+		}
+	}
+}
+
+func TestParse_SchemaValidation(t *testing.T) {
+	repo := &repository.RepositoryInfo{Type: repository.GitHub, Owner: "org", Repo: "app", Ref: "main"}
+	f := &mockFetcher{PathToContent: map[string]string{
+		"overlay": "resources:\n  - ../base\nsortOptions:\n  order: alphabetical\n",
+		"base":    "resources: []\n",
+	}}
+
+	for _, enabled := range []bool{false, true} {
+		p := NewParser(f, repo)
+		p.SchemaValidation = enabled
+		graph, err := p.Parse("overlay")
+		if err != nil {
+			t.Fatalf("Parse: %v", err)
+		}
+		warnings := map[string][]string{}
+		for _, e := range graph.Elements {
+			if e.Group == "nodes" {
+				warnings[e.Data.Path] = e.Data.Warnings
+			}
+		}
+		var want []string
+		if enabled {
+			want = []string{`line 4: sortOptions.order: "alphabetical" is not one of legacy, fifo`}
+		}
+		if !reflect.DeepEqual(warnings["overlay"], want) {
+			t.Errorf("SchemaValidation=%v: overlay warnings = %q, want %q", enabled, warnings["overlay"], want)
+		}
+		if warnings["base"] != nil {
+			t.Errorf("SchemaValidation=%v: base warnings = %q, want none", enabled, warnings["base"])
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package parser
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// strictSchemas are the schemas of the values decoded into each type of a
+// Kustomization. A field the type doesn't have but its schema lists is known to
+// kustomize, the parser just doesn't read it (apiVersion, a generator's behavior...).
+var strictSchemas = map[string]*schema{
+	reflect.TypeOf(Kustomization{}).String():     kustomizationSchema,
+	reflect.TypeOf(GeneratorArgs{}).String():     generatorSchema,
+	reflect.TypeOf(ImageOverride{}).String():     kustomizationSchema.fields["images"].items,
+	reflect.TypeOf(ReplacementEntry{}).String():  kustomizationSchema.fields["replacements"].items,
+	reflect.TypeOf(OpenAPISpec{}).String():       kustomizationSchema.fields["openapi"],
+	reflect.TypeOf(HelmChart{}).String():         kustomizationSchema.fields["helmCharts"].items,
+	reflect.TypeOf(SortOptions{}).String():       kustomizationSchema.fields["sortOptions"],
+	reflect.TypeOf(LegacySortOptions{}).String(): kustomizationSchema.fields["sortOptions"].fields["legacySortOptions"],
+	reflect.TypeOf(Var{}).String():               objectType,
+	reflect.TypeOf(VarObjRef{}).String():         objectType,
+	reflect.TypeOf(VarFieldRef{}).String():       objectType,
+}
+
+// ParseKustomizationStrict parses a kustomization file like the parser does, and also
+// reports its fields unknown to kustomize (a typo like "resourcs:", dropped by the
+// lenient decoding) as warnings, e.g. `line 2: unknown field "resourcs"`, instead of
+// failing. Known fields are those of kustomizationSchema, nested ones (generators,
+// Helm charts...) included. Known fields are parsed all the same. Invalid YAML and
+// values of the wrong type are still errors.
+func ParseKustomizationStrict(data []byte) (*Kustomization, []string, error) {
+	var kust Kustomization
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	err := dec.Decode(&kust)
+	if err == nil || errors.Is(err, io.EOF) {
+		return &kust, nil, nil
+	}
+
+	var typeErr *yaml.TypeError
+	if !errors.As(err, &typeErr) {
+		return nil, nil, fmt.Errorf("failed to parse kustomization YAML: %w", err)
+	}
+	var warnings, failures []string
+	for _, msg := range typeErr.Errors {
+		// "line 2: field resourcs not found in type parser.Kustomization"
+		line, field, ok := strings.Cut(msg, ": field ")
+		if !ok {
+			failures = append(failures, msg)
+			continue
+		}
+		name, typeName, ok := strings.Cut(field, " not found in type ")
+		if !ok {
+			failures = append(failures, msg)
+			continue
+		}
+		if s := strictSchemas[typeName]; s != nil && (s.fields == nil || s.fields[name] != nil) {
+			continue
+		}
+		warnings = append(warnings, fmt.Sprintf("%s: unknown field %q", line, name))
+	}
+	if len(failures) > 0 {
+		return nil, nil, fmt.Errorf("failed to parse kustomization YAML: %w", &yaml.TypeError{Errors: failures})
+	}
+	return &kust, warnings, nil
+}
@@ -0,0 +1,94 @@
+package parser
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseKustomizationStrict(t *testing.T) {
+	cases := []struct {
+		name          string
+		yaml          string
+		wantResources []string
+		wantWarnings  []string
+		wantErr       bool
+	}{
+		{
+			name: "clean file",
+			yaml: `apiVersion: kustomize.config.k8s.io/v1beta1
+kind: Kustomization
+namespace: openstack
+commonLabels:
+  app: demo
+resources:
+  - ../base
+patchesStrategicMerge:
+  - patch.yaml
+`,
+			wantResources: []string{"../base"},
+		},
+		{
+			name: "typo'd fields",
+			yaml: `apiVersion: kustomize.config.k8s.io/v1beta1
+kind: Kustomization
+resources:
+  - ../base
+componets:
+  - ../components/monitoring
+namePrefx: prod-
+`,
+			wantResources: []string{"../base"},
+			wantWarnings:  []string{`line 5: unknown field "componets"`, `line 7: unknown field "namePrefx"`},
+		},
+		{
+			name: "nested fields the parser doesn't read",
+			yaml: `resources: [../base]
+configMapGenerator:
+  - name: settings
+    behavior: merge
+    options:
+      disableNameSuffixHash: true
+secretGenerator:
+  - name: creds
+    type: kubernetes.io/tls
+    behavior: replace
+helmCharts:
+  - name: minecraft
+    includeCRDs: true
+images:
+  - name: nginx
+    tagSuffix: -debug
+`,
+			wantResources: []string{"../base"},
+		},
+		{
+			name:          "typo'd nested field",
+			yaml:          "resources: [../base]\nconfigMapGenerator:\n  - name: settings\n    behaviour: merge\n",
+			wantResources: []string{"../base"},
+			wantWarnings:  []string{`line 4: unknown field "behaviour"`},
+		},
+		{name: "empty file"},
+		{name: "invalid YAML", yaml: "resources: [../base\n", wantErr: true},
+		{name: "wrong type", yaml: "resources: ../base\nresourcs: []\n", wantErr: true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			kust, warnings, err := ParseKustomizationStrict([]byte(c.yaml))
+			if c.wantErr {
+				if err == nil {
+					t.Fatalf("ParseKustomizationStrict() = %+v, want an error", kust)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseKustomizationStrict: %v", err)
+			}
+			if !slices.Equal(kust.Resources, c.wantResources) {
+				t.Errorf("Resources = %v, want %v", kust.Resources, c.wantResources)
+			}
+			if !slices.Equal(warnings, c.wantWarnings) {
+				t.Errorf("warnings = %q, want %q", warnings, c.wantWarnings)
+			}
+		})
+	}
+}
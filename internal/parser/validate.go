@@ -0,0 +1,103 @@
+package parser
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/cjeanner/kustomap/internal/repository"
+)
+
+// ReferenceError is a diagnostic of ValidateReferences: a reference that doesn't
+// parse or resolve, and the kustomization field it is listed in.
+type ReferenceError struct {
+	Ref    string
+	Origin ReferenceOrigin
+	Err    error
+}
+
+func (e *ReferenceError) Error() string {
+	return fmt.Sprintf("%s %s: %v", e.Origin, e.Ref, e.Err)
+}
+
+func (e *ReferenceError) Unwrap() error {
+	return e.Err
+}
+
+// ValidateReferences checks that every resources, bases and components entry of kust,
+// a kustomization at repoInfo.Path, parses and resolves to a real branch or tag, without
+// fetching any file. It returns a diagnostic per failing reference (none when they all
+// resolve). The token is used for the repositories of repoInfo's type.
+func ValidateReferences(kust *Kustomization, repoInfo *repository.RepositoryInfo, token string) []ReferenceError {
+	return ValidateReferencesContext(context.Background(), kust, repoInfo, token)
+}
+
+// ValidateReferencesContext is ValidateReferences with a context passed to the API calls.
+func ValidateReferencesContext(ctx context.Context, kust *Kustomization, repoInfo *repository.RepositoryInfo, token string) []ReferenceError {
+	tokens := repository.TokensByType(map[repository.RepositoryType]string{repoInfo.Type: token})
+
+	var diagnostics []ReferenceError
+	check := func(refs []string, origin ReferenceOrigin) {
+		for _, ref := range refs {
+			if err := validateReference(ctx, ref, repoInfo, tokens); err != nil {
+				diagnostics = append(diagnostics, ReferenceError{Ref: ref, Origin: origin, Err: err})
+			}
+		}
+	}
+	check(kust.Resources, OriginResource)
+	check(kust.Bases, OriginBase)
+	check(kust.Components, OriginComponent)
+	return diagnostics
+}
+
+// validateReference parses ref, listed in the kustomization at repoInfo.Path, and
+// resolves the repository and ref it points to.
+func validateReference(ctx context.Context, ref string, repoInfo *repository.RepositoryInfo, tokens repository.TokenProvider) error {
+	// Plain files are only fetched, they have nothing to resolve
+	if isYAMLFile(ref) && !strings.Contains(ref, "://") {
+		return nil
+	}
+
+	kustomizeRef, err := ParseReference(ref, probeToken(ref, tokens))
+	if err != nil {
+		return err
+	}
+
+	switch kustomizeRef.Type {
+	case ReferenceRelative:
+		if repoInfo.Type == repository.Local {
+			return nil
+		}
+		_, err := ResolveRelative(repoInfo.Path, kustomizeRef.RelativePath)
+		return err
+	case ReferenceLocal:
+		if repoInfo.Type != repository.Local {
+			return errors.New("local references are only followed from local repositories")
+		}
+		return nil
+	case ReferenceRemote:
+		childRepo := kustomizeRef.RepoInfo
+		token := tokens(childRepo)
+		if childRepo.AmbiguousProjectPath != "" {
+			if _, err := repository.ResolveGitLabProjectContext(ctx, childRepo, token); err != nil {
+				return fmt.Errorf("failed to resolve GitLab project: %w", err)
+			}
+		}
+		if childRepo.AmbiguousPath != "" {
+			childRepo.Ref = ""
+			if _, _, err := repository.ResolveBranchAndPathContext(ctx, childRepo, childRepo.AmbiguousPath, token); err != nil {
+				return fmt.Errorf("failed to resolve branch: %w", err)
+			}
+			return nil
+		}
+		if childRepo.Ref == "" {
+			if _, err := repository.ResolveDefaultBranchContext(ctx, childRepo, token); err != nil {
+				return fmt.Errorf("failed to resolve default branch: %w", err)
+			}
+			return nil
+		}
+		return repository.VerifyRef(ctx, childRepo, token)
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package parser
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/cjeanner/kustomap/internal/repository"
+)
+
+func TestValidateReferences(t *testing.T) {
+	repository.SetTestRefLister(&defaultBranchRefLister{branch: "main"})
+	defer repository.SetTestRefLister(nil)
+
+	kust := &Kustomization{
+		Resources: []string{
+			"deploy.yaml",
+			"../../base",
+			"../../../../outside",
+			"https://github.com/org/lib//base?ref=main",
+			"https://github.com/org/lib//base",
+			"https://github.com/org/lib//base?ref=gone",
+			"ftp://example.com/manifests",
+		},
+		Bases:      []string{"/srv/checkout/base"},
+		Components: []string{"../../components/monitoring"},
+	}
+	repoInfo := &repository.RepositoryInfo{Type: repository.GitHub, Owner: "org", Repo: "app", Ref: "main", Path: "overlays/prod"}
+
+	diagnostics := ValidateReferences(kust, repoInfo, "")
+
+	want := []struct {
+		ref    string
+		origin ReferenceOrigin
+		is     error
+	}{
+		{"../../../../outside", OriginResource, ErrEscapesRepoRoot},
+		{"https://github.com/org/lib//base?ref=gone", OriginResource, repository.ErrNoMatchingRef},
+		{"ftp://example.com/manifests", OriginResource, ErrUnsupportedScheme},
+		{"/srv/checkout/base", OriginBase, nil},
+	}
+	if len(diagnostics) != len(want) {
+		t.Fatalf("got %d diagnostics, want %d: %v", len(diagnostics), len(want), diagnostics)
+	}
+	for i, w := range want {
+		d := diagnostics[i]
+		if d.Ref != w.ref || d.Origin != w.origin {
+			t.Errorf("diagnostic %d = %s %s, want %s %s", i, d.Origin, d.Ref, w.origin, w.ref)
+		}
+		if w.is != nil && !errors.Is(&d, w.is) {
+			t.Errorf("diagnostic %d error = %v, want %v", i, d.Err, w.is)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package repository
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// APICall describes one HTTP call made to a GitHub/GitLab API.
+type APICall struct {
+	Host     string        `json:"host"`
+	Method   string        `json:"method"`
+	Path     string        `json:"path"`
+	Status   int           `json:"status"` // 0 when the request failed without a response
+	Duration time.Duration `json:"duration"`
+}
+
+// APICallLog collects the API calls made with a context from WithAPICallLog.
+// It is safe for concurrent use.
+type APICallLog struct {
+	mu    sync.Mutex
+	calls []APICall
+}
+
+// Calls returns a copy of the recorded calls, in the order they completed.
+func (l *APICallLog) Calls() []APICall {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]APICall(nil), l.calls...)
+}
+
+func (l *APICallLog) record(call APICall) {
+	l.mu.Lock()
+	l.calls = append(l.calls, call)
+	l.mu.Unlock()
+}
+
+type apiCallLogKey struct{}
+
+// WithAPICallLog returns a context whose API calls (resolver and fetchers) are recorded
+// in the returned log. Calls made with other contexts are not recorded.
+func WithAPICallLog(ctx context.Context) (context.Context, *APICallLog) {
+	log := &APICallLog{}
+	return context.WithValue(ctx, apiCallLogKey{}, log), log
+}
+
+// apiCallLogFrom returns the log attached to ctx, or nil.
+func apiCallLogFrom(ctx context.Context) *APICallLog {
+	log, _ := ctx.Value(apiCallLogKey{}).(*APICallLog)
+	return log
+}
+
+// apiCallLogTransport records each request in the APICallLog of its context, if any.
+type apiCallLogTransport struct {
+	base http.RoundTripper
+	now  func() time.Time
+}
+
+func (t *apiCallLogTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	log := apiCallLogFrom(req.Context())
+	if log == nil {
+		return t.base.RoundTrip(req)
+	}
+
+	start := t.now()
+	resp, err := t.base.RoundTrip(req)
+	call := APICall{
+		Host:     req.URL.Host,
+		Method:   req.Method,
+		Path:     req.URL.Path,
+		Duration: t.now().Sub(start),
+	}
+	if resp != nil {
+		call.Status = resp.StatusCode
+	}
+	log.record(call)
+	return resp, err
+}
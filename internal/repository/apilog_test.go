@@ -0,0 +1,36 @@
+package repository
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestAPICallLogTransport(t *testing.T) {
+	tick := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	transport := &apiCallLogTransport{
+		base: &recordingTransport{},
+		now: func() time.Time {
+			tick = tick.Add(25 * time.Millisecond)
+			return tick
+		},
+	}
+
+	ctx, callLog := WithAPICallLog(context.Background())
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, "https://api.github.com/repos/o/r/branches?page=2", nil)
+	if _, err := transport.RoundTrip(req); err != nil {
+		t.Fatalf("RoundTrip: %v", err)
+	}
+	// Requests without a log in their context are not recorded
+	plain, _ := http.NewRequest(http.MethodGet, "https://api.github.com/repos/o/r/tags", nil)
+	if _, err := transport.RoundTrip(plain); err != nil {
+		t.Fatalf("RoundTrip: %v", err)
+	}
+
+	calls := callLog.Calls()
+	want := APICall{Host: "api.github.com", Method: http.MethodGet, Path: "/repos/o/r/branches", Status: http.StatusOK, Duration: 25 * time.Millisecond}
+	if len(calls) != 1 || calls[0] != want {
+		t.Errorf("Calls() = %+v, want [%+v]", calls, want)
+	}
+}
@@ -0,0 +1,139 @@
+package repository
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/go-github/v82/github"
+	gitlab "gitlab.com/gitlab-org/api/client-go"
+)
+
+// DefaultGitHubAPIVersion is the GitHub REST API version pinned on every request so
+// the tool doesn't break when GitHub (or go-github) changes its default.
+const DefaultGitHubAPIVersion = "2022-11-28"
+
+// Environment variables overriding the API root of the github.com and gitlab.com
+// clients, e.g. to target a local GitLab or a GitHub API proxy in tests. GITHUB_API_URL
+// is the API root itself (https://ghe.example.com/api/v3); GITLAB_API_URL may omit the
+// /api/v4 suffix. Repositories of other hosts (GitHub Enterprise, self-managed GitLab)
+// keep using their own. GitHub Actions sets GITHUB_API_URL to the API of the instance
+// running the workflow (https://api.github.com on github.com): unset it in a GitHub
+// Enterprise workflow analyzing github.com repositories.
+const (
+	GitHubAPIURLEnv = "GITHUB_API_URL"
+	GitLabAPIURLEnv = "GITLAB_API_URL"
+)
+
+// APIURLOverride returns the API root set by GitHubAPIURLEnv for a github.com
+// repository, or the instance URL set by GitLabAPIURLEnv (without /api/v4) for a
+// gitlab.com one, without trailing "/". It is "" when unset and for repositories of
+// other hosts, so their tokens are never sent to the override.
+func APIURLOverride(repoInfo *RepositoryInfo) string {
+	if host := strings.ToLower(repoInfo.Host()); host != "" && host != defaultHosts[repoInfo.Type] {
+		return ""
+	}
+	switch repoInfo.Type {
+	case GitHub:
+		return strings.TrimSuffix(os.Getenv(GitHubAPIURLEnv), "/")
+	case GitLab:
+		return strings.TrimSuffix(strings.TrimSuffix(os.Getenv(GitLabAPIURLEnv), "/"), "/api/v4")
+	}
+	return ""
+}
+
+// gitHubAPIVersion holds the X-GitHub-Api-Version override (a string) set by
+// SetGitHubAPIVersion; unset or empty means DefaultGitHubAPIVersion.
+var gitHubAPIVersion atomic.Value
+
+// SetGitHubAPIVersion overrides the pinned GitHub API version. An empty string
+// restores DefaultGitHubAPIVersion. Safe to call while requests run.
+func SetGitHubAPIVersion(version string) {
+	gitHubAPIVersion.Store(version)
+}
+
+// GitHubAPIVersion returns the GitHub API version sent with requests.
+func GitHubAPIVersion() string {
+	if version, _ := gitHubAPIVersion.Load().(string); version != "" {
+		return version
+	}
+	return DefaultGitHubAPIVersion
+}
+
+// testTransport is set by tests to intercept API HTTP traffic. When nil,
+// http.DefaultTransport is used.
+var testTransport http.RoundTripper
+
+// SetTestTransport sets the base RoundTripper used by the API clients. Only for
+// tests; call with nil to restore http.DefaultTransport. The content cache is
+// cleared so files served by a previous transport are not reused.
+func SetTestTransport(rt http.RoundTripper) {
+	testTransport = rt
+	ClearContentCache()
+}
+
+// newHTTPClient returns the HTTP client used by the GitHub/GitLab API clients.
+// Calls made with a context from WithAPICallLog are recorded.
+func newHTTPClient() *http.Client {
+	base := testTransport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &http.Client{Transport: &apiCallLogTransport{base: rateLimiter.Transport(base), now: time.Now}}
+}
+
+// gitHubHeaderTransport pins the GitHub API version (and JSON media type) on every request.
+type gitHubHeaderTransport struct {
+	base    http.RoundTripper
+	version string
+}
+
+func (t *gitHubHeaderTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("X-GitHub-Api-Version", t.version)
+	if req.Header.Get("Accept") == "" {
+		req.Header.Set("Accept", "application/vnd.github+json")
+	}
+	return t.base.RoundTrip(req)
+}
+
+// NewGitHubClient creates a GitHub API client for the repository, authenticated when
+// token is set. Requests go through the shared rate limiter and carry the pinned API
+// version. Those of a github.com repository target GITHUB_API_URL when set, like a GitHub
+// Enterprise client.
+func NewGitHubClient(repoInfo *RepositoryInfo, token string) *github.Client {
+	httpClient := newHTTPClient()
+	httpClient.Transport = &gitHubHeaderTransport{base: httpClient.Transport, version: GitHubAPIVersion()}
+	client := github.NewClient(httpClient)
+	if token != "" {
+		client = client.WithAuthToken(token)
+	}
+	if apiURL := APIURLOverride(repoInfo); apiURL != "" {
+		baseURL, err := url.Parse(apiURL + "/")
+		if err != nil || baseURL.Host == "" {
+			logger().Warn("ignoring invalid "+GitHubAPIURLEnv, "url", apiURL, "error", err)
+		} else {
+			client.BaseURL = baseURL
+		}
+	}
+	return client
+}
+
+// NewGitLabClient creates a GitLab API client for the repository's instance, or
+// GITLAB_API_URL when set for a gitlab.com repository. Requests go through the shared
+// rate limiter.
+func NewGitLabClient(repoInfo *RepositoryInfo, token string) (*gitlab.Client, error) {
+	apiURL := repoInfo.BaseURL + "/api/v4"
+	if override := APIURLOverride(repoInfo); override != "" {
+		apiURL = override + "/api/v4"
+	}
+	client, err := gitlab.NewClient(token, gitlab.WithBaseURL(apiURL), gitlab.WithHTTPClient(newHTTPClient()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GitLab client: %w", err)
+	}
+	return client, nil
+}
@@ -0,0 +1,214 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// recordingTransport is a fake RoundTripper that records requests and answers
+// every call with an empty JSON array.
+type recordingTransport struct {
+	mu       sync.Mutex
+	requests []*http.Request
+}
+
+func (rt *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	rt.mu.Lock()
+	rt.requests = append(rt.requests, req)
+	rt.mu.Unlock()
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       io.NopCloser(strings.NewReader("[]")),
+		Request:    req,
+	}, nil
+}
+
+func TestNewGitHubClient_PinsAPIVersion(t *testing.T) {
+	rt := &recordingTransport{}
+	SetTestTransport(rt)
+	defer SetTestTransport(nil)
+	ClearRefCache()
+	defer ClearRefCache()
+
+	repoInfo := &RepositoryInfo{Type: GitHub, Owner: "o", Repo: "r", BaseURL: "https://github.com"}
+	// No branches exist, so resolution fails; we only care about the requests made
+	_, _, _ = ResolveBranchAndPath(repoInfo, "main/path", "")
+
+	if len(rt.requests) == 0 {
+		t.Fatal("expected GitHub API requests through the test transport")
+	}
+	for _, req := range rt.requests {
+		if got := req.Header.Get("X-GitHub-Api-Version"); got != DefaultGitHubAPIVersion {
+			t.Errorf("%s %s: X-GitHub-Api-Version = %q, want %q", req.Method, req.URL.Path, got, DefaultGitHubAPIVersion)
+		}
+		if got := req.Header.Get("Accept"); got == "" {
+			t.Errorf("%s %s: missing Accept header", req.Method, req.URL.Path)
+		}
+	}
+}
+
+func TestSetGitHubAPIVersion_Override(t *testing.T) {
+	rt := &recordingTransport{}
+	SetTestTransport(rt)
+	defer SetTestTransport(nil)
+	SetGitHubAPIVersion("2026-03-10")
+	defer SetGitHubAPIVersion("")
+
+	client := NewGitHubClient(&RepositoryInfo{Type: GitHub}, "")
+	req, err := client.NewRequest(http.MethodGet, "repos/o/r", nil)
+	if err != nil {
+		t.Fatalf("NewRequest: %v", err)
+	}
+	if _, err := client.Do(t.Context(), req, nil); err != nil {
+		t.Fatalf("Do: %v", err)
+	}
+	if len(rt.requests) != 1 {
+		t.Fatalf("requests = %d, want 1", len(rt.requests))
+	}
+	if got := rt.requests[0].Header.Get("X-GitHub-Api-Version"); got != "2026-03-10" {
+		t.Errorf("X-GitHub-Api-Version = %q, want override 2026-03-10", got)
+	}
+
+	SetGitHubAPIVersion("")
+	if GitHubAPIVersion() != DefaultGitHubAPIVersion {
+		t.Errorf("GitHubAPIVersion() = %q after reset, want %q", GitHubAPIVersion(), DefaultGitHubAPIVersion)
+	}
+}
+
+// pagedTransport is a fake GitHub/GitLab API serving branches on one page and
+// tags spread over several pages, using each API's pagination headers.
+type pagedTransport struct {
+	branches []string
+	tagPages [][]string
+}
+
+func (rt *pagedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var names []string
+	h := http.Header{"Content-Type": []string{"application/json"}}
+	switch {
+	case strings.HasSuffix(req.URL.Path, "/branches"):
+		names = rt.branches
+	case strings.HasSuffix(req.URL.Path, "/tags"):
+		page := 1
+		if p := req.URL.Query().Get("page"); p != "" {
+			page, _ = strconv.Atoi(p)
+		}
+		names = rt.tagPages[page-1]
+		if page < len(rt.tagPages) {
+			next := *req.URL
+			q := next.Query()
+			q.Set("page", strconv.Itoa(page+1))
+			next.RawQuery = q.Encode()
+			h.Set("Link", fmt.Sprintf(`<%s>; rel="next"`, next.String())) // GitHub
+			h.Set("X-Next-Page", strconv.Itoa(page+1))                    // GitLab
+		}
+	}
+	var items []string
+	for _, n := range names {
+		items = append(items, fmt.Sprintf(`{"name":%q}`, n))
+	}
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     h,
+		Body:       io.NopCloser(strings.NewReader("[" + strings.Join(items, ",") + "]")),
+		Request:    req,
+	}, nil
+}
+
+func TestListBranchesAndTags_PaginatesTags(t *testing.T) {
+	rt := &pagedTransport{
+		branches: []string{"main"},
+		tagPages: [][]string{{"v1.0.0", "v1.1.0"}, {"v2.0.0"}, {"v3.0.0"}},
+	}
+	SetTestTransport(rt)
+	defer SetTestTransport(nil)
+	ClearRefCache()
+	defer ClearRefCache()
+
+	for _, repoInfo := range []*RepositoryInfo{
+		{Type: GitHub, Owner: "o", Repo: "r", BaseURL: "https://github.com"},
+		{Type: GitLab, Owner: "g", Repo: "p", BaseURL: "https://gitlab.example.com"},
+	} {
+		t.Run(string(repoInfo.Type), func(t *testing.T) {
+			refs, err := listBranchesAndTags(context.Background(), repoInfo, "")
+			if err != nil {
+				t.Fatalf("listBranchesAndTags: %v", err)
+			}
+			want := []string{"main", "v1.0.0", "v1.1.0", "v2.0.0", "v3.0.0"}
+			if strings.Join(refs, ",") != strings.Join(want, ",") {
+				t.Errorf("refs = %v, want %v", refs, want)
+			}
+
+			// A tag from the last page must be resolvable
+			branch, path, err := ResolveBranchAndPath(repoInfo, "v3.0.0/deploy", "")
+			if err != nil {
+				t.Fatalf("ResolveBranchAndPath: %v", err)
+			}
+			if branch != "v3.0.0" || path != "deploy" {
+				t.Errorf("branch/path = %q/%q, want v3.0.0/deploy", branch, path)
+			}
+		})
+	}
+}
+
+func TestAPIURLEnvOverride(t *testing.T) {
+	cases := []struct {
+		name       string
+		env, value string
+		repoInfo   *RepositoryInfo
+		wantPrefix string
+	}{
+		{
+			name: "GitHub proxy", env: GitHubAPIURLEnv, value: "http://localhost:8080/github/",
+			repoInfo:   &RepositoryInfo{Type: GitHub, Owner: "o", Repo: "r", BaseURL: "https://github.com"},
+			wantPrefix: "http://localhost:8080/github/repos/o/r/",
+		},
+		{
+			name: "GitHub Enterprise", env: GitHubAPIURLEnv, value: "https://ghe.example.com/api/v3",
+			repoInfo:   &RepositoryInfo{Type: GitHub, Owner: "o", Repo: "r", BaseURL: "https://github.com"},
+			wantPrefix: "https://ghe.example.com/api/v3/repos/o/r/",
+		},
+		{
+			name: "local GitLab", env: GitLabAPIURLEnv, value: "http://localhost:3000",
+			repoInfo:   &RepositoryInfo{Type: GitLab, Owner: "g", Repo: "p", BaseURL: "https://gitlab.com"},
+			wantPrefix: "http://localhost:3000/api/v4/projects/g%2Fp/",
+		},
+		{
+			name: "self-managed GitLab not redirected", env: GitLabAPIURLEnv, value: "http://localhost:3000",
+			repoInfo:   &RepositoryInfo{Type: GitLab, Owner: "g", Repo: "p", BaseURL: "https://gitlab.example.com"},
+			wantPrefix: "https://gitlab.example.com/api/v4/projects/g%2Fp/",
+		},
+		{
+			name: "invalid GitHub URL ignored", env: GitHubAPIURLEnv, value: "not a url",
+			repoInfo:   &RepositoryInfo{Type: GitHub, Owner: "o", Repo: "r", BaseURL: "https://github.com"},
+			wantPrefix: "https://api.github.com/repos/o/r/",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			t.Setenv(c.env, c.value)
+			rt := &recordingTransport{}
+			SetTestTransport(rt)
+			defer SetTestTransport(nil)
+
+			if _, err := listBranchesAndTags(context.Background(), c.repoInfo, ""); err != nil {
+				t.Fatalf("listBranchesAndTags: %v", err)
+			}
+			if len(rt.requests) == 0 {
+				t.Fatal("expected API requests through the test transport")
+			}
+			for _, req := range rt.requests {
+				if got := req.URL.EscapedPath(); !strings.HasPrefix(req.URL.Scheme+"://"+req.URL.Host+got, c.wantPrefix) {
+					t.Errorf("request to %s, want under %s", req.URL, c.wantPrefix)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,151 @@
+package repository
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultContentCacheSize is the total size of the file contents kept by the shared
+// content cache.
+const defaultContentCacheSize = 32 << 20
+
+// defaultContentCacheTTL is how long fetched contents are reused: a branch may move.
+const defaultContentCacheTTL = defaultRefCacheTTL
+
+// contentCacheEntry holds a cached file content.
+type contentCacheEntry struct {
+	key     string
+	data    []byte
+	expires time.Time
+}
+
+// ContentCache keeps fetched file contents, keyed by ContentCacheKey, so repeated
+// builds don't download the same kustomization files again. It holds at most
+// maxBytes of contents, evicting the least recently used first, each for at most
+// ttl. Safe for concurrent use.
+type ContentCache struct {
+	mu       sync.Mutex
+	maxBytes int
+	ttl      time.Duration
+	size     int
+	order    *list.List // of *contentCacheEntry, most recently used first
+	entries  map[string]*list.Element
+	now      func() time.Time
+}
+
+// NewContentCache returns an empty cache of at most maxBytes of contents, each kept
+// for ttl. A maxBytes or ttl <= 0 disables caching.
+func NewContentCache(maxBytes int, ttl time.Duration) *ContentCache {
+	return &ContentCache{
+		maxBytes: maxBytes,
+		ttl:      ttl,
+		order:    list.New(),
+		entries:  make(map[string]*list.Element),
+		now:      time.Now,
+	}
+}
+
+// ContentCacheKey identifies path at ref in repoInfo as fetched with token:
+// host/owner/repo/ref/credential/path. The credential is a hash of the token, empty
+// for anonymous fetches, so contents fetched with one token aren't served to callers
+// with another one (or none), who may not be allowed to read them.
+func ContentCacheKey(repoInfo *RepositoryInfo, ref, path, token string) string {
+	return strings.Join([]string{strings.ToLower(repoInfo.Host()), repoInfo.Owner, repoInfo.Repo, ref, credentialKey(token), path}, "/")
+}
+
+// credentialKey identifies token in cache keys without holding it: a hash, or "" for
+// anonymous calls.
+func credentialKey(token string) string {
+	if token == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:8])
+}
+
+// Get returns a copy of the content cached for key, if fresh.
+func (c *ContentCache) Get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*contentCacheEntry)
+	if !c.now().Before(entry.expires) {
+		c.remove(elem)
+		return nil, false
+	}
+	c.order.MoveToFront(elem)
+	return append([]byte(nil), entry.data...), true
+}
+
+// Add caches a copy of data for key, evicting the least recently used contents to
+// stay within the size limit. Contents larger than the limit aren't cached.
+func (c *ContentCache) Add(key string, data []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.entries[key]; ok {
+		c.remove(elem)
+	}
+	if c.ttl <= 0 || len(data) > c.maxBytes {
+		return
+	}
+	entry := &contentCacheEntry{key: key, data: append([]byte(nil), data...), expires: c.now().Add(c.ttl)}
+	c.entries[key] = c.order.PushFront(entry)
+	c.size += len(data)
+	c.evict()
+}
+
+// Clear drops all cached contents.
+func (c *ContentCache) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.order.Init()
+	c.entries = make(map[string]*list.Element)
+	c.size = 0
+}
+
+// SetMaxBytes changes the size limit, evicting contents above it.
+func (c *ContentCache) SetMaxBytes(maxBytes int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.maxBytes = maxBytes
+	c.evict()
+}
+
+// evict removes the least recently used contents until the cache fits maxBytes
+func (c *ContentCache) evict() {
+	for c.size > max(c.maxBytes, 0) {
+		c.remove(c.order.Back())
+	}
+}
+
+func (c *ContentCache) remove(elem *list.Element) {
+	entry := c.order.Remove(elem).(*contentCacheEntry)
+	delete(c.entries, entry.key)
+	c.size -= len(entry.data)
+}
+
+// contentCache is the shared content cache used by the fetchers.
+var contentCache = NewContentCache(defaultContentCacheSize, defaultContentCacheTTL)
+
+// SharedContentCache returns the content cache shared by the fetchers.
+func SharedContentCache() *ContentCache {
+	return contentCache
+}
+
+// ClearContentCache drops all cached file contents.
+func ClearContentCache() {
+	contentCache.Clear()
+}
+
+// SetContentCacheSize sets the total size of the cached file contents. A size <= 0
+// disables caching.
+func SetContentCacheSize(maxBytes int) {
+	contentCache.SetMaxBytes(maxBytes)
+}
@@ -0,0 +1,62 @@
+package repository
+
+import (
+	"testing"
+	"time"
+)
+
+func TestContentCache_LRU(t *testing.T) {
+	c := NewContentCache(10, time.Minute)
+	c.Add("a", []byte("aaaa"))
+	c.Add("b", []byte("bbbb"))
+	if _, ok := c.Get("a"); !ok { // a is now the most recently used
+		t.Fatal("Get(a) missed")
+	}
+	c.Add("c", []byte("cccc")) // over 10 bytes: evicts b
+
+	if _, ok := c.Get("b"); ok {
+		t.Error("Get(b) hit, want evicted as least recently used")
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, ok := c.Get(key); !ok {
+			t.Errorf("Get(%s) missed", key)
+		}
+	}
+
+	c.Add("big", []byte("larger than the limit"))
+	if _, ok := c.Get("big"); ok {
+		t.Error("content larger than the limit was cached")
+	}
+	if _, ok := c.Get("a"); !ok {
+		t.Error("Get(a) missed after adding an oversized content")
+	}
+
+	c.SetMaxBytes(4)
+	if _, ok := c.Get("c"); ok {
+		t.Error("Get(c) hit after shrinking the cache, want evicted")
+	}
+
+	data, _ := c.Get("a")
+	data[0] = 'x'
+	if got, _ := c.Get("a"); string(got) != "aaaa" {
+		t.Errorf("Get(a) = %q after modifying a previous result, want aaaa", got)
+	}
+}
+
+func TestContentCache_TTL(t *testing.T) {
+	c := NewContentCache(100, time.Minute)
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	c.now = func() time.Time { return now }
+
+	c.Add("k", []byte("content"))
+	if _, ok := c.Get("k"); !ok {
+		t.Fatal("Get before expiry missed")
+	}
+	now = now.Add(2 * time.Minute)
+	if _, ok := c.Get("k"); ok {
+		t.Error("Get after expiry should miss")
+	}
+	if c.size != 0 {
+		t.Errorf("size = %d after expiry, want 0", c.size)
+	}
+}
@@ -2,22 +2,41 @@ package repository
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
 	"net/http"
 	"net/url"
+	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 )
 
 type RepositoryType string
 
 const (
-	GitHub  RepositoryType = "github"
-	GitLab  RepositoryType = "gitlab"
-	Unknown RepositoryType = "unknown"
+	GitHub      RepositoryType = "github"
+	GitLab      RepositoryType = "gitlab"
+	AzureDevOps RepositoryType = "azuredevops"
+	Local       RepositoryType = "local"
+	Archive     RepositoryType = "archive"
+	Unknown     RepositoryType = "unknown"
 )
 
+// ErrUnknownRepositoryType is returned by DetectRepository for a host whose API
+// answered neither the GitLab nor the GitHub probe.
+var ErrUnknownRepositoryType = errors.New("unable to detect repository type")
+
+// MaxTypeProbes is the number of API requests DetectRepository makes at most to
+// find out the type of a host: the GitLab probe, then the GitHub one.
+const MaxTypeProbes = 2
+
+// LocalRef is the ref of Local repositories: the working tree as it is on disk.
+const LocalRef = "working-tree"
+
+// ArchiveRef is the ref of Archive repositories: the snapshot the archive holds.
+const ArchiveRef = "snapshot"
+
 type RepositoryInfo struct {
 	Type          RepositoryType
 	Owner         string
@@ -26,41 +45,186 @@ type RepositoryInfo struct {
 	BaseURL       string
 	Path          string
 	AmbiguousPath string
+
+	// AmbiguousProjectPath is set for GitLab URLs without a "//" separator whose
+	// subgroups, project and path can't be told apart (group/sub/project/path);
+	// ResolveGitLabProject splits it. Owner/Repo hold the first two segments meanwhile.
+	AmbiguousProjectPath string
+
+	// LocalRoot is the root directory on disk of a Local repository, or the archive
+	// file of an Archive one
+	LocalRoot string
+
+	// go-getter options from kustomize remote references (?submodules=&timeout=&depth=)
+	Submodules bool // clone submodules (kustomize default: true)
+	Timeout    int  // clone timeout in seconds; 0 means default
+	Depth      int  // clone depth; 0 means default
+
+	// TypeProbes is the number of API requests DetectRepository made to find out the
+	// type of an unknown host; 0 when the URL told it
+	TypeProbes int
+
+	// SSHPort is the port of an ssh:// reference (ssh://git@host:2222/...); 0 means default
+	SSHPort int
+
+	// Fork fallback (opt-in): when the fork lacks the ref, resolve against its parent
+	FollowForkParent bool
+	ResolvedFromFork string // "owner/repo" of the fork when resolution fell back to the parent
 }
 
 // DetectRepository parses the URL and determines the repository type
 func DetectRepository(repoURL string, token string) (*RepositoryInfo, error) {
+	// Local checkout or archive: plain absolute path
+	if filepath.IsAbs(repoURL) {
+		return newDiskRepository(repoURL), nil
+	}
+
 	parsedURL, err := url.Parse(repoURL)
 	if err != nil {
 		return nil, fmt.Errorf("invalid URL: %w", err)
 	}
 
-	host := parsedURL.Host
+	// Local checkout or archive: file:///abs/path
+	if parsedURL.Scheme == "file" {
+		if parsedURL.Host != "" && parsedURL.Host != "localhost" {
+			return nil, fmt.Errorf("file URL must not have a remote host: %s", parsedURL.Host)
+		}
+		if !filepath.IsAbs(parsedURL.Path) {
+			return nil, fmt.Errorf("file URL must hold an absolute path: %s", repoURL)
+		}
+		return newDiskRepository(parsedURL.Path), nil
+	}
+
+	// Registered self-hosted GitLab, possibly under a subpath (https://corp.example/gitlab)
+	if instanceURL, projectPath, ok := SplitGitLabInstance(repoURL); ok {
+		return parseGitLabURL(projectPath, instanceURL)
+	}
+
+	// Host names are case-insensitive: "GitLab.MyCorp.net" is classified like "gitlab.mycorp.net"
+	host := strings.ToLower(parsedURL.Host)
 	path := strings.Trim(parsedURL.Path, "/")
-	baseURL := fmt.Sprintf("%s://%s", parsedURL.Scheme, host)
+	baseURL := fmt.Sprintf("%s://%s", strings.ToLower(parsedURL.Scheme), host)
 
 	// GitHub.com - direct detection
 	if strings.Contains(host, "github.com") {
 		return parseGitHubURL(path, baseURL)
 	}
 
+	// Azure DevOps, and its legacy org.visualstudio.com hosts
+	if host == "dev.azure.com" || strings.HasSuffix(host, ".visualstudio.com") {
+		return parseAzureDevOpsURL(host, path, parsedURL.Query(), baseURL)
+	}
+
 	// GitLab - detect by hostname or URL structure
 	if strings.Contains(host, "gitlab") || strings.Contains(path, "/-/") {
-		log.Printf("Detected GitLab from hostname or URL structure")
+		logger().Debug("detected GitLab from hostname or URL structure", "host", host)
 		return parseGitLabURL(path, baseURL)
 	}
 
 	// For ambiguous cases, try probing with token
-	repoType := probeRepositoryType(baseURL, token)
+	repoType, probes := probeRepositoryType(baseURL, token)
 
+	var info *RepositoryInfo
 	switch repoType {
 	case GitLab:
-		return parseGitLabURL(path, baseURL)
+		info, err = parseGitLabURL(path, baseURL)
 	case GitHub:
-		return parseGitHubURL(path, baseURL)
+		info, err = parseGitHubURL(path, baseURL)
 	default:
-		return nil, fmt.Errorf("unable to detect repository type for: %s", host)
+		return nil, fmt.Errorf("%w for: %s", ErrUnknownRepositoryType, host)
+	}
+	if info != nil {
+		info.TypeProbes = probes
+	}
+	return info, err
+}
+
+// gitLabInstance is a registered self-hosted GitLab: host and optional base path
+// (e.g. "/gitlab" when the instance is served behind a reverse-proxy subpath).
+type gitLabInstance struct {
+	scheme   string
+	host     string
+	basePath string
+}
+
+var (
+	gitLabInstancesMu sync.RWMutex
+	gitLabInstances   []gitLabInstance
+)
+
+// RegisterGitLabInstance registers a self-hosted GitLab by its base URL, which may
+// include a subpath (https://corp.example/gitlab). URLs under it are detected as
+// GitLab without probing, and the subpath is kept in BaseURL (so the API is reached
+// at BaseURL + "/api/v4") instead of being read as part of the project path.
+func RegisterGitLabInstance(baseURL string) error {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return fmt.Errorf("invalid GitLab base URL: %w", err)
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return fmt.Errorf("invalid GitLab base URL: %s", baseURL)
+	}
+	inst := gitLabInstance{
+		scheme:   u.Scheme,
+		host:     strings.ToLower(u.Host),
+		basePath: strings.Trim(u.Path, "/"),
+	}
+
+	gitLabInstancesMu.Lock()
+	defer gitLabInstancesMu.Unlock()
+	for _, existing := range gitLabInstances {
+		if existing == inst {
+			return nil
+		}
+	}
+	gitLabInstances = append(gitLabInstances, inst)
+	return nil
+}
+
+// ClearGitLabInstances forgets all registered GitLab instances.
+func ClearGitLabInstances() {
+	gitLabInstancesMu.Lock()
+	gitLabInstances = nil
+	gitLabInstancesMu.Unlock()
+}
+
+// SplitGitLabInstance splits rawURL into the base URL of the registered GitLab
+// instance it belongs to (subpath included) and the project path after it.
+// The longest matching base path wins. ok is false when no instance matches.
+func SplitGitLabInstance(rawURL string) (baseURL, projectPath string, ok bool) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return "", "", false
+	}
+	host := strings.ToLower(u.Host)
+	path := strings.Trim(u.Path, "/")
+
+	gitLabInstancesMu.RLock()
+	defer gitLabInstancesMu.RUnlock()
+
+	var best *gitLabInstance
+	for i := range gitLabInstances {
+		inst := &gitLabInstances[i]
+		if inst.host != host {
+			continue
+		}
+		if inst.basePath != "" && path != inst.basePath && !strings.HasPrefix(path, inst.basePath+"/") {
+			continue
+		}
+		if best == nil || len(inst.basePath) > len(best.basePath) {
+			best = inst
+		}
+	}
+	if best == nil {
+		return "", "", false
 	}
+
+	baseURL = fmt.Sprintf("%s://%s", u.Scheme, host)
+	if best.basePath != "" {
+		baseURL += "/" + best.basePath
+	}
+	projectPath = strings.TrimPrefix(strings.TrimPrefix(path, best.basePath), "/")
+	return baseURL, projectPath, true
 }
 
 // isGitLabInstance checks if the URL is a GitLab instance
@@ -81,13 +245,13 @@ func isGitLabInstance(baseURL, token string) bool {
 
 	resp, err := client.Do(req)
 	if err != nil {
-		log.Printf("Failed to probe GitLab API: %v", err)
+		logger().Warn("failed to probe GitLab API", "error", err)
 		return false
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		log.Printf("GitLab API returned status %d", resp.StatusCode)
+		logger().Warn("GitLab API probe failed", "status", resp.StatusCode)
 		return false
 	}
 
@@ -129,19 +293,76 @@ func isGitHubInstance(baseURL, token string) bool {
 	return resp.StatusCode == http.StatusOK
 }
 
-// probeRepositoryType attempts to detect the repository type by probing APIs
-func probeRepositoryType(baseURL, token string) RepositoryType {
+// probeRepositoryType attempts to detect the repository type by probing APIs, also
+// returning the number of probe requests made
+func probeRepositoryType(baseURL, token string) (RepositoryType, int) {
 	// Try GitLab first
 	if isGitLabInstance(baseURL, token) {
-		return GitLab
+		return GitLab, 1
 	}
 
 	// Try GitHub
 	if isGitHubInstance(baseURL, token) {
-		return GitHub
+		return GitHub, MaxTypeProbes
+	}
+
+	return Unknown, MaxTypeProbes
+}
+
+// NewLocalRepository describes a checkout on disk rooted at root. There is a single
+// ref (LocalRef) and paths are relative to root.
+func NewLocalRepository(root string) *RepositoryInfo {
+	root = filepath.Clean(root)
+	return &RepositoryInfo{
+		Type:      Local,
+		Repo:      filepath.Base(root),
+		Ref:       LocalRef,
+		LocalRoot: root,
 	}
+}
 
-	return Unknown
+// NewArchiveRepository describes a .tar.gz, .tgz, .tar or .zip snapshot of a
+// repository stored at file. There is a single ref (ArchiveRef) and paths are
+// relative to the archive root.
+func NewArchiveRepository(file string) *RepositoryInfo {
+	file = filepath.Clean(file)
+	return &RepositoryInfo{
+		Type:      Archive,
+		Repo:      strings.TrimSuffix(filepath.Base(file), archiveExt(file)),
+		Ref:       ArchiveRef,
+		LocalRoot: file,
+	}
+}
+
+// IsArchivePath reports whether p names an archive kustomap can read (by extension).
+func IsArchivePath(p string) bool {
+	return archiveExt(p) != ""
+}
+
+// archiveExt returns the archive extension p ends with, or "".
+func archiveExt(p string) string {
+	lower := strings.ToLower(p)
+	for _, ext := range []string{".tar.gz", ".tgz", ".tar", ".zip"} {
+		if strings.HasSuffix(lower, ext) {
+			return p[len(p)-len(ext):]
+		}
+	}
+	return ""
+}
+
+// newDiskRepository describes an absolute path on disk: an Archive when one of its
+// segments has an archive extension (the rest is the path inside the archive, as in
+// /srv/manifests.tar.gz/overlays/prod), a Local checkout otherwise.
+func newDiskRepository(p string) *RepositoryInfo {
+	parts := strings.Split(filepath.ToSlash(p), "/")
+	for i, part := range parts {
+		if IsArchivePath(part) {
+			info := NewArchiveRepository(filepath.FromSlash(strings.Join(parts[:i+1], "/")))
+			info.Path = strings.Trim(strings.Join(parts[i+1:], "/"), "/")
+			return info
+		}
+	}
+	return NewLocalRepository(p)
 }
 
 // parseGitHubURL extracts owner/repo/path from GitHub URL
@@ -155,7 +376,7 @@ func parseGitHubURL(path, baseURL string) (*RepositoryInfo, error) {
 		Type:          GitHub,
 		Owner:         parts[0],
 		Repo:          strings.TrimSuffix(parts[1], ".git"),
-		Ref:           "main",
+		Ref:           "", // Default branch, resolved later (ResolveDefaultBranch)
 		BaseURL:       baseURL,
 		Path:          "",
 		AmbiguousPath: "",
@@ -222,7 +443,7 @@ func parseGitLabURL(path, baseURL string) (*RepositoryInfo, error) {
 		Type:          GitLab,
 		Owner:         owner,
 		Repo:          repo,
-		Ref:           "main", // Will be resolved later
+		Ref:           "", // Default branch, resolved later (ResolveDefaultBranch)
 		BaseURL:       baseURL,
 		Path:          "",
 		AmbiguousPath: ambiguousPath, // Store for later resolution
@@ -231,6 +452,73 @@ func parseGitLabURL(path, baseURL string) (*RepositoryInfo, error) {
 	return info, nil
 }
 
+// parseAzureDevOpsURL extracts organization/project/repo from an Azure DevOps URL:
+// dev.azure.com/org/project/_git/repo or org.visualstudio.com/project/_git/repo. Owner
+// is "org/project". The repository browser's ?path= and ?version= are the path and ref.
+func parseAzureDevOpsURL(host, path string, query url.Values, baseURL string) (*RepositoryInfo, error) {
+	parts := strings.Split(path, "/")
+	gitIndex := -1
+	for i, part := range parts {
+		if part == "_git" {
+			gitIndex = i
+			break
+		}
+	}
+	if gitIndex < 0 || gitIndex+1 >= len(parts) {
+		return nil, fmt.Errorf("invalid Azure DevOps repository path (want org/project/_git/repo): %s", path)
+	}
+
+	owner := parts[:gitIndex]
+	if org, ok := strings.CutSuffix(host, ".visualstudio.com"); ok {
+		// Legacy host: the organization is the subdomain, the collection may be explicit
+		if len(owner) > 0 && owner[0] == "DefaultCollection" {
+			owner = owner[1:]
+		}
+		owner = append([]string{org}, owner...)
+	}
+	if len(owner) != 2 {
+		return nil, fmt.Errorf("invalid Azure DevOps repository path (want org/project/_git/repo): %s", path)
+	}
+
+	repoPath := strings.Join(parts[gitIndex+2:], "/")
+	if p := query.Get("path"); p != "" {
+		repoPath = p
+	}
+	return &RepositoryInfo{
+		Type:    AzureDevOps,
+		Owner:   strings.Join(owner, "/"),
+		Repo:    strings.TrimSuffix(parts[gitIndex+1], ".git"),
+		Ref:     AzureDevOpsRef(query.Get("version")),
+		BaseURL: baseURL,
+		Path:    strings.Trim(repoPath, "/"),
+	}, nil
+}
+
+// AzureDevOpsRef translates an Azure DevOps version ("GBmain" for branch main, "GTv1"
+// for tag v1, "GC<sha>" for a commit) into a plain ref. Other values are kept as is.
+func AzureDevOpsRef(version string) string {
+	for _, prefix := range []string{"GB", "GT", "GC"} {
+		if ref, ok := strings.CutPrefix(version, prefix); ok && ref != "" {
+			return ref
+		}
+	}
+	return version
+}
+
 func (r *RepositoryInfo) String() string {
 	return fmt.Sprintf("%s:%s/%s@%s", r.Type, r.Owner, r.Repo, r.Ref)
 }
+
+// Host returns the host of the repository's base URL ("github.com" when unset for
+// GitHub), or "" for local repositories.
+func (r *RepositoryInfo) Host() string {
+	if r.BaseURL != "" {
+		if u, err := url.Parse(r.BaseURL); err == nil && u.Host != "" {
+			return u.Host
+		}
+	}
+	if r.Type == GitHub {
+		return "github.com"
+	}
+	return ""
+}
@@ -19,14 +19,14 @@ func TestDetectRepository_GitHub(t *testing.T) {
 			repoURL: "https://github.com/owner/repo",
 			owner:   "owner",
 			repo:    "repo",
-			ref:     "main",
+			ref:     "",
 		},
 		{
 			name:    "with path (path not stored in detector; only tree/blob set AmbiguousPath)",
 			repoURL: "https://github.com/owner/repo/deploy/base",
 			owner:   "owner",
 			repo:    "repo",
-			ref:     "main",
+			ref:     "",
 		},
 		{
 			name:       "tree branch path",
@@ -34,7 +34,7 @@ func TestDetectRepository_GitHub(t *testing.T) {
 			owner:      "owner",
 			repo:       "repo",
 			ambiguous:  "main/deploy/overlay",
-			ref:        "main",
+			ref:        "",
 		},
 		{
 			name:       "blob branch path",
@@ -42,14 +42,14 @@ func TestDetectRepository_GitHub(t *testing.T) {
 			owner:      "owner",
 			repo:       "repo",
 			ambiguous:  "develop/README.md",
-			ref:        "main",
+			ref:        "",
 		},
 		{
 			name:    "repo with .git",
 			repoURL: "https://github.com/owner/repo.git",
 			owner:   "owner",
 			repo:    "repo",
-			ref:     "main",
+			ref:     "",
 		},
 	}
 	for _, c := range cases {
@@ -221,6 +221,60 @@ func TestParseGitLabURL(t *testing.T) {
 	}
 }
 
+func TestDetectRepository_AzureDevOps(t *testing.T) {
+	cases := []struct {
+		name    string
+		repoURL string
+		owner   string
+		path    string
+		ref     string
+		baseURL string
+	}{
+		{name: "repository", repoURL: "https://dev.azure.com/org/project/_git/repo", owner: "org/project", baseURL: "https://dev.azure.com"},
+		{name: "browse branch", repoURL: "https://dev.azure.com/org/project/_git/repo?path=/deploy/overlay&version=GBmain", owner: "org/project", path: "deploy/overlay", ref: "main", baseURL: "https://dev.azure.com"},
+		{name: "browse tag", repoURL: "https://dev.azure.com/org/project/_git/repo?path=/deploy&version=GTv1.0", owner: "org/project", path: "deploy", ref: "v1.0", baseURL: "https://dev.azure.com"},
+		{name: "legacy host", repoURL: "https://org.visualstudio.com/project/_git/repo", owner: "org/project", baseURL: "https://org.visualstudio.com"},
+		{name: "legacy default collection", repoURL: "https://org.visualstudio.com/DefaultCollection/project/_git/repo.git", owner: "org/project", baseURL: "https://org.visualstudio.com"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			info, err := DetectRepository(c.repoURL, "")
+			if err != nil {
+				t.Fatalf("DetectRepository error: %v", err)
+			}
+			if info.Type != AzureDevOps || info.Owner != c.owner || info.Repo != "repo" {
+				t.Errorf("got %s %s/%s, want azuredevops %s/repo", info.Type, info.Owner, info.Repo, c.owner)
+			}
+			if info.Path != c.path || info.Ref != c.ref || info.BaseURL != c.baseURL {
+				t.Errorf("path/ref/baseURL = %q/%q/%q, want %q/%q/%q", info.Path, info.Ref, info.BaseURL, c.path, c.ref, c.baseURL)
+			}
+		})
+	}
+
+	for _, bad := range []string{"https://dev.azure.com/org/project", "https://dev.azure.com/org/_git/repo"} {
+		if _, err := DetectRepository(bad, ""); err == nil {
+			t.Errorf("DetectRepository(%q) should fail", bad)
+		}
+	}
+}
+
+func TestAzureDevOpsRef(t *testing.T) {
+	cases := map[string]string{
+		"GBmain":      "main",
+		"GBfeature/x": "feature/x",
+		"GTv1":        "v1",
+		"GCabc123":    "abc123",
+		"main":        "main",
+		"GB":          "GB",
+		"":            "",
+	}
+	for version, want := range cases {
+		if got := AzureDevOpsRef(version); got != want {
+			t.Errorf("AzureDevOpsRef(%q) = %q, want %q", version, got, want)
+		}
+	}
+}
+
 func TestDetectRepository_InvalidURL(t *testing.T) {
 	_, err := DetectRepository("://invalid", "")
 	if err == nil {
@@ -284,3 +338,112 @@ func TestDetectRepository_RealURLs(t *testing.T) {
 		})
 	}
 }
+
+func TestDetectRepository_Local(t *testing.T) {
+	cases := []struct {
+		name     string
+		repoURL  string
+		wantRoot string
+		wantRepo string
+		wantErr  bool
+	}{
+		{name: "file URL", repoURL: "file:///home/user/gitops/overlay", wantRoot: "/home/user/gitops/overlay", wantRepo: "overlay"},
+		{name: "file URL with localhost", repoURL: "file://localhost/srv/repo", wantRoot: "/srv/repo", wantRepo: "repo"},
+		{name: "plain absolute path", repoURL: "/srv/repo/", wantRoot: "/srv/repo", wantRepo: "repo"},
+		{name: "file URL with remote host", repoURL: "file://server/share/repo", wantErr: true},
+		{name: "file URL with relative path", repoURL: "file:relative/repo", wantErr: true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			info, err := DetectRepository(c.repoURL, "")
+			if c.wantErr {
+				if err == nil {
+					t.Fatalf("DetectRepository(%q) expected error, got %+v", c.repoURL, info)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("DetectRepository(%q): %v", c.repoURL, err)
+			}
+			if info.Type != Local || info.LocalRoot != c.wantRoot || info.Repo != c.wantRepo || info.Ref != LocalRef {
+				t.Errorf("got type=%s root=%q repo=%q ref=%q, want local root=%q repo=%q ref=%q",
+					info.Type, info.LocalRoot, info.Repo, info.Ref, c.wantRoot, c.wantRepo, LocalRef)
+			}
+		})
+	}
+}
+
+func TestDetectRepository_Archive(t *testing.T) {
+	cases := []struct {
+		repoURL  string
+		wantRoot string
+		wantRepo string
+		wantPath string
+	}{
+		{repoURL: "/srv/exports/manifests.tar.gz", wantRoot: "/srv/exports/manifests.tar.gz", wantRepo: "manifests"},
+		{repoURL: "file:///srv/exports/manifests.TGZ", wantRoot: "/srv/exports/manifests.TGZ", wantRepo: "manifests"},
+		{repoURL: "/srv/exports/manifests.zip/overlays/prod/", wantRoot: "/srv/exports/manifests.zip", wantRepo: "manifests", wantPath: "overlays/prod"},
+	}
+	for _, c := range cases {
+		info, err := DetectRepository(c.repoURL, "")
+		if err != nil {
+			t.Fatalf("DetectRepository(%q): %v", c.repoURL, err)
+		}
+		if info.Type != Archive || info.LocalRoot != c.wantRoot || info.Repo != c.wantRepo || info.Path != c.wantPath || info.Ref != ArchiveRef {
+			t.Errorf("DetectRepository(%q) = type=%s root=%q repo=%q path=%q ref=%q, want archive root=%q repo=%q path=%q ref=%q",
+				c.repoURL, info.Type, info.LocalRoot, info.Repo, info.Path, info.Ref, c.wantRoot, c.wantRepo, c.wantPath, ArchiveRef)
+		}
+	}
+}
+
+func TestSplitGitLabInstance(t *testing.T) {
+	defer ClearGitLabInstances()
+	if err := RegisterGitLabInstance("https://corp.example/gitlab"); err != nil {
+		t.Fatal(err)
+	}
+	if err := RegisterGitLabInstance("https://corp.example/gitlab/eu"); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		url         string
+		wantBase    string
+		wantProject string
+		wantOK      bool
+	}{
+		{"https://corp.example/gitlab/group/project", "https://corp.example/gitlab", "group/project", true},
+		{"https://corp.example/gitlab/eu/group/project", "https://corp.example/gitlab/eu", "group/project", true},
+		{"https://CORP.example/gitlab/", "https://corp.example/gitlab", "", true},
+		{"https://corp.example/gitlabx/group/project", "", "", false},
+		{"https://other.example/gitlab/group/project", "", "", false},
+	}
+	for _, c := range cases {
+		t.Run(c.url, func(t *testing.T) {
+			base, project, ok := SplitGitLabInstance(c.url)
+			if ok != c.wantOK || base != c.wantBase || project != c.wantProject {
+				t.Errorf("SplitGitLabInstance(%q) = (%q, %q, %v), want (%q, %q, %v)",
+					c.url, base, project, ok, c.wantBase, c.wantProject, c.wantOK)
+			}
+		})
+	}
+
+	if err := RegisterGitLabInstance("corp.example/gitlab"); err == nil {
+		t.Error("RegisterGitLabInstance without scheme should error")
+	}
+}
+
+func TestDetectRepository_GitLabSubpath(t *testing.T) {
+	defer ClearGitLabInstances()
+	if err := RegisterGitLabInstance("https://corp.example/gitlab"); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := DetectRepository("https://corp.example/gitlab/group/sub/project/-/tree/main/base", "")
+	if err != nil {
+		t.Fatalf("DetectRepository: %v", err)
+	}
+	if info.Type != GitLab || info.BaseURL != "https://corp.example/gitlab" ||
+		info.Owner != "group/sub" || info.Repo != "project" || info.AmbiguousPath != "main/base" {
+		t.Errorf("got %+v, want GitLab at https://corp.example/gitlab, group/sub/project, ambiguous main/base", info)
+	}
+}
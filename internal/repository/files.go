@@ -0,0 +1,10 @@
+package repository
+
+// kustomizationFilenames are the file names kustomize accepts, in lookup order.
+var kustomizationFilenames = []string{"kustomization.yaml", "kustomization.yml", "Kustomization"}
+
+// KustomizationFilenames returns the file names kustomize accepts for a directory,
+// in the order they are probed: kustomization.yaml, kustomization.yml, Kustomization.
+func KustomizationFilenames() []string {
+	return append([]string(nil), kustomizationFilenames...)
+}
@@ -0,0 +1,18 @@
+package repository
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestKustomizationFilenames(t *testing.T) {
+	want := []string{"kustomization.yaml", "kustomization.yml", "Kustomization"}
+	got := KustomizationFilenames()
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("KustomizationFilenames() = %q, want %q", got, want)
+	}
+	got[0] = "changed"
+	if KustomizationFilenames()[0] != "kustomization.yaml" {
+		t.Error("KustomizationFilenames() must return a copy")
+	}
+}
@@ -0,0 +1,28 @@
+package repository
+
+import (
+	"log/slog"
+	"sync/atomic"
+)
+
+// discardLogger is the logger in effect until SetLogger is called.
+var discardLogger = slog.New(slog.DiscardHandler)
+
+// currentLogger holds the logger set by SetLogger; nil means discardLogger.
+var currentLogger atomic.Pointer[slog.Logger]
+
+// logger returns the receiver of the package's diagnostics: branch and project
+// resolution (Info), API failures worked around and retries (Warn), listing details
+// (Debug). It discards everything until SetLogger is called.
+func logger() *slog.Logger {
+	if l := currentLogger.Load(); l != nil {
+		return l
+	}
+	return discardLogger
+}
+
+// SetLogger sets the logger of the package's diagnostics, e.g. slog.Default(); nil
+// silences them again. Safe to call while requests run.
+func SetLogger(l *slog.Logger) {
+	currentLogger.Store(l)
+}
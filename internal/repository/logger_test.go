@@ -0,0 +1,54 @@
+package repository
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+// failingParentLister lists fixed branches and fails fork parent lookups.
+type failingParentLister struct {
+	mockRefLister
+}
+
+func (*failingParentLister) ParentRepository(*RepositoryInfo, string) (*RepositoryInfo, error) {
+	return nil, errors.New("forbidden")
+}
+
+func TestSetLogger_ResolutionMessages(t *testing.T) {
+	var buf bytes.Buffer
+	SetLogger(slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	defer SetLogger(nil)
+	SetTestRefLister(&failingParentLister{mockRefLister{branches: []string{"main", "release/v1"}}})
+	defer SetTestRefLister(nil)
+
+	if _, _, err := ResolveBranchAndPath(&RepositoryInfo{Type: GitHub, Owner: "owner", Repo: "repo"}, "release/v1/deploy", ""); err != nil {
+		t.Fatalf("ResolveBranchAndPath: %v", err)
+	}
+	fork := &RepositoryInfo{Type: GitHub, Owner: "me", Repo: "fork", FollowForkParent: true}
+	if _, _, err := ResolveBranchAndPath(fork, "feature/x/deploy", ""); !errors.Is(err, ErrNoMatchingRef) {
+		t.Fatalf("ResolveBranchAndPath(fork) err = %v, want ErrNoMatchingRef", err)
+	}
+
+	out := buf.String()
+	for _, want := range []string{
+		`level=INFO msg="resolved branch and path" branch=release/v1 path=deploy`,
+		`level=WARN msg="failed to look up fork parent" repo=me/fork error=forbidden`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("log output lacks %q:\n%s", want, out)
+		}
+	}
+
+	// nil silences the package again
+	SetLogger(nil)
+	buf.Reset()
+	if _, _, err := ResolveBranchAndPath(&RepositoryInfo{Type: GitHub, Owner: "owner", Repo: "other"}, "main/deploy", ""); err != nil {
+		t.Fatalf("ResolveBranchAndPath: %v", err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("SetLogger(nil) still logs: %s", buf.String())
+	}
+}
@@ -0,0 +1,43 @@
+package repository
+
+import (
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// defaultHosts are the hosts left out of node IDs, implied by the repository type
+var defaultHosts = map[RepositoryType]string{
+	GitHub:      "github.com",
+	GitLab:      "gitlab.com",
+	AzureDevOps: "dev.azure.com",
+}
+
+// CanonicalNodeID returns the graph node ID of nodePath at ref in repoInfo. Every way of
+// referencing the same target (trailing slashes, "./" segments, a ".git" suffix, owner
+// or repo case) gives the same ID:
+//
+//	type[@host]:owner/repo[/path]@ref
+//
+// host is the lowercased host of the repository, omitted for github.com (GitHub),
+// gitlab.com (GitLab) and dev.azure.com (AzureDevOps); owner and repo are lowercased (GitHub and GitLab paths are
+// case-insensitive) and stripped of ".git"; path is cleaned, without leading or trailing
+// "/", and omitted for the repository root; ref is kept as is.
+//
+// Local and Archive repositories are keyed by location on disk instead, as
+// type:/root/path@ref, since a local path may climb out of its root ("../base").
+func CanonicalNodeID(repoInfo *RepositoryInfo, ref, nodePath string) string {
+	if repoInfo.Type == Local || repoInfo.Type == Archive {
+		return string(repoInfo.Type) + ":" + path.Join(filepath.ToSlash(repoInfo.LocalRoot), nodePath) + "@" + ref
+	}
+
+	prefix := string(repoInfo.Type)
+	if host := strings.ToLower(repoInfo.Host()); host != "" && host != defaultHosts[repoInfo.Type] {
+		prefix += "@" + host
+	}
+	id := prefix + ":" + strings.ToLower(repoInfo.Owner) + "/" + strings.ToLower(strings.TrimSuffix(repoInfo.Repo, ".git"))
+	if p := strings.Trim(path.Clean("/"+nodePath), "/"); p != "" {
+		id += "/" + p
+	}
+	return id + "@" + ref
+}
@@ -0,0 +1,86 @@
+package repository
+
+import "testing"
+
+func TestCanonicalNodeID(t *testing.T) {
+	github := func(owner, repo string) *RepositoryInfo {
+		return &RepositoryInfo{Type: GitHub, Owner: owner, Repo: repo, BaseURL: "https://github.com"}
+	}
+	corp := func(baseURL string) *RepositoryInfo {
+		return &RepositoryInfo{Type: GitLab, Owner: "group/sub", Repo: "proj", BaseURL: baseURL}
+	}
+
+	cases := []struct {
+		name     string
+		variants []*RepositoryInfo
+		paths    []string
+		ref      string
+		want     string
+	}{
+		{
+			name:     "owner/repo case and .git",
+			variants: []*RepositoryInfo{github("org", "app"), github("Org", "App"), github("ORG", "app.git"), {Type: GitHub, Owner: "org", Repo: "app"}},
+			paths:    []string{"overlays/prod"},
+			ref:      "main",
+			want:     "github:org/app/overlays/prod@main",
+		},
+		{
+			name:     "path spellings",
+			variants: []*RepositoryInfo{github("org", "app")},
+			paths:    []string{"overlays/prod", "overlays/prod/", "/overlays/prod", "./overlays/prod", "overlays//prod", "overlays/dev/../prod"},
+			ref:      "main",
+			want:     "github:org/app/overlays/prod@main",
+		},
+		{
+			name:     "repository root",
+			variants: []*RepositoryInfo{github("org", "app")},
+			paths:    []string{"", "/", ".", "./"},
+			ref:      "v1.0",
+			want:     "github:org/app@v1.0",
+		},
+		{
+			name:     "ref case is kept",
+			variants: []*RepositoryInfo{github("org", "app")},
+			paths:    []string{"base"},
+			ref:      "Release/V2",
+			want:     "github:org/app/base@Release/V2",
+		},
+		{
+			name:     "gitlab.com host is implied",
+			variants: []*RepositoryInfo{{Type: GitLab, Owner: "group/sub", Repo: "proj", BaseURL: "https://gitlab.com"}, {Type: GitLab, Owner: "Group/Sub", Repo: "proj"}},
+			paths:    []string{"base"},
+			ref:      "main",
+			want:     "gitlab:group/sub/proj/base@main",
+		},
+		{
+			name:     "self-hosted host",
+			variants: []*RepositoryInfo{corp("https://gitlab.corp.example"), corp("https://GitLab.Corp.Example/"), corp("https://gitlab.corp.example/gitlab")},
+			paths:    []string{"base"},
+			ref:      "main",
+			want:     "gitlab@gitlab.corp.example:group/sub/proj/base@main",
+		},
+		{
+			name:     "local root",
+			variants: []*RepositoryInfo{NewLocalRepository("/srv/repo/overlay"), NewLocalRepository("/srv/repo/overlay/")},
+			paths:    []string{"../base", "../base/"},
+			ref:      LocalRef,
+			want:     "local:/srv/repo/base@working-tree",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			for _, info := range c.variants {
+				for _, p := range c.paths {
+					if got := CanonicalNodeID(info, c.ref, p); got != c.want {
+						t.Errorf("CanonicalNodeID(%s/%s at %s, %q, %q) = %q, want %q", info.Owner, info.Repo, info.BaseURL, c.ref, p, got, c.want)
+					}
+				}
+			}
+		})
+	}
+
+	enterprise := &RepositoryInfo{Type: GitHub, Owner: "org", Repo: "app", BaseURL: "https://github.corp.example"}
+	if a, b := CanonicalNodeID(github("org", "app"), "main", "base"), CanonicalNodeID(enterprise, "main", "base"); a == b {
+		t.Errorf("different hosts share ID %q", a)
+	}
+}
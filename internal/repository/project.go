@@ -0,0 +1,82 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	gitlab "gitlab.com/gitlab-org/api/client-go"
+)
+
+// ProjectLookup reports whether a GitLab project exists at projectPath (namespace and
+// project, e.g. "group/sub/project"). A RefLister set with SetTestRefLister may
+// implement it so ResolveGitLabProject can be tested without calling real APIs.
+type ProjectLookup interface {
+	ProjectExists(repoInfo *RepositoryInfo, projectPath, token string) (bool, error)
+}
+
+// ResolveGitLabProject splits repoInfo.AmbiguousProjectPath (subgroups, project and
+// path without a "//" separator, e.g. "group/sub1/sub2/project/deploy/base") by
+// asking the API which prefix is a project, shortest first: GitLab doesn't allow a
+// project and a group with the same path, so the first match is the only one.
+// repoInfo.Owner/Repo are set to the project and the path within it is returned.
+// Nothing is resolved when AmbiguousProjectPath is empty.
+func ResolveGitLabProject(repoInfo *RepositoryInfo, token string) (string, error) {
+	return ResolveGitLabProjectContext(context.Background(), repoInfo, token)
+}
+
+// ResolveGitLabProjectContext is ResolveGitLabProject with a context passed to the API calls.
+func ResolveGitLabProjectContext(ctx context.Context, repoInfo *RepositoryInfo, token string) (string, error) {
+	fullPath := strings.Trim(repoInfo.AmbiguousProjectPath, "/")
+	if fullPath == "" {
+		return "", nil
+	}
+	segments := strings.Split(fullPath, "/")
+
+	for n := 2; n <= len(segments); n++ {
+		projectPath := strings.Join(segments[:n], "/")
+		exists, err := gitLabProjectExists(ctx, repoInfo, projectPath, token)
+		if err != nil {
+			return "", fmt.Errorf("failed to look up project %s: %w", projectPath, err)
+		}
+		if !exists {
+			continue
+		}
+		repoInfo.Owner = strings.Join(segments[:n-1], "/")
+		repoInfo.Repo = strings.TrimSuffix(segments[n-1], ".git")
+		repoInfo.AmbiguousProjectPath = ""
+		path := strings.Join(segments[n:], "/")
+		logger().Info("resolved GitLab project", "repo", repoInfo.Owner+"/"+repoInfo.Repo, "path", path)
+		return path, nil
+	}
+	return "", fmt.Errorf("no GitLab project found in path %s", fullPath)
+}
+
+// gitLabProjectExists looks up a project using the test ProjectLookup or the GitLab API.
+func gitLabProjectExists(ctx context.Context, repoInfo *RepositoryInfo, projectPath, token string) (bool, error) {
+	if testRefLister != nil {
+		pl, ok := testRefLister.(ProjectLookup)
+		if !ok {
+			return false, fmt.Errorf("project lookup not supported by test RefLister")
+		}
+		return pl.ProjectExists(repoInfo, projectPath, token)
+	}
+
+	limiter := rateLimiter
+	limiter.Acquire()
+	defer limiter.Release()
+
+	client, err := NewGitLabClient(repoInfo, token)
+	if err != nil {
+		return false, err
+	}
+	_, resp, err := client.Projects.GetProject(strings.TrimSuffix(projectPath, ".git"), nil, gitlab.WithContext(ctx))
+	if err != nil {
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,105 @@
+package repository
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// projectRefLister knows a fixed set of GitLab project paths and records lookups.
+type projectRefLister struct {
+	projects map[string]bool
+	err      error
+	lookups  []string
+}
+
+func (m *projectRefLister) ListBranchesAndTags(_ *RepositoryInfo, _ string) ([]string, error) {
+	return []string{"main"}, nil
+}
+
+func (m *projectRefLister) ProjectExists(_ *RepositoryInfo, projectPath, _ string) (bool, error) {
+	m.lookups = append(m.lookups, projectPath)
+	if m.err != nil {
+		return false, m.err
+	}
+	return m.projects[projectPath], nil
+}
+
+func TestResolveGitLabProject(t *testing.T) {
+	cases := []struct {
+		name      string
+		path      string
+		project   string
+		wantOwner string
+		wantRepo  string
+		wantPath  string
+	}{
+		{"no subgroup", "group/project/deploy/base", "group/project", "group", "project", "deploy/base"},
+		{"two subgroup levels", "group/sub1/sub2/project/deploy/base", "group/sub1/sub2/project", "group/sub1/sub2", "project", "deploy/base"},
+		{"three subgroup levels", "group/sub1/sub2/sub3/project/overlay", "group/sub1/sub2/sub3/project", "group/sub1/sub2/sub3", "project", "overlay"},
+		{"project root", "group/sub1/project", "group/sub1/project", "group/sub1", "project", ""},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			SetTestRefLister(&projectRefLister{projects: map[string]bool{c.project: true}})
+			defer SetTestRefLister(nil)
+
+			info := &RepositoryInfo{Type: GitLab, Owner: "group", Repo: "guess", AmbiguousProjectPath: c.path}
+			path, err := ResolveGitLabProject(info, "")
+			if err != nil {
+				t.Fatalf("ResolveGitLabProject: %v", err)
+			}
+			if info.Owner != c.wantOwner || info.Repo != c.wantRepo || path != c.wantPath {
+				t.Errorf("got %s/%s path %q, want %s/%s path %q", info.Owner, info.Repo, path, c.wantOwner, c.wantRepo, c.wantPath)
+			}
+			if info.AmbiguousProjectPath != "" {
+				t.Errorf("AmbiguousProjectPath = %q, want cleared", info.AmbiguousProjectPath)
+			}
+		})
+	}
+}
+
+func TestResolveGitLabProject_ShortestFirst(t *testing.T) {
+	mock := &projectRefLister{projects: map[string]bool{"group/sub/project": true}}
+	SetTestRefLister(mock)
+	defer SetTestRefLister(nil)
+
+	info := &RepositoryInfo{Type: GitLab, AmbiguousProjectPath: "group/sub/project/a/b/c"}
+	if _, err := ResolveGitLabProject(info, ""); err != nil {
+		t.Fatalf("ResolveGitLabProject: %v", err)
+	}
+	want := []string{"group/sub", "group/sub/project"}
+	if strings.Join(mock.lookups, ",") != strings.Join(want, ",") {
+		t.Errorf("lookups = %v, want %v", mock.lookups, want)
+	}
+}
+
+func TestResolveGitLabProject_Errors(t *testing.T) {
+	t.Run("nothing to resolve", func(t *testing.T) {
+		info := &RepositoryInfo{Type: GitLab, Owner: "group", Repo: "project"}
+		path, err := ResolveGitLabProject(info, "")
+		if err != nil || path != "" || info.Owner != "group" || info.Repo != "project" {
+			t.Errorf("got path %q err %v, info %s/%s; want no change", path, err, info.Owner, info.Repo)
+		}
+	})
+	t.Run("no project", func(t *testing.T) {
+		SetTestRefLister(&projectRefLister{})
+		defer SetTestRefLister(nil)
+		info := &RepositoryInfo{Type: GitLab, Owner: "group", Repo: "sub", AmbiguousProjectPath: "group/sub/path"}
+		if _, err := ResolveGitLabProject(info, ""); err == nil {
+			t.Error("expected an error when no prefix is a project")
+		}
+		if info.Owner != "group" || info.Repo != "sub" {
+			t.Errorf("info = %s/%s, want the guess kept", info.Owner, info.Repo)
+		}
+	})
+	t.Run("lookup error", func(t *testing.T) {
+		lookupErr := errors.New("boom")
+		SetTestRefLister(&projectRefLister{err: lookupErr})
+		defer SetTestRefLister(nil)
+		info := &RepositoryInfo{Type: GitLab, AmbiguousProjectPath: "group/sub/path"}
+		if _, err := ResolveGitLabProject(info, ""); !errors.Is(err, lookupErr) {
+			t.Errorf("err = %v, want it to wrap the lookup error", err)
+		}
+	})
+}
@@ -0,0 +1,156 @@
+package repository
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+// defaultMaxConcurrency is the number of concurrent API calls allowed when the
+// rate-limit budget is unknown or full.
+const defaultMaxConcurrency = 8
+
+// AdaptiveLimiter bounds the number of concurrent API calls and lowers that bound
+// as the rate-limit budget reported by the API (X-RateLimit-Remaining) shrinks.
+// The bound recovers automatically once the API reports a refilled budget.
+type AdaptiveLimiter struct {
+	mu        sync.Mutex
+	cond      *sync.Cond
+	max       int
+	active    int
+	remaining int // -1 until a response reported it
+	limit     int // -1 until a response reported it
+}
+
+// NewAdaptiveLimiter creates a limiter allowing at most max concurrent calls.
+func NewAdaptiveLimiter(max int) *AdaptiveLimiter {
+	if max < 1 {
+		max = 1
+	}
+	l := &AdaptiveLimiter{max: max, remaining: -1, limit: -1}
+	l.cond = sync.NewCond(&l.mu)
+	return l
+}
+
+// Max returns the configured maximum concurrency.
+func (l *AdaptiveLimiter) Max() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.max
+}
+
+// SetMax changes the maximum concurrency. Calls already holding a slot keep it;
+// waiters are woken up in case the bound grew.
+func (l *AdaptiveLimiter) SetMax(max int) {
+	if max < 1 {
+		max = 1
+	}
+	l.mu.Lock()
+	l.max = max
+	l.mu.Unlock()
+	l.cond.Broadcast()
+}
+
+// Limit returns the effective concurrency given the last observed rate-limit budget:
+// max scaled by remaining/limit, never below 1.
+func (l *AdaptiveLimiter) Limit() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.limitLocked()
+}
+
+func (l *AdaptiveLimiter) limitLocked() int {
+	if l.remaining < 0 || l.limit <= 0 || l.remaining >= l.limit {
+		return l.max
+	}
+	n := (l.max*l.remaining + l.limit - 1) / l.limit // ceil
+	if n < 1 {
+		n = 1
+	}
+	return n
+}
+
+// Observe records the rate-limit budget from an API response's headers.
+// GitHub uses X-RateLimit-*, GitLab uses RateLimit-*; responses without them are ignored.
+func (l *AdaptiveLimiter) Observe(h http.Header) {
+	remaining, okRemaining := headerInt(h, "X-RateLimit-Remaining", "RateLimit-Remaining")
+	limit, okLimit := headerInt(h, "X-RateLimit-Limit", "RateLimit-Limit")
+	if !okRemaining {
+		return
+	}
+
+	l.mu.Lock()
+	l.remaining = remaining
+	if okLimit {
+		l.limit = limit
+	}
+	l.mu.Unlock()
+	// The limit may have grown (budget reset): wake up waiters
+	l.cond.Broadcast()
+}
+
+// Acquire blocks until a slot is available under the current effective limit.
+func (l *AdaptiveLimiter) Acquire() {
+	l.mu.Lock()
+	for l.active >= l.limitLocked() {
+		l.cond.Wait()
+	}
+	l.active++
+	l.mu.Unlock()
+}
+
+// Release frees a slot taken by Acquire.
+func (l *AdaptiveLimiter) Release() {
+	l.mu.Lock()
+	l.active--
+	l.mu.Unlock()
+	l.cond.Broadcast()
+}
+
+// Transport wraps base so every response's rate-limit headers are observed by the limiter.
+func (l *AdaptiveLimiter) Transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &rateLimitTransport{base: base, limiter: l}
+}
+
+type rateLimitTransport struct {
+	base    http.RoundTripper
+	limiter *AdaptiveLimiter
+}
+
+func (t *rateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if resp != nil {
+		t.limiter.Observe(resp.Header)
+	}
+	return resp, err
+}
+
+// headerInt returns the first of the given headers that holds an integer.
+func headerInt(h http.Header, keys ...string) (int, bool) {
+	for _, k := range keys {
+		if v := h.Get(k); v != "" {
+			if n, err := strconv.Atoi(v); err == nil {
+				return n, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// rateLimiter bounds concurrent branch/tag listing calls across all resolutions.
+var rateLimiter = NewAdaptiveLimiter(defaultMaxConcurrency)
+
+// SetMaxConcurrency resizes the shared limiter to allow at most n concurrent API calls.
+// Safe to call while requests run.
+func SetMaxConcurrency(n int) {
+	rateLimiter.SetMax(n)
+}
+
+// RateLimiter returns the shared limiter used by ResolveBranchAndPath, so callers
+// running their own worker pool can size it to the current rate-limit budget.
+func RateLimiter() *AdaptiveLimiter {
+	return rateLimiter
+}
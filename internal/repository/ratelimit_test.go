@@ -0,0 +1,152 @@
+package repository
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// decliningTransport is a fake RoundTripper reporting a rate-limit budget that
+// shrinks by step on every response.
+type decliningTransport struct {
+	mu        sync.Mutex
+	limit     int
+	remaining int
+	step      int
+}
+
+func (d *decliningTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	d.mu.Lock()
+	d.remaining -= d.step
+	if d.remaining < 0 {
+		d.remaining = 0
+	}
+	h := http.Header{}
+	h.Set("X-RateLimit-Limit", strconv.Itoa(d.limit))
+	h.Set("X-RateLimit-Remaining", strconv.Itoa(d.remaining))
+	d.mu.Unlock()
+	return &http.Response{StatusCode: http.StatusOK, Header: h, Body: http.NoBody, Request: req}, nil
+}
+
+func TestAdaptiveLimiter_DecliningBudgetReducesConcurrency(t *testing.T) {
+	l := NewAdaptiveLimiter(8)
+	client := &http.Client{Transport: l.Transport(&decliningTransport{limit: 100, remaining: 100, step: 20})}
+
+	var limits []int
+	for i := 0; i < 4; i++ {
+		resp, err := client.Get("https://api.github.com/repos/o/r/branches")
+		if err != nil {
+			t.Fatalf("Get: %v", err)
+		}
+		resp.Body.Close()
+		limits = append(limits, l.Limit())
+	}
+
+	// remaining 80, 60, 40, 20 out of 100 -> 7, 5, 4, 2 workers
+	want := []int{7, 5, 4, 2}
+	for i := range want {
+		if limits[i] != want[i] {
+			t.Errorf("after response %d: Limit() = %d, want %d (all: %v)", i+1, limits[i], want[i], limits)
+		}
+	}
+	if limits[len(limits)-1] >= l.Max() {
+		t.Errorf("Limit() = %d, want below configured max %d", limits[len(limits)-1], l.Max())
+	}
+}
+
+func TestAdaptiveLimiter_Recovers(t *testing.T) {
+	l := NewAdaptiveLimiter(4)
+	h := http.Header{}
+	h.Set("X-RateLimit-Limit", "5000")
+	h.Set("X-RateLimit-Remaining", "0")
+	l.Observe(h)
+	if got := l.Limit(); got != 1 {
+		t.Errorf("exhausted budget: Limit() = %d, want 1", got)
+	}
+	h.Set("X-RateLimit-Remaining", "5000")
+	l.Observe(h)
+	if got := l.Limit(); got != 4 {
+		t.Errorf("reset budget: Limit() = %d, want 4", got)
+	}
+}
+
+func TestAdaptiveLimiter_GitLabHeadersAndMissingHeaders(t *testing.T) {
+	l := NewAdaptiveLimiter(10)
+	l.Observe(http.Header{})
+	if got := l.Limit(); got != 10 {
+		t.Errorf("no headers: Limit() = %d, want 10", got)
+	}
+	h := http.Header{}
+	h.Set("RateLimit-Limit", "100")
+	h.Set("RateLimit-Remaining", "50")
+	l.Observe(h)
+	if got := l.Limit(); got != 5 {
+		t.Errorf("GitLab headers: Limit() = %d, want 5", got)
+	}
+}
+
+func TestAdaptiveLimiter_AcquireRespectsLimit(t *testing.T) {
+	l := NewAdaptiveLimiter(8)
+	h := http.Header{}
+	h.Set("X-RateLimit-Limit", "100")
+	h.Set("X-RateLimit-Remaining", "25")
+	l.Observe(h) // effective limit 2
+
+	var active, peak int32
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			l.Acquire()
+			defer l.Release()
+			n := atomic.AddInt32(&active, 1)
+			for {
+				p := atomic.LoadInt32(&peak)
+				if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+					break
+				}
+			}
+			time.Sleep(5 * time.Millisecond)
+			atomic.AddInt32(&active, -1)
+		}()
+	}
+	wg.Wait()
+
+	if peak > 2 {
+		t.Errorf("peak concurrency = %d, want <= 2", peak)
+	}
+}
+
+func TestAdaptiveLimiter_SetMaxWakesWaiters(t *testing.T) {
+	l := NewAdaptiveLimiter(1)
+	l.Acquire()
+
+	acquired := make(chan struct{})
+	go func() {
+		l.Acquire()
+		close(acquired)
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("second Acquire succeeded with max 1")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	l.SetMax(2)
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("waiter not woken up after SetMax(2)")
+	}
+	if got := l.Max(); got != 2 {
+		t.Errorf("Max() = %d, want 2", got)
+	}
+	l.SetMax(0)
+	if got := l.Max(); got != 1 {
+		t.Errorf("Max() after SetMax(0) = %d, want 1", got)
+	}
+}
@@ -0,0 +1,83 @@
+package repository
+
+import (
+	"sync"
+	"time"
+)
+
+// defaultRefCacheTTL is how long branch/tag listings are reused before being listed again.
+const defaultRefCacheTTL = 5 * time.Minute
+
+// refCacheEntry holds a cached branch+tag listing.
+type refCacheEntry struct {
+	refs    []string
+	expires time.Time
+}
+
+// refListCache caches branch+tag listings per repository so building a graph that
+// references the same repo many times lists its refs only once. Safe for concurrent use.
+type refListCache struct {
+	mu      sync.RWMutex
+	ttl     time.Duration
+	entries map[string]refCacheEntry
+	now     func() time.Time
+}
+
+func newRefListCache(ttl time.Duration) *refListCache {
+	return &refListCache{ttl: ttl, entries: make(map[string]refCacheEntry), now: time.Now}
+}
+
+func (c *refListCache) get(key string) ([]string, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	entry, ok := c.entries[key]
+	if !ok || !c.now().Before(entry.expires) {
+		return nil, false
+	}
+	return append([]string(nil), entry.refs...), true
+}
+
+func (c *refListCache) set(key string, refs []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.ttl <= 0 {
+		return
+	}
+	c.entries[key] = refCacheEntry{
+		refs:    append([]string(nil), refs...),
+		expires: c.now().Add(c.ttl),
+	}
+}
+
+func (c *refListCache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = make(map[string]refCacheEntry)
+}
+
+func (c *refListCache) setTTL(ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ttl = ttl
+}
+
+// refCache is the shared branch/tag listing cache used by ResolveBranchAndPath.
+var refCache = newRefListCache(defaultRefCacheTTL)
+
+// refCacheKey identifies a repository listed with token in the ref cache
+// (Type/Owner/Repo/BaseURL/credential, see credentialKey): a private repository's
+// refs listed with a token aren't reused for anonymous callers.
+func refCacheKey(repoInfo *RepositoryInfo, token string) string {
+	return string(repoInfo.Type) + "/" + repoInfo.Owner + "/" + repoInfo.Repo + "/" + repoInfo.BaseURL + "/" + credentialKey(token)
+}
+
+// ClearRefCache drops all cached branch/tag listings.
+func ClearRefCache() {
+	refCache.clear()
+}
+
+// SetRefCacheTTL sets how long branch/tag listings are cached. A TTL <= 0 disables caching
+// for new listings. Existing entries keep their original expiry.
+func SetRefCacheTTL(ttl time.Duration) {
+	refCache.setTTL(ttl)
+}
@@ -0,0 +1,108 @@
+package repository
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// countingRefLister counts ListBranchesAndTags calls.
+type countingRefLister struct {
+	mu       sync.Mutex
+	branches []string
+	calls    int
+}
+
+func (m *countingRefLister) ListBranchesAndTags(_ *RepositoryInfo, _ string) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calls++
+	return m.branches, nil
+}
+
+func TestResolveBranchAndPath_UsesRefCache(t *testing.T) {
+	mock := &countingRefLister{branches: []string{"main", "develop"}}
+	SetTestRefLister(mock)
+	defer SetTestRefLister(nil)
+
+	repoInfo := &RepositoryInfo{Type: GitHub, Owner: "o", Repo: "r", BaseURL: "https://github.com"}
+	for _, p := range []string{"main/a", "develop/b", "main/c"} {
+		if _, _, err := ResolveBranchAndPath(repoInfo, p, ""); err != nil {
+			t.Fatalf("ResolveBranchAndPath(%q): %v", p, err)
+		}
+	}
+	if mock.calls != 1 {
+		t.Errorf("RefLister calls = %d, want 1 (cached)", mock.calls)
+	}
+
+	// Another repo has its own entry
+	other := &RepositoryInfo{Type: GitHub, Owner: "o", Repo: "other", BaseURL: "https://github.com"}
+	if _, _, err := ResolveBranchAndPath(other, "main/a", ""); err != nil {
+		t.Fatalf("ResolveBranchAndPath: %v", err)
+	}
+	if mock.calls != 2 {
+		t.Errorf("RefLister calls = %d, want 2 (different repo)", mock.calls)
+	}
+
+	// Refs listed with a token aren't reused for anonymous callers
+	if _, _, err := ResolveBranchAndPath(other, "main/a", "secret"); err != nil {
+		t.Fatalf("ResolveBranchAndPath: %v", err)
+	}
+	if mock.calls != 3 {
+		t.Errorf("RefLister calls = %d, want 3 (authenticated listing)", mock.calls)
+	}
+	if _, _, err := ResolveBranchAndPath(other, "main/a", "secret"); err != nil {
+		t.Fatalf("ResolveBranchAndPath: %v", err)
+	}
+	if mock.calls != 3 {
+		t.Errorf("RefLister calls = %d, want 3 (cached for the same token)", mock.calls)
+	}
+
+	ClearRefCache()
+	if _, _, err := ResolveBranchAndPath(repoInfo, "main/a", ""); err != nil {
+		t.Fatalf("ResolveBranchAndPath: %v", err)
+	}
+	if mock.calls != 4 {
+		t.Errorf("RefLister calls = %d, want 4 (after ClearRefCache)", mock.calls)
+	}
+}
+
+func TestRefListCache_TTL(t *testing.T) {
+	c := newRefListCache(time.Minute)
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	c.now = func() time.Time { return now }
+
+	c.set("k", []string{"main"})
+	if refs, ok := c.get("k"); !ok || len(refs) != 1 {
+		t.Fatalf("get before expiry = %v, %v; want [main], true", refs, ok)
+	}
+	now = now.Add(2 * time.Minute)
+	if _, ok := c.get("k"); ok {
+		t.Error("get after expiry should miss")
+	}
+
+	c.setTTL(0)
+	c.set("k", []string{"main"})
+	if _, ok := c.get("k"); ok {
+		t.Error("TTL 0 should disable caching")
+	}
+}
+
+func TestRefListCache_ConcurrentUse(t *testing.T) {
+	c := newRefListCache(time.Minute)
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			c.set("k", []string{"main", "develop"})
+		}()
+		go func() {
+			defer wg.Done()
+			if refs, ok := c.get("k"); ok && len(refs) != 2 {
+				t.Errorf("get = %v, want 2 refs", refs)
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,178 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/go-github/v82/github"
+	gitlab "gitlab.com/gitlab-org/api/client-go"
+)
+
+// RefKind tells branches from lightweight and annotated tags.
+type RefKind string
+
+const (
+	RefBranch         RefKind = "branch"
+	RefLightweightTag RefKind = "lightweight-tag" // points to a commit
+	RefAnnotatedTag   RefKind = "annotated-tag"   // points to a tag object, which points to a commit
+)
+
+// Ref is a branch or tag with the object it points to. Annotated tags point to a tag
+// object and not to a commit: SHA is the tag object's, and Commit the commit it
+// dereferences to when the API reports it ("" otherwise).
+type Ref struct {
+	Name   string
+	Kind   RefKind
+	SHA    string
+	Commit string
+}
+
+// RefDetailLister is implemented by test RefListers that list refs with their kind.
+type RefDetailLister interface {
+	ListRefs(repoInfo *RepositoryInfo, token string) ([]Ref, error)
+}
+
+// ListRefs lists the branches and tags of repoInfo with their kind and target, for
+// callers that fetch content at a ref and must dereference annotated tags. Branch and
+// tag names alone (for path resolution) come from the cached ListBranchesAndTags.
+func ListRefs(repoInfo *RepositoryInfo, token string) ([]Ref, error) {
+	return ListRefsContext(context.Background(), repoInfo, token)
+}
+
+// ListRefsContext is ListRefs with a context passed to the API calls.
+func ListRefsContext(ctx context.Context, repoInfo *RepositoryInfo, token string) ([]Ref, error) {
+	if testRefLister != nil {
+		dl, ok := testRefLister.(RefDetailLister)
+		if !ok {
+			return nil, errors.New("test RefLister does not list ref details")
+		}
+		return dl.ListRefs(repoInfo, token)
+	}
+
+	limiter := rateLimiter
+	limiter.Acquire()
+	defer limiter.Release()
+
+	var refs []Ref
+	err := apiRetrier.do(ctx, func() error {
+		var err error
+		switch repoInfo.Type {
+		case GitHub:
+			refs, err = listGitHubRefs(ctx, repoInfo, token)
+		case GitLab:
+			refs, err = listGitLabRefs(ctx, repoInfo, token)
+		default:
+			err = fmt.Errorf("unsupported repository type: %s", repoInfo.Type)
+		}
+		return err
+	})
+	return refs, err
+}
+
+// listGitHubRefs lists GitHub branches and tags. Tags come from the git refs API,
+// which reports whether each points to a commit or to an annotated tag object.
+func listGitHubRefs(ctx context.Context, repoInfo *RepositoryInfo, token string) ([]Ref, error) {
+	client := NewGitHubClient(repoInfo, token)
+
+	var refs []Ref
+	opts := &github.BranchListOptions{
+		ListOptions: github.ListOptions{PerPage: 100},
+	}
+	for {
+		branches, resp, err := client.Repositories.ListBranches(ctx, repoInfo.Owner, repoInfo.Repo, opts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list branches: %w", err)
+		}
+		for _, branch := range branches {
+			sha := branch.GetCommit().GetSHA()
+			refs = append(refs, Ref{Name: branch.GetName(), Kind: RefBranch, SHA: sha, Commit: sha})
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+
+	tags, _, err := client.Git.ListMatchingRefs(ctx, repoInfo.Owner, repoInfo.Repo, "tags")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tags: %w", err)
+	}
+	for _, tag := range tags {
+		ref := Ref{Name: strings.TrimPrefix(tag.GetRef(), "refs/tags/"), SHA: tag.GetObject().GetSHA()}
+		if tag.GetObject().GetType() == "tag" {
+			ref.Kind = RefAnnotatedTag
+		} else {
+			ref.Kind = RefLightweightTag
+			ref.Commit = ref.SHA
+		}
+		refs = append(refs, ref)
+	}
+	return refs, nil
+}
+
+// listGitLabRefs lists GitLab branches and tags. A tag whose target differs from its
+// commit is annotated: the target is the tag object.
+func listGitLabRefs(ctx context.Context, repoInfo *RepositoryInfo, token string) ([]Ref, error) {
+	client, err := NewGitLabClient(repoInfo, token)
+	if err != nil {
+		return nil, err
+	}
+	projectID := fmt.Sprintf("%s/%s", repoInfo.Owner, repoInfo.Repo)
+
+	var refs []Ref
+	opts := &gitlab.ListBranchesOptions{
+		ListOptions: gitlab.ListOptions{PerPage: 100},
+	}
+	for {
+		branches, resp, err := client.Branches.ListBranches(projectID, opts, gitlab.WithContext(ctx))
+		if err != nil {
+			return nil, fmt.Errorf("failed to list branches: %w", err)
+		}
+		for _, branch := range branches {
+			var sha string
+			if branch.Commit != nil {
+				sha = branch.Commit.ID
+			}
+			refs = append(refs, Ref{Name: branch.Name, Kind: RefBranch, SHA: sha, Commit: sha})
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+
+	tagOpts := &gitlab.ListTagsOptions{
+		ListOptions: gitlab.ListOptions{PerPage: 100},
+	}
+	for {
+		tags, resp, err := client.Tags.ListTags(projectID, tagOpts, gitlab.WithContext(ctx))
+		if err != nil {
+			return nil, fmt.Errorf("failed to list tags: %w", err)
+		}
+		for _, tag := range tags {
+			refs = append(refs, gitLabTagRef(tag))
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		tagOpts.Page = resp.NextPage
+	}
+	return refs, nil
+}
+
+// gitLabTagRef converts a GitLab tag to a Ref
+func gitLabTagRef(tag *gitlab.Tag) Ref {
+	ref := Ref{Name: tag.Name, Kind: RefLightweightTag, SHA: tag.Target}
+	if tag.Commit != nil {
+		ref.Commit = tag.Commit.ID
+	}
+	if ref.SHA == "" {
+		ref.SHA = ref.Commit
+	}
+	if ref.Commit != "" && ref.SHA != ref.Commit {
+		ref.Kind = RefAnnotatedTag
+	}
+	return ref
+}
@@ -0,0 +1,99 @@
+package repository
+
+import (
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// routeTransport answers requests whose path ends with a key with its JSON body,
+// and others with an empty array.
+type routeTransport map[string]string
+
+func (rt routeTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	body := "[]"
+	for suffix, b := range rt {
+		if strings.HasSuffix(req.URL.Path, suffix) {
+			body = b
+		}
+	}
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       io.NopCloser(strings.NewReader(body)),
+		Request:    req,
+	}, nil
+}
+
+func TestListRefs_TagKinds(t *testing.T) {
+	cases := []struct {
+		name      string
+		repoInfo  *RepositoryInfo
+		transport routeTransport
+	}{
+		{
+			name:     "GitHub",
+			repoInfo: &RepositoryInfo{Type: GitHub, Owner: "o", Repo: "r"},
+			transport: routeTransport{
+				"/repos/o/r/branches": `[{"name": "main", "commit": {"sha": "c1"}}]`,
+				"/repos/o/r/git/matching-refs/tags": `[
+					{"ref": "refs/tags/v1-light", "object": {"type": "commit", "sha": "c2"}},
+					{"ref": "refs/tags/v1-annotated", "object": {"type": "tag", "sha": "t3"}}]`,
+			},
+		},
+		{
+			name:     "GitLab",
+			repoInfo: &RepositoryInfo{Type: GitLab, Owner: "g", Repo: "p", BaseURL: "https://gitlab.example.com"},
+			transport: routeTransport{
+				"/repository/branches": `[{"name": "main", "commit": {"id": "c1"}}]`,
+				"/repository/tags": `[
+					{"name": "v1-light", "target": "c2", "commit": {"id": "c2"}},
+					{"name": "v1-annotated", "target": "t3", "message": "release", "commit": {"id": "c3"}}]`,
+			},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			SetTestTransport(c.transport)
+			defer SetTestTransport(nil)
+
+			refs, err := ListRefs(c.repoInfo, "")
+			if err != nil {
+				t.Fatalf("ListRefs: %v", err)
+			}
+			want := []Ref{
+				{Name: "main", Kind: RefBranch, SHA: "c1", Commit: "c1"},
+				{Name: "v1-light", Kind: RefLightweightTag, SHA: "c2", Commit: "c2"},
+				{Name: "v1-annotated", Kind: RefAnnotatedTag, SHA: "t3"},
+			}
+			if c.repoInfo.Type == GitLab {
+				want[2].Commit = "c3" // GitLab reports the commit an annotated tag points to
+			}
+			if !reflect.DeepEqual(refs, want) {
+				t.Errorf("ListRefs =\n%+v\nwant\n%+v", refs, want)
+			}
+		})
+	}
+}
+
+type detailRefLister struct{ mockRefLister }
+
+func (m *detailRefLister) ListRefs(_ *RepositoryInfo, _ string) ([]Ref, error) {
+	return []Ref{{Name: "v1", Kind: RefAnnotatedTag, SHA: "t1"}}, nil
+}
+
+func TestListRefs_TestRefLister(t *testing.T) {
+	SetTestRefLister(&detailRefLister{})
+	defer SetTestRefLister(nil)
+	refs, err := ListRefs(&RepositoryInfo{Type: GitHub, Owner: "o", Repo: "r"}, "")
+	if err != nil || len(refs) != 1 || refs[0].Kind != RefAnnotatedTag {
+		t.Errorf("ListRefs = %+v, %v; want the RefDetailLister's refs", refs, err)
+	}
+
+	SetTestRefLister(&mockRefLister{branches: []string{"main"}})
+	if _, err := ListRefs(&RepositoryInfo{Type: GitHub, Owner: "o", Repo: "r"}, ""); err == nil {
+		t.Error("ListRefs with a RefLister without details should error")
+	}
+}
@@ -2,8 +2,10 @@ package repository
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
+	"regexp"
+	"slices"
 	"strings"
 
 	"github.com/google/go-github/v82/github"
@@ -21,41 +23,309 @@ type RefLister interface {
 var testRefLister RefLister
 
 // SetTestRefLister sets the RefLister used by ResolveBranchAndPath. Only for
-// tests; call with nil to restore real API behavior.
+// tests; call with nil to restore real API behavior. The ref cache is cleared
+// so results from a previous lister are not reused.
 func SetTestRefLister(l RefLister) {
 	testRefLister = l
+	ClearRefCache()
 }
 
+// ContextRefLister is a RefLister that also accepts the caller's context. A RefLister
+// set with SetTestRefLister may implement it to observe cancellation.
+type ContextRefLister interface {
+	ListBranchesAndTagsContext(ctx context.Context, repoInfo *RepositoryInfo, token string) ([]string, error)
+}
+
+// ParentLookup returns the parent (upstream) repository of a fork, or nil when the
+// repository is not a fork. A RefLister set with SetTestRefLister may implement it
+// so fork fallback can be tested without calling real APIs.
+type ParentLookup interface {
+	ParentRepository(repoInfo *RepositoryInfo, token string) (*RepositoryInfo, error)
+}
+
+// DefaultBranchLister returns a repository's default branch. A RefLister set with
+// SetTestRefLister may implement it so ResolveDefaultBranch can be tested without real APIs.
+type DefaultBranchLister interface {
+	DefaultBranch(repoInfo *RepositoryInfo, token string) (string, error)
+}
+
+// ResolveDefaultBranch queries the repository's default branch (which may be "master"
+// or a custom name rather than "main") and stores it in repoInfo.Ref.
+func ResolveDefaultBranch(repoInfo *RepositoryInfo, token string) (string, error) {
+	return ResolveDefaultBranchContext(context.Background(), repoInfo, token)
+}
+
+// ResolveDefaultBranchContext is ResolveDefaultBranch with a context passed to the API calls.
+func ResolveDefaultBranchContext(ctx context.Context, repoInfo *RepositoryInfo, token string) (string, error) {
+	// A local checkout only has its working tree
+	if repoInfo.Type == Local {
+		repoInfo.Ref = LocalRef
+		return LocalRef, nil
+	}
+	// ...and an archive its snapshot
+	if repoInfo.Type == Archive {
+		repoInfo.Ref = ArchiveRef
+		return ArchiveRef, nil
+	}
+
+	limiter := rateLimiter
+	limiter.Acquire()
+	defer limiter.Release()
+
+	var branch string
+	if testRefLister != nil {
+		dl, ok := testRefLister.(DefaultBranchLister)
+		if !ok {
+			return "", fmt.Errorf("default branch lookup not supported by test RefLister")
+		}
+		b, err := dl.DefaultBranch(repoInfo, token)
+		if err != nil {
+			return "", err
+		}
+		branch = b
+	} else {
+		switch repoInfo.Type {
+		case GitHub:
+			repo, _, err := NewGitHubClient(repoInfo, token).Repositories.Get(ctx, repoInfo.Owner, repoInfo.Repo)
+			if err != nil {
+				return "", fmt.Errorf("failed to get repository: %w", err)
+			}
+			branch = repo.GetDefaultBranch()
+		case GitLab:
+			client, err := NewGitLabClient(repoInfo, token)
+			if err != nil {
+				return "", err
+			}
+			project, _, err := client.Projects.GetProject(fmt.Sprintf("%s/%s", repoInfo.Owner, repoInfo.Repo), nil, gitlab.WithContext(ctx))
+			if err != nil {
+				return "", fmt.Errorf("failed to get project: %w", err)
+			}
+			branch = project.DefaultBranch
+		default:
+			return "", fmt.Errorf("unsupported repository type: %s", repoInfo.Type)
+		}
+	}
+
+	if branch == "" {
+		return "", fmt.Errorf("no default branch for %s/%s", repoInfo.Owner, repoInfo.Repo)
+	}
+	logger().Info("resolved default branch", "repo", repoInfo.Owner+"/"+repoInfo.Repo, "branch", branch)
+	repoInfo.Ref = branch
+	return branch, nil
+}
+
+// ErrNoMatchingRef is returned (wrapped) when no branch or tag matches the path.
+var ErrNoMatchingRef = errors.New("no matching branch found")
+
+// ErrAmbiguousRef is returned (wrapped) when several branches/tags match the path at
+// the same segment boundary.
+var ErrAmbiguousRef = errors.New("ambiguous branch match")
+
 // ResolveBranchAndPath resolves ambiguous URLs by listing branches
 // Returns: (branch/ref, path, error)
+//
+// When repoInfo.FollowForkParent is set and the repository is a fork lacking a
+// matching branch/tag, the fork's parent is tried instead. On success repoInfo is
+// switched to the parent (Owner/Repo) and ResolvedFromFork records the fork.
+//
+// When repoInfo.Ref is already set (an explicit ?ref=), no branches are listed:
+// the ref is returned as is and the whole urlPath is the path.
+//
+// A path starting with a commit SHA (7 to 40 hex characters) that no branch or tag
+// matches resolves to that commit.
 func ResolveBranchAndPath(repoInfo *RepositoryInfo, urlPath string, token string) (string, string, error) {
+	return ResolveBranchAndPathContext(context.Background(), repoInfo, urlPath, token)
+}
+
+// ResolveBranchAndPathContext is ResolveBranchAndPath with a context passed to the
+// GitHub/GitLab API calls, so callers can set deadlines or cancel.
+func ResolveBranchAndPathContext(ctx context.Context, repoInfo *RepositoryInfo, urlPath string, token string) (string, string, error) {
+	return ResolveBranchAndPathTokens(ctx, repoInfo, urlPath, StaticToken(token))
+}
+
+// ResolveBranchAndPathTokens is ResolveBranchAndPathContext taking the token of each
+// repository it queries (the repository, then its fork parent) from tokens.
+func ResolveBranchAndPathTokens(ctx context.Context, repoInfo *RepositoryInfo, urlPath string, tokens TokenProvider) (string, string, error) {
+	// A local checkout has a single ref (its working tree): the whole path is the path
+	if repoInfo.Type == Local {
+		return LocalRef, strings.Trim(urlPath, "/"), nil
+	}
+	if repoInfo.Type == Archive {
+		return ArchiveRef, strings.Trim(urlPath, "/"), nil
+	}
+	// Explicit ref: nothing to disambiguate, skip the (rate-limited) branch listing
+	if repoInfo.Ref != "" {
+		return repoInfo.Ref, strings.Trim(urlPath, "/"), nil
+	}
+
+	branch, path, err := resolveRefs(ctx, repoInfo, urlPath, tokens(repoInfo))
+	if err == nil || !repoInfo.FollowForkParent || !errors.Is(err, ErrNoMatchingRef) {
+		return branch, path, err
+	}
+
+	parent, perr := lookupParent(ctx, repoInfo, tokens(repoInfo))
+	if perr != nil || parent == nil {
+		if perr != nil {
+			logger().Warn("failed to look up fork parent", "repo", repoInfo.Owner+"/"+repoInfo.Repo, "error", perr)
+		}
+		return "", "", err
+	}
+	branch, path, perr = resolveRefs(ctx, parent, urlPath, tokens(parent))
+	if perr != nil {
+		return "", "", err
+	}
+
+	logger().Info("resolved via fork parent", "repo", repoInfo.Owner+"/"+repoInfo.Repo, "parent", parent.Owner+"/"+parent.Repo)
+	repoInfo.ResolvedFromFork = repoInfo.Owner + "/" + repoInfo.Repo
+	repoInfo.Owner = parent.Owner
+	repoInfo.Repo = parent.Repo
+	return branch, path, nil
+}
+
+// resolveRefs lists branches/tags for repoInfo and matches them against urlPath.
+func resolveRefs(ctx context.Context, repoInfo *RepositoryInfo, urlPath string, token string) (string, string, error) {
+	// Bound concurrent API calls; the bound shrinks as the rate-limit budget depletes
+	limiter := rateLimiter
+	limiter.Acquire()
+	defer limiter.Release()
+
+	branches, err := listBranchesAndTagsCached(ctx, repoInfo, token)
+	if err != nil {
+		return "", "", err
+	}
+	branch, path, err := findLongestMatch(branches, urlPath)
+	if errors.Is(err, ErrNoMatchingRef) {
+		// Content can be fetched at a commit, which no branch/tag listing names
+		first, rest, _ := strings.Cut(strings.Trim(urlPath, "/"), "/")
+		if IsCommitSHA(first) {
+			logger().Info("resolved branch and path", "commit", first, "path", rest)
+			return first, rest, nil
+		}
+	}
+	return branch, path, err
+}
+
+// VerifyRef checks that repoInfo.Ref names a branch or tag of the repository (listed
+// through the ref cache), or looks like a commit SHA. It returns an error wrapping
+// ErrNoMatchingRef when it doesn't.
+func VerifyRef(ctx context.Context, repoInfo *RepositoryInfo, token string) error {
+	if repoInfo.Type == Local || repoInfo.Type == Archive || IsCommitSHA(repoInfo.Ref) {
+		return nil
+	}
+
+	limiter := rateLimiter
+	limiter.Acquire()
+	defer limiter.Release()
+
+	refs, err := listBranchesAndTagsCached(ctx, repoInfo, token)
+	if err != nil {
+		return err
+	}
+	if !slices.Contains(refs, repoInfo.Ref) {
+		return fmt.Errorf("%w: %s in %s/%s", ErrNoMatchingRef, repoInfo.Ref, repoInfo.Owner, repoInfo.Repo)
+	}
+	return nil
+}
+
+// commitSHAPattern matches full and abbreviated (7 characters or more) commit SHAs
+var commitSHAPattern = regexp.MustCompile(`^[0-9a-fA-F]{7,40}$`)
+
+// IsCommitSHA reports whether ref looks like a full or abbreviated commit SHA.
+func IsCommitSHA(ref string) bool {
+	return commitSHAPattern.MatchString(ref)
+}
+
+// listBranchesAndTagsCached returns the branch+tag names for repoInfo, from the
+// ref cache when a fresh entry exists. Rate-limited listings are retried with jittered backoff.
+func listBranchesAndTagsCached(ctx context.Context, repoInfo *RepositoryInfo, token string) ([]string, error) {
+	key := refCacheKey(repoInfo, token)
+	if refs, ok := refCache.get(key); ok {
+		return refs, nil
+	}
+	var refs []string
+	err := apiRetrier.do(ctx, func() error {
+		var err error
+		refs, err = listBranchesAndTags(ctx, repoInfo, token)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	refCache.set(key, refs)
+	return refs, nil
+}
+
+// listBranchesAndTags lists branch+tag names using the test RefLister or the real API.
+func listBranchesAndTags(ctx context.Context, repoInfo *RepositoryInfo, token string) ([]string, error) {
 	if testRefLister != nil {
-		branches, err := testRefLister.ListBranchesAndTags(repoInfo, token)
-		if err != nil {
-			return "", "", err
+		if cl, ok := testRefLister.(ContextRefLister); ok {
+			return cl.ListBranchesAndTagsContext(ctx, repoInfo, token)
 		}
-		return findLongestMatch(branches, urlPath)
+		return testRefLister.ListBranchesAndTags(repoInfo, token)
 	}
 	switch repoInfo.Type {
 	case GitHub:
-		return resolveGitHubBranchAndPath(repoInfo, urlPath, token)
+		return listGitHubBranchesAndTags(ctx, repoInfo, token)
 	case GitLab:
-		return resolveGitLabBranchAndPath(repoInfo, urlPath, token)
+		return listGitLabBranchesAndTags(ctx, repoInfo, token)
 	default:
-		return "", "", fmt.Errorf("unsupported repository type: %s", repoInfo.Type)
+		return nil, fmt.Errorf("unsupported repository type: %s", repoInfo.Type)
 	}
 }
 
-// resolveGitHubBranchAndPath resolves GitHub branch and path
-func resolveGitHubBranchAndPath(repoInfo *RepositoryInfo, urlPath string, token string) (string, string, error) {
-	ctx := context.Background()
-	var client *github.Client
-	if token != "" {
-		client = github.NewClient(nil).WithAuthToken(token)
-	} else {
-		client = github.NewClient(nil)
+// lookupParent returns the parent repository of a fork (nil if not a fork).
+func lookupParent(ctx context.Context, repoInfo *RepositoryInfo, token string) (*RepositoryInfo, error) {
+	if testRefLister != nil {
+		if pl, ok := testRefLister.(ParentLookup); ok {
+			return pl.ParentRepository(repoInfo, token)
+		}
+		return nil, nil
 	}
 
+	switch repoInfo.Type {
+	case GitHub:
+		repo, _, err := NewGitHubClient(repoInfo, token).Repositories.Get(ctx, repoInfo.Owner, repoInfo.Repo)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get repository: %w", err)
+		}
+		parent := repo.GetParent()
+		if parent == nil {
+			return nil, nil
+		}
+		info := *repoInfo
+		info.Owner = parent.GetOwner().GetLogin()
+		info.Repo = parent.GetName()
+		return &info, nil
+	case GitLab:
+		client, err := NewGitLabClient(repoInfo, token)
+		if err != nil {
+			return nil, err
+		}
+		project, _, err := client.Projects.GetProject(fmt.Sprintf("%s/%s", repoInfo.Owner, repoInfo.Repo), nil, gitlab.WithContext(ctx))
+		if err != nil {
+			return nil, fmt.Errorf("failed to get project: %w", err)
+		}
+		if project.ForkedFromProject == nil {
+			return nil, nil
+		}
+		pathWithNamespace := project.ForkedFromProject.PathWithNamespace
+		idx := strings.LastIndex(pathWithNamespace, "/")
+		if idx <= 0 {
+			return nil, fmt.Errorf("invalid parent project path: %s", pathWithNamespace)
+		}
+		info := *repoInfo
+		info.Owner = pathWithNamespace[:idx]
+		info.Repo = pathWithNamespace[idx+1:]
+		return &info, nil
+	default:
+		return nil, fmt.Errorf("unsupported repository type: %s", repoInfo.Type)
+	}
+}
+
+// listGitHubBranchesAndTags lists all GitHub branch and tag names
+func listGitHubBranchesAndTags(ctx context.Context, repoInfo *RepositoryInfo, token string) ([]string, error) {
+	client := NewGitHubClient(repoInfo, token)
+
 	// List all branches
 	opts := &github.BranchListOptions{
 		ListOptions: github.ListOptions{PerPage: 100},
@@ -70,7 +340,7 @@ func resolveGitHubBranchAndPath(repoInfo *RepositoryInfo, urlPath string, token
 			opts,
 		)
 		if err != nil {
-			return "", "", fmt.Errorf("failed to list branches: %w", err)
+			return nil, fmt.Errorf("failed to list branches: %w", err)
 		}
 
 		for _, branch := range branches {
@@ -83,34 +353,37 @@ func resolveGitHubBranchAndPath(repoInfo *RepositoryInfo, urlPath string, token
 		opts.Page = resp.NextPage
 	}
 
-	// Also list tags
+	// Also list tags (all pages); a failure keeps the tags listed so far
 	tagOpts := &github.ListOptions{PerPage: 100}
-	tags, _, err := client.Repositories.ListTags(ctx, repoInfo.Owner, repoInfo.Repo, tagOpts)
-	if err == nil {
+	for {
+		tags, resp, err := client.Repositories.ListTags(ctx, repoInfo.Owner, repoInfo.Repo, tagOpts)
+		if err != nil {
+			logger().Warn("failed to list tags", "repo", repoInfo.Owner+"/"+repoInfo.Repo, "error", err)
+			break
+		}
+
 		for _, tag := range tags {
 			allBranches = append(allBranches, tag.GetName())
 		}
+
+		if resp.NextPage == 0 {
+			break
+		}
+		tagOpts.Page = resp.NextPage
 	}
 
-	// Find longest matching branch/tag in the path
-	return findLongestMatch(allBranches, urlPath)
+	return allBranches, nil
 }
 
-// resolveGitLabBranchAndPath resolves GitLab branch and path
-func resolveGitLabBranchAndPath(repoInfo *RepositoryInfo, urlPath string, token string) (string, string, error) {
-	var client *gitlab.Client
-	var err error
-
-	if token != "" {
-		client, err = gitlab.NewClient(token, gitlab.WithBaseURL(repoInfo.BaseURL+"/api/v4"))
-	} else {
-		client, err = gitlab.NewClient("", gitlab.WithBaseURL(repoInfo.BaseURL+"/api/v4"))
-	}
-
+// listGitLabBranchesAndTags lists all GitLab branch and tag names
+func listGitLabBranchesAndTags(ctx context.Context, repoInfo *RepositoryInfo, token string) ([]string, error) {
+	client, err := NewGitLabClient(repoInfo, token)
 	if err != nil {
-		return "", "", fmt.Errorf("failed to create GitLab client: %w", err)
+		return nil, err
 	}
 
+	// Full project path, subgroups included; the client URL-encodes it into the request
+	// path (group%2Fsub%2Fproject), so encoding it here would double-encode it
 	projectID := fmt.Sprintf("%s/%s", repoInfo.Owner, repoInfo.Repo)
 
 	// List all branches
@@ -120,9 +393,9 @@ func resolveGitLabBranchAndPath(repoInfo *RepositoryInfo, urlPath string, token
 
 	var allBranches []string
 	for {
-		branches, resp, err := client.Branches.ListBranches(projectID, opts)
+		branches, resp, err := client.Branches.ListBranches(projectID, opts, gitlab.WithContext(ctx))
 		if err != nil {
-			return "", "", fmt.Errorf("failed to list branches: %w", err)
+			return nil, fmt.Errorf("failed to list branches: %w", err)
 		}
 
 		for _, branch := range branches {
@@ -135,50 +408,78 @@ func resolveGitLabBranchAndPath(repoInfo *RepositoryInfo, urlPath string, token
 		opts.Page = resp.NextPage
 	}
 
-	// Also list tags
+	// Also list tags (all pages); a failure keeps the tags listed so far
 	tagOpts := &gitlab.ListTagsOptions{
 		ListOptions: gitlab.ListOptions{PerPage: 100},
 	}
-	tags, _, err := client.Tags.ListTags(projectID, tagOpts)
-	if err == nil {
+	for {
+		tags, resp, err := client.Tags.ListTags(projectID, tagOpts, gitlab.WithContext(ctx))
+		if err != nil {
+			logger().Warn("failed to list tags", "repo", projectID, "error", err)
+			break
+		}
+
 		for _, tag := range tags {
 			allBranches = append(allBranches, tag.Name)
 		}
+
+		if resp.NextPage == 0 {
+			break
+		}
+		tagOpts.Page = resp.NextPage
 	}
 
-	log.Printf("Found %d branches/tags for %s", len(allBranches), projectID)
+	logger().Debug("listed branches and tags", "repo", projectID, "count", len(allBranches))
 
-	// Find longest matching branch/tag in the path
-	return findLongestMatch(allBranches, urlPath)
+	return allBranches, nil
 }
 
-// findLongestMatch finds the longest branch name that matches the beginning of the path
+// findLongestMatch finds the longest branch name that matches the beginning of the path.
+// A branch only matches on a path-segment boundary: it must be followed by "/" or the
+// end of the path (so "main" does not match "main-feature/..."). When several refs
+// match at the same boundary (e.g. a branch and a tag sharing a name), an error
+// wrapping ErrAmbiguousRef lists them so the user can pass an explicit ?ref=.
 // Returns: (matched branch, remaining path, error)
 func findLongestMatch(branches []string, urlPath string) (string, string, error) {
 	urlPath = strings.Trim(urlPath, "/")
 
 	var longestMatch string
-	var longestMatchLen int
+	var candidates []string // refs matching at the longest boundary
 
 	for _, branch := range branches {
-		// Check if path starts with this branch
-		if strings.HasPrefix(urlPath, branch) {
-			if len(branch) > longestMatchLen {
-				longestMatch = branch
-				longestMatchLen = len(branch)
-			}
+		if branch == "" || !matchesAtSegmentBoundary(urlPath, branch) {
+			continue
+		}
+		switch {
+		case len(branch) > len(longestMatch):
+			longestMatch = branch
+			candidates = []string{branch}
+		case len(branch) == len(longestMatch):
+			candidates = append(candidates, branch)
 		}
 	}
 
 	if longestMatch == "" {
-		return "", "", fmt.Errorf("no matching branch found in path: %s", urlPath)
+		return "", "", fmt.Errorf("%w in path: %s", ErrNoMatchingRef, urlPath)
+	}
+	if len(candidates) > 1 {
+		return "", "", fmt.Errorf("%w in path %s: candidates %s; use an explicit ?ref=",
+			ErrAmbiguousRef, urlPath, strings.Join(candidates, ", "))
 	}
 
 	// Extract remaining path after the branch
 	remainingPath := strings.TrimPrefix(urlPath, longestMatch)
 	remainingPath = strings.TrimPrefix(remainingPath, "/")
 
-	log.Printf("Resolved: branch=%s, path=%s", longestMatch, remainingPath)
+	logger().Info("resolved branch and path", "branch", longestMatch, "path", remainingPath)
 
 	return longestMatch, remainingPath, nil
 }
+
+// matchesAtSegmentBoundary reports whether urlPath starts with branch followed by "/" or the end.
+func matchesAtSegmentBoundary(urlPath, branch string) bool {
+	if !strings.HasPrefix(urlPath, branch) {
+		return false
+	}
+	return len(urlPath) == len(branch) || urlPath[len(branch)] == '/'
+}
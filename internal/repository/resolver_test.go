@@ -1,8 +1,14 @@
 package repository
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 )
 
 // mockRefLister returns fixed branches/tags for tests.
@@ -213,6 +219,59 @@ func TestFindLongestMatch(t *testing.T) {
 			urlPath:   "main",
 			wantErr:   true,
 		},
+		{
+			name:       "branch must end on a segment boundary",
+			branches:   []string{"main"},
+			urlPath:    "main-feature/overlay",
+			wantErr:    true,
+		},
+		{
+			name:     "dev does not match development",
+			branches: []string{"dev"},
+			urlPath:  "development/base",
+			wantErr:  true,
+		},
+		{
+			name:       "development wins over non-aligned dev",
+			branches:   []string{"dev", "development"},
+			urlPath:    "development/base",
+			wantBranch: "development",
+			wantPath:   "base",
+		},
+		{
+			name:       "dev matches its own segment",
+			branches:   []string{"dev", "development"},
+			urlPath:    "dev/base",
+			wantBranch: "dev",
+			wantPath:   "base",
+		},
+		{
+			name:       "main-feature wins over non-aligned main",
+			branches:   []string{"main", "main-feature"},
+			urlPath:    "main-feature/overlay",
+			wantBranch: "main-feature",
+			wantPath:   "overlay",
+		},
+		{
+			name:       "segment boundary excludes shorter non-aligned prefix",
+			branches:   []string{"feature/x", "feature/x-extra"},
+			urlPath:    "feature/x-extra/base",
+			wantBranch: "feature/x-extra",
+			wantPath:   "base",
+		},
+		{
+			name:       "shorter aligned branch still matches",
+			branches:   []string{"feature/x", "feature/x-extra"},
+			urlPath:    "feature/x/base",
+			wantBranch: "feature/x",
+			wantPath:   "base",
+		},
+		{
+			name:     "branch and tag with the same name are ambiguous",
+			branches: []string{"main", "v1", "v1"},
+			urlPath:  "v1/deploy",
+			wantErr:  true,
+		},
 		{
 			name:       "tag and branch",
 			branches:   []string{"main", "v1.0", "v1.0.0"},
@@ -243,3 +302,343 @@ func TestFindLongestMatch(t *testing.T) {
 		})
 	}
 }
+
+// forkRefLister lists refs per "owner/repo" and knows each fork's parent.
+type forkRefLister struct {
+	refs    map[string][]string
+	parents map[string]*RepositoryInfo
+}
+
+func (m *forkRefLister) ListBranchesAndTags(repoInfo *RepositoryInfo, _ string) ([]string, error) {
+	return m.refs[repoInfo.Owner+"/"+repoInfo.Repo], nil
+}
+
+func (m *forkRefLister) ParentRepository(repoInfo *RepositoryInfo, _ string) (*RepositoryInfo, error) {
+	return m.parents[repoInfo.Owner+"/"+repoInfo.Repo], nil
+}
+
+func TestResolveBranchAndPath_FollowForkParent(t *testing.T) {
+	mock := &forkRefLister{
+		refs: map[string][]string{
+			"me/repo":       {"main"},
+			"upstream/repo": {"main", "feature/x"},
+		},
+		parents: map[string]*RepositoryInfo{
+			"me/repo": {Type: GitHub, Owner: "upstream", Repo: "repo"},
+		},
+	}
+	SetTestRefLister(mock)
+	defer SetTestRefLister(nil)
+
+	// Opt-in disabled: the fork lacks the branch, resolution fails
+	repoInfo := &RepositoryInfo{Type: GitHub, Owner: "me", Repo: "repo"}
+	if _, _, err := ResolveBranchAndPath(repoInfo, "feature/x/deploy", ""); err == nil {
+		t.Fatal("expected error without FollowForkParent")
+	}
+
+	repoInfo = &RepositoryInfo{Type: GitHub, Owner: "me", Repo: "repo", FollowForkParent: true}
+	branch, path, err := ResolveBranchAndPath(repoInfo, "feature/x/deploy", "")
+	if err != nil {
+		t.Fatalf("ResolveBranchAndPath: %v", err)
+	}
+	if branch != "feature/x" || path != "deploy" {
+		t.Errorf("branch/path = %q/%q, want feature/x/deploy", branch, path)
+	}
+	if repoInfo.Owner != "upstream" || repoInfo.Repo != "repo" {
+		t.Errorf("repo = %s/%s, want upstream/repo", repoInfo.Owner, repoInfo.Repo)
+	}
+	if repoInfo.ResolvedFromFork != "me/repo" {
+		t.Errorf("ResolvedFromFork = %q, want me/repo", repoInfo.ResolvedFromFork)
+	}
+}
+
+func TestResolveBranchAndPath_FollowForkParent_BranchInFork(t *testing.T) {
+	mock := &forkRefLister{
+		refs: map[string][]string{"me/repo": {"main"}, "upstream/repo": {"main"}},
+		parents: map[string]*RepositoryInfo{
+			"me/repo": {Type: GitHub, Owner: "upstream", Repo: "repo"},
+		},
+	}
+	SetTestRefLister(mock)
+	defer SetTestRefLister(nil)
+
+	repoInfo := &RepositoryInfo{Type: GitHub, Owner: "me", Repo: "repo", FollowForkParent: true}
+	if _, _, err := ResolveBranchAndPath(repoInfo, "main/deploy", ""); err != nil {
+		t.Fatalf("ResolveBranchAndPath: %v", err)
+	}
+	if repoInfo.Owner != "me" || repoInfo.ResolvedFromFork != "" {
+		t.Errorf("fork has the branch: repo = %s/%s (from fork %q), want me/repo unchanged", repoInfo.Owner, repoInfo.Repo, repoInfo.ResolvedFromFork)
+	}
+}
+
+// defaultBranchLister is a mock RefLister that also reports a default branch.
+type defaultBranchLister struct {
+	mockRefLister
+	defaultBranch string
+	err           error
+	calls         int
+}
+
+func (m *defaultBranchLister) DefaultBranch(_ *RepositoryInfo, _ string) (string, error) {
+	m.calls++
+	return m.defaultBranch, m.err
+}
+
+func TestResolveDefaultBranch_WithMock(t *testing.T) {
+	mock := &defaultBranchLister{defaultBranch: "master"}
+	SetTestRefLister(mock)
+	defer SetTestRefLister(nil)
+
+	repoInfo := &RepositoryInfo{Type: GitHub, Owner: "o", Repo: "r"}
+	branch, err := ResolveDefaultBranch(repoInfo, "")
+	if err != nil {
+		t.Fatalf("ResolveDefaultBranch: %v", err)
+	}
+	if branch != "master" {
+		t.Errorf("branch = %q, want master", branch)
+	}
+	if repoInfo.Ref != "master" {
+		t.Errorf("repoInfo.Ref = %q, want master", repoInfo.Ref)
+	}
+}
+
+func TestResolveDefaultBranch_WithMock_Error(t *testing.T) {
+	for name, mock := range map[string]*defaultBranchLister{
+		"api error":    {err: fmt.Errorf("not found")},
+		"empty branch": {defaultBranch: ""},
+	} {
+		t.Run(name, func(t *testing.T) {
+			SetTestRefLister(mock)
+			defer SetTestRefLister(nil)
+
+			repoInfo := &RepositoryInfo{Type: GitLab, Owner: "g", Repo: "p"}
+			if _, err := ResolveDefaultBranch(repoInfo, ""); err == nil {
+				t.Fatal("expected error, got nil")
+			}
+			if repoInfo.Ref != "" {
+				t.Errorf("repoInfo.Ref = %q, want empty on error", repoInfo.Ref)
+			}
+		})
+	}
+}
+
+func TestFindLongestMatch_AmbiguousErrorListsCandidates(t *testing.T) {
+	_, _, err := findLongestMatch([]string{"main", "release", "release"}, "release/overlay")
+	if err == nil {
+		t.Fatal("expected ambiguity error, got nil")
+	}
+	if !errors.Is(err, ErrAmbiguousRef) {
+		t.Errorf("errors.Is(err, ErrAmbiguousRef) = false, err = %v", err)
+	}
+	if !strings.Contains(err.Error(), "release, release") || !strings.Contains(err.Error(), "?ref=") {
+		t.Errorf("error should list candidates and suggest ?ref=, got %q", err)
+	}
+
+	_, _, err = findLongestMatch([]string{"main"}, "develop/overlay")
+	if !errors.Is(err, ErrNoMatchingRef) {
+		t.Errorf("errors.Is(err, ErrNoMatchingRef) = false, err = %v", err)
+	}
+}
+
+// blockingRefLister blocks until the caller's context is done and records that it saw it.
+type blockingRefLister struct {
+	cancelled bool
+}
+
+func (m *blockingRefLister) ListBranchesAndTags(_ *RepositoryInfo, _ string) ([]string, error) {
+	return nil, fmt.Errorf("context-less listing should not be used")
+}
+
+func (m *blockingRefLister) ListBranchesAndTagsContext(ctx context.Context, _ *RepositoryInfo, _ string) ([]string, error) {
+	<-ctx.Done()
+	m.cancelled = true
+	return nil, ctx.Err()
+}
+
+func TestResolveBranchAndPathContext_Cancelled(t *testing.T) {
+	lister := &blockingRefLister{}
+	SetTestRefLister(lister)
+	defer SetTestRefLister(nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	repoInfo := &RepositoryInfo{Type: GitHub, Owner: "owner", Repo: "repo"}
+	_, _, err := ResolveBranchAndPathContext(ctx, repoInfo, "main/overlay", "")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v, want context.DeadlineExceeded", err)
+	}
+	if !lister.cancelled {
+		t.Error("expected the RefLister to observe the cancellation")
+	}
+}
+
+func TestResolveBranchAndPath_Local(t *testing.T) {
+	// No API call and no RefLister: a local checkout has a single working tree
+	SetTestRefLister(nil)
+	repoInfo := NewLocalRepository("/srv/repo")
+	branch, path, err := ResolveBranchAndPath(repoInfo, "/overlays/dev/", "")
+	if err != nil {
+		t.Fatalf("ResolveBranchAndPath: %v", err)
+	}
+	if branch != LocalRef || path != "overlays/dev" {
+		t.Errorf("got (%q, %q), want (%q, overlays/dev)", branch, path, LocalRef)
+	}
+
+	repoInfo.Ref = ""
+	if branch, err := ResolveDefaultBranch(repoInfo, ""); err != nil || branch != LocalRef || repoInfo.Ref != LocalRef {
+		t.Errorf("ResolveDefaultBranch = (%q, %v), Ref = %q, want %q", branch, err, repoInfo.Ref, LocalRef)
+	}
+}
+
+// TestResolveBranchAndPath_GitLabSubpath resolves against a mock GitLab served under
+// /gitlab, checking the API is called below the subpath.
+func TestResolveBranchAndPath_GitLabSubpath(t *testing.T) {
+	var apiPaths []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		apiPaths = append(apiPaths, r.URL.EscapedPath())
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/repository/branches"):
+			fmt.Fprint(w, `[{"name":"main"},{"name":"release/1.0"}]`)
+		default:
+			fmt.Fprint(w, `[]`)
+		}
+	}))
+	defer srv.Close()
+	SetTestRefLister(nil)
+	defer ClearRefCache()
+	defer ClearGitLabInstances()
+	if err := RegisterGitLabInstance(srv.URL + "/gitlab"); err != nil {
+		t.Fatal(err)
+	}
+
+	repoInfo, err := DetectRepository(srv.URL+"/gitlab/group/project/-/tree/release/1.0/deploy", "")
+	if err != nil {
+		t.Fatalf("DetectRepository: %v", err)
+	}
+	branch, path, err := ResolveBranchAndPath(repoInfo, repoInfo.AmbiguousPath, "")
+	if err != nil {
+		t.Fatalf("ResolveBranchAndPath: %v", err)
+	}
+	if branch != "release/1.0" || path != "deploy" {
+		t.Errorf("got (%q, %q), want (release/1.0, deploy)", branch, path)
+	}
+	if len(apiPaths) == 0 || apiPaths[0] != "/gitlab/api/v4/projects/group%2Fproject/repository/branches" {
+		t.Errorf("API paths = %v, want branches listed under /gitlab/api/v4", apiPaths)
+	}
+}
+
+// TestResolveBranchAndPath_GitLabSubgroupProjectID ensures a project in nested
+// subgroups is addressed by its URL-encoded full path, encoded exactly once.
+func TestResolveBranchAndPath_GitLabSubgroupProjectID(t *testing.T) {
+	var apiPaths []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		apiPaths = append(apiPaths, r.URL.EscapedPath())
+		w.Header().Set("Content-Type", "application/json")
+		if strings.HasSuffix(r.URL.Path, "/repository/branches") {
+			fmt.Fprint(w, `[{"name":"main"}]`)
+			return
+		}
+		fmt.Fprint(w, `[]`)
+	}))
+	defer srv.Close()
+	SetTestRefLister(nil)
+	defer ClearRefCache()
+
+	repoInfo := &RepositoryInfo{Type: GitLab, Owner: "group/sub/team", Repo: "project", BaseURL: srv.URL}
+	branch, path, err := ResolveBranchAndPath(repoInfo, "main/deploy", "")
+	if err != nil {
+		t.Fatalf("ResolveBranchAndPath: %v", err)
+	}
+	if branch != "main" || path != "deploy" {
+		t.Errorf("got (%q, %q), want (main, deploy)", branch, path)
+	}
+	want := []string{
+		"/api/v4/projects/group%2Fsub%2Fteam%2Fproject/repository/branches",
+		"/api/v4/projects/group%2Fsub%2Fteam%2Fproject/repository/tags",
+	}
+	if strings.Join(apiPaths, " ") != strings.Join(want, " ") {
+		t.Errorf("API paths = %v, want %v", apiPaths, want)
+	}
+}
+
+func TestResolveBranchAndPath_ExplicitRefSkipsListing(t *testing.T) {
+	mock := &countingRefLister{branches: []string{"main", "release"}}
+	SetTestRefLister(mock)
+	defer SetTestRefLister(nil)
+
+	repoInfo := &RepositoryInfo{Type: GitHub, Owner: "o", Repo: "r", Ref: "release/v1"}
+	branch, path, err := ResolveBranchAndPath(repoInfo, "/release/v1/kustomize/base/", "")
+	if err != nil {
+		t.Fatalf("ResolveBranchAndPath: %v", err)
+	}
+	if branch != "release/v1" || path != "release/v1/kustomize/base" {
+		t.Errorf("got (%q, %q), want the explicit ref and the whole path", branch, path)
+	}
+	if mock.calls != 0 {
+		t.Errorf("RefLister calls = %d, want 0 with an explicit ref", mock.calls)
+	}
+}
+
+func TestResolveBranchAndPath_CommitSHA(t *testing.T) {
+	SetTestRefLister(&mockRefLister{branches: []string{"main"}})
+	defer SetTestRefLister(nil)
+
+	cases := []struct {
+		name      string
+		urlPath   string
+		branch    string
+		path      string
+		noMatchOK bool
+	}{
+		{"full SHA", "a1b2c3d4e5f60718293a4b5c6d7e8f9012345678/deploy/base", "a1b2c3d4e5f60718293a4b5c6d7e8f9012345678", "deploy/base", false},
+		{"short SHA", "a1b2c3d/deploy", "a1b2c3d", "deploy", false},
+		{"not hex", "a1b2c3z/deploy", "", "", true},
+		{"too short", "a1b2c3/deploy", "", "", true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			repoInfo := &RepositoryInfo{Type: GitHub, Owner: "owner", Repo: "repo"}
+			branch, path, err := ResolveBranchAndPath(repoInfo, c.urlPath, "")
+			if c.noMatchOK {
+				if !errors.Is(err, ErrNoMatchingRef) {
+					t.Errorf("ResolveBranchAndPath(%q) = %q, %q, %v; want ErrNoMatchingRef", c.urlPath, branch, path, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ResolveBranchAndPath(%q): %v", c.urlPath, err)
+			}
+			if branch != c.branch || path != c.path {
+				t.Errorf("ResolveBranchAndPath(%q) = %q, %q; want %q, %q", c.urlPath, branch, path, c.branch, c.path)
+			}
+		})
+	}
+}
+
+func TestVerifyRef(t *testing.T) {
+	SetTestRefLister(&mockRefLister{branches: []string{"main", "release/v1", "v1.0.0"}})
+	defer SetTestRefLister(nil)
+
+	cases := []struct {
+		ref     string
+		wantErr bool
+	}{
+		{"main", false},
+		{"release/v1", false},
+		{"v1.0.0", false},
+		{"a1b2c3d", false},
+		{"release", true},
+		{"feature/gone", true},
+	}
+	for _, c := range cases {
+		err := VerifyRef(context.Background(), &RepositoryInfo{Type: GitHub, Owner: "owner", Repo: "repo", Ref: c.ref}, "")
+		if c.wantErr != (err != nil) {
+			t.Errorf("VerifyRef(%q) = %v, want error: %v", c.ref, err, c.wantErr)
+		}
+		if c.wantErr && !errors.Is(err, ErrNoMatchingRef) {
+			t.Errorf("VerifyRef(%q) = %v, want ErrNoMatchingRef", c.ref, err)
+		}
+	}
+}
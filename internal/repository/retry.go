@@ -0,0 +1,161 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/go-github/v82/github"
+	gitlab "gitlab.com/gitlab-org/api/client-go"
+)
+
+// defaultRetryAttempts is the number of attempts (including the first) for API listings.
+const defaultRetryAttempts = 4
+
+// retrier retries rate-limited or transient API failures with exponential backoff.
+// Backoff uses full jitter (a random delay in [0, min(maxDelay, baseDelay*2^attempt)])
+// so that many references hitting the same rate-limited repo don't retry in lockstep.
+// A GitHub primary rate limit is waited out until its reset time, up to maxResetWait.
+type retrier struct {
+	attempts     atomic.Int32  // total attempts, including the first; set while requests run
+	baseDelay    time.Duration // cap of the first backoff
+	maxDelay     time.Duration // upper bound of any backoff
+	maxResetWait time.Duration // upper bound when waiting for a rate-limit reset
+	sleep        func(ctx context.Context, d time.Duration) error
+	now          func() time.Time
+	randInt63    func(n int64) int64 // returns a value in [0, n); nil disables jitter
+}
+
+// apiRetrier is used when listing branches and tags. Tests replace it to avoid real sleeps.
+var apiRetrier = newRetrier(defaultRetryAttempts, 500*time.Millisecond, 30*time.Second)
+
+// newRetrier returns a retrier with real sleeps, clock and jitter, waiting at most
+// 5 minutes for a rate-limit reset.
+func newRetrier(attempts int, baseDelay, maxDelay time.Duration) *retrier {
+	r := &retrier{
+		baseDelay:    baseDelay,
+		maxDelay:     maxDelay,
+		maxResetWait: 5 * time.Minute,
+		sleep:        sleepContext,
+		now:          time.Now,
+		randInt63:    rand.Int63n,
+	}
+	r.attempts.Store(int32(attempts))
+	return r
+}
+
+// sleepContext waits d, returning ctx's error early when it is done first, so a
+// cancelled request doesn't wait out a rate-limit reset.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// SetMaxRetryAttempts sets how many times a rate-limited listing is attempted in total
+// (values below 1 mean a single attempt, i.e. no retry). Safe to call while requests run.
+func SetMaxRetryAttempts(n int) {
+	if n < 1 {
+		n = 1
+	}
+	apiRetrier.attempts.Store(int32(n))
+}
+
+// backoff returns the delay before retry number attempt (0 for the first retry).
+func (r *retrier) backoff(attempt int) time.Duration {
+	ceiling := r.maxDelay
+	if attempt < 32 {
+		if d := r.baseDelay << uint(attempt); d > 0 && d < ceiling {
+			ceiling = d
+		}
+	}
+	if r.randInt63 == nil || ceiling <= 0 {
+		return ceiling
+	}
+	return time.Duration(r.randInt63(int64(ceiling) + 1))
+}
+
+// delay returns how long to wait before retry number attempt after err: the jittered
+// backoff, or the time left until a GitHub rate-limit reset when that is longer.
+func (r *retrier) delay(attempt int, err error) time.Duration {
+	d := r.backoff(attempt)
+	if reset, ok := rateLimitReset(err); ok && r.now != nil {
+		wait := reset.Sub(r.now())
+		if r.maxResetWait > 0 && wait > r.maxResetWait {
+			wait = r.maxResetWait
+		}
+		if wait > d {
+			d = wait
+		}
+	}
+	return d
+}
+
+// do calls fn until it succeeds, returns a non-retryable error, attempts run out,
+// or ctx is done. When still rate-limited after the last attempt, the error is
+// wrapped with the reset timestamp.
+func (r *retrier) do(ctx context.Context, fn func() error) error {
+	var err error
+	attempts := int(r.attempts.Load())
+	for attempt := 0; attempt < attempts; attempt++ {
+		if attempt > 0 {
+			delay := r.delay(attempt-1, err)
+			logger().Warn("retrying API call", "delay", delay, "attempt", attempt+1, "attempts", attempts, "error", err)
+			if sleepErr := r.sleep(ctx, delay); sleepErr != nil {
+				return sleepErr
+			}
+		}
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		if err = fn(); err == nil || !isRetryable(err) {
+			return err
+		}
+	}
+	if reset, ok := rateLimitReset(err); ok {
+		return fmt.Errorf("%w (rate limit resets at %s)", err, reset.Format(time.RFC3339))
+	}
+	return err
+}
+
+// rateLimitReset returns the reset time of a GitHub primary rate-limit error.
+func rateLimitReset(err error) (time.Time, bool) {
+	var rateErr *github.RateLimitError
+	if !errors.As(err, &rateErr) || rateErr.Rate.Reset.IsZero() {
+		return time.Time{}, false
+	}
+	return rateErr.Rate.Reset.Time, true
+}
+
+// isRetryable reports whether err is a rate-limit or transient server error from
+// the GitHub or GitLab API.
+func isRetryable(err error) bool {
+	var rateErr *github.RateLimitError
+	var abuseErr *github.AbuseRateLimitError
+	if errors.As(err, &rateErr) || errors.As(err, &abuseErr) {
+		return true
+	}
+
+	var ghErr *github.ErrorResponse
+	if errors.As(err, &ghErr) && ghErr.Response != nil {
+		return retryableStatus(ghErr.Response.StatusCode)
+	}
+	var glErr *gitlab.ErrorResponse
+	if errors.As(err, &glErr) && glErr.Response != nil {
+		return retryableStatus(glErr.Response.StatusCode)
+	}
+	return false
+}
+
+func retryableStatus(code int) bool {
+	return code == http.StatusTooManyRequests || code >= http.StatusInternalServerError
+}
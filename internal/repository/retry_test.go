@@ -0,0 +1,254 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v82/github"
+	gitlab "gitlab.com/gitlab-org/api/client-go"
+)
+
+// rateLimitedResponse is the response a GitHub rate-limit error carries (its Error() reads it).
+func rateLimitedResponse() *http.Response {
+	req, _ := http.NewRequest(http.MethodGet, "https://api.github.com/repos/owner/repo/branches", nil)
+	return &http.Response{StatusCode: http.StatusForbidden, Request: req}
+}
+
+func TestRetrier_BackoffWithinJitteredRange(t *testing.T) {
+	var ceilings []int64
+	r := &retrier{
+		baseDelay: 100 * time.Millisecond,
+		maxDelay:  time.Second,
+		randInt63: func(n int64) int64 { ceilings = append(ceilings, n); return n / 2 },
+	}
+
+	want := []time.Duration{100, 200, 400, 800, 1000, 1000}
+	for attempt, w := range want {
+		ceiling := w * time.Millisecond
+		got := r.backoff(attempt)
+		if got < 0 || got > ceiling {
+			t.Errorf("backoff(%d) = %v, want within [0, %v]", attempt, got, ceiling)
+		}
+		if got != time.Duration((int64(ceiling)+1)/2) {
+			t.Errorf("backoff(%d) = %v, want deterministic midpoint of [0, %v]", attempt, got, ceiling)
+		}
+		if ceilings[attempt] != int64(ceiling)+1 {
+			t.Errorf("backoff(%d) drew from [0, %d), want [0, %d)", attempt, ceilings[attempt], int64(ceiling)+1)
+		}
+	}
+}
+
+func TestRetrier_NoJitter(t *testing.T) {
+	r := &retrier{baseDelay: 100 * time.Millisecond, maxDelay: time.Second}
+	if got := r.backoff(2); got != 400*time.Millisecond {
+		t.Errorf("backoff(2) without jitter = %v, want 400ms", got)
+	}
+}
+
+func TestRetrier_Do(t *testing.T) {
+	rateLimited := &github.RateLimitError{Response: rateLimitedResponse(), Message: "API rate limit exceeded"}
+
+	cases := []struct {
+		name       string
+		errs       []error // returned by successive calls; nil means success
+		wantCalls  int
+		wantSleeps int
+		wantErr    bool
+	}{
+		{"success first try", []error{nil}, 1, 0, false},
+		{"retries rate limit then succeeds", []error{rateLimited, rateLimited, nil}, 3, 2, false},
+		{"gives up after attempts", []error{rateLimited, rateLimited, rateLimited, rateLimited}, 3, 2, true},
+		{"non-retryable returns immediately", []error{errors.New("not found"), nil}, 1, 0, true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var sleeps []time.Duration
+			r := &retrier{
+				baseDelay: 10 * time.Millisecond,
+				maxDelay:  time.Second,
+				sleep:     func(_ context.Context, d time.Duration) error { sleeps = append(sleeps, d); return nil },
+				randInt63: func(n int64) int64 { return n - 1 },
+			}
+			r.attempts.Store(3)
+			calls := 0
+			err := r.do(context.Background(), func() error {
+				err := c.errs[calls]
+				calls++
+				return err
+			})
+			if calls != c.wantCalls {
+				t.Errorf("calls = %d, want %d", calls, c.wantCalls)
+			}
+			if len(sleeps) != c.wantSleeps {
+				t.Errorf("sleeps = %v, want %d", sleeps, c.wantSleeps)
+			}
+			if (err != nil) != c.wantErr {
+				t.Errorf("err = %v, wantErr %v", err, c.wantErr)
+			}
+		})
+	}
+}
+
+func TestRetrier_DoStopsWaitingWhenCancelled(t *testing.T) {
+	now := time.Now()
+	r := &retrier{
+		baseDelay:    10 * time.Millisecond,
+		maxDelay:     time.Second,
+		maxResetWait: 5 * time.Minute,
+		sleep:        sleepContext,
+		now:          func() time.Time { return now },
+	}
+	r.attempts.Store(3)
+	ctx, cancel := context.WithCancel(context.Background())
+	calls := 0
+	start := time.Now()
+	err := r.do(ctx, func() error {
+		calls++
+		cancel() // cancelled while the retry waits for the reset
+		return &github.RateLimitError{
+			Rate:     github.Rate{Reset: github.Timestamp{Time: now.Add(5 * time.Minute)}},
+			Response: rateLimitedResponse(),
+			Message:  "API rate limit exceeded",
+		}
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, want context.Canceled", err)
+	}
+	if calls != 1 {
+		t.Errorf("calls = %d, want 1", calls)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("do returned after %v, want it to stop waiting on cancel", elapsed)
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	status := func(code int) *http.Response { return &http.Response{StatusCode: code} }
+	cases := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"github rate limit", fmt.Errorf("failed to list branches: %w", &github.RateLimitError{}), true},
+		{"github abuse limit", &github.AbuseRateLimitError{}, true},
+		{"github 502", &github.ErrorResponse{Response: status(http.StatusBadGateway)}, true},
+		{"github 404", &github.ErrorResponse{Response: status(http.StatusNotFound)}, false},
+		{"gitlab 429", fmt.Errorf("failed to list branches: %w", &gitlab.ErrorResponse{Response: status(http.StatusTooManyRequests)}), true},
+		{"gitlab 403", &gitlab.ErrorResponse{Response: status(http.StatusForbidden)}, false},
+		{"plain error", errors.New("boom"), false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := isRetryable(c.err); got != c.want {
+				t.Errorf("isRetryable(%v) = %v, want %v", c.err, got, c.want)
+			}
+		})
+	}
+}
+
+// flakyRefLister returns a GitHub rate-limit error for the first failures calls.
+type flakyRefLister struct {
+	failures int
+	reset    time.Time
+	calls    int
+}
+
+func (m *flakyRefLister) ListBranchesAndTags(_ *RepositoryInfo, _ string) ([]string, error) {
+	m.calls++
+	if m.calls <= m.failures {
+		return nil, fmt.Errorf("failed to list branches: %w", &github.RateLimitError{
+			Rate:     github.Rate{Limit: 60, Remaining: 0, Reset: github.Timestamp{Time: m.reset}},
+			Response: rateLimitedResponse(),
+			Message:  "API rate limit exceeded",
+		})
+	}
+	return []string{"main"}, nil
+}
+
+// useTestRetrier replaces apiRetrier with one that records sleeps instead of sleeping.
+func useTestRetrier(t *testing.T, attempts int, now time.Time) *[]time.Duration {
+	t.Helper()
+	var sleeps []time.Duration
+	orig := apiRetrier
+	apiRetrier = &retrier{
+		baseDelay:    100 * time.Millisecond,
+		maxDelay:     time.Second,
+		maxResetWait: time.Minute,
+		sleep:        func(_ context.Context, d time.Duration) error { sleeps = append(sleeps, d); return nil },
+		now:          func() time.Time { return now },
+	}
+	apiRetrier.attempts.Store(int32(attempts))
+	t.Cleanup(func() { apiRetrier = orig })
+	return &sleeps
+}
+
+func TestResolveBranchAndPath_RetriesRateLimit(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	sleeps := useTestRetrier(t, 4, now)
+	lister := &flakyRefLister{failures: 2, reset: now.Add(10 * time.Second)}
+	SetTestRefLister(lister)
+	defer SetTestRefLister(nil)
+
+	repoInfo := &RepositoryInfo{Type: GitHub, Owner: "owner", Repo: "repo"}
+	branch, path, err := ResolveBranchAndPath(repoInfo, "main/overlay", "")
+	if err != nil {
+		t.Fatalf("ResolveBranchAndPath: %v", err)
+	}
+	if branch != "main" || path != "overlay" {
+		t.Errorf("got (%q, %q), want (main, overlay)", branch, path)
+	}
+	if lister.calls != 3 {
+		t.Errorf("calls = %d, want 3", lister.calls)
+	}
+	// Each retry waits until the reset time (longer than the backoff)
+	if len(*sleeps) != 2 || (*sleeps)[0] != 10*time.Second || (*sleeps)[1] != 10*time.Second {
+		t.Errorf("sleeps = %v, want [10s 10s]", *sleeps)
+	}
+}
+
+func TestResolveBranchAndPath_RateLimitExhausted(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	sleeps := useTestRetrier(t, 3, now)
+	reset := now.Add(time.Hour)
+	lister := &flakyRefLister{failures: 10, reset: reset}
+	SetTestRefLister(lister)
+	defer SetTestRefLister(nil)
+
+	repoInfo := &RepositoryInfo{Type: GitHub, Owner: "owner", Repo: "repo"}
+	_, _, err := ResolveBranchAndPath(repoInfo, "main/overlay", "")
+	var rateErr *github.RateLimitError
+	if !errors.As(err, &rateErr) {
+		t.Fatalf("err = %v, want wrapped *github.RateLimitError", err)
+	}
+	if !strings.Contains(err.Error(), reset.Format(time.RFC3339)) {
+		t.Errorf("err = %q, want it to contain the reset time %s", err, reset.Format(time.RFC3339))
+	}
+	if lister.calls != 3 {
+		t.Errorf("calls = %d, want 3", lister.calls)
+	}
+	// The wait for a distant reset is capped by maxResetWait
+	for _, d := range *sleeps {
+		if d != time.Minute {
+			t.Errorf("sleep = %v, want capped at 1m", d)
+		}
+	}
+}
+
+func TestSetMaxRetryAttempts(t *testing.T) {
+	orig := apiRetrier.attempts.Load()
+	defer apiRetrier.attempts.Store(orig)
+
+	SetMaxRetryAttempts(7)
+	if got := apiRetrier.attempts.Load(); got != 7 {
+		t.Errorf("attempts = %d, want 7", got)
+	}
+	SetMaxRetryAttempts(0)
+	if got := apiRetrier.attempts.Load(); got != 1 {
+		t.Errorf("attempts = %d, want 1", got)
+	}
+}
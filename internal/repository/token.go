@@ -0,0 +1,108 @@
+package repository
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// TokenProvider returns the credential to use for a repository ("" for none), so a
+// graph spanning several hosts (github.com and a private GitLab) authenticates to each.
+type TokenProvider func(repoInfo *RepositoryInfo) string
+
+// StaticToken returns a TokenProvider giving token for every repository.
+func StaticToken(token string) TokenProvider {
+	return func(*RepositoryInfo) string {
+		return token
+	}
+}
+
+// TokensByType returns a TokenProvider choosing the token by repository type.
+func TokensByType(tokens map[RepositoryType]string) TokenProvider {
+	return func(repoInfo *RepositoryInfo) string {
+		return tokens[repoInfo.Type]
+	}
+}
+
+// TokensByHost returns a TokenProvider choosing the token by repository host (see
+// RepositoryInfo.Host), e.g. "github.com" or "gitlab.mycorp.net".
+func TokensByHost(tokens map[string]string) TokenProvider {
+	return func(repoInfo *RepositoryInfo) string {
+		return tokens[repoInfo.Host()]
+	}
+}
+
+// DefaultTokenProvider returns a TokenProvider reading credentials from the environment:
+// GITHUB_TOKEN for github.com and GITLAB_TOKEN for gitlab.com, then the password of the
+// ~/.netrc machine entry for the repository's host. Other hosts (GitHub Enterprise,
+// self-managed GitLab) only get their netrc machine entry; the netrc default entry is
+// never used. Both are read once, when the provider is created.
+func DefaultTokenProvider() TokenProvider {
+	env := map[string]string{
+		"github.com":     os.Getenv("GITHUB_TOKEN"),
+		"api.github.com": os.Getenv("GITHUB_TOKEN"),
+		"gitlab.com":     os.Getenv("GITLAB_TOKEN"),
+	}
+	var netrc map[string]string
+	if home, err := os.UserHomeDir(); err == nil {
+		if data, err := os.ReadFile(filepath.Join(home, ".netrc")); err == nil {
+			netrc = parseNetrc(string(data))
+		}
+	}
+
+	return func(repoInfo *RepositoryInfo) string {
+		host := strings.ToLower(repoInfo.Host())
+		if host == "" {
+			host = defaultHosts[repoInfo.Type]
+		}
+		if host == "" {
+			return ""
+		}
+		if token := env[host]; token != "" {
+			return token
+		}
+		return netrc[host]
+	}
+}
+
+// parseNetrc maps the machine names of a .netrc file to their password. The default
+// entry and macdef bodies are skipped.
+func parseNetrc(data string) map[string]string {
+	passwords := make(map[string]string)
+	var machine string
+	inEntry := false
+	lines := strings.Split(data, "\n")
+	for i := 0; i < len(lines); i++ {
+		fields := strings.Fields(lines[i])
+		for j := 0; j < len(fields); j++ {
+			switch fields[j] {
+			case "machine":
+				if j+1 < len(fields) {
+					j++
+					machine, inEntry = strings.ToLower(fields[j]), true
+				}
+			case "default":
+				inEntry = false
+			case "password":
+				if j+1 < len(fields) {
+					j++
+					if inEntry {
+						if _, seen := passwords[machine]; !seen {
+							passwords[machine] = fields[j]
+						}
+					}
+				}
+			case "login", "account":
+				j++ // skip the value
+			case "macdef":
+				// The macro runs up to the next empty line
+				for i+1 < len(lines) && strings.TrimSpace(lines[i+1]) != "" {
+					i++
+				}
+				inEntry = false
+				j = len(fields)
+			}
+		}
+	}
+	return passwords
+}
@@ -0,0 +1,132 @@
+package repository
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTokenProviders(t *testing.T) {
+	github := &RepositoryInfo{Type: GitHub, Owner: "o", Repo: "r"}
+	gitlab := &RepositoryInfo{Type: GitLab, Owner: "g", Repo: "p", BaseURL: "https://gitlab.mycorp.net"}
+
+	cases := []struct {
+		name               string
+		tokens             TokenProvider
+		wantGitHub, wantGL string
+	}{
+		{"static", StaticToken("t"), "t", "t"},
+		{"by type", TokensByType(map[RepositoryType]string{GitHub: "gh", GitLab: "gl"}), "gh", "gl"},
+		{"by host", TokensByHost(map[string]string{"github.com": "gh", "gitlab.mycorp.net": "gl"}), "gh", "gl"},
+		{"by host, unknown host", TokensByHost(map[string]string{"gitlab.com": "gl"}), "", ""},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := c.tokens(github); got != c.wantGitHub {
+				t.Errorf("GitHub token = %q, want %q", got, c.wantGitHub)
+			}
+			if got := c.tokens(gitlab); got != c.wantGL {
+				t.Errorf("GitLab token = %q, want %q", got, c.wantGL)
+			}
+		})
+	}
+}
+
+// tokenRefLister records the token each repository's branches were listed with.
+type tokenRefLister struct {
+	tokens map[string]string // owner/repo -> token
+}
+
+func (m *tokenRefLister) ListBranchesAndTags(repoInfo *RepositoryInfo, token string) ([]string, error) {
+	m.tokens[repoInfo.Owner+"/"+repoInfo.Repo] = token
+	return []string{"main"}, nil
+}
+
+func TestResolveBranchAndPathTokens_PerRepository(t *testing.T) {
+	mock := &tokenRefLister{tokens: map[string]string{}}
+	SetTestRefLister(mock)
+	defer SetTestRefLister(nil)
+
+	tokens := TokensByType(map[RepositoryType]string{GitHub: "gh-token", GitLab: "gl-token"})
+	for _, repo := range []*RepositoryInfo{
+		{Type: GitHub, Owner: "o", Repo: "r"},
+		{Type: GitLab, Owner: "g", Repo: "p", BaseURL: "https://gitlab.mycorp.net"},
+	} {
+		if _, _, err := ResolveBranchAndPathTokens(context.Background(), repo, "main/deploy", tokens); err != nil {
+			t.Fatalf("ResolveBranchAndPathTokens(%s): %v", repo, err)
+		}
+	}
+	if mock.tokens["o/r"] != "gh-token" || mock.tokens["g/p"] != "gl-token" {
+		t.Errorf("tokens used = %v, want gh-token for o/r and gl-token for g/p", mock.tokens)
+	}
+}
+
+func TestParseNetrc(t *testing.T) {
+	data := `machine github.com login me password gh-secret
+machine GitLab.MyCorp.net
+  login me
+  password gl-secret
+macdef init
+  password not-a-password
+
+default login anonymous password fallback
+`
+	got := parseNetrc(data)
+	want := map[string]string{"github.com": "gh-secret", "gitlab.mycorp.net": "gl-secret"}
+	if len(got) != len(want) {
+		t.Errorf("parseNetrc = %v, want %v", got, want)
+	}
+	for machine, password := range want {
+		if got[machine] != password {
+			t.Errorf("password for %q = %q, want %q", machine, got[machine], password)
+		}
+	}
+}
+
+func TestDefaultTokenProvider(t *testing.T) {
+	home := t.TempDir()
+	netrc := "machine github.com password netrc-gh\nmachine gitlab.mycorp.net password netrc-gl\ndefault password fallback\n"
+	if err := os.WriteFile(filepath.Join(home, ".netrc"), []byte(netrc), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("HOME", home)
+
+	github := &RepositoryInfo{Type: GitHub, Owner: "o", Repo: "r"}
+	gitlabCom := &RepositoryInfo{Type: GitLab, Owner: "g", Repo: "p", BaseURL: "https://gitlab.com"}
+	gitlab := &RepositoryInfo{Type: GitLab, Owner: "g", Repo: "p", BaseURL: "https://gitlab.mycorp.net"}
+	enterprise := &RepositoryInfo{Type: GitHub, Owner: "o", Repo: "r", BaseURL: "https://ghe.example.org"}
+	unknownHost := &RepositoryInfo{Type: GitLab, Owner: "g", Repo: "p", BaseURL: "https://gitlab.example.org"}
+
+	cases := []struct {
+		name                                  string
+		githubEnv, gitlabEnv                  string
+		wantGitHub, wantGLCom, wantGL, wantUH string
+	}{
+		{"netrc only", "", "", "netrc-gh", "", "netrc-gl", ""},
+		{"env var first", "env-gh", "env-gl", "env-gh", "env-gl", "netrc-gl", ""},
+		{"env var for one host", "env-gh", "", "env-gh", "", "netrc-gl", ""},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			t.Setenv("GITHUB_TOKEN", c.githubEnv)
+			t.Setenv("GITLAB_TOKEN", c.gitlabEnv)
+			tokens := DefaultTokenProvider()
+			if got := tokens(github); got != c.wantGitHub {
+				t.Errorf("GitHub token = %q, want %q", got, c.wantGitHub)
+			}
+			if got := tokens(gitlabCom); got != c.wantGLCom {
+				t.Errorf("gitlab.com token = %q, want %q", got, c.wantGLCom)
+			}
+			if got := tokens(gitlab); got != c.wantGL {
+				t.Errorf("GitLab token = %q, want %q", got, c.wantGL)
+			}
+			if got := tokens(enterprise); got != "" {
+				t.Errorf("GitHub Enterprise token = %q, want none (GITHUB_TOKEN is for github.com)", got)
+			}
+			if got := tokens(unknownHost); got != c.wantUH {
+				t.Errorf("token for a host without netrc entry = %q, want %q", got, c.wantUH)
+			}
+		})
+	}
+}
@@ -0,0 +1,148 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+
+	"github.com/cjeanner/kustomap/internal/parser"
+	"github.com/cjeanner/kustomap/internal/repository"
+	"github.com/cjeanner/kustomap/internal/types"
+)
+
+// buildWithTokens builds the graphs served by GraphHandler. Tests replace it.
+var buildWithTokens = parser.BuildWithTokens
+
+// buildStream builds the graphs streamed by GraphStreamHandler. Tests replace it.
+var buildStream = parser.BuildStream
+
+// GraphHandler serves the dependency graph of the reference given in the "ref" query
+// parameter as JSON, building it on each request with credentials from tokens
+// (anonymous when nil). A missing or malformed reference, a path naming no branch, or a
+// local repository while they are disabled (see SetAllowLocal) is a 400; a failure of
+// the GitHub/GitLab APIs a 502.
+func GraphHandler(tokens repository.TokenProvider) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ref := strings.TrimSpace(r.URL.Query().Get("ref"))
+		if ref == "" {
+			respondError(w, http.StatusBadRequest, "ref is required")
+			return
+		}
+		if rejectLocalRef(w, ref) {
+			return
+		}
+		log.Printf("Building graph for: %s", ref)
+
+		result, err := buildWithTokens(r.Context(), ref, tokens)
+		if err != nil {
+			status := http.StatusBadGateway
+			if errors.Is(err, parser.ErrMalformedReference) || errors.Is(err, repository.ErrNoMatchingRef) || errors.Is(err, repository.ErrAmbiguousRef) {
+				status = http.StatusBadRequest
+			}
+			respondError(w, status, err.Error())
+			return
+		}
+
+		writeGraphJSON(w, r, result.Graph)
+	})
+}
+
+// GraphStreamHandler is GraphHandler over a WebSocket: it builds the graph of the "ref"
+// query parameter, sending each parser.ProgressEvent as a JSON text frame as it
+// happens. The last frame is a "complete" event holding the graph, or an "error" event,
+// after which the connection is closed. The build stops when the client goes away.
+func GraphStreamHandler(tokens repository.TokenProvider) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ref := strings.TrimSpace(r.URL.Query().Get("ref"))
+		if ref == "" {
+			respondError(w, http.StatusBadRequest, "ref is required")
+			return
+		}
+		if rejectLocalRef(w, ref) {
+			return
+		}
+
+		conn, err := websocket.Accept(w, r, nil)
+		if err != nil {
+			log.Printf("⚠️  WebSocket upgrade failed: %v", err)
+			return
+		}
+		defer conn.CloseNow()
+		log.Printf("Streaming graph build for: %s", ref)
+
+		// Nothing is read from the client: CloseRead handles its close frames and
+		// cancels ctx when the connection drops, stopping the build.
+		ctx := conn.CloseRead(r.Context())
+		for ev := range buildStream(ctx, ref, tokens) {
+			if err := wsjson.Write(ctx, conn, ev); err != nil {
+				log.Printf("⚠️  Streaming graph build for %s: %v", ref, err)
+				return
+			}
+		}
+		conn.Close(websocket.StatusNormalClosure, "")
+	})
+}
+
+// rejectLocalRef answers a 400 and returns true when ref is a local checkout or archive
+// while local repositories are disabled. References that can't be detected are left
+// to the build, which reports them.
+func rejectLocalRef(w http.ResponseWriter, ref string) bool {
+	repoInfo, err := repository.DetectRepository(ref, "")
+	if err != nil || !localDisabled(repoInfo) {
+		return false
+	}
+	respondError(w, http.StatusBadRequest, errLocalDisabled)
+	return true
+}
+
+// writeGraphJSON writes graph as JSON with an ETag: the hash of its serialization with
+// sorted elements, so an unchanged graph always gets the same one. A request whose
+// If-None-Match holds that ETag gets a 304 without body. A graph failing
+// Graph.Validate, which the frontend can't render, is a 500.
+func writeGraphJSON(w http.ResponseWriter, r *http.Request, graph *types.Graph) {
+	if errs := graph.Validate(); len(errs) > 0 {
+		err := errors.Join(errs...)
+		log.Printf("⚠️  Not serving invalid graph %s: %v", graph.ID, err)
+		respondError(w, http.StatusInternalServerError, fmt.Sprintf("invalid graph: %v", err))
+		return
+	}
+	sorted := *graph
+	sorted.Elements = append([]types.Element(nil), graph.Elements...)
+	sorted.Sort()
+	body, err := json.Marshal(&sorted)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, fmt.Sprintf("failed to encode graph: %v", err))
+		return
+	}
+	body = append(body, '\n')
+
+	sum := sha256.Sum256(body)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+	w.Header().Set("ETag", etag)
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
+}
+
+// etagMatches reports whether an If-None-Match header value lists etag (or is "*").
+// Weak validators ("W/...") match their strong form.
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == etag || candidate == "*" {
+			return true
+		}
+	}
+	return false
+}
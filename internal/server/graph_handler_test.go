@@ -0,0 +1,195 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+
+	"github.com/cjeanner/kustomap/internal/parser"
+	"github.com/cjeanner/kustomap/internal/repository"
+	"github.com/cjeanner/kustomap/internal/types"
+)
+
+func TestGraphHandler(t *testing.T) {
+	graph := &types.Graph{Elements: []types.Element{
+		{Group: "nodes", Data: types.ElementData{ID: "github:org/app/overlay@main", Type: "overlay"}},
+	}}
+	upstreamErr := errors.New("failed to fetch initial kustomization: 503 Service Unavailable")
+
+	cases := []struct {
+		name       string
+		query      string
+		build      func(context.Context, string, repository.TokenProvider) (*parser.BuildResult, error)
+		wantStatus int
+	}{
+		{
+			name:  "success",
+			query: "?ref=https://github.com/org/app/tree/main/overlay",
+			build: func(context.Context, string, repository.TokenProvider) (*parser.BuildResult, error) {
+				return &parser.BuildResult{Graph: graph}, nil
+			},
+			wantStatus: http.StatusOK,
+		},
+		{name: "missing ref", query: "", wantStatus: http.StatusBadRequest},
+		{name: "local path", query: "?ref=/etc/kustomap", wantStatus: http.StatusBadRequest},
+		{name: "file URL", query: "?ref=" + url.QueryEscape("file:///etc/kustomap"), wantStatus: http.StatusBadRequest},
+		{name: "archive", query: "?ref=/x.tar.gz", wantStatus: http.StatusBadRequest},
+		{name: "malformed ref", query: "?ref=" + "%3A%2F%2Fnot-a-url", build: parser.BuildWithTokens, wantStatus: http.StatusBadRequest},
+		{
+			name:  "no matching branch",
+			query: "?ref=https://github.com/org/app/tree/gone/overlay",
+			build: func(context.Context, string, repository.TokenProvider) (*parser.BuildResult, error) {
+				return nil, fmt.Errorf("failed to resolve branch: %w in path: gone/overlay", repository.ErrNoMatchingRef)
+			},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:  "upstream failure",
+			query: "?ref=https://github.com/org/app/tree/main/overlay",
+			build: func(context.Context, string, repository.TokenProvider) (*parser.BuildResult, error) {
+				return nil, upstreamErr
+			},
+			wantStatus: http.StatusBadGateway,
+		},
+		{
+			name:  "invalid graph",
+			query: "?ref=https://github.com/org/app/tree/main/overlay",
+			build: func(context.Context, string, repository.TokenProvider) (*parser.BuildResult, error) {
+				dangling := types.Element{Group: "edges", Data: types.ElementData{
+					ID: "edge", Source: "github:org/app/overlay@main", Target: "github:org/app/base@main",
+				}}
+				return &parser.BuildResult{Graph: &types.Graph{Elements: append(append([]types.Element(nil), graph.Elements...), dangling)}}, nil
+			},
+			wantStatus: http.StatusInternalServerError,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			defer func(orig func(context.Context, string, repository.TokenProvider) (*parser.BuildResult, error)) {
+				buildWithTokens = orig
+			}(buildWithTokens)
+			buildWithTokens = func(ctx context.Context, ref string, tokens repository.TokenProvider) (*parser.BuildResult, error) {
+				if c.build == nil {
+					t.Fatalf("graph built for %q", ref)
+				}
+				return c.build(ctx, ref, tokens)
+			}
+
+			rec := httptest.NewRecorder()
+			GraphHandler(nil).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/graph"+c.query, nil))
+
+			if rec.Code != c.wantStatus {
+				t.Errorf("status = %d, want %d (body %s)", rec.Code, c.wantStatus, rec.Body)
+			}
+			if got := rec.Header().Get("Content-Type"); got != "application/json" {
+				t.Errorf("Content-Type = %q, want application/json", got)
+			}
+			if c.wantStatus != http.StatusOK {
+				var resp AnalyzeResponse
+				if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || resp.Status != "error" || resp.Message == "" {
+					t.Errorf("error body = %s, want an error response with a message", rec.Body)
+				}
+				return
+			}
+			var got types.Graph
+			if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+				t.Fatalf("Unmarshal graph: %v", err)
+			}
+			if len(got.Elements) != 1 || got.Elements[0].Data.ID != "github:org/app/overlay@main" {
+				t.Errorf("graph = %+v, want the built graph", got)
+			}
+			if rec.Header().Get("ETag") == "" {
+				t.Error("graph response without ETag")
+			}
+		})
+	}
+}
+
+func TestServer_GraphRoute(t *testing.T) {
+	r := New(nil, fstestMapFS{})
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/graph", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("GET /api/v1/graph without ref status = %d, want 400", rec.Code)
+	}
+}
+
+func TestGraphStreamHandler(t *testing.T) {
+	graph := &types.Graph{Elements: []types.Element{
+		{Group: "nodes", Data: types.ElementData{ID: "github:org/app/overlay@main", Type: "overlay"}},
+	}}
+	defer func(orig func(context.Context, string, repository.TokenProvider) <-chan parser.ProgressEvent) {
+		buildStream = orig
+	}(buildStream)
+	buildStream = func(_ context.Context, ref string, _ repository.TokenProvider) <-chan parser.ProgressEvent {
+		events := make(chan parser.ProgressEvent, 2)
+		events <- parser.ProgressEvent{Type: parser.EventNodeAdded, NodeID: "github:org/app/overlay@main", NodeType: "overlay"}
+		events <- parser.ProgressEvent{Type: parser.EventComplete, Graph: graph}
+		close(events)
+		return events
+	}
+
+	srv := httptest.NewServer(New(nil, fstestMapFS{}))
+	defer srv.Close()
+	wsURL := "ws" + strings.TrimPrefix(srv.URL, "http") + "/api/v1/graph/stream?ref=" + url.QueryEscape("https://github.com/org/app/tree/main/overlay")
+
+	ctx := context.Background()
+	conn, _, err := websocket.Dial(ctx, wsURL, nil)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer conn.CloseNow()
+
+	var events []parser.ProgressEvent
+	for {
+		var ev parser.ProgressEvent
+		if err := wsjson.Read(ctx, conn, &ev); err != nil {
+			if websocket.CloseStatus(err) != websocket.StatusNormalClosure {
+				t.Fatalf("Read: %v", err)
+			}
+			break
+		}
+		events = append(events, ev)
+	}
+	if len(events) != 2 || events[0].Type != parser.EventNodeAdded || events[1].Type != parser.EventComplete {
+		t.Fatalf("events = %+v, want node-added then complete", events)
+	}
+	if g := events[1].Graph; g == nil || len(g.Elements) != 1 || g.Elements[0].Data.ID != "github:org/app/overlay@main" {
+		t.Errorf("complete graph = %+v, want the built graph", events[1].Graph)
+	}
+
+	rec := httptest.NewRecorder()
+	GraphStreamHandler(nil).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/graph/stream", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("stream without ref status = %d, want 400", rec.Code)
+	}
+}
+
+func TestGraphStreamHandler_LocalDisabled(t *testing.T) {
+	defer func(orig func(context.Context, string, repository.TokenProvider) <-chan parser.ProgressEvent) {
+		buildStream = orig
+	}(buildStream)
+	buildStream = func(_ context.Context, ref string, _ repository.TokenProvider) <-chan parser.ProgressEvent {
+		t.Errorf("graph streamed for %q", ref)
+		events := make(chan parser.ProgressEvent)
+		close(events)
+		return events
+	}
+
+	for _, ref := range []string{"/etc/kustomap", "file:///etc/kustomap", "/x.tar.gz"} {
+		rec := httptest.NewRecorder()
+		GraphStreamHandler(nil).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/graph/stream?ref="+url.QueryEscape(ref), nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("stream of %s status = %d, want 400", ref, rec.Code)
+		}
+	}
+}
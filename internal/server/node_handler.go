@@ -0,0 +1,100 @@
+package server
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/cjeanner/kustomap/internal/fetcher"
+	"github.com/cjeanner/kustomap/internal/repository"
+	"github.com/cjeanner/kustomap/internal/storage"
+	"github.com/cjeanner/kustomap/internal/types"
+)
+
+// newNodeFetcher creates the fetchers NodeDetailsHandler reads kustomizations with. Tests replace it.
+var newNodeFetcher = fetcher.NewFetcher
+
+// NodeDetailsHandler serves the NodeDetails of the {nodeID} node of graph {graphID},
+// with its parents and children. When the graph doesn't hold the node's kustomization
+// file, it is fetched from the node's repository with credentials from tokens
+// (anonymous when nil). Unknown graphs and nodes are a 404.
+func NodeDetailsHandler(store storage.Storage, tokens repository.TokenProvider) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		graphID := chi.URLParam(r, "graphID")
+		nodeID := chi.URLParam(r, "nodeID")
+
+		decodedNodeID, err := url.QueryUnescape(nodeID)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid node ID")
+			return
+		}
+		log.Printf("Retrieving node: %s from graph: %s", nodeID, graphID)
+
+		nodeDetails, err := store.GetNode(graphID, decodedNodeID)
+		if err != nil {
+			respondError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		if nodeDetails.RawContent == "" {
+			if graph, err := store.GetGraph(graphID); err == nil {
+				nodeDetails.RawContent = fetchNodeContent(graph, decodedNodeID, tokens)
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(nodeDetails)
+	})
+}
+
+// fetchNodeContent fetches the kustomization file of a remote kustomization node,
+// returning "" for other nodes or when it can't be fetched.
+func fetchNodeContent(graph *types.Graph, nodeID string, tokens repository.TokenProvider) string {
+	var data *types.ElementData
+	for i := range graph.Elements {
+		if elem := &graph.Elements[i]; elem.Group == "nodes" && elem.Data.ID == nodeID {
+			data = &elem.Data
+			break
+		}
+	}
+	if data == nil || data.Owner == "" {
+		return ""
+	}
+	switch data.Type {
+	case "overlay", "resource", "component":
+	default:
+		return ""
+	}
+	// Only remote repositories: the server doesn't read local paths on behalf of a client
+	prefix, _, _ := strings.Cut(nodeID, ":")
+	repoType, _, _ := strings.Cut(prefix, "@")
+	if repoType != string(repository.GitHub) && repoType != string(repository.GitLab) {
+		return ""
+	}
+
+	repoInfo := &repository.RepositoryInfo{
+		Type:    repository.RepositoryType(repoType),
+		Owner:   data.Owner,
+		Repo:    data.Repo,
+		Ref:     data.Ref,
+		BaseURL: graph.BaseURLs[nodeID],
+	}
+	var token string
+	if tokens != nil {
+		token = tokens(repoInfo)
+	}
+	f, err := newNodeFetcher(repoInfo, token)
+	if err != nil {
+		log.Printf("Warning: failed to create fetcher for %s: %v", nodeID, err)
+		return ""
+	}
+	content, err := f.FindKustomizationInPath(data.Path)
+	if err != nil {
+		log.Printf("Warning: failed to fetch kustomization of %s: %v", nodeID, err)
+		return ""
+	}
+	return content
+}
@@ -0,0 +1,106 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/cjeanner/kustomap/internal/fetcher"
+	"github.com/cjeanner/kustomap/internal/repository"
+	"github.com/cjeanner/kustomap/internal/storage"
+	"github.com/cjeanner/kustomap/internal/types"
+)
+
+// stubFetcher serves kustomization files by path.
+type stubFetcher map[string]string
+
+func (f stubFetcher) FetchFile(string) ([]byte, error) { return nil, errors.New("not implemented") }
+func (f stubFetcher) ListFiles() ([]string, error)     { return nil, nil }
+func (f stubFetcher) FindKustomizationInPath(path string) (string, error) {
+	if content, ok := f[path]; ok {
+		return content, nil
+	}
+	return "", fetcher.ErrKustomizationNotFound
+}
+
+func TestNodeDetailsHandler(t *testing.T) {
+	const (
+		overlayID = "github:org/app/overlay@main"
+		baseID    = "github:org/app/base@main"
+	)
+	store := storage.NewMemoryStorage()
+	store.SaveGraph(&types.Graph{ID: "g1", Elements: []types.Element{
+		{Group: "nodes", Data: types.ElementData{ID: overlayID, Label: "overlay", Type: "overlay", Path: "overlay", RawContent: "resources:\n  - ../base\n", Owner: "org", Repo: "app", Ref: "main"}},
+		{Group: "nodes", Data: types.ElementData{ID: baseID, Label: "base", Type: "resource", Path: "base", Owner: "org", Repo: "app", Ref: "main"}},
+		{Group: "edges", Data: types.ElementData{ID: types.EdgeID(overlayID, "resource", baseID), Source: overlayID, Target: baseID, EdgeType: "resource"}},
+	}})
+
+	var fetchedRepo *repository.RepositoryInfo
+	fetchedToken := "unset"
+	defer func(orig func(*repository.RepositoryInfo, string) (fetcher.Fetcher, error)) { newNodeFetcher = orig }(newNodeFetcher)
+	newNodeFetcher = func(repo *repository.RepositoryInfo, token string) (fetcher.Fetcher, error) {
+		fetchedRepo, fetchedToken = repo, token
+		return stubFetcher{"base": "# shared base\nresources:\n  - deploy.yaml\n"}, nil
+	}
+
+	cases := []struct {
+		name         string
+		graphID      string
+		nodeID       string
+		wantStatus   int
+		wantRaw      string
+		wantParents  []string
+		wantChildren []string
+	}{
+		{"stored content", "g1", overlayID, http.StatusOK, "resources:\n  - ../base\n", nil, []string{baseID}},
+		{"fetched content", "g1", baseID, http.StatusOK, "# shared base\nresources:\n  - deploy.yaml\n", []string{overlayID}, nil},
+		{"unknown node", "g1", "github:org/app/gone@main", http.StatusNotFound, "", nil, nil},
+		{"unknown graph", "g2", overlayID, http.StatusNotFound, "", nil, nil},
+	}
+	r := New(store, fstestMapFS{})
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/node/"+c.graphID+"/"+url.QueryEscape(c.nodeID), nil))
+			if rec.Code != c.wantStatus {
+				t.Fatalf("status = %d, want %d (body %s)", rec.Code, c.wantStatus, rec.Body)
+			}
+			if c.wantStatus != http.StatusOK {
+				return
+			}
+
+			// Contract keys of the details endpoint (see TestNodeDetails_JSONShape)
+			var raw map[string]interface{}
+			if err := json.Unmarshal(rec.Body.Bytes(), &raw); err != nil {
+				t.Fatalf("Unmarshal: %v", err)
+			}
+			for _, key := range []string{"id", "label", "type", "path", "parents", "children", "rawContent"} {
+				if _, ok := raw[key]; !ok {
+					t.Errorf("NodeDetails JSON missing key %q: %s", key, rec.Body)
+				}
+			}
+
+			var details types.NodeDetails
+			if err := json.Unmarshal(rec.Body.Bytes(), &details); err != nil {
+				t.Fatalf("Unmarshal NodeDetails: %v", err)
+			}
+			if details.ID != c.nodeID || details.RawContent != c.wantRaw {
+				t.Errorf("details = ID %q RawContent %q, want %q %q", details.ID, details.RawContent, c.nodeID, c.wantRaw)
+			}
+			if len(details.Parents) != len(c.wantParents) || len(details.Children) != len(c.wantChildren) ||
+				(len(c.wantParents) > 0 && details.Parents[0] != c.wantParents[0]) ||
+				(len(c.wantChildren) > 0 && details.Children[0] != c.wantChildren[0]) {
+				t.Errorf("Parents %v Children %v, want %v %v", details.Parents, details.Children, c.wantParents, c.wantChildren)
+			}
+		})
+	}
+	if fetchedRepo == nil || fetchedRepo.Type != repository.GitHub || fetchedRepo.Owner != "org" || fetchedRepo.Repo != "app" || fetchedRepo.Ref != "main" {
+		t.Errorf("fetched from %+v, want github org/app@main", fetchedRepo)
+	}
+	if fetchedToken != "" {
+		t.Errorf("fetched with token %q, want an anonymous fetch", fetchedToken)
+	}
+}
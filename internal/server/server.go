@@ -2,11 +2,13 @@ package server
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/fs"
 	"log"
 	"net/http"
 	"net/url"
+	"path"
 	"path/filepath"
 	"strings"
 	"time"
@@ -28,6 +30,16 @@ type AnalyzeRequest struct {
 	URL         string `json:"url"`
 	GitHubToken string `json:"github_token"`
 	GitLabToken string `json:"gitlab_token"`
+	// FollowForkParent resolves against the fork's parent repo when the fork lacks the branch
+	FollowForkParent bool `json:"follow_fork_parent,omitempty"`
+	// DisambiguateLabels appends a repo hint to labels shared by nodes from different repos
+	DisambiguateLabels bool `json:"disambiguate_labels,omitempty"`
+	// MaxDepth stops following references this many levels below the URL; unlimited when unset
+	MaxDepth *int `json:"max_depth,omitempty"`
+	// Strict fails the analysis when any reference can't be resolved
+	Strict bool `json:"strict,omitempty"`
+	// Exclude lists glob patterns ("owner/repo/path") of references not to follow
+	Exclude []string `json:"exclude,omitempty"`
 }
 
 // AnalyzeResponse is the JSON response for analyze and error responses.
@@ -37,6 +49,24 @@ type AnalyzeResponse struct {
 	Message string `json:"message,omitempty"`
 }
 
+// allowLocal lets /analyze read local checkouts and archives (file:// URLs and absolute paths).
+// Off by default: it exposes the server's filesystem to API clients.
+var allowLocal bool
+
+// SetAllowLocal enables or disables analyzing local repositories.
+func SetAllowLocal(allow bool) {
+	allowLocal = allow
+}
+
+// errLocalDisabled is the message of the 400 refusing a local repository.
+const errLocalDisabled = "local repositories are disabled (start the server with -allow-local)"
+
+// localDisabled reports whether repoInfo is a local checkout or archive while local
+// repositories are disabled: reading it would expose the server's filesystem.
+func localDisabled(repoInfo *repository.RepositoryInfo) bool {
+	return (repoInfo.Type == repository.Local || repoInfo.Type == repository.Archive) && !allowLocal
+}
+
 // New builds a chi router with API and static file routes.
 // webRoot is the embedded web filesystem (e.g. fs.Sub(embedFS, "web")).
 func New(store storage.Storage, webRoot fs.FS) *chi.Mux {
@@ -48,7 +78,9 @@ func New(store storage.Storage, webRoot fs.FS) *chi.Mux {
 	r.Route("/api/v1", func(r chi.Router) {
 		r.Post("/analyze", handleAnalyze(store))
 		r.Get("/graph/{id}", handleGetGraph(store))
-		r.Get("/node/{graphID}/{nodeID}", handleGetNode(store))
+		r.Method(http.MethodGet, "/graph", GraphHandler(nil))
+		r.Method(http.MethodGet, "/graph/stream", GraphStreamHandler(nil))
+		r.Method(http.MethodGet, "/node/{graphID}/{nodeID}", NodeDetailsHandler(store, nil))
 		r.Post("/node/{graphID}/{nodeID}/build", handleBuildNode(store))
 	})
 
@@ -101,6 +133,12 @@ func handleAnalyze(store storage.Storage) http.HandlerFunc {
 			http.Error(w, "URL is required", http.StatusBadRequest)
 			return
 		}
+		for _, pattern := range req.Exclude {
+			if _, err := path.Match(pattern, ""); err != nil {
+				http.Error(w, fmt.Sprintf("Invalid exclude pattern %q", pattern), http.StatusBadRequest)
+				return
+			}
+		}
 
 		log.Printf("Analyzing repository: %s", req.URL)
 
@@ -110,6 +148,10 @@ func handleAnalyze(store storage.Storage) http.HandlerFunc {
 			return
 		}
 		log.Printf("✅ Detected: %s", repoInfo.String())
+		if localDisabled(repoInfo) {
+			respondError(w, http.StatusBadRequest, errLocalDisabled)
+			return
+		}
 
 		var token string
 		switch repoInfo.Type {
@@ -119,9 +161,10 @@ func handleAnalyze(store storage.Storage) http.HandlerFunc {
 			token = req.GitLabToken
 		}
 
+		repoInfo.FollowForkParent = req.FollowForkParent
 		if repoInfo.AmbiguousPath != "" {
 			log.Printf("Resolving ambiguous path: %s", repoInfo.AmbiguousPath)
-			branch, path, err := repository.ResolveBranchAndPath(repoInfo, repoInfo.AmbiguousPath, token)
+			branch, path, err := repository.ResolveBranchAndPathContext(r.Context(), repoInfo, repoInfo.AmbiguousPath, token)
 			if err != nil {
 				respondError(w, http.StatusBadRequest, fmt.Sprintf("failed to resolve branch: %v", err))
 				return
@@ -130,10 +173,18 @@ func handleAnalyze(store storage.Storage) http.HandlerFunc {
 			repoInfo.Path = path
 			log.Printf("✅ Resolved: branch=%s, path=%s", branch, path)
 		}
+		if repoInfo.Ref == "" {
+			branch, err := repository.ResolveDefaultBranchContext(r.Context(), repoInfo, token)
+			if err != nil {
+				respondError(w, http.StatusBadRequest, fmt.Sprintf("failed to resolve default branch: %v", err))
+				return
+			}
+			log.Printf("✅ Using default branch: %s", branch)
+		}
 
 		searchPath := repoInfo.Path
 
-		f, err := fetcher.NewFetcher(repoInfo, token)
+		f, err := fetcher.NewFetcherContext(r.Context(), repoInfo, token)
 		if err != nil {
 			respondError(w, http.StatusInternalServerError, err.Error())
 			return
@@ -141,11 +192,23 @@ func handleAnalyze(store storage.Storage) http.HandlerFunc {
 		log.Printf("✅ Created fetcher")
 
 		p := parser.NewParser(f, repoInfo)
+		p.SetContext(r.Context())
 		p.SetToken(repository.GitHub, req.GitHubToken)
 		p.SetToken(repository.GitLab, req.GitLabToken)
+		p.DisambiguateLabels = req.DisambiguateLabels
+		if req.MaxDepth != nil {
+			p.MaxDepth = *req.MaxDepth
+		}
+		p.StrictMode = req.Strict
+		p.Exclude = req.Exclude
 
 		graph, err := p.Parse(searchPath)
 		if err != nil {
+			var unresolved *parser.UnresolvedReferenceError
+			if errors.As(err, &unresolved) {
+				respondError(w, http.StatusUnprocessableEntity, err.Error())
+				return
+			}
 			respondError(w, http.StatusInternalServerError, err.Error())
 			return
 		}
@@ -185,38 +248,32 @@ func handleGetGraph(store storage.Storage) http.HandlerFunc {
 			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 			w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=graph-%s.mmd", graphID))
 			w.Write([]byte(mermaidCode))
+		case "cypher":
+			cypher := graph.ToCypher()
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=graph-%s.cypher", graphID))
+			w.Write([]byte(cypher))
+		case "plantuml":
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=graph-%s.puml", graphID))
+			w.Write([]byte(graph.ToPlantUML()))
+		case "graphml":
+			w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+			w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=graph-%s.graphml", graphID))
+			if err := graph.ToGraphML(w); err != nil {
+				log.Printf("Failed to write GraphML for graph %s: %v", graphID, err)
+			}
+		case "stats":
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(graph.Stats())
 		case "json":
 			fallthrough
 		default:
-			w.Header().Set("Content-Type", "application/json")
-			json.NewEncoder(w).Encode(graph)
+			writeGraphJSON(w, r, graph)
 		}
 	}
 }
 
-func handleGetNode(store storage.Storage) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		graphID := chi.URLParam(r, "graphID")
-		nodeID := chi.URLParam(r, "nodeID")
-
-		decodedNodeID, err := url.QueryUnescape(nodeID)
-		if err != nil {
-			respondError(w, http.StatusBadRequest, "Invalid node ID")
-			return
-		}
-		log.Printf("Retrieving node: %s from graph: %s", nodeID, graphID)
-
-		nodeDetails, err := store.GetNode(graphID, decodedNodeID)
-		if err != nil {
-			respondError(w, http.StatusNotFound, err.Error())
-			return
-		}
-
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(nodeDetails)
-	}
-}
-
 // BuildRequest is the optional JSON body for POST /api/v1/node/{graphID}/{nodeID}/build.
 type BuildRequest struct {
 	GitHubToken string `json:"github_token"`
@@ -249,8 +306,8 @@ func handleBuildNode(store storage.Storage) http.HandlerFunc {
 			respondError(w, http.StatusBadRequest, "Build is not available for component nodes; use an overlay or resource node")
 			return
 		}
-		if nodeDetails.Type == "error" {
-			respondError(w, http.StatusBadRequest, "Build is not available for error nodes")
+		if nodeDetails.Type == "error" || nodeDetails.Type == "missing" {
+			respondError(w, http.StatusBadRequest, "Build is not available for error or missing nodes")
 			return
 		}
 
@@ -1,6 +1,7 @@
 package server
 
 import (
+	"encoding/json"
 	"io/fs"
 	"net/http"
 	"net/http/httptest"
@@ -52,6 +53,72 @@ func TestServer_GetGraph_Found(t *testing.T) {
 	}
 }
 
+func TestServer_GetGraph_ETag(t *testing.T) {
+	nodes := []types.Element{
+		{Group: "nodes", Data: types.ElementData{ID: "a", Type: "overlay"}},
+		{Group: "nodes", Data: types.ElementData{ID: "b", Type: "resource"}},
+		{Group: "edges", Data: types.ElementData{ID: types.EdgeID("a", "resource", "b"), Source: "a", Target: "b", EdgeType: "resource"}},
+	}
+	store := storage.NewMemoryStorage()
+	store.SaveGraph(&types.Graph{ID: "g1", Created: "2025-01-01", Elements: nodes})
+	r := New(store, fstestMapFS{})
+
+	get := func(path, ifNoneMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		return rec
+	}
+
+	first := get("/api/v1/graph/g1", "")
+	etag := first.Header().Get("ETag")
+	if first.Code != http.StatusOK || etag == "" || first.Body.Len() == 0 {
+		t.Fatalf("GET status = %d ETag %q body %d bytes, want 200 with an ETag and a body", first.Code, etag, first.Body.Len())
+	}
+	if again := get("/api/v1/graph/g1", "").Header().Get("ETag"); again != etag {
+		t.Errorf("ETag changed between requests: %q then %q", etag, again)
+	}
+	// The same graph with its elements in another order has the same ETag
+	shuffled := httptest.NewRecorder()
+	writeGraphJSON(shuffled, httptest.NewRequest(http.MethodGet, "/", nil), &types.Graph{ID: "g1", Created: "2025-01-01", Elements: []types.Element{nodes[2], nodes[1], nodes[0]}})
+	if got := shuffled.Header().Get("ETag"); got != etag {
+		t.Errorf("ETag of the reordered graph = %q, want %q", got, etag)
+	}
+
+	notModified := get("/api/v1/graph/g1", etag)
+	if notModified.Code != http.StatusNotModified || notModified.Body.Len() != 0 {
+		t.Errorf("GET with If-None-Match = status %d, %d bytes; want 304 without body", notModified.Code, notModified.Body.Len())
+	}
+	if rec := get("/api/v1/graph/g1", `"other", W/`+etag); rec.Code != http.StatusNotModified {
+		t.Errorf("GET with If-None-Match listing a weak ETag = %d, want 304", rec.Code)
+	}
+	if rec := get("/api/v1/graph/g1", `"stale"`); rec.Code != http.StatusOK || rec.Body.Len() == 0 {
+		t.Errorf("GET with a stale If-None-Match = %d, want 200 with body", rec.Code)
+	}
+}
+
+func TestServer_GetGraph_Stats(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	store.SaveGraph(&types.Graph{ID: "g1", Elements: []types.Element{
+		{Group: "nodes", Data: types.ElementData{ID: "a", Type: "overlay"}},
+		{Group: "nodes", Data: types.ElementData{ID: "b", Type: "resource"}},
+		{Group: "edges", Data: types.ElementData{ID: types.EdgeID("a", "resource", "b"), Source: "a", Target: "b", EdgeType: "resource"}},
+	}})
+	rec := httptest.NewRecorder()
+	New(store, fstestMapFS{}).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/graph/g1?format=stats", nil))
+
+	var stats types.GraphStats
+	if err := json.Unmarshal(rec.Body.Bytes(), &stats); err != nil {
+		t.Fatalf("Unmarshal stats: %v (body %s)", err, rec.Body)
+	}
+	if stats.Edges != 1 || stats.MaxDepth != 1 || stats.NodesByType["overlay"] != 1 || stats.NodesByType["resource"] != 1 {
+		t.Errorf("stats = %+v, want 1 overlay, 1 resource, 1 edge, depth 1", stats)
+	}
+}
+
 // fstestMapFS is a minimal fs.FS for tests (avoids importing testing/fstest in production).
 type fstestMapFS struct{}
 
@@ -16,14 +16,16 @@ type Storage interface {
 
 // MemoryStorage stores graphs in memory
 type MemoryStorage struct {
-	graphs map[string]*types.Graph
-	mu     sync.RWMutex
+	graphs  map[string]*types.Graph
+	indexes map[string]*types.GraphIndex // built on save, for GetNode
+	mu      sync.RWMutex
 }
 
 // NewMemoryStorage creates a new in-memory storage
 func NewMemoryStorage() *MemoryStorage {
 	return &MemoryStorage{
-		graphs: make(map[string]*types.Graph),
+		graphs:  make(map[string]*types.Graph),
+		indexes: make(map[string]*types.GraphIndex),
 	}
 }
 
@@ -37,6 +39,7 @@ func (s *MemoryStorage) SaveGraph(graph *types.Graph) error {
 	}
 
 	s.graphs[graph.ID] = graph
+	s.indexes[graph.ID] = graph.Index()
 	return nil
 }
 
@@ -58,47 +61,28 @@ func (s *MemoryStorage) GetNode(graphID, nodeID string) (*types.NodeDetails, err
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	graph, exists := s.graphs[graphID]
+	index, exists := s.indexes[graphID]
 	if !exists {
 		return nil, fmt.Errorf("graph not found: %s", graphID)
 	}
 
-	// Find the node
-	var nodeData *types.ElementData
-	for _, elem := range graph.Elements {
-		if elem.Group == "nodes" && elem.Data.ID == nodeID {
-			nodeData = &elem.Data
-			break
-		}
-	}
-
-	if nodeData == nil {
+	node := index.Node(nodeID)
+	if node == nil {
 		return nil, fmt.Errorf("node not found: %s", nodeID)
 	}
+	nodeData := &node.Data
 
 	// Build NodeDetails with relationships
 	details := &types.NodeDetails{
-		ID:       nodeData.ID,
-		Label:    nodeData.Label,
-		Type:     nodeData.Type,
-		Path:     nodeData.Path,
-		Content:  nodeData.Content,
-		Parents:  []string{},
-		Children: []string{},
-	}
-
-	// Find parent and child nodes
-	for _, elem := range graph.Elements {
-		if elem.Group == "edges" {
-			if elem.Data.Target == nodeID {
-				// This edge points TO our node (parent relationship)
-				details.Parents = append(details.Parents, elem.Data.Source)
-			}
-			if elem.Data.Source == nodeID {
-				// This edge points FROM our node (child relationship)
-				details.Children = append(details.Children, elem.Data.Target)
-			}
-		}
+		ID:         nodeData.ID,
+		Label:      nodeData.Label,
+		Type:       nodeData.Type,
+		Path:       nodeData.Path,
+		Content:    nodeData.Content,
+		RawContent: nodeData.RawContent,
+		Patches:    nodeData.Patches,
+		Parents:    append([]string{}, index.Parents(nodeID)...),
+		Children:   append([]string{}, index.Children(nodeID)...),
 	}
 
 	return details, nil
@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"reflect"
 	"testing"
 
 	"github.com/cjeanner/kustomap/internal/types"
@@ -47,11 +48,15 @@ func TestMemoryStorage_GetGraph_NotFound(t *testing.T) {
 
 func TestMemoryStorage_GetNode(t *testing.T) {
 	s := NewMemoryStorage()
+	patches := []types.PatchInfo{
+		{Field: "patchesJson6902", Target: &types.PatchTarget{Kind: "Deployment", Name: "web"}, Path: "overlay/image.json"},
+		{Field: "patches", Inline: true},
+	}
 	g := &types.Graph{
 		ID:      "g1",
 		Created: "2025-01-01",
 		Elements: []types.Element{
-			{Group: "nodes", Data: types.ElementData{ID: "n1", Label: "overlay", Type: "overlay", Path: "overlay"}},
+			{Group: "nodes", Data: types.ElementData{ID: "n1", Label: "overlay", Type: "overlay", Path: "overlay", RawContent: "resources:\n  - ../base\n", Patches: patches}},
 			{Group: "nodes", Data: types.ElementData{ID: "n2", Label: "base", Type: "resource", Path: "base"}},
 			{Group: "edges", Data: types.ElementData{Source: "n1", Target: "n2", EdgeType: "resource"}},
 		},
@@ -67,6 +72,12 @@ func TestMemoryStorage_GetNode(t *testing.T) {
 	if details.ID != "n1" || details.Label != "overlay" {
 		t.Errorf("GetNode = ID %q Label %q, want n1 overlay", details.ID, details.Label)
 	}
+	if details.RawContent != "resources:\n  - ../base\n" {
+		t.Errorf("RawContent = %q, want the node's raw kustomization", details.RawContent)
+	}
+	if !reflect.DeepEqual(details.Patches, patches) {
+		t.Errorf("Patches = %+v, want the node's patches %+v", details.Patches, patches)
+	}
 	if len(details.Children) != 1 || details.Children[0] != "n2" {
 		t.Errorf("Children = %v, want [n2]", details.Children)
 	}
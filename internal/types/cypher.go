@@ -0,0 +1,79 @@
+package types
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ToCypher converts the graph to Neo4j Cypher CREATE statements:
+// one (n:Node {...}) per node and one (a)-[:DEPENDS {...}]->(b) per edge, as a single
+// query so node variables stay in scope for the edges. Properties come from ElementData.
+func (g *Graph) ToCypher() string {
+	if g == nil {
+		return ""
+	}
+
+	nodeIDToVar := make(map[string]string)
+	var b strings.Builder
+	for i := range g.Elements {
+		e := &g.Elements[i]
+		if e.Group != "nodes" {
+			continue
+		}
+		if _, ok := nodeIDToVar[e.Data.ID]; ok {
+			continue
+		}
+		v := fmt.Sprintf("n%d", len(nodeIDToVar))
+		nodeIDToVar[e.Data.ID] = v
+		b.WriteString(fmt.Sprintf("CREATE (%s:Node {%s})\n", v, cypherProps(
+			"id", e.Data.ID,
+			"label", e.Data.Label,
+			"type", e.Data.Type,
+			"path", e.Data.Path,
+		)))
+	}
+
+	for i := range g.Elements {
+		e := &g.Elements[i]
+		if e.Group != "edges" {
+			continue
+		}
+		src := nodeIDToVar[e.Data.Source]
+		tgt := nodeIDToVar[e.Data.Target]
+		if src == "" || tgt == "" {
+			continue
+		}
+		b.WriteString(fmt.Sprintf("CREATE (%s)-[:DEPENDS {%s}]->(%s)\n", src, cypherProps(
+			"id", e.Data.ID,
+			"via", e.Data.EdgeType,
+		), tgt))
+	}
+
+	out := strings.TrimSuffix(b.String(), "\n")
+	if out == "" {
+		return ""
+	}
+	return out + ";\n"
+}
+
+// cypherProps renders key/value pairs as a Cypher property map body, skipping empty values.
+func cypherProps(kv ...string) string {
+	var props []string
+	for i := 0; i+1 < len(kv); i += 2 {
+		if kv[i+1] == "" {
+			continue
+		}
+		props = append(props, fmt.Sprintf("%s: '%s'", kv[i], escapeCypherString(kv[i+1])))
+	}
+	return strings.Join(props, ", ")
+}
+
+// escapeCypherString escapes backslashes, single quotes and newlines for a '...' Cypher string.
+func escapeCypherString(s string) string {
+	return strings.NewReplacer(
+		`\`, `\\`,
+		`'`, `\'`,
+		"\n", `\n`,
+		"\r", `\r`,
+	).Replace(s)
+}
@@ -0,0 +1,71 @@
+package types
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestToCypher_NilOrEmpty(t *testing.T) {
+	var nilGraph *Graph
+	if got := nilGraph.ToCypher(); got != "" {
+		t.Errorf("ToCypher() of nil graph = %q, want empty", got)
+	}
+	if got := (&Graph{}).ToCypher(); got != "" {
+		t.Errorf("ToCypher() of empty graph = %q, want empty", got)
+	}
+}
+
+func TestToCypher_NodesAndEdges(t *testing.T) {
+	g := &Graph{
+		Elements: []Element{
+			{Group: "nodes", Data: ElementData{ID: "github:o/r/overlay@main", Label: "overlay", Type: "overlay", Path: "overlay"}},
+			{Group: "nodes", Data: ElementData{ID: "github:o/r/base@main", Label: "base", Type: "resource", Path: "base"}},
+			{Group: "nodes", Data: ElementData{ID: "github:o/r/comp@main", Label: "it's", Type: "component", Path: "comp"}},
+			{Group: "edges", Data: ElementData{ID: "e1", Source: "github:o/r/overlay@main", Target: "github:o/r/base@main", EdgeType: "resource"}},
+			{Group: "edges", Data: ElementData{ID: "e2", Source: "github:o/r/overlay@main", Target: "github:o/r/comp@main", EdgeType: "component"}},
+		},
+	}
+	got := g.ToCypher()
+
+	if n := strings.Count(got, "CREATE ("); n != 5 {
+		t.Errorf("CREATE statements = %d, want 5 (3 nodes + 2 edges):\n%s", n, got)
+	}
+	if n := strings.Count(got, ":Node {"); n != 3 {
+		t.Errorf("node CREATE statements = %d, want 3", n)
+	}
+	if n := strings.Count(got, "-[:DEPENDS {"); n != 2 {
+		t.Errorf("edge CREATE statements = %d, want 2", n)
+	}
+	for _, want := range []string{
+		"id: 'github:o/r/overlay@main'",
+		"type: 'overlay'",
+		"path: 'base'",
+		"label: 'it\\'s'",
+		"via: 'resource'",
+		"CREATE (n0)-[:DEPENDS {id: 'e1', via: 'resource'}]->(n1)",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected %q in output:\n%s", want, got)
+		}
+	}
+	if !strings.HasSuffix(got, ";\n") {
+		t.Errorf("expected output to end with ';', got %q", got)
+	}
+}
+
+func TestEscapeCypherString(t *testing.T) {
+	cases := []struct {
+		in   string
+		want string
+	}{
+		{"plain", "plain"},
+		{"it's", `it\'s`},
+		{`back\slash`, `back\\slash`},
+		{"line\nbreak", `line\nbreak`},
+	}
+	for _, c := range cases {
+		if got := escapeCypherString(c.in); got != c.want {
+			t.Errorf("escapeCypherString(%q) = %q, want %q", c.in, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package types
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// GraphDiff is what changed between two builds of a graph, node and edge elements
+// apart, as computed by DiffGraphs.
+type GraphDiff struct {
+	Nodes ElementDiff `json:"nodes"`
+	Edges ElementDiff `json:"edges"`
+}
+
+// ElementDiff lists the elements of one group only in the new graph (Added), only in
+// the old one (Removed), and in both with different data (Changed), each sorted by ID.
+type ElementDiff struct {
+	Added   []Element       `json:"added,omitempty"`
+	Removed []Element       `json:"removed,omitempty"`
+	Changed []ElementChange `json:"changed,omitempty"`
+}
+
+// ElementChange is an element whose data differs between the two graphs. Fields names
+// the differing ElementData fields, by their JSON name ("content", "ref"...).
+type ElementChange struct {
+	ID     string      `json:"id"`
+	Fields []string    `json:"fields"`
+	Old    ElementData `json:"old"`
+	New    ElementData `json:"new"`
+}
+
+// Empty reports whether the diff has no change at all.
+func (d GraphDiff) Empty() bool {
+	return d.Nodes.empty() && d.Edges.empty()
+}
+
+func (d ElementDiff) empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// DiffGraphs compares old and new element by Data.ID: nodes and edges are matched by
+// ID within their group, an element with the same ID but different Data is changed.
+// A nil graph has no elements. When a graph has several elements with the same ID,
+// the first one is compared.
+func DiffGraphs(old, new *Graph) GraphDiff {
+	oldNodes, oldEdges := elementsByID(old)
+	newNodes, newEdges := elementsByID(new)
+	return GraphDiff{
+		Nodes: diffElements(oldNodes, newNodes),
+		Edges: diffElements(oldEdges, newEdges),
+	}
+}
+
+// elementsByID indexes the nodes and edges of g by Data.ID, keeping the first of duplicates
+func elementsByID(g *Graph) (nodes, edges map[string]Element) {
+	nodes, edges = make(map[string]Element), make(map[string]Element)
+	if g == nil {
+		return nodes, edges
+	}
+	for _, elem := range g.Elements {
+		group := nodes
+		if elem.Group == "edges" {
+			group = edges
+		}
+		if _, ok := group[elem.Data.ID]; !ok {
+			group[elem.Data.ID] = elem
+		}
+	}
+	return nodes, edges
+}
+
+func diffElements(old, new map[string]Element) ElementDiff {
+	var diff ElementDiff
+	for id, elem := range new {
+		prev, ok := old[id]
+		if !ok {
+			diff.Added = append(diff.Added, elem)
+			continue
+		}
+		if fields := changedFields(prev.Data, elem.Data); len(fields) > 0 {
+			diff.Changed = append(diff.Changed, ElementChange{ID: id, Fields: fields, Old: prev.Data, New: elem.Data})
+		}
+	}
+	for id, elem := range old {
+		if _, ok := new[id]; !ok {
+			diff.Removed = append(diff.Removed, elem)
+		}
+	}
+
+	sort.Slice(diff.Added, func(i, j int) bool { return diff.Added[i].Data.ID < diff.Added[j].Data.ID })
+	sort.Slice(diff.Removed, func(i, j int) bool { return diff.Removed[i].Data.ID < diff.Removed[j].Data.ID })
+	sort.Slice(diff.Changed, func(i, j int) bool { return diff.Changed[i].ID < diff.Changed[j].ID })
+	return diff
+}
+
+// changedFields returns the JSON names of the ElementData fields differing between a
+// and b, in declaration order. RawContent, left out of the JSON, is named "rawContent".
+func changedFields(a, b ElementData) []string {
+	va, vb := reflect.ValueOf(a), reflect.ValueOf(b)
+	t := va.Type()
+	var fields []string
+	for i := 0; i < t.NumField(); i++ {
+		if reflect.DeepEqual(va.Field(i).Interface(), vb.Field(i).Interface()) {
+			continue
+		}
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "" || name == "-" {
+			name = strings.ToLower(field.Name[:1]) + field.Name[1:]
+		}
+		fields = append(fields, name)
+	}
+	return fields
+}
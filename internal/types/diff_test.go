@@ -0,0 +1,72 @@
+package types
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestDiffGraphs(t *testing.T) {
+	node := func(id, ref string) Element {
+		return Element{Group: "nodes", Data: ElementData{ID: id, Label: id, Type: "overlay", Ref: ref}}
+	}
+	edge := func(source, target string) Element {
+		id := EdgeID(source, "resource", target)
+		return Element{Group: "edges", Data: ElementData{ID: id, Source: source, Target: target, EdgeType: "resource"}}
+	}
+
+	old := &Graph{Elements: []Element{
+		node("overlay", "main"), node("base", "v1"), node("legacy", "main"),
+		edge("overlay", "base"), edge("overlay", "legacy"),
+	}}
+	new := &Graph{Elements: []Element{
+		node("overlay", "main"), node("base", "v2"), node("legacy", "main"), node("monitoring", "main"),
+		edge("overlay", "base"), edge("overlay", "monitoring"),
+	}}
+
+	diff := DiffGraphs(old, new)
+	if diff.Empty() {
+		t.Fatal("Empty() = true, want changes")
+	}
+	if want := []Element{node("monitoring", "main")}; !reflect.DeepEqual(diff.Nodes.Added, want) {
+		t.Errorf("Nodes.Added = %+v, want %+v", diff.Nodes.Added, want)
+	}
+	if diff.Nodes.Removed != nil {
+		t.Errorf("Nodes.Removed = %+v, want none", diff.Nodes.Removed)
+	}
+	wantChanged := []ElementChange{{ID: "base", Fields: []string{"ref"}, Old: node("base", "v1").Data, New: node("base", "v2").Data}}
+	if !reflect.DeepEqual(diff.Nodes.Changed, wantChanged) {
+		t.Errorf("Nodes.Changed = %+v, want %+v", diff.Nodes.Changed, wantChanged)
+	}
+	if want := []Element{edge("overlay", "monitoring")}; !reflect.DeepEqual(diff.Edges.Added, want) {
+		t.Errorf("Edges.Added = %+v, want %+v", diff.Edges.Added, want)
+	}
+	if want := []Element{edge("overlay", "legacy")}; !reflect.DeepEqual(diff.Edges.Removed, want) {
+		t.Errorf("Edges.Removed = %+v, want %+v", diff.Edges.Removed, want)
+	}
+	if diff.Edges.Changed != nil {
+		t.Errorf("Edges.Changed = %+v, want none", diff.Edges.Changed)
+	}
+
+	data, err := json.Marshal(diff)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	var decoded GraphDiff
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if !reflect.DeepEqual(decoded, diff) {
+		t.Errorf("JSON round trip = %+v, want %+v", decoded, diff)
+	}
+}
+
+func TestDiffGraphs_Identical(t *testing.T) {
+	g := edgesGraph("overlay>base", "base>lib")
+	if diff := DiffGraphs(g, edgesGraph("overlay>base", "base>lib")); !diff.Empty() {
+		t.Errorf("DiffGraphs(identical) = %+v, want empty", diff)
+	}
+	if diff := DiffGraphs(nil, g); len(diff.Edges.Added) != 2 || len(diff.Edges.Removed) != 0 {
+		t.Errorf("DiffGraphs(nil, g) = %+v, want every edge added", diff)
+	}
+}
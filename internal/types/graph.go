@@ -0,0 +1,634 @@
+package types
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// OrphanedPatches returns the IDs of patch nodes (Type "patch") whose target
+// can't be matched to any node in the graph. A patch target is read from the
+// patch node's Content["target"] (a map with "kind" and optional "name"); a node
+// matches when its Content["kind"] equals the target kind and, if the target has
+// a name, its Content["name"] equals it. Patch nodes without a target are not reported.
+func (g *Graph) OrphanedPatches() []string {
+	var orphaned []string
+	for _, patch := range g.Elements {
+		if patch.Group != "nodes" || patch.Data.Type != "patch" {
+			continue
+		}
+		kind, name, ok := patchTarget(patch.Data.Content)
+		if !ok {
+			continue
+		}
+		matched := false
+		for _, elem := range g.Elements {
+			if elem.Group != "nodes" || elem.Data.Type == "patch" {
+				continue
+			}
+			if contentString(elem.Data.Content, "kind") != kind {
+				continue
+			}
+			if name != "" && contentString(elem.Data.Content, "name") != name {
+				continue
+			}
+			matched = true
+			break
+		}
+		if !matched {
+			orphaned = append(orphaned, patch.Data.ID)
+		}
+	}
+	return orphaned
+}
+
+// patchTarget extracts kind/name from a patch node content's "target" entry.
+func patchTarget(content map[string]interface{}) (kind, name string, ok bool) {
+	target, isMap := content["target"].(map[string]interface{})
+	if !isMap {
+		return "", "", false
+	}
+	kind, _ = target["kind"].(string)
+	name, _ = target["name"].(string)
+	return kind, name, kind != ""
+}
+
+// contentString returns content[key] if it is a string, or "".
+func contentString(content map[string]interface{}, key string) string {
+	s, _ := content[key].(string)
+	return s
+}
+
+// DetectCycles returns the reference cycles in the graph as node-ID sequences, using
+// only edges (Group "edges") with Source -> Target treated as directed. Each cycle is
+// listed from the node where it was entered, without repeating it at the end (A->B->A
+// is ["A", "B"]; a self-reference is ["A"]). One cycle is reported per back edge found
+// by a depth-first search in element order, so results are stable. Returns nil when
+// the graph is acyclic.
+func (g *Graph) DetectCycles() [][]string {
+	adjacency, order := g.edgeAdjacency()
+
+	const (
+		unvisited = iota
+		inProgress
+		done
+	)
+	state := make(map[string]int, len(order))
+	var stack []string
+	var cycles [][]string
+
+	var visit func(id string)
+	visit = func(id string) {
+		state[id] = inProgress
+		stack = append(stack, id)
+		for _, next := range adjacency[id] {
+			switch state[next] {
+			case unvisited:
+				visit(next)
+			case inProgress:
+				// Back edge: the cycle is the stack from next to id
+				for i := len(stack) - 1; i >= 0; i-- {
+					if stack[i] == next {
+						cycles = append(cycles, append([]string(nil), stack[i:]...))
+						break
+					}
+				}
+			}
+		}
+		stack = stack[:len(stack)-1]
+		state[id] = done
+	}
+
+	for _, id := range order {
+		if state[id] == unvisited {
+			visit(id)
+		}
+	}
+	return cycles
+}
+
+// edgeAdjacency returns the directed adjacency lists built from the graph's edges
+// and the node IDs in order of first appearance (as source or target).
+func (g *Graph) edgeAdjacency() (map[string][]string, []string) {
+	adjacency := make(map[string][]string)
+	seen := make(map[string]bool)
+	var order []string
+	add := func(id string) {
+		if !seen[id] {
+			seen[id] = true
+			order = append(order, id)
+		}
+	}
+	for _, elem := range g.Elements {
+		if elem.Group != "edges" {
+			continue
+		}
+		add(elem.Data.Source)
+		add(elem.Data.Target)
+		adjacency[elem.Data.Source] = append(adjacency[elem.Data.Source], elem.Data.Target)
+	}
+	return adjacency, order
+}
+
+// ErrCycle is returned by TopologicalSort when the graph has a reference cycle.
+var ErrCycle = errors.New("graph has a cycle")
+
+// TopologicalSort returns the node IDs ordered so that dependencies come before their
+// dependents: for each edge Source -> Target (an overlay referencing its base), Target
+// is listed before Source. Nodes without edges are included. Ties are broken by
+// element order, so the result is stable. Returns an error wrapping ErrCycle, naming
+// the first cycle found, when the graph is not acyclic.
+func (g *Graph) TopologicalSort() ([]string, error) {
+	if cycles := g.DetectCycles(); len(cycles) > 0 {
+		cycle := append(cycles[0], cycles[0][0])
+		return nil, fmt.Errorf("%w: %s", ErrCycle, strings.Join(cycle, " -> "))
+	}
+
+	adjacency, order := g.edgeAdjacency()
+	order = g.withUnlinkedNodes(order)
+
+	// Post-order DFS along Source -> Target lists every dependency before its dependents
+	visited := make(map[string]bool, len(order))
+	sorted := make([]string, 0, len(order))
+	var visit func(id string)
+	visit = func(id string) {
+		visited[id] = true
+		for _, next := range adjacency[id] {
+			if !visited[next] {
+				visit(next)
+			}
+		}
+		sorted = append(sorted, id)
+	}
+	for _, id := range order {
+		if !visited[id] {
+			visit(id)
+		}
+	}
+	return sorted, nil
+}
+
+// withUnlinkedNodes prepends to order the node elements that don't appear in it
+// (nodes without edges), in element order.
+func (g *Graph) withUnlinkedNodes(order []string) []string {
+	seen := make(map[string]bool, len(order))
+	for _, id := range order {
+		seen[id] = true
+	}
+	var nodes []string
+	for _, elem := range g.Elements {
+		if elem.Group == "nodes" && !seen[elem.Data.ID] {
+			seen[elem.Data.ID] = true
+			nodes = append(nodes, elem.Data.ID)
+		}
+	}
+	return append(nodes, order...)
+}
+
+// Merge appends other's elements to the graph, skipping nodes and edges whose Data.ID
+// is already present, so the merged Elements have no duplicate IDs. When an element
+// with the same ID differs from the existing one, the existing element is kept and its
+// ID is returned in the conflicts. BaseURLs are merged the same way.
+func (g *Graph) Merge(other *Graph) (conflicts []string) {
+	if other == nil {
+		return nil
+	}
+
+	existing := make(map[string]int, len(g.Elements))
+	for i, elem := range g.Elements {
+		existing[elem.Data.ID] = i
+	}
+	for _, elem := range other.Elements {
+		if i, ok := existing[elem.Data.ID]; ok {
+			if !reflect.DeepEqual(g.Elements[i], elem) {
+				conflicts = append(conflicts, elem.Data.ID)
+			}
+			continue
+		}
+		existing[elem.Data.ID] = len(g.Elements)
+		g.Elements = append(g.Elements, elem)
+	}
+
+	for id, baseURL := range other.BaseURLs {
+		if g.BaseURLs == nil {
+			g.BaseURLs = make(map[string]string)
+		}
+		if _, ok := g.BaseURLs[id]; !ok {
+			g.BaseURLs[id] = baseURL
+		}
+	}
+	return conflicts
+}
+
+// ErrNodeNotFound is returned by Replace when the node to replace is missing.
+var ErrNodeNotFound = errors.New("node not found")
+
+// Replace swaps the subtree rooted at nodeID (the node and its descendants) for sub, a
+// freshly built graph of that node, e.g. after its kustomization changed. Nodes of the
+// subtree found in sub are updated in place and their outgoing edges replaced by sub's;
+// sub's new nodes and edges are appended. Nodes of the old subtree that are no longer
+// reachable from nodeID or from a node outside the subtree are removed with their edges
+// and BaseURLs. Nodes outside the subtree, and their edges, are left untouched even when
+// sub also holds them. Levels are not recomputed: call ComputeLevels afterwards.
+func (g *Graph) Replace(nodeID string, sub *Graph) error {
+	ix := g.Index()
+	if ix.Node(nodeID) == nil {
+		return fmt.Errorf("%w in graph: %s", ErrNodeNotFound, nodeID)
+	}
+	if sub == nil || sub.Index().Node(nodeID) == nil {
+		return fmt.Errorf("%w in subgraph: %s", ErrNodeNotFound, nodeID)
+	}
+
+	subtree := map[string]bool{nodeID: true}
+	for _, id := range ix.Descendants(nodeID) {
+		subtree[id] = true
+	}
+
+	// replaced are the nodes sub is authoritative for: those of the old subtree and new ones
+	replaced := make(map[string]Element)
+	for _, elem := range sub.Elements {
+		if elem.Group != "nodes" {
+			continue
+		}
+		if _, ok := replaced[elem.Data.ID]; ok {
+			continue
+		}
+		if ix.Node(elem.Data.ID) == nil || subtree[elem.Data.ID] {
+			replaced[elem.Data.ID] = elem
+		}
+	}
+
+	elements := make([]Element, 0, len(g.Elements)+len(sub.Elements))
+	present := make(map[string]bool, len(g.Elements))
+	for _, elem := range g.Elements {
+		switch {
+		case elem.Group == "edges":
+			if _, ok := replaced[elem.Data.Source]; ok {
+				continue
+			}
+		default:
+			if fresh, ok := replaced[elem.Data.ID]; ok {
+				elem = fresh
+			}
+		}
+		present[elem.Data.ID] = true
+		elements = append(elements, elem)
+	}
+	for _, elem := range sub.Elements {
+		if elem.Group == "edges" {
+			if _, ok := replaced[elem.Data.Source]; !ok || present[elem.Data.ID] {
+				continue
+			}
+		} else if _, ok := replaced[elem.Data.ID]; !ok || present[elem.Data.ID] {
+			continue
+		}
+		present[elem.Data.ID] = true
+		elements = append(elements, elem)
+	}
+	g.Elements = elements
+
+	for id := range replaced {
+		delete(g.BaseURLs, id)
+		if baseURL, ok := sub.BaseURLs[id]; ok {
+			if g.BaseURLs == nil {
+				g.BaseURLs = make(map[string]string)
+			}
+			g.BaseURLs[id] = baseURL
+		}
+	}
+
+	// Old subtree nodes only reachable through the edges that were replaced are orphans
+	ix = g.Index()
+	reached := map[string]bool{nodeID: true}
+	queue := []string{nodeID}
+	for _, elem := range g.Elements {
+		id := elem.Data.ID
+		if elem.Group == "edges" {
+			id = elem.Data.Source
+		}
+		if !subtree[id] && !reached[id] {
+			reached[id] = true
+			queue = append(queue, id)
+		}
+	}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		for _, next := range ix.Children(id) {
+			if !reached[next] {
+				reached[next] = true
+				queue = append(queue, next)
+			}
+		}
+	}
+	kept := g.Elements[:0]
+	for _, elem := range g.Elements {
+		if elem.Group == "edges" && reached[elem.Data.Source] && reached[elem.Data.Target] ||
+			elem.Group != "edges" && reached[elem.Data.ID] {
+			kept = append(kept, elem)
+			continue
+		}
+		if elem.Group != "edges" {
+			delete(g.BaseURLs, elem.Data.ID)
+		}
+	}
+	g.Elements = kept
+	return nil
+}
+
+// Dedup collapses elements sharing a Data.ID, keeping the first occurrence, so
+// Cytoscape doesn't warn about duplicate IDs.
+func (g *Graph) Dedup() {
+	seen := make(map[string]bool, len(g.Elements))
+	deduped := g.Elements[:0]
+	for _, elem := range g.Elements {
+		if seen[elem.Data.ID] {
+			continue
+		}
+		seen[elem.Data.ID] = true
+		deduped = append(deduped, elem)
+	}
+	g.Elements = deduped
+}
+
+// Errors reported by Validate, wrapped with the offending element.
+var (
+	ErrDanglingEdge = errors.New("dangling edge")
+	ErrDuplicateID  = errors.New("duplicate element ID")
+	ErrInvalidGroup = errors.New("invalid element group")
+)
+
+// Validate checks that the graph can be rendered by Cytoscape: every edge links two
+// existing nodes (ErrDanglingEdge), element IDs are unique (ErrDuplicateID), and each
+// element is in the group its fields imply: "nodes" without Source or Target, "edges"
+// with both (ErrInvalidGroup). It returns one error per problem, none for a valid graph.
+func (g *Graph) Validate() []error {
+	var errs []error
+	nodes := make(map[string]bool)
+	seen := make(map[string]bool, len(g.Elements))
+	for _, elem := range g.Elements {
+		id := elem.Data.ID
+		if seen[id] {
+			errs = append(errs, fmt.Errorf("%w: %s", ErrDuplicateID, id))
+		}
+		seen[id] = true
+
+		switch elem.Group {
+		case "nodes":
+			if elem.Data.Source != "" || elem.Data.Target != "" {
+				errs = append(errs, fmt.Errorf("%w: node %s has a source or target (%s)", ErrInvalidGroup, id, EdgeLabel(elem.Data.Source, elem.Data.Target)))
+			}
+			nodes[id] = true
+		case "edges":
+			if elem.Data.Source == "" || elem.Data.Target == "" {
+				errs = append(errs, fmt.Errorf("%w: edge %s lacks a source or target (%s)", ErrInvalidGroup, id, EdgeLabel(elem.Data.Source, elem.Data.Target)))
+			}
+		default:
+			errs = append(errs, fmt.Errorf("%w: %q for element %s", ErrInvalidGroup, elem.Group, id))
+		}
+	}
+
+	for _, elem := range g.Elements {
+		if elem.Group != "edges" {
+			continue
+		}
+		for _, end := range []string{elem.Data.Source, elem.Data.Target} {
+			if end != "" && !nodes[end] {
+				errs = append(errs, fmt.Errorf("%w: edge %s (%s) references missing node %s", ErrDanglingEdge, elem.Data.ID, EdgeLabel(elem.Data.Source, elem.Data.Target), end))
+			}
+		}
+	}
+	return errs
+}
+
+// Sort orders Elements with nodes before edges, each group by Data.ID, so the
+// serialized graph doesn't depend on the order it was built in.
+func (g *Graph) Sort() {
+	sort.SliceStable(g.Elements, func(i, j int) bool {
+		a, b := g.Elements[i], g.Elements[j]
+		if a.Group != b.Group {
+			return a.Group == "nodes"
+		}
+		return a.Data.ID < b.Data.ID
+	})
+}
+
+// ComputeLevels assigns each node its layout level: nodes without incoming edges (the
+// root overlays) are level 0 and each Source -> Target hop adds one, using the shortest
+// distance (BFS) from a root. Nodes only reachable through a cycle with no root are
+// levelled from the first such node in element order, so cycles always terminate with
+// a deterministic result. The levels are also stored in each node's Data.Level.
+func (g *Graph) ComputeLevels() map[string]int {
+	levels := g.levels()
+	for i, elem := range g.Elements {
+		if level, ok := levels[elem.Data.ID]; ok && elem.Group == "nodes" {
+			g.Elements[i].Data.Level = &level
+		}
+	}
+	return levels
+}
+
+// levels computes the levels of ComputeLevels without storing them
+func (g *Graph) levels() map[string]int {
+	adjacency, order := g.edgeAdjacency()
+	order = g.withUnlinkedNodes(order)
+
+	incoming := make(map[string]bool)
+	for _, targets := range adjacency {
+		for _, target := range targets {
+			incoming[target] = true
+		}
+	}
+
+	levels := make(map[string]int, len(order))
+	bfs := func(queue []string) {
+		for len(queue) > 0 {
+			id := queue[0]
+			queue = queue[1:]
+			for _, next := range adjacency[id] {
+				if _, ok := levels[next]; !ok {
+					levels[next] = levels[id] + 1
+					queue = append(queue, next)
+				}
+			}
+		}
+	}
+
+	var roots []string
+	for _, id := range order {
+		if !incoming[id] {
+			levels[id] = 0
+			roots = append(roots, id)
+		}
+	}
+	bfs(roots)
+	for _, id := range order {
+		if _, ok := levels[id]; !ok {
+			levels[id] = 0
+			bfs([]string{id})
+		}
+	}
+	return levels
+}
+
+// GraphStats summarizes a graph for dashboards.
+type GraphStats struct {
+	NodesByType  map[string]int `json:"nodesByType"`
+	Edges        int            `json:"edges"`
+	MaxDepth     int            `json:"maxDepth"`     // highest node level, see ComputeLevels
+	Repositories int            `json:"repositories"` // distinct host/owner/repo of the nodes
+}
+
+// Stats counts the nodes by type, the edges and the distinct repositories of the
+// graph, and finds its depth. The graph isn't modified.
+func (g *Graph) Stats() GraphStats {
+	stats := GraphStats{NodesByType: make(map[string]int)}
+	repos := make(map[string]bool)
+	levels := g.levels()
+	for _, elem := range g.Elements {
+		if elem.Group == "edges" {
+			stats.Edges++
+			continue
+		}
+		stats.NodesByType[elem.Data.Type]++
+		stats.MaxDepth = max(stats.MaxDepth, levels[elem.Data.ID])
+		if elem.Data.Repo != "" {
+			repos[elem.Data.Host+"/"+elem.Data.Owner+"/"+elem.Data.Repo] = true
+		}
+	}
+	stats.Repositories = len(repos)
+	return stats
+}
+
+// Descendants returns every node reachable from nodeID by following edges forward
+// (Source -> Target): everything the node depends on. IDs are listed once, in BFS
+// order, and nodeID itself is excluded even when it is part of a cycle.
+func (g *Graph) Descendants(nodeID string) []string {
+	return g.Index().Descendants(nodeID)
+}
+
+// Ancestors returns every node that reaches nodeID by following edges forward, i.e.
+// the nodes found walking edges backward (Target -> Source): everything that depends
+// on it. IDs are listed once, in BFS order, and nodeID itself is excluded.
+func (g *Graph) Ancestors(nodeID string) []string {
+	return g.Index().Ancestors(nodeID)
+}
+
+// GraphIndex holds lookups precomputed from a graph's elements: nodes by ID and the
+// forward (Source -> Target) and reverse adjacency of its edges, so queries don't scan
+// every element. It reflects the graph when it was built: call Graph.Index again
+// after adding or removing elements.
+type GraphIndex struct {
+	graph   *Graph
+	nodes   map[string]int // index in graph.Elements
+	forward map[string][]string
+	reverse map[string][]string
+}
+
+// Index builds the GraphIndex of the graph. Adjacency lists keep edge order, with
+// one entry per edge.
+func (g *Graph) Index() *GraphIndex {
+	ix := &GraphIndex{
+		graph:   g,
+		nodes:   make(map[string]int),
+		forward: make(map[string][]string),
+		reverse: make(map[string][]string),
+	}
+	for i, elem := range g.Elements {
+		if elem.Group == "edges" {
+			ix.forward[elem.Data.Source] = append(ix.forward[elem.Data.Source], elem.Data.Target)
+			ix.reverse[elem.Data.Target] = append(ix.reverse[elem.Data.Target], elem.Data.Source)
+		} else if _, ok := ix.nodes[elem.Data.ID]; !ok {
+			ix.nodes[elem.Data.ID] = i
+		}
+	}
+	return ix
+}
+
+// Node returns the (first) node element with the given ID, or nil.
+func (ix *GraphIndex) Node(id string) *Element {
+	i, ok := ix.nodes[id]
+	if !ok {
+		return nil
+	}
+	return &ix.graph.Elements[i]
+}
+
+// Children returns the targets of the edges leaving nodeID. The slice must not be modified.
+func (ix *GraphIndex) Children(nodeID string) []string {
+	return ix.forward[nodeID]
+}
+
+// Parents returns the sources of the edges reaching nodeID. The slice must not be modified.
+func (ix *GraphIndex) Parents(nodeID string) []string {
+	return ix.reverse[nodeID]
+}
+
+// Descendants is Graph.Descendants using the index.
+func (ix *GraphIndex) Descendants(nodeID string) []string {
+	return reachable(ix.forward, nodeID)
+}
+
+// Ancestors is Graph.Ancestors using the index.
+func (ix *GraphIndex) Ancestors(nodeID string) []string {
+	return reachable(ix.reverse, nodeID)
+}
+
+// reachable returns the nodes reachable from start in adjacency, excluding start.
+func reachable(adjacency map[string][]string, start string) []string {
+	seen := map[string]bool{start: true}
+	var result []string
+	queue := []string{start}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		for _, next := range adjacency[id] {
+			if !seen[next] {
+				seen[next] = true
+				result = append(result, next)
+				queue = append(queue, next)
+			}
+		}
+	}
+	return result
+}
+
+// Filter returns a new graph with the nodes for which keep returns true, and the edges
+// whose source and target both survive; edges to removed nodes are dropped. keep is
+// only called for nodes. ID, Created and the BaseURLs of kept nodes are copied.
+func (g *Graph) Filter(keep func(Element) bool) *Graph {
+	filtered := &Graph{ID: g.ID, Created: g.Created, Elements: []Element{}}
+	kept := make(map[string]bool)
+	for _, elem := range g.Elements {
+		if elem.Group == "nodes" && keep(elem) {
+			kept[elem.Data.ID] = true
+			filtered.Elements = append(filtered.Elements, elem)
+		}
+	}
+	for _, elem := range g.Elements {
+		if elem.Group == "edges" && kept[elem.Data.Source] && kept[elem.Data.Target] {
+			filtered.Elements = append(filtered.Elements, elem)
+		}
+	}
+	for id, baseURL := range g.BaseURLs {
+		if kept[id] {
+			if filtered.BaseURLs == nil {
+				filtered.BaseURLs = make(map[string]string)
+			}
+			filtered.BaseURLs[id] = baseURL
+		}
+	}
+	return filtered
+}
+
+// ElementsJSON encodes the elements of the graph alone, as the JSON array taken by
+// Cytoscape's cy.add(elements). A graph without elements is "[]".
+func (g *Graph) ElementsJSON() ([]byte, error) {
+	if g.Elements == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal(g.Elements)
+}
@@ -0,0 +1,645 @@
+package types
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestGraph_OrphanedPatches(t *testing.T) {
+	g := &Graph{
+		Elements: []Element{
+			{Group: "nodes", Data: ElementData{ID: "overlay", Type: "overlay"}},
+			{Group: "nodes", Data: ElementData{ID: "nodeset", Type: "resource", Content: map[string]interface{}{
+				"kind": "OpenStackDataPlaneNodeSet", "name": "nodeset-02",
+			}}},
+			{Group: "nodes", Data: ElementData{ID: "patch-kind", Type: "patch", Content: map[string]interface{}{
+				"target": map[string]interface{}{"kind": "OpenStackDataPlaneNodeSet"},
+			}}},
+			{Group: "nodes", Data: ElementData{ID: "patch-kind-name", Type: "patch", Content: map[string]interface{}{
+				"target": map[string]interface{}{"kind": "OpenStackDataPlaneNodeSet", "name": "nodeset-02"},
+			}}},
+			{Group: "nodes", Data: ElementData{ID: "patch-missing-kind", Type: "patch", Content: map[string]interface{}{
+				"target": map[string]interface{}{"kind": "OpenStackControlPlane"},
+			}}},
+			{Group: "nodes", Data: ElementData{ID: "patch-missing-name", Type: "patch", Content: map[string]interface{}{
+				"target": map[string]interface{}{"kind": "OpenStackDataPlaneNodeSet", "name": "nodeset-99"},
+			}}},
+			{Group: "nodes", Data: ElementData{ID: "patch-no-target", Type: "patch"}},
+			{Group: "edges", Data: ElementData{ID: "overlay->nodeset", Source: "overlay", Target: "nodeset", EdgeType: "resource"}},
+		},
+	}
+
+	got := g.OrphanedPatches()
+	want := []string{"patch-missing-kind", "patch-missing-name"}
+	if len(got) != len(want) {
+		t.Fatalf("OrphanedPatches() = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("OrphanedPatches()[%d] = %q, want %q", i, got[i], want[i])
+		}
+	}
+}
+
+func TestGraph_OrphanedPatches_None(t *testing.T) {
+	g := &Graph{Elements: []Element{
+		{Group: "nodes", Data: ElementData{ID: "overlay", Type: "overlay"}},
+	}}
+	if got := g.OrphanedPatches(); got != nil {
+		t.Errorf("OrphanedPatches() = %v, want nil", got)
+	}
+}
+
+// edgesGraph builds a graph with one edge per "source>target" pair.
+func edgesGraph(pairs ...string) *Graph {
+	g := &Graph{}
+	for _, p := range pairs {
+		src, tgt, _ := strings.Cut(p, ">")
+		g.Elements = append(g.Elements, Element{Group: "edges", Data: ElementData{
+			ID: EdgeID(src, "resource", tgt), Source: src, Target: tgt, EdgeType: "resource",
+		}})
+	}
+	return g
+}
+
+func TestGraph_DetectCycles(t *testing.T) {
+	cases := []struct {
+		name  string
+		graph *Graph
+		want  [][]string
+	}{
+		{"acyclic", edgesGraph("overlay>base", "overlay>component", "component>base"), nil},
+		{"empty", &Graph{}, nil},
+		{"two-node cycle", edgesGraph("A>B", "B>A"), [][]string{{"A", "B"}}},
+		{"cycle below an entry point", edgesGraph("overlay>A", "A>B", "B>C", "C>A"), [][]string{{"A", "B", "C"}}},
+		{"self reference", edgesGraph("A>A"), [][]string{{"A"}}},
+		{"two cycles", edgesGraph("A>B", "B>A", "C>D", "D>C"), [][]string{{"A", "B"}, {"C", "D"}}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := c.graph.DetectCycles()
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("DetectCycles() = %v, want %v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestGraph_DetectCycles_IgnoresNodes(t *testing.T) {
+	g := edgesGraph("A>B")
+	// A node element whose Source/Target fields are set must not count as an edge
+	g.Elements = append(g.Elements, Element{Group: "nodes", Data: ElementData{ID: "B", Source: "B", Target: "A"}})
+	if got := g.DetectCycles(); got != nil {
+		t.Errorf("DetectCycles() = %v, want nil", got)
+	}
+}
+
+func TestGraph_TopologicalSort(t *testing.T) {
+	g := edgesGraph("overlay>component", "overlay>base", "component>base")
+	g.Elements = append(g.Elements, Element{Group: "nodes", Data: ElementData{ID: "standalone"}})
+
+	got, err := g.TopologicalSort()
+	if err != nil {
+		t.Fatalf("TopologicalSort() error = %v", err)
+	}
+	want := []string{"standalone", "base", "component", "overlay"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("TopologicalSort() = %v, want %v", got, want)
+	}
+
+	pos := make(map[string]int, len(got))
+	for i, id := range got {
+		pos[id] = i
+	}
+	for _, elem := range g.Elements {
+		if elem.Group == "edges" && pos[elem.Data.Target] > pos[elem.Data.Source] {
+			t.Errorf("%s listed after its dependent %s", elem.Data.Target, elem.Data.Source)
+		}
+	}
+}
+
+func TestGraph_TopologicalSort_Cycle(t *testing.T) {
+	g := edgesGraph("overlay>A", "A>B", "B>A")
+
+	got, err := g.TopologicalSort()
+	if !errors.Is(err, ErrCycle) {
+		t.Fatalf("TopologicalSort() error = %v, want ErrCycle", err)
+	}
+	if got != nil {
+		t.Errorf("TopologicalSort() = %v, want nil", got)
+	}
+	if !strings.Contains(err.Error(), "A -> B -> A") {
+		t.Errorf("error %q should name the cycle", err)
+	}
+}
+
+func TestGraph_Merge_Disjoint(t *testing.T) {
+	g := edgesGraph("overlay-a>base-a")
+	other := edgesGraph("overlay-b>base-b")
+	other.BaseURLs = map[string]string{"overlay-b": "https://gitlab.example.com"}
+
+	if conflicts := g.Merge(other); conflicts != nil {
+		t.Errorf("Merge() conflicts = %v, want nil", conflicts)
+	}
+	if len(g.Elements) != 2 {
+		t.Fatalf("len(Elements) = %d, want 2", len(g.Elements))
+	}
+	if g.Elements[1].Data.Source != "overlay-b" {
+		t.Errorf("Elements[1] = %+v, want the overlay-b edge", g.Elements[1].Data)
+	}
+	if g.BaseURLs["overlay-b"] != "https://gitlab.example.com" {
+		t.Errorf("BaseURLs = %v, want overlay-b merged", g.BaseURLs)
+	}
+}
+
+func TestGraph_Merge_Overlapping(t *testing.T) {
+	node := func(id, nodeType string) Element {
+		return Element{Group: "nodes", Data: ElementData{ID: id, Label: id, Type: nodeType}}
+	}
+	g := edgesGraph("overlay-a>base")
+	g.Elements = append(g.Elements, node("overlay-a", "overlay"), node("base", "resource"))
+	g.BaseURLs = map[string]string{"base": "https://github.com"}
+
+	other := edgesGraph("overlay-a>base", "overlay-b>base")
+	other.Elements = append(other.Elements, node("overlay-b", "overlay"), node("base", "component"))
+	other.BaseURLs = map[string]string{"base": "https://gitlab.example.com"}
+
+	conflicts := g.Merge(other)
+	if !reflect.DeepEqual(conflicts, []string{"base"}) {
+		t.Errorf("Merge() conflicts = %v, want [base]", conflicts)
+	}
+
+	seen := make(map[string]bool)
+	for _, elem := range g.Elements {
+		if seen[elem.Data.ID] {
+			t.Errorf("duplicate element ID %s", elem.Data.ID)
+		}
+		seen[elem.Data.ID] = true
+		if elem.Data.ID == "base" && elem.Data.Type != "resource" {
+			t.Errorf("base node Type = %s, want the existing resource node", elem.Data.Type)
+		}
+	}
+	if len(g.Elements) != 5 {
+		t.Errorf("len(Elements) = %d, want 5", len(g.Elements))
+	}
+	if g.BaseURLs["base"] != "https://github.com" {
+		t.Errorf("BaseURLs[base] = %s, want the existing URL", g.BaseURLs["base"])
+	}
+}
+
+func TestGraph_Dedup(t *testing.T) {
+	g := edgesGraph("overlay-a>base", "overlay-b>base", "overlay-a>base")
+	g.Elements = append(g.Elements,
+		Element{Group: "nodes", Data: ElementData{ID: "base", Type: "resource"}},
+		Element{Group: "nodes", Data: ElementData{ID: "base", Type: "component"}},
+	)
+
+	g.Dedup()
+
+	if len(g.Elements) != 3 {
+		t.Fatalf("len(Elements) = %d, want 3", len(g.Elements))
+	}
+	if g.Elements[0].Data.Source != "overlay-a" || g.Elements[1].Data.Source != "overlay-b" {
+		t.Errorf("edges = %+v, want order preserved", g.Elements[:2])
+	}
+	if g.Elements[2].Data.Type != "resource" {
+		t.Errorf("base node Type = %s, want the first occurrence", g.Elements[2].Data.Type)
+	}
+}
+
+func TestGraph_ComputeLevels(t *testing.T) {
+	cases := []struct {
+		name  string
+		graph *Graph
+		want  map[string]int
+	}{
+		{"chain", edgesGraph("overlay>component", "component>base"),
+			map[string]int{"overlay": 0, "component": 1, "base": 2}},
+		{"diamond", edgesGraph("overlay>left", "overlay>right", "left>base", "right>base"),
+			map[string]int{"overlay": 0, "left": 1, "right": 1, "base": 2}},
+		{"shortcut uses shortest distance", edgesGraph("overlay>component", "component>base", "overlay>base"),
+			map[string]int{"overlay": 0, "component": 1, "base": 1}},
+		{"cycle below a root", edgesGraph("overlay>A", "A>B", "B>A"),
+			map[string]int{"overlay": 0, "A": 1, "B": 2}},
+		{"rootless cycle", edgesGraph("A>B", "B>C", "C>A"),
+			map[string]int{"A": 0, "B": 1, "C": 2}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := c.graph.ComputeLevels()
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("ComputeLevels() = %v, want %v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestGraph_ComputeLevels_SetsNodeLevel(t *testing.T) {
+	g := edgesGraph("overlay>base")
+	g.Elements = append(g.Elements,
+		Element{Group: "nodes", Data: ElementData{ID: "overlay"}},
+		Element{Group: "nodes", Data: ElementData{ID: "base"}},
+		Element{Group: "nodes", Data: ElementData{ID: "standalone"}},
+	)
+
+	g.ComputeLevels()
+
+	want := map[string]int{"overlay": 0, "base": 1, "standalone": 0}
+	for _, elem := range g.Elements {
+		if elem.Group == "edges" {
+			if elem.Data.Level != nil {
+				t.Errorf("edge %s has Level %d, want nil", elem.Data.ID, *elem.Data.Level)
+			}
+			continue
+		}
+		if elem.Data.Level == nil || *elem.Data.Level != want[elem.Data.ID] {
+			t.Errorf("node %s Level = %v, want %d", elem.Data.ID, elem.Data.Level, want[elem.Data.ID])
+		}
+	}
+}
+
+func TestGraph_DescendantsAndAncestors(t *testing.T) {
+	// Two overlays sharing a component and a base, plus a cycle through a common lib
+	g := edgesGraph(
+		"prod>network", "prod>app",
+		"staging>app",
+		"app>base", "network>base",
+		"base>lib", "lib>base",
+	)
+
+	cases := []struct {
+		name string
+		got  []string
+		want []string
+	}{
+		{"descendants of an overlay", g.Descendants("prod"), []string{"network", "app", "base", "lib"}},
+		{"descendants of a leaf in a cycle", g.Descendants("lib"), []string{"base"}},
+		{"descendants of unknown node", g.Descendants("missing"), nil},
+		{"ancestors of the shared base", g.Ancestors("base"), []string{"app", "network", "lib", "prod", "staging"}},
+		{"ancestors of a component", g.Ancestors("app"), []string{"prod", "staging"}},
+		{"ancestors of a root", g.Ancestors("prod"), nil},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if !reflect.DeepEqual(c.got, c.want) {
+				t.Errorf("got %v, want %v", c.got, c.want)
+			}
+		})
+	}
+}
+
+func TestGraph_Filter(t *testing.T) {
+	g := edgesGraph("overlay>base", "overlay>fix-replicas", "fix-replicas>base", "overlay>monitoring")
+	g.ID = "graph-1"
+	for _, n := range []struct{ id, typ string }{
+		{"overlay", "overlay"}, {"base", "resource"}, {"fix-replicas", "patch"}, {"monitoring", "component"},
+	} {
+		g.Elements = append(g.Elements, Element{Group: "nodes", Data: ElementData{ID: n.id, Type: n.typ}})
+	}
+	g.BaseURLs = map[string]string{"base": "https://github.com", "fix-replicas": "https://github.com"}
+
+	filtered := g.Filter(func(e Element) bool { return e.Data.Type != "patch" })
+
+	var nodes, edges []string
+	for _, elem := range filtered.Elements {
+		if elem.Group == "nodes" {
+			nodes = append(nodes, elem.Data.ID)
+		} else {
+			edges = append(edges, elem.Data.Source+">"+elem.Data.Target)
+		}
+	}
+	if want := []string{"overlay", "base", "monitoring"}; !reflect.DeepEqual(nodes, want) {
+		t.Errorf("nodes = %v, want %v", nodes, want)
+	}
+	if want := []string{"overlay>base", "overlay>monitoring"}; !reflect.DeepEqual(edges, want) {
+		t.Errorf("edges = %v, want %v (edges to the patch dropped)", edges, want)
+	}
+	if filtered.ID != "graph-1" {
+		t.Errorf("ID = %q, want graph-1", filtered.ID)
+	}
+	if _, ok := filtered.BaseURLs["fix-replicas"]; ok || filtered.BaseURLs["base"] == "" {
+		t.Errorf("BaseURLs = %v, want only kept nodes", filtered.BaseURLs)
+	}
+	if len(g.Elements) != 8 {
+		t.Errorf("original graph modified: %d elements, want 8", len(g.Elements))
+	}
+}
+
+func TestGraph_Sort(t *testing.T) {
+	g := &Graph{Elements: []Element{
+		{Group: "edges", Data: ElementData{ID: "edge-b"}},
+		{Group: "nodes", Data: ElementData{ID: "overlay"}},
+		{Group: "edges", Data: ElementData{ID: "edge-a"}},
+		{Group: "nodes", Data: ElementData{ID: "base"}},
+		{Group: "nodes", Data: ElementData{ID: "component"}},
+	}}
+	g.Sort()
+
+	var got []string
+	for _, elem := range g.Elements {
+		got = append(got, elem.Group+":"+elem.Data.ID)
+	}
+	want := []string{"nodes:base", "nodes:component", "nodes:overlay", "edges:edge-a", "edges:edge-b"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Sort() order = %v, want %v", got, want)
+	}
+}
+
+func TestGraph_Stats(t *testing.T) {
+	g := edgesGraph("overlay>base", "overlay>monitoring", "base>deploy", "monitoring>deploy")
+	for _, n := range []ElementData{
+		{ID: "overlay", Type: "overlay", Host: "github.com", Owner: "org", Repo: "app"},
+		{ID: "base", Type: "resource", Host: "github.com", Owner: "org", Repo: "app"},
+		{ID: "deploy", Type: "resource", Host: "github.com", Owner: "org", Repo: "app"},
+		{ID: "monitoring", Type: "component", Host: "gitlab.mycorp.net", Owner: "group", Repo: "app"},
+		{ID: "oci:ghcr.io/org/chart:1", Type: "oci"},
+	} {
+		g.Elements = append(g.Elements, Element{Group: "nodes", Data: n})
+	}
+
+	got := g.Stats()
+	want := GraphStats{
+		NodesByType:  map[string]int{"overlay": 1, "resource": 2, "component": 1, "oci": 1},
+		Edges:        4,
+		MaxDepth:     2,
+		Repositories: 2,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Stats() = %+v, want %+v", got, want)
+	}
+	for _, elem := range g.Elements {
+		if elem.Data.Level != nil {
+			t.Errorf("Stats() set the level of %s", elem.Data.ID)
+		}
+	}
+}
+
+// naiveReachable walks the graph scanning every edge at each step, forward or backward.
+func naiveReachable(g *Graph, start string, backward bool) []string {
+	seen := map[string]bool{start: true}
+	var result []string
+	queue := []string{start}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		for _, elem := range g.Elements {
+			from, to := elem.Data.Source, elem.Data.Target
+			if backward {
+				from, to = to, from
+			}
+			if elem.Group == "edges" && from == id && !seen[to] {
+				seen[to] = true
+				result = append(result, to)
+				queue = append(queue, to)
+			}
+		}
+	}
+	return result
+}
+
+func TestGraphIndex_MatchesNaiveScan(t *testing.T) {
+	g := edgesGraph(
+		"prod>network", "prod>app",
+		"staging>app",
+		"app>base", "network>base",
+		"base>lib", "lib>base",
+		"app>base",
+	)
+	ids := []string{"prod", "staging", "network", "app", "base", "lib", "missing"}
+	for _, id := range ids {
+		g.Elements = append(g.Elements, Element{Group: "nodes", Data: ElementData{ID: id, Type: "resource"}})
+	}
+
+	check := func(g *Graph, ix *GraphIndex) {
+		t.Helper()
+		for _, id := range ids {
+			var parents, children []string
+			for _, elem := range g.Elements {
+				if elem.Group == "edges" && elem.Data.Target == id {
+					parents = append(parents, elem.Data.Source)
+				}
+				if elem.Group == "edges" && elem.Data.Source == id {
+					children = append(children, elem.Data.Target)
+				}
+			}
+			if got := ix.Parents(id); !reflect.DeepEqual(got, parents) {
+				t.Errorf("Parents(%s) = %v, want %v", id, got, parents)
+			}
+			if got := ix.Children(id); !reflect.DeepEqual(got, children) {
+				t.Errorf("Children(%s) = %v, want %v", id, got, children)
+			}
+			if got, want := ix.Descendants(id), naiveReachable(g, id, false); !reflect.DeepEqual(got, want) {
+				t.Errorf("Descendants(%s) = %v, want %v", id, got, want)
+			}
+			if got, want := ix.Ancestors(id), naiveReachable(g, id, true); !reflect.DeepEqual(got, want) {
+				t.Errorf("Ancestors(%s) = %v, want %v", id, got, want)
+			}
+			if node := ix.Node(id); node == nil || node.Data.ID != id {
+				t.Errorf("Node(%s) = %+v", id, node)
+			}
+		}
+		if ix.Node("unknown") != nil {
+			t.Error("Node(unknown) should be nil")
+		}
+	}
+	check(g, g.Index())
+
+	// After a mutation the old index is stale; a rebuilt one matches again
+	g.Elements = append(g.Elements, edgesGraph("lib>missing").Elements...)
+	ix := g.Index()
+	check(g, ix)
+	if got := ix.Descendants("prod"); !reflect.DeepEqual(got, []string{"network", "app", "base", "lib", "missing"}) {
+		t.Errorf("rebuilt Descendants(prod) = %v", got)
+	}
+}
+
+// treeGraph is edgesGraph with a node element per ID, labelled by origin ("old", "new")
+func treeGraph(origin string, nodes []string, pairs ...string) *Graph {
+	g := edgesGraph(pairs...)
+	for _, id := range nodes {
+		g.Elements = append(g.Elements, Element{Group: "nodes", Data: ElementData{ID: id, Label: origin + " " + id}})
+	}
+	g.BaseURLs = map[string]string{}
+	for _, id := range nodes {
+		g.BaseURLs[id] = origin
+	}
+	return g
+}
+
+func TestGraph_Replace(t *testing.T) {
+	// prod and staging share app; app used to reference base, lib and a config (only
+	// used from app), and now references base, lib and a new secret. lib is also
+	// referenced by staging.
+	g := treeGraph("old", []string{"prod", "staging", "app", "base", "config", "lib"},
+		"prod>app", "staging>app", "staging>lib",
+		"app>base", "app>config", "app>lib",
+	)
+	sub := treeGraph("new", []string{"app", "base", "secret", "lib"},
+		"app>base", "app>secret", "app>lib",
+	)
+	before := g.Index()
+	unaffected := map[string]Element{}
+	for _, id := range []string{"prod", "staging"} {
+		unaffected[id] = *before.Node(id)
+	}
+
+	if err := g.Replace("app", sub); err != nil {
+		t.Fatalf("Replace: %v", err)
+	}
+
+	ix := g.Index()
+	if ix.Node("config") != nil {
+		t.Error("orphaned node config was not removed")
+	}
+	if _, ok := g.BaseURLs["config"]; ok {
+		t.Error("BaseURL of orphaned node config was not removed")
+	}
+	for id, want := range unaffected {
+		if got := ix.Node(id); got == nil || !reflect.DeepEqual(*got, want) {
+			t.Errorf("unaffected node %s = %+v, want %+v", id, got, want)
+		}
+	}
+	// Subtree nodes still referenced are refreshed from sub
+	for _, id := range []string{"app", "base", "secret", "lib"} {
+		if got := ix.Node(id); got == nil || got.Data.Label != "new "+id || g.BaseURLs[id] != "new" {
+			t.Errorf("node %s = %+v (base URL %q), want the one of the subgraph", id, got, g.BaseURLs[id])
+		}
+	}
+
+	var edges []string
+	for _, e := range g.Elements {
+		if e.Group == "edges" {
+			edges = append(edges, e.Data.Source+">"+e.Data.Target)
+		}
+	}
+	sort.Strings(edges)
+	want := []string{"app>base", "app>lib", "app>secret", "prod>app", "staging>app", "staging>lib"}
+	if !reflect.DeepEqual(edges, want) {
+		t.Errorf("edges = %v, want %v", edges, want)
+	}
+	if len(g.Elements) != len(want)+6 {
+		t.Errorf("got %d elements, want %d (no duplicates)", len(g.Elements), len(want)+6)
+	}
+}
+
+func TestGraph_Replace_OrphanedChain(t *testing.T) {
+	// Dropping a reference removes everything only reachable through it, cycles included
+	g := treeGraph("old", []string{"overlay", "base", "a", "b"}, "overlay>base", "base>a", "a>b", "b>a")
+	sub := treeGraph("new", []string{"base"})
+
+	if err := g.Replace("base", sub); err != nil {
+		t.Fatalf("Replace: %v", err)
+	}
+	var ids []string
+	for _, e := range g.Elements {
+		ids = append(ids, e.Data.ID)
+	}
+	want := []string{EdgeID("overlay", "resource", "base"), "overlay", "base"}
+	if !reflect.DeepEqual(ids, want) {
+		t.Errorf("elements = %v, want %v", ids, want)
+	}
+}
+
+func TestGraph_Replace_NodeNotFound(t *testing.T) {
+	g := treeGraph("old", []string{"overlay", "base"}, "overlay>base")
+	if err := g.Replace("missing", treeGraph("new", []string{"missing"})); !errors.Is(err, ErrNodeNotFound) {
+		t.Errorf("Replace of unknown node: err = %v, want ErrNodeNotFound", err)
+	}
+	if err := g.Replace("base", treeGraph("new", []string{"other"})); !errors.Is(err, ErrNodeNotFound) {
+		t.Errorf("Replace with a subgraph without the node: err = %v, want ErrNodeNotFound", err)
+	}
+	if len(g.Elements) != 3 {
+		t.Errorf("failed Replace modified the graph: %+v", g.Elements)
+	}
+}
+
+func TestGraph_Validate(t *testing.T) {
+	node := func(id string) Element {
+		return Element{Group: "nodes", Data: ElementData{ID: id, Label: id}}
+	}
+	edge := func(source, target string) Element {
+		return Element{Group: "edges", Data: ElementData{ID: EdgeID(source, "resource", target), Source: source, Target: target, EdgeType: "resource"}}
+	}
+
+	cases := []struct {
+		name     string
+		elements []Element
+		want     []error // sentinel of each error, in order
+	}{
+		{name: "valid", elements: []Element{node("overlay"), node("base"), edge("overlay", "base")}},
+		{name: "empty"},
+		{
+			name:     "dangling target",
+			elements: []Element{node("overlay"), edge("overlay", "base")},
+			want:     []error{ErrDanglingEdge},
+		},
+		{
+			name:     "dangling source and target",
+			elements: []Element{edge("overlay", "base")},
+			want:     []error{ErrDanglingEdge, ErrDanglingEdge},
+		},
+		{
+			name:     "duplicate node ID",
+			elements: []Element{node("overlay"), node("base"), node("base"), edge("overlay", "base")},
+			want:     []error{ErrDuplicateID},
+		},
+		{
+			name: "edge in the nodes group",
+			elements: []Element{node("overlay"), node("base"),
+				{Group: "nodes", Data: ElementData{ID: "e", Source: "overlay", Target: "base"}}},
+			want: []error{ErrInvalidGroup},
+		},
+		{
+			name:     "node in the edges group",
+			elements: []Element{node("overlay"), {Group: "edges", Data: ElementData{ID: "base", Label: "base"}}},
+			want:     []error{ErrInvalidGroup},
+		},
+		{
+			name:     "unknown group",
+			elements: []Element{node("overlay"), {Group: "node", Data: ElementData{ID: "base"}}},
+			want:     []error{ErrInvalidGroup},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			errs := (&Graph{Elements: c.elements}).Validate()
+			if len(errs) != len(c.want) {
+				t.Fatalf("Validate() = %v, want %d errors", errs, len(c.want))
+			}
+			for i, err := range errs {
+				if !errors.Is(err, c.want[i]) {
+					t.Errorf("Validate()[%d] = %v, want %v", i, err, c.want[i])
+				}
+			}
+		})
+	}
+
+	errs := (&Graph{Elements: []Element{node("overlay"), edge("overlay", "base")}}).Validate()
+	if len(errs) == 1 && !strings.Contains(errs[0].Error(), "missing node base") {
+		t.Errorf("Validate() = %v, want the missing node named", errs)
+	}
+}
+
+func TestGraph_ElementsJSON(t *testing.T) {
+	g := edgesGraph("overlay>base")
+	g.ID, g.Created = "graph-1", "2024-01-01T00:00:00Z"
+	data, err := g.ElementsJSON()
+	if err != nil {
+		t.Fatalf("ElementsJSON: %v", err)
+	}
+	var elements []Element
+	if err := json.Unmarshal(data, &elements); err != nil {
+		t.Fatalf("ElementsJSON = %s, want a JSON array: %v", data, err)
+	}
+	if !reflect.DeepEqual(elements, g.Elements) {
+		t.Errorf("decoded elements = %+v, want %+v", elements, g.Elements)
+	}
+
+	if data, err := (&Graph{ID: "empty"}).ElementsJSON(); err != nil || string(data) != "[]" {
+		t.Errorf("ElementsJSON(no elements) = %s, %v, want []", data, err)
+	}
+}
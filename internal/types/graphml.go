@@ -0,0 +1,132 @@
+package types
+
+import (
+	"encoding/xml"
+	"io"
+)
+
+// graphMLNamespace is the GraphML XML namespace expected by yEd and Gephi.
+const graphMLNamespace = "http://graphml.graphdrawing.org/xmlns"
+
+type graphMLDoc struct {
+	XMLName xml.Name     `xml:"graphml"`
+	XMLNS   string       `xml:"xmlns,attr"`
+	Keys    []graphMLKey `xml:"key"`
+	Graph   graphMLGraph `xml:"graph"`
+}
+
+type graphMLKey struct {
+	ID       string `xml:"id,attr"`
+	For      string `xml:"for,attr"`
+	AttrName string `xml:"attr.name,attr"`
+	AttrType string `xml:"attr.type,attr"`
+}
+
+type graphMLGraph struct {
+	ID          string        `xml:"id,attr"`
+	EdgeDefault string        `xml:"edgedefault,attr"`
+	Nodes       []graphMLNode `xml:"node"`
+	Edges       []graphMLEdge `xml:"edge"`
+}
+
+type graphMLNode struct {
+	ID   string        `xml:"id,attr"`
+	Data []graphMLData `xml:"data"`
+}
+
+type graphMLEdge struct {
+	ID     string        `xml:"id,attr"`
+	Source string        `xml:"source,attr"`
+	Target string        `xml:"target,attr"`
+	Data   []graphMLData `xml:"data"`
+}
+
+type graphMLData struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:",chardata"`
+}
+
+// graphMLKeys declares the label, type and path data keys for nodes and edges.
+var graphMLKeys = []graphMLKey{
+	{ID: "node_label", For: "node", AttrName: "label", AttrType: "string"},
+	{ID: "node_type", For: "node", AttrName: "type", AttrType: "string"},
+	{ID: "node_path", For: "node", AttrName: "path", AttrType: "string"},
+	{ID: "edge_label", For: "edge", AttrName: "label", AttrType: "string"},
+	{ID: "edge_type", For: "edge", AttrName: "type", AttrType: "string"},
+	{ID: "edge_path", For: "edge", AttrName: "path", AttrType: "string"},
+}
+
+// ToGraphML writes the graph as a directed GraphML document (for yEd, Gephi...) to w.
+// Nodes and edges carry label, type and path data keys; edges whose source or target
+// is not a node of the graph are skipped.
+func (g *Graph) ToGraphML(w io.Writer) error {
+	doc := graphMLDoc{
+		XMLNS: graphMLNamespace,
+		Keys:  graphMLKeys,
+		Graph: graphMLGraph{ID: "G", EdgeDefault: "directed"},
+	}
+	if g != nil {
+		doc.Graph.ID = graphMLGraphID(g)
+		nodes := make(map[string]bool)
+		for i := range g.Elements {
+			e := &g.Elements[i]
+			if e.Group != "nodes" || nodes[e.Data.ID] {
+				continue
+			}
+			nodes[e.Data.ID] = true
+			label := e.Data.Label
+			if label == "" {
+				label = e.Data.ID
+			}
+			doc.Graph.Nodes = append(doc.Graph.Nodes, graphMLNode{
+				ID:   e.Data.ID,
+				Data: graphMLDataOf("node", label, e.Data.Type, e.Data.Path),
+			})
+		}
+		for i := range g.Elements {
+			e := &g.Elements[i]
+			if e.Group != "edges" || !nodes[e.Data.Source] || !nodes[e.Data.Target] {
+				continue
+			}
+			doc.Graph.Edges = append(doc.Graph.Edges, graphMLEdge{
+				ID:     e.Data.ID,
+				Source: e.Data.Source,
+				Target: e.Data.Target,
+				Data:   graphMLDataOf("edge", e.Data.Label, e.Data.EdgeType, e.Data.Path),
+			})
+		}
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+func graphMLGraphID(g *Graph) string {
+	if g.ID != "" {
+		return g.ID
+	}
+	return "G"
+}
+
+// graphMLDataOf returns the non-empty label/type/path data of a node or edge.
+func graphMLDataOf(group, label, typ, path string) []graphMLData {
+	var data []graphMLData
+	for _, d := range []graphMLData{
+		{Key: group + "_label", Value: label},
+		{Key: group + "_type", Value: typ},
+		{Key: group + "_path", Value: path},
+	} {
+		if d.Value != "" {
+			data = append(data, d)
+		}
+	}
+	return data
+}
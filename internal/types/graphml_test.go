@@ -0,0 +1,89 @@
+package types
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strings"
+	"testing"
+)
+
+func TestToGraphML_Structure(t *testing.T) {
+	g := &Graph{
+		ID: "graph-1",
+		Elements: []Element{
+			{Group: "nodes", Data: ElementData{ID: "github:o/r/overlay@main", Label: "overlay", Type: "overlay", Path: "overlay"}},
+			{Group: "nodes", Data: ElementData{ID: "github:o/r/base@main", Label: "<base> & co", Type: "resource", Path: "base"}},
+			{Group: "edges", Data: ElementData{ID: "e1", Label: "github:o/r/overlay@main->github:o/r/base@main",
+				Source: "github:o/r/overlay@main", Target: "github:o/r/base@main", EdgeType: "resource"}},
+			{Group: "edges", Data: ElementData{ID: "dangling", Source: "github:o/r/overlay@main", Target: "unknown"}},
+		},
+	}
+	var buf bytes.Buffer
+	if err := g.ToGraphML(&buf); err != nil {
+		t.Fatalf("ToGraphML: %v", err)
+	}
+	if !strings.HasPrefix(buf.String(), "<?xml") {
+		t.Errorf("expected XML header, got %q", buf.String()[:20])
+	}
+
+	var doc graphMLDoc
+	if err := xml.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatalf("output is not well-formed XML: %v\n%s", err, buf.String())
+	}
+	if doc.XMLName.Space != graphMLNamespace {
+		t.Errorf("namespace = %q, want %q", doc.XMLName.Space, graphMLNamespace)
+	}
+	if len(doc.Keys) != 6 {
+		t.Errorf("keys = %d, want 6 (label/type/path for nodes and edges)", len(doc.Keys))
+	}
+	if doc.Graph.ID != "graph-1" || doc.Graph.EdgeDefault != "directed" {
+		t.Errorf("graph id/edgedefault = %q/%q, want graph-1/directed", doc.Graph.ID, doc.Graph.EdgeDefault)
+	}
+	if len(doc.Graph.Nodes) != 2 {
+		t.Fatalf("nodes = %d, want 2", len(doc.Graph.Nodes))
+	}
+	if len(doc.Graph.Edges) != 1 {
+		t.Fatalf("edges = %d, want 1 (dangling edge skipped)", len(doc.Graph.Edges))
+	}
+
+	base := doc.Graph.Nodes[1]
+	wantData := map[string]string{"node_label": "<base> & co", "node_type": "resource", "node_path": "base"}
+	for _, d := range base.Data {
+		if wantData[d.Key] != d.Value {
+			t.Errorf("node data %s = %q, want %q", d.Key, d.Value, wantData[d.Key])
+		}
+		delete(wantData, d.Key)
+	}
+	if len(wantData) > 0 {
+		t.Errorf("missing node data: %v", wantData)
+	}
+
+	edge := doc.Graph.Edges[0]
+	if edge.Source != "github:o/r/overlay@main" || edge.Target != "github:o/r/base@main" {
+		t.Errorf("edge = %s -> %s, want overlay -> base", edge.Source, edge.Target)
+	}
+	keys := make(map[string]bool)
+	for _, k := range doc.Keys {
+		keys[k.ID] = true
+	}
+	for _, d := range append(base.Data, edge.Data...) {
+		if !keys[d.Key] {
+			t.Errorf("data key %q is not declared", d.Key)
+		}
+	}
+}
+
+func TestToGraphML_NilGraph(t *testing.T) {
+	var buf bytes.Buffer
+	var nilGraph *Graph
+	if err := nilGraph.ToGraphML(&buf); err != nil {
+		t.Fatalf("ToGraphML() of nil graph: %v", err)
+	}
+	var doc graphMLDoc
+	if err := xml.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatalf("output is not well-formed XML: %v", err)
+	}
+	if len(doc.Graph.Nodes) != 0 || len(doc.Graph.Edges) != 0 {
+		t.Errorf("expected an empty graph, got %+v", doc.Graph)
+	}
+}
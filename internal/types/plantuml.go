@@ -0,0 +1,112 @@
+package types
+
+import (
+	"fmt"
+	"strings"
+)
+
+// plantUMLPackages maps node types to the PlantUML package grouping them, in output order.
+var plantUMLPackages = []struct {
+	name  string
+	types []string
+}{
+	{"overlays", []string{"overlay"}},
+	{"bases", []string{"base", "resource"}},
+	{"components", []string{"component"}},
+	{"patches", []string{"patch"}},
+}
+
+// ToPlantUML converts the graph to a PlantUML component diagram:
+// one component per node, grouped in packages by node type (overlays, bases,
+// components, patches, then any other type under its own name), and one arrow per
+// edge labelled with its edge type. Labels are quoted so slashes and colons are safe.
+func (g *Graph) ToPlantUML() string {
+	var b strings.Builder
+	b.WriteString("@startuml\n")
+	if g == nil {
+		b.WriteString("@enduml\n")
+		return b.String()
+	}
+
+	packageOf := make(map[string]string)
+	for _, p := range plantUMLPackages {
+		for _, t := range p.types {
+			packageOf[t] = p.name
+		}
+	}
+	var packageOrder []string
+	for _, p := range plantUMLPackages {
+		packageOrder = append(packageOrder, p.name)
+	}
+
+	nodeIDToAlias := make(map[string]string)
+	byPackage := make(map[string][]string)
+	for i := range g.Elements {
+		e := &g.Elements[i]
+		if e.Group != "nodes" {
+			continue
+		}
+		if _, ok := nodeIDToAlias[e.Data.ID]; ok {
+			continue
+		}
+		alias := fmt.Sprintf("n%d", len(nodeIDToAlias))
+		nodeIDToAlias[e.Data.ID] = alias
+
+		label := e.Data.Label
+		if label == "" {
+			label = e.Data.ID
+		}
+		pkg, ok := packageOf[e.Data.Type]
+		if !ok {
+			pkg = e.Data.Type
+			if pkg == "" {
+				pkg = "other"
+			}
+			packageOf[e.Data.Type] = pkg
+			packageOrder = append(packageOrder, pkg)
+		}
+		byPackage[pkg] = append(byPackage[pkg],
+			fmt.Sprintf("  component \"%s\" as %s\n", escapePlantUMLLabel(label), alias))
+	}
+
+	for _, pkg := range packageOrder {
+		components := byPackage[pkg]
+		if len(components) == 0 {
+			continue
+		}
+		b.WriteString(fmt.Sprintf("package \"%s\" {\n", escapePlantUMLLabel(pkg)))
+		for _, c := range components {
+			b.WriteString(c)
+		}
+		b.WriteString("}\n")
+	}
+
+	for i := range g.Elements {
+		e := &g.Elements[i]
+		if e.Group != "edges" {
+			continue
+		}
+		src := nodeIDToAlias[e.Data.Source]
+		tgt := nodeIDToAlias[e.Data.Target]
+		if src == "" || tgt == "" {
+			continue
+		}
+		if e.Data.EdgeType != "" {
+			b.WriteString(fmt.Sprintf("%s --> %s : %s\n", src, tgt, escapePlantUMLLabel(e.Data.EdgeType)))
+		} else {
+			b.WriteString(fmt.Sprintf("%s --> %s\n", src, tgt))
+		}
+	}
+
+	b.WriteString("@enduml\n")
+	return b.String()
+}
+
+// escapePlantUMLLabel makes s safe inside a "..." PlantUML string, which has no escape
+// for double quotes: they are replaced with single quotes, and newlines with spaces.
+func escapePlantUMLLabel(s string) string {
+	return strings.NewReplacer(
+		`"`, `'`,
+		"\n", " ",
+	).Replace(s)
+}
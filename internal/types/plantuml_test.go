@@ -0,0 +1,49 @@
+package types
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestToPlantUML_NilGraph(t *testing.T) {
+	var nilGraph *Graph
+	if got := nilGraph.ToPlantUML(); got != "@startuml\n@enduml\n" {
+		t.Errorf("ToPlantUML() of nil graph = %q", got)
+	}
+}
+
+func TestToPlantUML_ComponentsAndArrows(t *testing.T) {
+	g := &Graph{
+		Elements: []Element{
+			{Group: "nodes", Data: ElementData{ID: "github:o/r/overlay@main", Label: "github:o/r/overlay", Type: "overlay"}},
+			{Group: "nodes", Data: ElementData{ID: "github:o/r/base@main", Label: "base", Type: "resource"}},
+			{Group: "nodes", Data: ElementData{ID: "github:o/r/comp@main", Label: `say "hi"`, Type: "component"}},
+			{Group: "nodes", Data: ElementData{ID: "error:x", Label: "x", Type: "error"}},
+			{Group: "edges", Data: ElementData{ID: "e1", Source: "github:o/r/overlay@main", Target: "github:o/r/base@main", EdgeType: "resource"}},
+			{Group: "edges", Data: ElementData{ID: "e2", Source: "github:o/r/overlay@main", Target: "github:o/r/comp@main", EdgeType: "component"}},
+		},
+	}
+	got := g.ToPlantUML()
+
+	if !strings.HasPrefix(got, "@startuml\n") || !strings.HasSuffix(got, "@enduml\n") {
+		t.Errorf("expected @startuml/@enduml markers:\n%s", got)
+	}
+	if n := strings.Count(got, "  component \""); n != 4 {
+		t.Errorf("components = %d, want one per node (4):\n%s", n, got)
+	}
+	for _, want := range []string{
+		"package \"overlays\" {\n  component \"github:o/r/overlay\" as n0\n}",
+		"package \"bases\" {\n  component \"base\" as n1\n}",
+		"component \"say 'hi'\" as n2",
+		"package \"error\" {",
+		"n0 --> n1 : resource",
+		"n0 --> n2 : component",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected %q in output:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "package \"patches\"") {
+		t.Errorf("empty packages should be omitted:\n%s", got)
+	}
+}
@@ -1,5 +1,10 @@
 package types
 
+import (
+	"crypto/sha256"
+	"encoding/hex"
+)
+
 // Graph represents the complete graph
 type Graph struct {
 	ID       string            `json:"id"`
@@ -19,11 +24,37 @@ type ElementData struct {
 	// Common
 	ID string `json:"id"`
 
-	// For nodes
+	// For nodes; edges carry a description of the relationship ("resource",
+	// "patch target: Deployment/web")
 	Label   string                 `json:"label,omitempty"`
 	Type    string                 `json:"type,omitempty"` // "resource", "overlay", "component"
 	Path    string                 `json:"path,omitempty"`
 	Content map[string]interface{} `json:"content,omitempty"` // kustomization.yaml content
+	Level   *int                   `json:"level,omitempty"`   // layout level, see Graph.ComputeLevels
+	// RawContent is the kustomization file as fetched; it's served with the node
+	// details rather than in every graph payload
+	RawContent string `json:"-"`
+	// Patches lists the patches of a kustomization node; served with the node details
+	Patches []PatchInfo `json:"-"`
+	// Truncated marks a node whose references weren't followed (builder depth limit)
+	Truncated bool `json:"truncated,omitempty"`
+	// Excluded marks a reference matching a builder exclude pattern, left unfollowed
+	Excluded bool `json:"excluded,omitempty"`
+	// Remote marks a remote reference left unfollowed by a local-only build
+	Remote bool `json:"remote,omitempty"`
+	// Error describes why an "error" or "missing" node's reference couldn't be resolved
+	Error string `json:"error,omitempty"`
+	// Warnings lists problems kustomize would reject that didn't stop the parser,
+	// e.g. the same target referenced twice
+	Warnings []string `json:"warnings,omitempty"`
+
+	// Source repository of a node, from the resolved repository info
+	Host  string `json:"host,omitempty"` // e.g. "github.com"; empty for local repositories
+	Owner string `json:"owner,omitempty"`
+	Repo  string `json:"repo,omitempty"`
+	Ref   string `json:"ref,omitempty"`
+	// Color is the node's color by source repository, see RepoColor
+	Color string `json:"color,omitempty"`
 
 	// For edges
 	Source   string `json:"source,omitempty"`
@@ -31,6 +62,32 @@ type ElementData struct {
 	EdgeType string `json:"edgeType,omitempty"` // "base", "resource", "patch"
 }
 
+// EdgeID returns a stable, content-addressed edge ID derived from source, edge type
+// (the "via" relation) and target, so differently-typed edges between the same pair
+// of nodes don't collide. The readable "source->target" form is EdgeLabel.
+func EdgeID(source, edgeType, target string) string {
+	sum := sha256.Sum256([]byte(source + "\x00" + edgeType + "\x00" + target))
+	return "edge-" + hex.EncodeToString(sum[:8])
+}
+
+// repoPalette is the fixed set of colors RepoColor picks from.
+var repoPalette = []string{
+	"#1f77b4", "#ff7f0e", "#2ca02c", "#d62728", "#9467bd", "#8c564b",
+	"#e377c2", "#7f7f7f", "#bcbd22", "#17becf", "#393b79", "#637939",
+}
+
+// RepoColor returns the color of the nodes of the owner/repo repository, picked from
+// a fixed palette by a hash of "owner/repo" so it is the same across builds.
+func RepoColor(owner, repo string) string {
+	sum := sha256.Sum256([]byte(owner + "/" + repo))
+	return repoPalette[int(sum[0])%len(repoPalette)]
+}
+
+// EdgeLabel returns the human-readable form of an edge: "source->target".
+func EdgeLabel(source, target string) string {
+	return source + "->" + target
+}
+
 // NodeDetails for details endpoint
 type NodeDetails struct {
 	ID      string                 `json:"id"`
@@ -38,8 +95,32 @@ type NodeDetails struct {
 	Type    string                 `json:"type"`
 	Path    string                 `json:"path"`
 	Content map[string]interface{} `json:"content"`
+	// RawContent is the verbatim kustomization file, comments and key order included
+	RawContent string `json:"rawContent,omitempty"`
+	// Patches are the patches and JSON6902 patches of a kustomization node
+	Patches []PatchInfo `json:"patches,omitempty"`
 
 	// Relations
 	Parents  []string `json:"parents"`  // Nodes pointing to current node
 	Children []string `json:"children"` // Nodes pointed by current node
 }
+
+// PatchInfo describes a patch of a kustomization: the objects it targets and whether
+// it is written inline or read from the file at Path.
+type PatchInfo struct {
+	Field  string       `json:"field"` // kustomization field listing it: "patches" or "patchesJson6902"
+	Target *PatchTarget `json:"target,omitempty"`
+	Path   string       `json:"path,omitempty"` // from the repository root; empty for inline patches
+	Inline bool         `json:"inline"`
+}
+
+// PatchTarget selects the objects a patch applies to.
+type PatchTarget struct {
+	Group              string `json:"group,omitempty"`
+	Version            string `json:"version,omitempty"`
+	Kind               string `json:"kind,omitempty"`
+	Name               string `json:"name,omitempty"`
+	Namespace          string `json:"namespace,omitempty"`
+	LabelSelector      string `json:"labelSelector,omitempty"`
+	AnnotationSelector string `json:"annotationSelector,omitempty"`
+}
@@ -2,6 +2,7 @@ package types
 
 import (
 	"encoding/json"
+	"strings"
 	"testing"
 )
 
@@ -196,4 +197,94 @@ func TestNodeDetails_JSONShape(t *testing.T) {
 			t.Errorf("NodeDetails JSON missing key %q (details endpoint contract)", key)
 		}
 	}
+	// rawContent is optional: only sent when the file was fetched
+	if _, ok := raw["rawContent"]; ok {
+		t.Errorf("NodeDetails JSON has rawContent without RawContent: %s", data)
+	}
+}
+
+func TestNodeDetails_RawContentRoundTrip(t *testing.T) {
+	rawYAML := "# production overlay\nresources:\n  - ../base # shared\nnamePrefix: prod-\n"
+	orig := &NodeDetails{ID: "id", Type: "overlay", RawContent: rawYAML, Parents: []string{}, Children: []string{}}
+
+	data, err := json.Marshal(orig)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	if !strings.Contains(string(data), `"rawContent":`) {
+		t.Errorf("NodeDetails JSON = %s, want a rawContent key", data)
+	}
+	var got NodeDetails
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if got.RawContent != rawYAML {
+		t.Errorf("RawContent = %q, want %q", got.RawContent, rawYAML)
+	}
+}
+
+func TestEdgeID(t *testing.T) {
+	resource := EdgeID("overlay", "resource", "base")
+	component := EdgeID("overlay", "component", "base")
+	if resource == component {
+		t.Errorf("differently-typed edges share ID %q", resource)
+	}
+	if again := EdgeID("overlay", "resource", "base"); again != resource {
+		t.Errorf("EdgeID not stable: %q then %q", resource, again)
+	}
+	if reversed := EdgeID("base", "resource", "overlay"); reversed == resource {
+		t.Errorf("reversed edge shares ID %q", resource)
+	}
+	// Field boundaries are part of the hash: "a"+"bc" differs from "ab"+"c"
+	if EdgeID("a", "bc", "d") == EdgeID("ab", "c", "d") {
+		t.Error("EdgeID must not collide across field boundaries")
+	}
+	if got := EdgeLabel("overlay", "base"); got != "overlay->base" {
+		t.Errorf("EdgeLabel = %q, want overlay->base", got)
+	}
+}
+
+func TestElementData_LevelJSON(t *testing.T) {
+	level := 0
+	data, err := json.Marshal(ElementData{ID: "root", Level: &level})
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	if !strings.Contains(string(data), `"level":0`) {
+		t.Errorf("JSON = %s, want level 0 serialized", data)
+	}
+
+	data, err = json.Marshal(ElementData{ID: "edge"})
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	if strings.Contains(string(data), `"level"`) {
+		t.Errorf("JSON = %s, want no level when unset", data)
+	}
+}
+
+func TestElementData_RepoKeysOnlyWhenSet(t *testing.T) {
+	repoKeys := []string{"host", "owner", "repo", "ref"}
+
+	withRepo := ElementData{ID: "node-1", Host: "github.com", Owner: "o", Repo: "r", Ref: "main"}
+	without := ElementData{ID: "a->b", Source: "a", Target: "b", EdgeType: "resource"}
+
+	for name, c := range map[string]struct {
+		data ElementData
+		want bool
+	}{"node with repo": {withRepo, true}, "edge": {without, false}} {
+		data, err := json.Marshal(c.data)
+		if err != nil {
+			t.Fatalf("Marshal %s: %v", name, err)
+		}
+		var raw map[string]interface{}
+		if err := json.Unmarshal(data, &raw); err != nil {
+			t.Fatalf("Unmarshal %s: %v", name, err)
+		}
+		for _, key := range repoKeys {
+			if _, ok := raw[key]; ok != c.want {
+				t.Errorf("%s: key %q present = %v, want %v", name, key, ok, c.want)
+			}
+		}
+	}
 }
@@ -7,10 +7,12 @@ import (
 	"fmt"
 	"io/fs"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"strconv"
 
+	"github.com/cjeanner/kustomap/internal/repository"
 	"github.com/cjeanner/kustomap/internal/server"
 	"github.com/cjeanner/kustomap/internal/storage"
 )
@@ -26,6 +28,8 @@ var webFS embed.FS
 
 func main() {
 	portFlag := flag.String("port", "", "HTTP listener port (default 3000, or set PORT env)")
+	allowLocal := flag.Bool("allow-local", false, "allow analyzing local checkouts and archives (file:// URLs and absolute paths)")
+	flag.Func("gitlab-instance", "self-hosted GitLab base URL, possibly under a subpath (e.g. https://corp.example/gitlab); repeatable", repository.RegisterGitLabInstance)
 	flag.Parse()
 
 	portStr := *portFlag
@@ -42,6 +46,8 @@ func main() {
 
 	store := storage.NewMemoryStorage()
 	webRoot, _ := fs.Sub(webFS, "web")
+	server.SetAllowLocal(*allowLocal)
+	repository.SetLogger(slog.Default())
 	r := server.New(store, webRoot)
 
 	addr := ":" + strconv.Itoa(port)
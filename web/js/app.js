@@ -158,6 +158,15 @@ function renderGraph(container, graphData, onNodeClick) {
                     'color': 'white'
                 }
             },
+            {
+                selector: 'node[type="missing"]',
+                style: {
+                    'background-color': '#f39c12',
+                    'border-color': '#d35400',
+                    'border-style': 'dashed',
+                    'border-width': 3
+                }
+            },
             {
                 selector: 'edge',
                 style: {
@@ -166,7 +175,13 @@ function renderGraph(container, graphData, onNodeClick) {
                     'target-arrow-color': '#95a5a6',
                     'target-arrow-shape': 'triangle',
                     'curve-style': 'bezier',
-                    'arrow-scale': 1.2
+                    'arrow-scale': 1.2,
+                    'label': 'data(label)',
+                    'font-size': '10px',
+                    'color': '#7f8c8d',
+                    'text-rotation': 'autorotate',
+                    'text-background-color': '#ffffff',
+                    'text-background-opacity': 0.8
                 }
             },
             {
@@ -549,7 +564,7 @@ class App {
 
             // Build overlay button: only for directories (overlay/resource dirs), not single .yaml/.yml files or components
             const pathIsFile = (p) => p && (p.toLowerCase().endsWith('.yaml') || p.toLowerCase().endsWith('.yml'));
-            const canBuild = nodeDetails.type !== 'component' && nodeDetails.type !== 'error' && !pathIsFile(nodeDetails.path);
+            const canBuild = nodeDetails.type !== 'component' && nodeDetails.type !== 'error' && nodeDetails.type !== 'missing' && !pathIsFile(nodeDetails.path);
             const buildButtonHtml = canBuild
                 ? `<p class="node-info-actions"><button type="button" class="build-overlay-btn" data-node-id="${nodeDetails.id}" data-node-label="${nodeDetails.label || nodeDetails.id}">Build overlay</button></p>`
                 : '';
@@ -589,6 +604,20 @@ class App {
                 html += '</div>';
             }
 
+            // Patches - inline or read from a file
+            if (nodeDetails.patches && nodeDetails.patches.length > 0) {
+                html += '<div class="relations-section">';
+                html += '<h3>🩹 Patches</h3>';
+                html += '<ul class="node-list">';
+                nodeDetails.patches.forEach(patch => {
+                    const target = patch.target ? [patch.target.kind, patch.target.name].filter(Boolean).join('/') : '';
+                    const source = patch.inline ? 'inline' : `<code>${patch.path}</code>`;
+                    html += `<li>${source} (${patch.field})${target ? ` → ${target}` : ''}</li>`;
+                });
+                html += '</ul>';
+                html += '</div>';
+            }
+
             // Content
             if (nodeDetails.content && Object.keys(nodeDetails.content).length > 0) {
                 html += '<div class="content-section">';